@@ -6,7 +6,10 @@ import (
 	"ktrlplane/internal/auth" // Import auth package
 	"ktrlplane/internal/config"
 	"ktrlplane/internal/db"
+	"ktrlplane/internal/mail"
+	"ktrlplane/internal/ratelimit"
 	"ktrlplane/internal/service"
+	"ktrlplane/internal/telemetry"
 	"log"
 	"net/http"
 	"net/url"
@@ -25,6 +28,31 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// --- Tracing & Metrics Setup ---
+	shutdownTracing, err := telemetry.Setup(context.Background(), cfg.Observability.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("Failed to flush traces: %v", err)
+		}
+	}()
+
+	shutdownMetrics, err := telemetry.SetupMetrics(context.Background(), cfg.Observability.Metrics, cfg.Observability.Tracing.ServiceName)
+	if err != nil {
+		log.Fatalf("Failed to set up metrics: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownMetrics(ctx); err != nil {
+			log.Printf("Failed to flush metrics: %v", err)
+		}
+	}()
+
 	// --- Database Initialization ---
 	if err := db.InitDB(cfg.Database); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
@@ -32,14 +60,15 @@ func main() {
 	defer db.CloseDB()
 
 	// --- Authentication Setup ---
-	// Pass Auth0 config to the auth package
-	if err := auth.SetupAuth(cfg.Auth.Audience, cfg.Auth.Issuer); err != nil {
+	// Pass the trusted OIDC issuers to the auth package
+	if err := auth.SetupAuth(cfg.Auth); err != nil {
 		log.Fatalf("Failed to set up authentication: %v", err)
 	}
 
 	// --- Stripe Setup ---
 	if cfg.Stripe.SecretKey != "" {
 		stripe.Key = cfg.Stripe.SecretKey
+		telemetry.InstrumentStripe()
 		log.Println("Stripe initialized successfully")
 	} else {
 		log.Println("Warning: Stripe secret key not configured. Billing features will not work.")
@@ -51,6 +80,23 @@ func main() {
 	organizationService := service.NewOrganizationService()
 	rbacService := service.NewRBACService()
 	billingService := service.NewBillingService(&cfg)
+
+	mailer, err := mail.NewFromConfig(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Failed to set up mail delivery: %v", err)
+	}
+	invitationService := service.NewInvitationService(&cfg, mailer)
+	if !invitationService.Enabled() {
+		log.Println("Warning: invitations.signing_key not configured. Invitations cannot be sent or accepted.")
+	}
+	serviceAccountService := service.NewServiceAccountService(&cfg)
+	personalAccessTokenService := service.NewPersonalAccessTokenService()
+	teamService := service.NewTeamService(&cfg)
+	paymentEnforcementService := service.NewPaymentEnforcementService(&cfg, mailer)
+	meteringService, err := service.NewMeteringService(&cfg, billingService)
+	if err != nil {
+		log.Fatalf("Failed to set up usage metering: %v", err)
+	}
 	
 	// --- Secret Service Initialization ---
 	secretService, err := service.NewSecretService()
@@ -87,11 +133,39 @@ func main() {
 		log.Println("Observability backends disabled. Logs and metrics endpoints will return service unavailable.")
 	}
 
+	// --- Background Jobs ---
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	rbacService.StartAssignmentSweeper(jobsCtx, service.DefaultAssignmentSweepInterval)
+	if cfg.Metering.Enabled {
+		meteringService.StartMetering(jobsCtx, service.MeteringInterval(cfg.Metering))
+		log.Printf("Usage metering enabled with %d meters", len(cfg.Metering.Meters))
+	}
+	if cfg.PaymentEnforcement.Enabled {
+		paymentEnforcementService.StartPaymentEnforcement(jobsCtx, service.PaymentEnforcementInterval(cfg.PaymentEnforcement))
+		log.Printf("Payment enforcement enabled with a grace period of %s", service.PaymentGracePeriod(cfg.PaymentEnforcement))
+	}
+
 	// --- API Handler Initialization ---
 	apiHandler := api.NewHandler(projectService, resourceService, organizationService, rbacService, billingService, secretService, proxyService)
+	apiHandler.InvitationService = invitationService
+	apiHandler.ServiceAccountService = serviceAccountService
+	apiHandler.PersonalAccessTokenService = personalAccessTokenService
+	apiHandler.TeamService = teamService
+	apiHandler.MeteringService = meteringService
+
+	// --- Rate Limiting ---
+	rateLimiter, err := ratelimit.NewFromConfig(jobsCtx, cfg.RateLimit)
+	if err != nil {
+		log.Fatalf("Failed to set up rate limiting: %v", err)
+	}
+	apiHandler.RateLimiter = rateLimiter
 
 	// --- Router Setup ---
-	router := api.SetupRouter(apiHandler)
+	router, err := api.SetupRouter(apiHandler, cfg.Server)
+	if err != nil {
+		log.Fatalf("Failed to set up router: %v", err)
+	}
 
 	// --- Server Initialization ---
 	if cfg.Server.Port == "" {
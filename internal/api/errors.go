@@ -0,0 +1,94 @@
+package api
+
+import (
+	"errors"
+	"ktrlplane/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// problemContentType is the media type for RFC 7807 error responses.
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details body.
+// Error duplicates Detail for clients that read the legacy "error" field.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Error    string `json:"error"`
+}
+
+// problemKind describes how a service error kind is rendered.
+type problemKind struct {
+	kind   error
+	status int
+	slug   string
+}
+
+// problemKinds maps service error kinds to HTTP statuses, most specific first.
+var problemKinds = []problemKind{
+	{service.ErrValidation, http.StatusBadRequest, "validation-error"},
+	{service.ErrUnauthorized, http.StatusUnauthorized, "unauthorized"},
+	{service.ErrPaymentRequired, http.StatusPaymentRequired, "payment-required"},
+	{service.ErrForbidden, http.StatusForbidden, "forbidden"},
+	{service.ErrNotFound, http.StatusNotFound, "not-found"},
+	{service.ErrConflict, http.StatusConflict, "conflict"},
+	{service.ErrUpstream, http.StatusBadGateway, "upstream-error"},
+}
+
+// internalErrorDetail is returned for errors without a domain kind so that
+// SQL and other internal messages are never exposed to clients.
+const internalErrorDetail = "An unexpected error occurred. Please try again later."
+
+// NewProblem builds the problem details for err.
+func NewProblem(err error, instance string) Problem {
+	for _, pk := range problemKinds {
+		if !errors.Is(err, pk.kind) {
+			continue
+		}
+		detail := pk.kind.Error()
+		var domainErr *service.Error
+		if errors.As(err, &domainErr) {
+			detail = domainErr.PublicMessage()
+		}
+		return Problem{
+			Type:     "urn:ktrlplane:problem:" + pk.slug,
+			Title:    http.StatusText(pk.status),
+			Status:   pk.status,
+			Detail:   detail,
+			Instance: instance,
+			Error:    detail,
+		}
+	}
+	return Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(http.StatusInternalServerError),
+		Status:   http.StatusInternalServerError,
+		Detail:   internalErrorDetail,
+		Instance: instance,
+		Error:    internalErrorDetail,
+	}
+}
+
+// writeProblem writes err as an application/problem+json response and aborts the chain.
+func writeProblem(c *gin.Context, err error) {
+	problem := NewProblem(err, c.Request.URL.Path)
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
+
+// ErrorHandlerMiddleware renders the last error attached with c.Error as
+// problem+json, unless the handler already wrote a response.
+func ErrorHandlerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		writeProblem(c, c.Errors.Last().Err)
+	}
+}
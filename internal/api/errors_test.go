@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ktrlplane/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func serveWithError(err error) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ErrorHandlerMiddleware())
+	r.GET("/things/:id", func(c *gin.Context) {
+		_ = c.Error(err)
+	})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/things/t1", nil)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestErrorHandlerMiddleware_MapsKinds(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{service.NotFound("project not found: p1"), http.StatusNotFound},
+		{service.Forbidden("insufficient permissions to update project"), http.StatusForbidden},
+		{service.Conflict("project p1 already exists"), http.StatusConflict},
+		{service.Validation("invalid project ID"), http.StatusBadRequest},
+		{service.PaymentRequired("billing account required"), http.StatusPaymentRequired},
+		{service.Unauthorized("Bearer token required"), http.StatusUnauthorized},
+		{service.Upstream(errors.New("stripe: 500"), "failed to create Stripe customer"), http.StatusBadGateway},
+		{fmt.Errorf("outer: %w", service.NotFound("resource not found: r1")), http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		w := serveWithError(tt.err)
+		assert.Equal(t, tt.status, w.Code, tt.err.Error())
+		assert.Equal(t, problemContentType, w.Header().Get("Content-Type"))
+
+		var problem Problem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		assert.Equal(t, tt.status, problem.Status)
+		assert.Equal(t, "/things/t1", problem.Instance)
+		assert.Equal(t, problem.Detail, problem.Error)
+	}
+}
+
+func TestErrorHandlerMiddleware_HidesInternalDetails(t *testing.T) {
+	w := serveWithError(service.Upstream(errors.New("card_declined: secret detail"), "failed to create Stripe subscription"))
+	assert.NotContains(t, w.Body.String(), "secret detail")
+	assert.Contains(t, w.Body.String(), "failed to create Stripe subscription")
+
+	w = serveWithError(fmt.Errorf("failed to query projects: %w", errors.New("relation \"ktrlplane.projects\" does not exist")))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "relation")
+
+	var problem Problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, internalErrorDetail, problem.Detail)
+}
+
+func TestErrorHandlerMiddleware_KeepsWrittenResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ErrorHandlerMiddleware())
+	r.GET("/", func(c *gin.Context) {
+		_ = c.Error(service.NotFound("missing"))
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestCustomRecoveryMiddleWare_ReturnsProblem(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CustomRecoveryMiddleWare())
+	r.GET("/", func(c *gin.Context) {
+		panic("nil map write in secret code path")
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret code path")
+}
@@ -1,24 +1,54 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"ktrlplane/internal/auth"
 	"ktrlplane/internal/models"
+	"ktrlplane/internal/ratelimit"
 	"ktrlplane/internal/service"
+	"ktrlplane/internal/utils"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 // Handler handles all API requests for the control plane.
+//
+// Handlers report failures with c.Error and return; ErrorHandlerMiddleware
+// turns the attached error into a problem+json response based on its kind.
 type Handler struct {
-	ProjectService      *service.ProjectService
-	ResourceService     *service.ResourceService
-	OrganizationService *service.OrganizationService
-	RBACService         *service.RBACService
-	BillingService      *service.BillingService
-	SecretService       *service.SecretService
-	ProxyService        *ProxyService // For logs and metrics proxying
+	ProjectService             *service.ProjectService
+	ResourceService            *service.ResourceService
+	OrganizationService        *service.OrganizationService
+	RBACService                *service.RBACService
+	BillingService             *service.BillingService
+	SecretService              *service.SecretService
+	ProxyService               *ProxyService      // For logs and metrics proxying
+	RateLimiter                *ratelimit.Limiter // Optional; nil disables rate limiting
+	InvitationService          *service.InvitationService
+	ServiceAccountService      *service.ServiceAccountService
+	PersonalAccessTokenService *service.PersonalAccessTokenService
+	TeamService                *service.TeamService
+	MeteringService            *service.MeteringService
+
+	// permissions and billingScopes default to RBACService and BillingService; tests replace them.
+	permissions   permissionChecker
+	billingScopes billingScopeResolver
+}
+
+// permissionChecker decides whether a user may perform an action on a scope.
+type permissionChecker interface {
+	CheckPermission(ctx context.Context, userID, action, scopeType, scopeID string) (bool, error)
+}
+
+// billingScopeResolver finds the scope whose billing account pays for a scope.
+type billingScopeResolver interface {
+	ResolveBillingScope(ctx context.Context, scopeType, scopeID string) (string, string, error)
 }
 
 // NewHandler creates a new Handler with the provided services.
@@ -38,62 +68,83 @@ func NewHandler(ps *service.ProjectService, rs *service.ResourceService, os *ser
 func (h *Handler) getUserFromContext(c *gin.Context) (*models.User, error) {
 	userValue, exists := c.Get("user")
 	if !exists {
-		err := fmt.Errorf("user not found in context")
-		if err2 := c.Error(err); err2 != nil {
-			return nil, fmt.Errorf("error handling context error: %w", err2)
-		}
-		return nil, err
+		return nil, service.Unauthorized("user not found in context")
 	}
 	user, ok := userValue.(models.User)
 	if !ok {
-		err := fmt.Errorf("invalid user type in context")
-		if err2 := c.Error(err); err2 != nil {
-			return nil, fmt.Errorf("error handling context error: %w", err2)
-		}
-		return nil, err
+		return nil, fmt.Errorf("invalid user type in context")
 	}
 	return &user, nil
 }
 
-// --- Organization Handlers ---
-// GetBillingStatus returns billing status for organization or project (for onboarding/payment enforcement)
-func (h *Handler) GetBillingStatus(c *gin.Context) {
-	// Determine scope type and ID from URL
-	var scopeType, scopeID string
+// scopeFromParams determines the billing scope (organization or project) from the URL.
+func scopeFromParams(c *gin.Context) (scopeType, scopeID string, err error) {
 	if orgID := c.Param("orgId"); orgID != "" {
-		scopeType = "organization"
-		scopeID = orgID
-	} else if projectID := c.Param("projectId"); projectID != "" {
-		scopeType = "project"
-		scopeID = projectID
-	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope"})
-		return
+		return "organization", orgID, nil
 	}
+	if projectID := c.Param("projectId"); projectID != "" {
+		return "project", projectID, nil
+	}
+	return "", "", service.Validation("invalid scope")
+}
 
-	user, err := h.getUserFromContext(c)
+// rbacScopeFromParams determines the RBAC scope (organization, project or resource) from the URL.
+func rbacScopeFromParams(c *gin.Context) (scopeType, scopeID string, err error) {
+	if resourceID := c.Param("resourceId"); resourceID != "" {
+		return "resource", resourceID, nil
+	}
+	if projectID := c.Param("projectId"); projectID != "" {
+		return "project", projectID, nil
+	}
+	if orgID := c.Param("orgId"); orgID != "" {
+		return "organization", orgID, nil
+	}
+	return "", "", service.Validation("invalid scope")
+}
+
+// requirePermission returns a Forbidden error with message when the user lacks action on the scope.
+func (h *Handler) requirePermission(c *gin.Context, userID, action, scopeType, scopeID, message string) error {
+	var permissions permissionChecker = h.RBACService
+	if h.permissions != nil {
+		permissions = h.permissions
+	}
+	hasPermission, err := permissions.CheckPermission(c, userID, action, scopeType, scopeID)
 	if err != nil {
-		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
-		return
+		return fmt.Errorf("failed to check permissions: %w", err)
 	}
+	if !hasPermission {
+		return service.Forbidden("%s", message)
+	}
+	return nil
+}
+
+// bindJSON binds the request body, reporting binding failures as validation errors.
+func bindJSON(c *gin.Context, obj any) error {
+	if err := c.ShouldBindJSON(obj); err != nil {
+		return service.Wrap(service.ErrValidation, err, "%s", err.Error())
+	}
+	return nil
+}
 
-	// Check read permission (billing info is readable by anyone with read access to the scope)
-	hasPermission, err := h.RBACService.CheckPermission(c, user.ID, "read", scopeType, scopeID)
+// --- Organization Handlers ---
+// GetBillingStatus returns billing status for organization or project (for onboarding/payment enforcement)
+func (h *Handler) GetBillingStatus(c *gin.Context) {
+	// Billing status is readable by anyone with read access to the scope and its payer
+	scopeType, scopeID, err := h.billingScope(c, "read", "Insufficient permissions to view billing")
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions", "details": err.Error()})
 		return
 	}
-	if !hasPermission {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to view billing"})
+
+	billingInfo, err := h.BillingService.GetBillingInfo(c.Request.Context(), scopeType, scopeID)
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	billingInfo, err := h.BillingService.GetBillingInfo(scopeType, scopeID)
+	enforcement, err := h.BillingService.GetPaymentEnforcement(c.Request.Context(), scopeType, scopeID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get billing info", "details": err.Error()})
 		return
 	}
 
@@ -103,48 +154,23 @@ func (h *Handler) GetBillingStatus(c *gin.Context) {
 		"payment_methods":      billingInfo.PaymentMethods,
 		"subscription_details": billingInfo.SubscriptionDetails,
 		"stripe_customer":      billingInfo.StripeCustomer, // Stripe customer info (includes email)
+		"payment_enforcement":  enforcement,                // Payment problems and suspension of paid resources
+		"payment_status":       billingInfo.PaymentStatus,  // What onboarding still needs, e.g. requires_payment_method
 	}
 	c.JSON(http.StatusOK, resp)
 }
 
 // CreateStripeSetupIntent creates a Stripe SetupIntent for payment onboarding
 func (h *Handler) CreateStripeSetupIntent(c *gin.Context) {
-	// Determine scope type and ID from URL
-	var scopeType, scopeID string
-	if orgID := c.Param("orgId"); orgID != "" {
-		scopeType = "organization"
-		scopeID = orgID
-	} else if projectID := c.Param("projectId"); projectID != "" {
-		scopeType = "project"
-		scopeID = projectID
-	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope"})
-		return
-	}
-
-	user, err := h.getUserFromContext(c)
-	if err != nil {
-		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
-		return
-	}
-
-	// Check manage_billing permission
-	hasPermission, err := h.RBACService.CheckPermission(c, user.ID, "manage_billing", scopeType, scopeID)
+	scopeType, scopeID, err := h.ownBillingScope(c, "manage_billing", "Insufficient permissions to manage billing")
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions", "details": err.Error()})
-		return
-	}
-	if !hasPermission {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to manage billing"})
 		return
 	}
 
-	clientSecret, err := h.BillingService.CreateStripeSetupIntent(scopeType, scopeID)
+	clientSecret, err := h.BillingService.CreateStripeSetupIntent(c.Request.Context(), scopeType, scopeID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create SetupIntent", "details": err.Error()})
 		return
 	}
 
@@ -154,23 +180,20 @@ func (h *Handler) CreateStripeSetupIntent(c *gin.Context) {
 // CreateOrganization handles the creation of a new organization.
 func (h *Handler) CreateOrganization(c *gin.Context) {
 	var req models.CreateOrganizationRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := bindJSON(c, &req); err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
 	org, err := h.OrganizationService.CreateOrganization(c.Request.Context(), req, user.ID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create organization", "details": err.Error()})
 		return
 	}
 	c.JSON(http.StatusCreated, org)
@@ -181,14 +204,12 @@ func (h *Handler) ListOrganizations(c *gin.Context) {
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
 	orgs, err := h.OrganizationService.ListOrganizations(c.Request.Context(), user.ID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list organizations", "details": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, orgs)
@@ -200,14 +221,12 @@ func (h *Handler) GetOrganization(c *gin.Context) {
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
 	org, err := h.OrganizationService.GetOrganization(c.Request.Context(), orgID, user.ID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found", "details": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, org)
@@ -217,23 +236,20 @@ func (h *Handler) GetOrganization(c *gin.Context) {
 func (h *Handler) UpdateOrganization(c *gin.Context) {
 	orgID := c.Param("orgId")
 	var req models.UpdateOrganizationRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := bindJSON(c, &req); err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
 	org, err := h.OrganizationService.UpdateOrganization(c.Request.Context(), orgID, req.Name, user.ID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update organization", "details": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, org)
@@ -245,14 +261,12 @@ func (h *Handler) DeleteOrganization(c *gin.Context) {
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
 	err = h.OrganizationService.DeleteOrganization(c.Request.Context(), orgID, user.ID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete organization", "details": err.Error()})
 		return
 	}
 	c.JSON(http.StatusNoContent, nil)
@@ -263,52 +277,49 @@ func (h *Handler) DeleteOrganization(c *gin.Context) {
 // CreateProject handles the creation of a new project.
 func (h *Handler) CreateProject(c *gin.Context) {
 	var req models.CreateProjectRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := bindJSON(c, &req); err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
 	project, err := h.ProjectService.CreateProject(c.Request.Context(), req, user.ID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create project", "details": err.Error()})
 		return
 	}
 	c.JSON(http.StatusCreated, project)
 }
 
-
 // CreateProjectSecret handles the creation of a new secret.
 func (h *Handler) CreateProjectSecret(c *gin.Context) {
 	projectID := c.Param("projectId")
-	
+
 	var req service.SecretData
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
 	user, err := h.getUserFromContext(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		_ = c.Error(err)
+		return
+	}
+
+	if h.SecretService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Secret service not available"})
 		return
 	}
 
 	secret, err := h.SecretService.CreateProjectSecret(c.Request.Context(), projectID, req, user.ID)
 	if err != nil {
-		if err.Error() == "insufficient permissions to create project secrets" {
-			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create secret", "details": err.Error()})
+		_ = c.Error(err)
 		return
 	}
 
@@ -318,59 +329,54 @@ func (h *Handler) CreateProjectSecret(c *gin.Context) {
 // UpdateProjectSecret handles the update of an existing secret.
 func (h *Handler) UpdateProjectSecret(c *gin.Context) {
 	projectID := c.Param("projectId")
-    
 	secretName := c.Param("secretName")
-	
+
 	var req service.SecretData
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-    // Ensure name in body matches name in URL if both present (optional safety check)
-    if req.Name != "" && req.Name != secretName {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Secret name in body does not match URL"})
-        return
-    }
-    // If name missing in body, set it from URL
-    req.Name = secretName
+	// Ensure name in body matches name in URL if both present (optional safety check)
+	if req.Name != "" && req.Name != secretName {
+		_ = c.Error(service.Validation("Secret name in body does not match URL"))
+		return
+	}
+	// If name missing in body, set it from URL
+	req.Name = secretName
 
 	user, err := h.getUserFromContext(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		_ = c.Error(err)
+		return
+	}
+
+	if h.SecretService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Secret service not available"})
 		return
 	}
 
 	secret, err := h.SecretService.UpdateProjectSecret(c.Request.Context(), projectID, secretName, req, user.ID)
 	if err != nil {
-		if err.Error() == "insufficient permissions to update project secrets" {
-			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
-			return
-		}
-		if strings.Contains(err.Error(), "not found") {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Secret not found", "details": err.Error()})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update secret", "details": err.Error()})
+		_ = c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, secret)
 }
+
 // GetProject retrieves a project by ID for the current user.
 func (h *Handler) GetProject(c *gin.Context) {
 	projectID := c.Param("projectId")
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
 	project, err := h.ProjectService.GetProjectByID(c.Request.Context(), projectID, user.ID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found", "details": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, project)
@@ -381,14 +387,12 @@ func (h *Handler) ListProjects(c *gin.Context) {
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
 	projects, err := h.ProjectService.ListProjects(c.Request.Context(), user.ID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list projects", "details": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, projects)
@@ -398,23 +402,20 @@ func (h *Handler) ListProjects(c *gin.Context) {
 func (h *Handler) UpdateProject(c *gin.Context) {
 	projectID := c.Param("projectId")
 	var req models.UpdateProjectRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := bindJSON(c, &req); err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
 	project, err := h.ProjectService.UpdateProject(c.Request.Context(), projectID, req, user.ID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project", "details": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, project)
@@ -426,14 +427,12 @@ func (h *Handler) DeleteProject(c *gin.Context) {
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
 	err = h.ProjectService.DeleteProject(c.Request.Context(), projectID, user.ID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project", "details": err.Error()})
 		return
 	}
 	c.JSON(http.StatusAccepted, gin.H{"message": "Project deletion initiated"})
@@ -445,28 +444,20 @@ func (h *Handler) DeleteProject(c *gin.Context) {
 func (h *Handler) CreateResource(c *gin.Context) {
 	projectID := c.Param("projectId")
 	var req models.CreateResourceRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := bindJSON(c, &req); err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
 		return
 	}
 
 	resource, err := h.ResourceService.CreateResource(c.Request.Context(), projectID, req, user.ID)
 	if err != nil {
-		if err.Error() == "insufficient permissions to create resource" {
-			_ = c.Error(err)
-			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to create resource"})
-			return
-		}
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create resource", "details": err.Error()})
 		return
 	}
 	c.JSON(http.StatusCreated, resource)
@@ -480,15 +471,13 @@ func (h *Handler) GetResource(c *gin.Context) {
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
 		return
 	}
 
+	// The service reports missing access as not found so existence is not revealed
 	resource, err := h.ResourceService.GetResourceByID(c.Request.Context(), projectID, resourceID, user.ID)
 	if err != nil {
-		// Always return 404 for security - don't reveal if resource exists but user lacks access
 		_ = c.Error(err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Resource not found"})
 		return
 	}
 	c.JSON(http.StatusOK, resource)
@@ -501,14 +490,12 @@ func (h *Handler) ListResources(c *gin.Context) {
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
 		return
 	}
 
 	resources, err := h.ResourceService.ListResources(c.Request.Context(), projectID, user.ID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list resources", "details": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, resources)
@@ -519,38 +506,72 @@ func (h *Handler) UpdateResource(c *gin.Context) {
 	projectID := c.Param("projectId")
 	resourceID := c.Param("resourceId")
 	var req models.UpdateResourceRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := bindJSON(c, &req); err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
 		return
 	}
 
 	resource, err := h.ResourceService.UpdateResource(c.Request.Context(), projectID, resourceID, req, user.ID)
 	if err != nil {
-		if err.Error() == "insufficient permissions to update resource" {
-			_ = c.Error(err)
-			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to update resource"})
-			return
-		}
-		if err.Error() == "billing account with active subscription required for tier changes" {
-			_ = c.Error(err)
-			c.JSON(http.StatusPaymentRequired, gin.H{"error": "Billing account with active subscription required for tier changes", "details": err.Error()})
-			return
-		}
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update resource", "details": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, resource)
 }
 
+// EstimateResource previews the price impact of creating a resource.
+func (h *Handler) EstimateResource(c *gin.Context) {
+	projectID := c.Param("projectId")
+	var req models.EstimateResourceRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	estimate, err := h.ResourceService.EstimateResource(c.Request.Context(), projectID, req, user.ID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, estimate)
+}
+
+// EstimateResourceUpdate previews the price impact of changing the SKU of a resource.
+func (h *Handler) EstimateResourceUpdate(c *gin.Context) {
+	projectID := c.Param("projectId")
+	resourceID := c.Param("resourceId")
+	var req models.EstimateResourceUpdateRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	estimate, err := h.ResourceService.EstimateResourceUpdate(c.Request.Context(), projectID, resourceID, req, user.ID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, estimate)
+}
+
 // DeleteResource deletes a resource by ID.
 func (h *Handler) DeleteResource(c *gin.Context) {
 	projectID := c.Param("projectId")
@@ -559,19 +580,12 @@ func (h *Handler) DeleteResource(c *gin.Context) {
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
 		return
 	}
 
 	err = h.ResourceService.DeleteResource(c.Request.Context(), projectID, resourceID, user.ID)
 	if err != nil {
-		if err.Error() == "insufficient permissions to delete resource" {
-			_ = c.Error(err)
-			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to delete resource"})
-			return
-		}
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete resource", "details": err.Error()})
 		return
 	}
 	c.JSON(http.StatusAccepted, gin.H{"message": "Resource deletion initiated"})
@@ -582,7 +596,7 @@ func (h *Handler) DeleteResource(c *gin.Context) {
 func (h *Handler) ListAllResources(c *gin.Context) {
 	user, err := h.getUserFromContext(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		_ = c.Error(err)
 		return
 	}
 
@@ -591,29 +605,30 @@ func (h *Handler) ListAllResources(c *gin.Context) {
 
 	resources, err := h.ResourceService.ListAllUserResources(c.Request.Context(), user.ID, resourceType)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		_ = c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"resources": resources})
 }
 
-// GetResourceTierPrice returns Stripe price details for a resource type and SKU
+// GetResourceTierPrice returns Stripe price details for a resource type and SKU, in the
+// currency given by the optional currency parameter
 func (h *Handler) GetResourceTierPrice(c *gin.Context) {
 	resourceType := c.Query("type")
 	sku := c.Query("sku")
 	if resourceType == "" || sku == "" {
-		c.JSON(400, gin.H{"error": "Missing type or sku parameter"})
+		_ = c.Error(service.Validation("Missing type or sku parameter"))
 		return
 	}
 
-	resourceTierPrice, err := h.BillingService.GetResourceTierPrice(resourceType, sku)
+	resourceTierPrice, err := h.BillingService.GetResourceTierPrice(c.Request.Context(), resourceType, sku, c.Query("currency"))
 	if err != nil {
-		c.JSON(404, gin.H{"error": err.Error()})
+		_ = c.Error(err)
 		return
 	}
 
-	c.JSON(200, resourceTierPrice)
+	c.JSON(http.StatusOK, resourceTierPrice)
 }
 
 // --- RBAC Handlers ---
@@ -623,7 +638,6 @@ func (h *Handler) ListRoles(c *gin.Context) {
 	roles, err := h.RBACService.ListRoles(c.Request.Context())
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list roles"})
 		return
 	}
 	c.JSON(http.StatusOK, roles)
@@ -635,7 +649,6 @@ func (h *Handler) ListRolePermissions(c *gin.Context) {
 	permissions, err := h.RBACService.ListPermissionsForRole(c.Request.Context(), roleID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list permissions for role"})
 		return
 	}
 	c.JSON(http.StatusOK, permissions)
@@ -652,12 +665,27 @@ func (h *Handler) SearchUsers(c *gin.Context) {
 	users, err := h.RBACService.SearchUsers(c.Request.Context(), query)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search users"})
 		return
 	}
 	c.JSON(http.StatusOK, users)
 }
 
+// resolveAssignee checks that userID identifies exactly one user.
+// notFound is returned when no user matches.
+func (h *Handler) resolveAssignee(c *gin.Context, userID string, notFound error) error {
+	users, err := h.RBACService.SearchUsers(c.Request.Context(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to look up user %s: %w", userID, err)
+	}
+	if len(users) == 0 {
+		return notFound
+	}
+	if len(users) > 1 {
+		return service.Validation("Ambiguous user_id, multiple users found")
+	}
+	return nil
+}
+
 // --- Project RBAC Handlers ---
 
 // ListProjectRoleAssignments lists all role assignments for a project.
@@ -667,7 +695,6 @@ func (h *Handler) ListProjectRoleAssignments(c *gin.Context) {
 	assignments, err := h.RBACService.GetRoleAssignmentsWithInheritance(c.Request.Context(), "project", projectID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role assignments", "details": err.Error()})
 		return
 	}
 
@@ -678,39 +705,31 @@ func (h *Handler) ListProjectRoleAssignments(c *gin.Context) {
 func (h *Handler) CreateProjectRoleAssignment(c *gin.Context) {
 	projectID := c.Param("projectId")
 
-	var req struct {
-		UserID string `json:"user_id" binding:"required"`
-		RoleID string `json:"role_id" binding:"required"`
-	}
-	if err := c.ShouldBindJSON(&req); err != nil {
+	var req models.CreateRoleAssignmentRequest
+	if err := bindJSON(c, &req); err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Validate user exists and is unique
-	users, err := h.RBACService.SearchUsers(c.Request.Context(), req.UserID)
-	if err != nil || len(users) == 0 {
-		_ = c.Error(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User not found for given user_id"})
+	if h.inviteUnknownEmail(c, "project", projectID, req, user.ID) {
 		return
 	}
-	if len(users) > 1 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Ambiguous user_id, multiple users found"})
+
+	// Validate user exists and is unique
+	if err := h.resolveAssignee(c, req.UserID, service.Validation("User not found for given user_id")); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	err = h.RBACService.AssignRole(c.Request.Context(), req.UserID, req.RoleID, "project", projectID, user.ID)
+	err = h.RBACService.AssignRoleUntil(c.Request.Context(), req.UserID, req.RoleID, "project", projectID, user.ID, req.ExpiresAt)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role", "details": err.Error()})
 		return
 	}
 
@@ -720,6 +739,7 @@ func (h *Handler) CreateProjectRoleAssignment(c *gin.Context) {
 		"user_id":     req.UserID,
 		"role_id":     req.RoleID,
 		"assigned_by": user.ID,
+		"expires_at":  req.ExpiresAt,
 	})
 }
 
@@ -731,26 +751,17 @@ func (h *Handler) DeleteProjectRoleAssignment(c *gin.Context) {
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
 		return
 	}
 
-	hasPermission, err := h.RBACService.CheckPermission(c, user.ID, "manage_access", "project", projectID)
-	if err != nil {
+	if err := h.requirePermission(c, user.ID, "manage_access", "project", projectID, "Insufficient permissions to delete role assignment"); err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permission"})
-		return
-	}
-	if !hasPermission {
-		_ = c.Error(err)
-		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to delete role assignment"})
 		return
 	}
 
 	err = h.RBACService.DeleteRoleAssignment(c, assignmentID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role assignment", "details": err.Error()})
 		return
 	}
 
@@ -772,7 +783,6 @@ func (h *Handler) ListResourceRoleAssignments(c *gin.Context) {
 	assignments, err := h.RBACService.GetRoleAssignmentsWithInheritance(c.Request.Context(), "resource", resourceID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role assignments", "details": err.Error()})
 		return
 	}
 
@@ -784,38 +794,30 @@ func (h *Handler) CreateResourceRoleAssignment(c *gin.Context) {
 	projectID := c.Param("projectId")
 	resourceID := c.Param("resourceId")
 
-	var req struct {
-		UserID string `json:"user_id" binding:"required"`
-		RoleID string `json:"role_id" binding:"required"`
-	}
-	if err := c.ShouldBindJSON(&req); err != nil {
+	var req models.CreateRoleAssignmentRequest
+	if err := bindJSON(c, &req); err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	users, err := h.RBACService.SearchUsers(c.Request.Context(), req.UserID)
-	if err != nil || len(users) == 0 {
-		_ = c.Error(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User not found for given user_id"})
+	if h.inviteUnknownEmail(c, "resource", resourceID, req, user.ID) {
 		return
 	}
-	if len(users) > 1 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Ambiguous user_id, multiple users found"})
+
+	if err := h.resolveAssignee(c, req.UserID, service.Validation("User not found for given user_id")); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	err = h.RBACService.AssignRole(c.Request.Context(), req.UserID, req.RoleID, "resource", resourceID, user.ID)
+	err = h.RBACService.AssignRoleUntil(c.Request.Context(), req.UserID, req.RoleID, "resource", resourceID, user.ID, req.ExpiresAt)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role", "details": err.Error()})
 		return
 	}
 
@@ -826,6 +828,7 @@ func (h *Handler) CreateResourceRoleAssignment(c *gin.Context) {
 		"user_id":     req.UserID,
 		"role_id":     req.RoleID,
 		"assigned_by": user.ID,
+		"expires_at":  req.ExpiresAt,
 	})
 }
 
@@ -838,25 +841,17 @@ func (h *Handler) DeleteResourceRoleAssignment(c *gin.Context) {
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
 		return
 	}
 
-	hasPermission, err := h.RBACService.CheckPermission(c, user.ID, "manage_access", "resource", resourceID)
-	if err != nil {
+	if err := h.requirePermission(c, user.ID, "manage_access", "resource", resourceID, "Insufficient permissions to delete role assignment"); err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permission"})
-		return
-	}
-	if !hasPermission {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to delete role assignment"})
 		return
 	}
 
 	err = h.RBACService.DeleteRoleAssignment(c, assignmentID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role assignment", "details": err.Error()})
 		return
 	}
 
@@ -877,7 +872,6 @@ func (h *Handler) ListOrganizationRoleAssignments(c *gin.Context) {
 	assignments, err := h.RBACService.GetRoleAssignmentsForScope(c.Request.Context(), "organization", orgID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role assignments", "details": err.Error()})
 		return
 	}
 
@@ -888,38 +882,30 @@ func (h *Handler) ListOrganizationRoleAssignments(c *gin.Context) {
 func (h *Handler) CreateOrganizationRoleAssignment(c *gin.Context) {
 	orgID := c.Param("orgId")
 
-	var req struct {
-		UserID string `json:"user_id" binding:"required"`
-		RoleID string `json:"role_id" binding:"required"`
-	}
-	if err := c.ShouldBindJSON(&req); err != nil {
+	var req models.CreateRoleAssignmentRequest
+	if err := bindJSON(c, &req); err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	users, err := h.RBACService.SearchUsers(c.Request.Context(), req.UserID)
-	if err != nil || len(users) == 0 {
-		_ = c.Error(err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found for given user_id"})
+	if h.inviteUnknownEmail(c, "organization", orgID, req, user.ID) {
 		return
 	}
-	if len(users) > 1 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Ambiguous user_id, multiple users found"})
+
+	if err := h.resolveAssignee(c, req.UserID, service.NotFound("User not found for given user_id")); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	err = h.RBACService.AssignRole(c.Request.Context(), req.UserID, req.RoleID, "organization", orgID, user.ID)
+	err = h.RBACService.AssignRoleUntil(c.Request.Context(), req.UserID, req.RoleID, "organization", orgID, user.ID, req.ExpiresAt)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role", "details": err.Error()})
 		return
 	}
 
@@ -929,6 +915,7 @@ func (h *Handler) CreateOrganizationRoleAssignment(c *gin.Context) {
 		"user_id":         req.UserID,
 		"role_id":         req.RoleID,
 		"assigned_by":     user.ID,
+		"expires_at":      req.ExpiresAt,
 	})
 }
 
@@ -940,25 +927,17 @@ func (h *Handler) DeleteOrganizationRoleAssignment(c *gin.Context) {
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
 		return
 	}
 
-	hasPermission, err := h.RBACService.CheckPermission(c, user.ID, "manage_access", "organization", orgID)
-	if err != nil {
+	if err := h.requirePermission(c, user.ID, "manage_access", "organization", orgID, "Insufficient permissions to delete role assignment"); err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permission"})
-		return
-	}
-	if !hasPermission {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to delete role assignment"})
 		return
 	}
 
 	err = h.RBACService.DeleteRoleAssignment(c, assignmentID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role assignment", "details": err.Error()})
 		return
 	}
 
@@ -969,269 +948,1416 @@ func (h *Handler) DeleteOrganizationRoleAssignment(c *gin.Context) {
 	})
 }
 
-// --- Billing Handlers ---
+// --- Access Request Handlers ---
 
-// GetBillingInfo retrieves billing information for organization or project.
-func (h *Handler) GetBillingInfo(c *gin.Context) {
-	// Determine scope type and ID from URL
-	var scopeType, scopeID string
+// CreateAccessRequest requests a temporary role on an organization, project or resource.
+func (h *Handler) CreateAccessRequest(c *gin.Context) {
+	scopeType, scopeID, err := rbacScopeFromParams(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
 
-	if orgID := c.Param("orgId"); orgID != "" {
-		scopeType = "organization"
-		scopeID = orgID
-	} else if projectID := c.Param("projectId"); projectID != "" {
-		scopeType = "project"
-		scopeID = projectID
-	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope"})
+	var req models.CreateAccessRequestRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
 
-	// Check manage_billing permission
-	hasPermission, err := h.RBACService.CheckPermission(c, user.ID, "manage_billing", scopeType, scopeID)
+	accessRequest, err := h.RBACService.RequestAccess(c.Request.Context(), user.ID, scopeType, scopeID, req)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions", "details": err.Error()})
 		return
 	}
 
-	if !hasPermission {
+	c.JSON(http.StatusCreated, accessRequest)
+}
+
+// ListAccessRequests lists access requests on a scope. Filter with ?status=pending.
+func (h *Handler) ListAccessRequests(c *gin.Context) {
+	scopeType, scopeID, err := rbacScopeFromParams(c)
+	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to view billing information"})
 		return
 	}
 
-	billingInfo, err := h.BillingService.GetBillingInfo(scopeType, scopeID)
+	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get billing information", "details": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, billingInfo)
+	requests, err := h.RBACService.ListAccessRequests(c.Request.Context(), user.ID, scopeType, scopeID, c.Query("status"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, requests)
 }
 
-// CreateStripeCustomer creates a Stripe customer for organization or project.
-func (h *Handler) CreateStripeCustomer(c *gin.Context) {
-	// Determine scope type and ID from URL
-	var scopeType, scopeID string
+// ApproveAccessRequest approves a pending access request, granting the role temporarily.
+func (h *Handler) ApproveAccessRequest(c *gin.Context) {
+	h.decideAccessRequest(c, h.RBACService.ApproveAccessRequest)
+}
 
-	if orgID := c.Param("orgId"); orgID != "" {
-		scopeType = "organization"
-		scopeID = orgID
-	} else if projectID := c.Param("projectId"); projectID != "" {
-		scopeType = "project"
-		scopeID = projectID
-	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope"})
-		return
-	}
+// DenyAccessRequest denies a pending access request.
+func (h *Handler) DenyAccessRequest(c *gin.Context) {
+	h.decideAccessRequest(c, h.RBACService.DenyAccessRequest)
+}
 
-	var req models.CreateStripeCustomerRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+func (h *Handler) decideAccessRequest(c *gin.Context, decide func(ctx context.Context, approverID, scopeType, scopeID, requestID string) (*models.AccessRequest, error)) {
+	scopeType, scopeID, err := rbacScopeFromParams(c)
+	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
 
-	// Check manage_billing permission
-	hasPermission, err := h.RBACService.CheckPermission(c, user.ID, "manage_billing", scopeType, scopeID)
+	accessRequest, err := decide(c.Request.Context(), user.ID, scopeType, scopeID, c.Param("requestId"))
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions", "details": err.Error()})
 		return
 	}
 
-	if !hasPermission {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to manage billing"})
-		return
+	c.JSON(http.StatusOK, accessRequest)
+}
+
+// --- Invitation Handlers ---
+
+// inviteUnknownEmail creates an invitation instead of a role assignment when req.UserID
+// is an email address that does not belong to any user yet. It reports whether it
+// handled the request.
+func (h *Handler) inviteUnknownEmail(c *gin.Context, scopeType, scopeID string, req models.CreateRoleAssignmentRequest, inviterID string) bool {
+	if h.InvitationService == nil || !utils.IsValidEmail(req.UserID) {
+		return false
+	}
+	users, err := h.RBACService.SearchUsers(c.Request.Context(), req.UserID)
+	if err != nil {
+		_ = c.Error(fmt.Errorf("failed to look up user %s: %w", req.UserID, err))
+		return true
+	}
+	for _, u := range users {
+		if strings.EqualFold(u.Email, req.UserID) || u.ID == req.UserID {
+			return false
+		}
 	}
 
-	// Use user email and name from Auth0 token
-	account, err := h.BillingService.CreateStripeCustomer(scopeType, scopeID, user.Email, user.Name, req.Description)
+	invitation, err := h.InvitationService.Invite(c.Request.Context(), inviterID, scopeType, scopeID,
+		models.CreateInvitationRequest{Email: req.UserID, RoleID: req.RoleID})
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create Stripe customer", "details": err.Error()})
-		return
+		return true
 	}
-
-	c.JSON(http.StatusOK, account)
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Invitation sent",
+		"invitation": invitation,
+	})
+	return true
 }
 
-// CreateStripeSubscription creates a Stripe subscription for organization or project.
-func (h *Handler) CreateStripeSubscription(c *gin.Context) {
-	// Determine scope type and ID from URL
-	var scopeType, scopeID string
+// ListInvitations lists invitations on a scope. Filter with ?status=pending.
+func (h *Handler) ListInvitations(c *gin.Context) {
+	scopeType, scopeID, err := rbacScopeFromParams(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
 
-	if orgID := c.Param("orgId"); orgID != "" {
-		scopeType = "organization"
-		scopeID = orgID
-	} else if projectID := c.Param("projectId"); projectID != "" {
-		scopeType = "project"
-		scopeID = projectID
-	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope"})
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	var req models.CreateStripeSubscriptionRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	invitations, err := h.InvitationService.ListInvitations(c.Request.Context(), user.ID, scopeType, scopeID, c.Query("status"))
+	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	fmt.Printf("Request parsed successfully: %+v\n", req)
+	c.JSON(http.StatusOK, invitations)
+}
 
-	user, err := h.getUserFromContext(c)
+// CreateInvitation invites an email address to take a role on a scope.
+func (h *Handler) CreateInvitation(c *gin.Context) {
+	scopeType, scopeID, err := rbacScopeFromParams(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
 
-	// Check manage_billing permission
-	hasPermission, err := h.RBACService.CheckPermission(c, user.ID, "manage_billing", scopeType, scopeID)
-	if err != nil {
+	var req models.CreateInvitationRequest
+	if err := bindJSON(c, &req); err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions", "details": err.Error()})
 		return
 	}
 
-	if !hasPermission {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to manage billing"})
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	fmt.Printf("About to call billing service CreateStripeSubscription\n")
-	account, err := h.BillingService.CreateStripeSubscription(scopeType, scopeID, req)
+	invitation, err := h.InvitationService.Invite(c.Request.Context(), user.ID, scopeType, scopeID, req)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subscription", "details": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, account)
+	c.JSON(http.StatusCreated, invitation)
 }
 
-// CreateStripeCustomerPortal creates a Stripe customer portal session for organization or project.
-func (h *Handler) CreateStripeCustomerPortal(c *gin.Context) {
-	// Determine scope type and ID from URL
-	var scopeType, scopeID string
+// ResendInvitation emails a pending invitation again with a new link.
+func (h *Handler) ResendInvitation(c *gin.Context) {
+	h.updateInvitation(c, h.InvitationService.ResendInvitation)
+}
 
-	if orgID := c.Param("orgId"); orgID != "" {
-		scopeType = "organization"
-		scopeID = orgID
-	} else if projectID := c.Param("projectId"); projectID != "" {
-		scopeType = "project"
-		scopeID = projectID
-	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope"})
+// RevokeInvitation revokes a pending invitation.
+func (h *Handler) RevokeInvitation(c *gin.Context) {
+	h.updateInvitation(c, h.InvitationService.RevokeInvitation)
+}
+
+func (h *Handler) updateInvitation(c *gin.Context, update func(ctx context.Context, userID, scopeType, scopeID, invitationID string) (*models.Invitation, error)) {
+	scopeType, scopeID, err := rbacScopeFromParams(c)
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
 
-	// Check manage_billing permission
-	hasPermission, err := h.RBACService.CheckPermission(c, user.ID, "manage_billing", scopeType, scopeID)
+	invitation, err := update(c.Request.Context(), user.ID, scopeType, scopeID, c.Param("invitationId"))
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions", "details": err.Error()})
 		return
 	}
 
-	if !hasPermission {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to manage billing"})
-		return
-	}
+	c.JSON(http.StatusOK, invitation)
+}
 
-	// Get return URL from request
-	type PortalRequest struct {
-		ReturnURL string `json:"return_url" binding:"required"`
+// AcceptInvitation grants the invited role to the calling user.
+func (h *Handler) AcceptInvitation(c *gin.Context) {
+	var req models.AcceptInvitationRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
 	}
 
-	var req PortalRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	user, err := h.getUserFromContext(c)
+	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if user.IsServiceAccount {
+		_ = c.Error(service.Forbidden("Service accounts cannot accept invitations"))
 		return
 	}
 
-	portalURL, err := h.BillingService.CreateStripeCustomerPortal(scopeType, scopeID, req.ReturnURL)
+	invitation, err := h.InvitationService.AcceptInvitation(c.Request.Context(), user.ID, req.Token)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create customer portal", "details": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"portal_url": portalURL})
+	c.JSON(http.StatusOK, invitation)
 }
 
-// CancelSubscription cancels a Stripe subscription for organization or project.
+// --- Account Linking Handlers ---
+
+// CreateAccountLinkToken issues a short-lived token for the current account. Redeeming it
+// with LinkAccount while signed in with another identity merges this account into it.
+func (h *Handler) CreateAccountLinkToken(c *gin.Context) {
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if user.IsServiceAccount {
+		_ = c.Error(service.Forbidden("Service accounts cannot be linked"))
+		return
+	}
+	if user.AccessTokenID != "" {
+		_ = c.Error(service.Forbidden("Accounts cannot be linked with a personal access token"))
+		return
+	}
+
+	token, err := h.RBACService.CreateAccountLinkToken(c.Request.Context(), user.ID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, token)
+}
+
+// LinkAccount merges the account that issued the token into the current user.
+func (h *Handler) LinkAccount(c *gin.Context) {
+	var req models.LinkAccountRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if user.IsServiceAccount {
+		_ = c.Error(service.Forbidden("Service accounts cannot be linked"))
+		return
+	}
+	if user.AccessTokenID != "" {
+		_ = c.Error(service.Forbidden("Accounts cannot be linked with a personal access token"))
+		return
+	}
+
+	merge, err := h.RBACService.LinkAccount(c.Request.Context(), user.ID, req.Token)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, merge)
+}
+
+// MergeUsers merges one user record into another, including all role assignments.
+// Requires the manage_users permission at global scope.
+func (h *Handler) MergeUsers(c *gin.Context) {
+	var req models.MergeUsersRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	merge, err := h.RBACService.MergeUsers(c.Request.Context(), user.ID, req.SourceUserID, req.TargetUserID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, merge)
+}
+
+// --- Team Handlers ---
+
+// ListTeams lists the teams of an organization.
+func (h *Handler) ListTeams(c *gin.Context) {
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	teams, err := h.TeamService.ListTeams(c.Request.Context(), user.ID, c.Param("orgId"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, teams)
+}
+
+// CreateTeam creates a team in an organization.
+func (h *Handler) CreateTeam(c *gin.Context) {
+	var req models.CreateTeamRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	team, err := h.TeamService.CreateTeam(c.Request.Context(), user.ID, c.Param("orgId"), req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, team)
+}
+
+// GetTeam returns a team.
+func (h *Handler) GetTeam(c *gin.Context) {
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	team, err := h.TeamService.GetTeam(c.Request.Context(), user.ID, c.Param("orgId"), c.Param("teamId"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, team)
+}
+
+// UpdateTeam renames a team or changes the IdP group it is synced from.
+func (h *Handler) UpdateTeam(c *gin.Context) {
+	var req models.UpdateTeamRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	team, err := h.TeamService.UpdateTeam(c.Request.Context(), user.ID, c.Param("orgId"), c.Param("teamId"), req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, team)
+}
+
+// DeleteTeam deletes a team with its memberships and role assignments.
+func (h *Handler) DeleteTeam(c *gin.Context) {
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.TeamService.DeleteTeam(c.Request.Context(), user.ID, c.Param("orgId"), c.Param("teamId")); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Team deleted successfully"})
+}
+
+// ListTeamMembers lists the members of a team.
+func (h *Handler) ListTeamMembers(c *gin.Context) {
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	members, err := h.TeamService.ListMembers(c.Request.Context(), user.ID, c.Param("orgId"), c.Param("teamId"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+// AddTeamMember adds an existing user, by ID or email, to a team.
+func (h *Handler) AddTeamMember(c *gin.Context) {
+	var req models.AddTeamMemberRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	users, err := h.RBACService.SearchUsers(c.Request.Context(), req.UserID)
+	if err != nil {
+		_ = c.Error(fmt.Errorf("failed to look up user %s: %w", req.UserID, err))
+		return
+	}
+	// Search matches substrings; only an exact ID or email identifies the member
+	memberID := ""
+	for _, candidate := range users {
+		if candidate.ID == req.UserID || strings.EqualFold(candidate.Email, req.UserID) {
+			memberID = candidate.ID
+			break
+		}
+	}
+	if memberID == "" {
+		_ = c.Error(service.NotFound("User not found for given user_id"))
+		return
+	}
+
+	err = h.TeamService.AddMember(c.Request.Context(), user.ID, c.Param("orgId"), c.Param("teamId"), memberID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Team member added",
+		"team_id": c.Param("teamId"),
+		"user_id": memberID,
+	})
+}
+
+// RemoveTeamMember removes a user from a team.
+func (h *Handler) RemoveTeamMember(c *gin.Context) {
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	err = h.TeamService.RemoveMember(c.Request.Context(), user.ID, c.Param("orgId"), c.Param("teamId"), c.Param("userId"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Team member removed"})
+}
+
+// --- Current User Handlers ---
+
+// profileOwner returns the caller if it may change its own account. Service accounts
+// are managed by their organization or project, and a personal access token cannot
+// change the account it belongs to.
+func (h *Handler) profileOwner(c *gin.Context) (*models.User, error) {
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsServiceAccount {
+		return nil, service.Forbidden("Service accounts cannot change their own account")
+	}
+	if user.AccessTokenID != "" {
+		return nil, service.Forbidden("Accounts cannot be changed with a personal access token")
+	}
+	return user, nil
+}
+
+// GetProfile returns the current user's profile and account type.
+func (h *Handler) GetProfile(c *gin.Context) {
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	profile, err := h.RBACService.GetProfile(c.Request.Context(), user)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// UpdateProfile updates the current user's display name.
+func (h *Handler) UpdateProfile(c *gin.Context) {
+	var req models.UpdateProfileRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	user, err := h.profileOwner(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	profile, err := h.RBACService.UpdateProfile(c.Request.Context(), user, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// DeleteAccount deletes the current user's account. It is refused while the user is
+// the only owner of an organization, project or resource.
+func (h *Handler) DeleteAccount(c *gin.Context) {
+	user, err := h.profileOwner(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.RBACService.DeleteAccount(c.Request.Context(), user.ID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	auth.ForgetUser(user.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
+}
+
+// GetAccessSummary lists the organizations, projects and resources the current user can
+// reach, with the effective role at each.
+func (h *Handler) GetAccessSummary(c *gin.Context) {
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	summary, err := h.RBACService.GetAccessSummary(c.Request.Context(), user.ID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// --- Personal Access Token Handlers ---
+
+// tokenOwner returns the caller if it may manage personal access tokens. Service
+// accounts have client secrets instead, and a token cannot mint or revoke tokens.
+func (h *Handler) tokenOwner(c *gin.Context) (*models.User, error) {
+	if h.PersonalAccessTokenService == nil {
+		return nil, service.NotFound("personal access tokens are not available")
+	}
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsServiceAccount {
+		return nil, service.Forbidden("Service accounts cannot have personal access tokens")
+	}
+	if user.AccessTokenID != "" {
+		return nil, service.Forbidden("Personal access tokens cannot manage personal access tokens")
+	}
+	return user, nil
+}
+
+// ListPersonalAccessTokens lists the current user's personal access tokens.
+func (h *Handler) ListPersonalAccessTokens(c *gin.Context) {
+	user, err := h.tokenOwner(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	tokens, err := h.PersonalAccessTokenService.ListTokens(c.Request.Context(), user.ID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// CreatePersonalAccessToken creates a personal access token. The token value is only returned once.
+func (h *Handler) CreatePersonalAccessToken(c *gin.Context) {
+	var req models.CreatePersonalAccessTokenRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	user, err := h.tokenOwner(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	token, err := h.PersonalAccessTokenService.CreateToken(c.Request.Context(), user.ID, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, token)
+}
+
+// RevokePersonalAccessToken revokes one of the current user's personal access tokens.
+func (h *Handler) RevokePersonalAccessToken(c *gin.Context) {
+	user, err := h.tokenOwner(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.PersonalAccessTokenService.RevokeToken(c.Request.Context(), user.ID, c.Param("tokenId")); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Access token revoked successfully"})
+}
+
+// --- Service Account Handlers ---
+
+// serviceAccountScope resolves the owning scope and the caller for service account routes.
+func (h *Handler) serviceAccountScope(c *gin.Context) (user *models.User, scopeType, scopeID string, err error) {
+	if h.ServiceAccountService == nil {
+		return nil, "", "", service.NotFound("service accounts are not available")
+	}
+	scopeType, scopeID, err = scopeFromParams(c)
+	if err != nil {
+		return nil, "", "", err
+	}
+	user, err = h.getUserFromContext(c)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return user, scopeType, scopeID, nil
+}
+
+// ListServiceAccounts lists the service accounts owned by an organization or project.
+func (h *Handler) ListServiceAccounts(c *gin.Context) {
+	user, scopeType, scopeID, err := h.serviceAccountScope(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	accounts, err := h.ServiceAccountService.ListServiceAccounts(c.Request.Context(), user.ID, scopeType, scopeID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, accounts)
+}
+
+// CreateServiceAccount creates a service account owned by an organization or project.
+func (h *Handler) CreateServiceAccount(c *gin.Context) {
+	var req models.CreateServiceAccountRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	user, scopeType, scopeID, err := h.serviceAccountScope(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	account, err := h.ServiceAccountService.CreateServiceAccount(c.Request.Context(), user.ID, scopeType, scopeID, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, account)
+}
+
+// GetServiceAccount returns a service account.
+func (h *Handler) GetServiceAccount(c *gin.Context) {
+	user, scopeType, scopeID, err := h.serviceAccountScope(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	account, err := h.ServiceAccountService.GetServiceAccount(c.Request.Context(), user.ID, scopeType, scopeID, c.Param("serviceAccountId"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// UpdateServiceAccount renames, remaps, disables or re-enables a service account.
+func (h *Handler) UpdateServiceAccount(c *gin.Context) {
+	var req models.UpdateServiceAccountRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	user, scopeType, scopeID, err := h.serviceAccountScope(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	account, err := h.ServiceAccountService.UpdateServiceAccount(c.Request.Context(), user.ID, scopeType, scopeID, c.Param("serviceAccountId"), req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// DeleteServiceAccount deletes a service account with its secrets and role assignments.
+func (h *Handler) DeleteServiceAccount(c *gin.Context) {
+	user, scopeType, scopeID, err := h.serviceAccountScope(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.ServiceAccountService.DeleteServiceAccount(c.Request.Context(), user.ID, scopeType, scopeID, c.Param("serviceAccountId")); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Service account deleted successfully"})
+}
+
+// ListServiceAccountSecrets lists the client secrets of a service account, without their values.
+func (h *Handler) ListServiceAccountSecrets(c *gin.Context) {
+	user, scopeType, scopeID, err := h.serviceAccountScope(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	secrets, err := h.ServiceAccountService.ListSecrets(c.Request.Context(), user.ID, scopeType, scopeID, c.Param("serviceAccountId"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, secrets)
+}
+
+// CreateServiceAccountSecret issues a client secret. The secret value is only returned once.
+func (h *Handler) CreateServiceAccountSecret(c *gin.Context) {
+	var req models.CreateServiceAccountSecretRequest
+	if c.Request.ContentLength != 0 {
+		if err := bindJSON(c, &req); err != nil {
+			_ = c.Error(err)
+			return
+		}
+	}
+
+	user, scopeType, scopeID, err := h.serviceAccountScope(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	secret, err := h.ServiceAccountService.CreateSecret(c.Request.Context(), user.ID, scopeType, scopeID, c.Param("serviceAccountId"), req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, secret)
+}
+
+// DeleteServiceAccountSecret revokes a client secret.
+func (h *Handler) DeleteServiceAccountSecret(c *gin.Context) {
+	user, scopeType, scopeID, err := h.serviceAccountScope(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	err = h.ServiceAccountService.DeleteSecret(c.Request.Context(), user.ID, scopeType, scopeID, c.Param("serviceAccountId"), c.Param("secretId"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Client secret deleted successfully"})
+}
+
+// IssueServiceAccountToken implements the OAuth 2.0 client credentials grant for service
+// accounts. Credentials are read from HTTP Basic authentication or the request body,
+// which may be form-encoded or JSON.
+func (h *Handler) IssueServiceAccountToken(c *gin.Context) {
+	if h.ServiceAccountService == nil {
+		_ = c.Error(service.NotFound("service account tokens are not available"))
+		return
+	}
+
+	var req models.ServiceAccountTokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		_ = c.Error(service.Wrap(service.ErrValidation, err, "%s", err.Error()))
+		return
+	}
+	if req.GrantType != "client_credentials" {
+		_ = c.Error(service.Validation("unsupported grant_type %q", req.GrantType))
+		return
+	}
+	if clientID, clientSecret, ok := c.Request.BasicAuth(); ok {
+		req.ClientID, req.ClientSecret = clientID, clientSecret
+	}
+
+	token, err := h.ServiceAccountService.IssueToken(c.Request.Context(), req.ClientID, req.ClientSecret)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, token)
+}
+
+// --- Billing Handlers ---
+
+// GetBillingInfo retrieves billing information for organization or project.
+func (h *Handler) GetBillingInfo(c *gin.Context) {
+	scopeType, scopeID, err := h.billingScope(c, "manage_billing", "Insufficient permissions to view billing information")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	billingInfo, err := h.BillingService.GetBillingInfo(c.Request.Context(), scopeType, scopeID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, billingInfo)
+}
+
+// CreateStripeCustomer creates a Stripe customer for organization or project.
+func (h *Handler) CreateStripeCustomer(c *gin.Context) {
+	scopeType, scopeID, err := h.ownBillingScope(c, "manage_billing", "Insufficient permissions to manage billing")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var req models.CreateStripeCustomerRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	// Use user email and name from Auth0 token
+	account, err := h.BillingService.CreateStripeCustomer(c.Request.Context(), scopeType, scopeID, user.Email, user.Name, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// CreateStripeSubscription creates a Stripe subscription for organization or project. When
+// the customer has no payment method yet, the response carries the client secret to collect it.
+func (h *Handler) CreateStripeSubscription(c *gin.Context) {
+	scopeType, scopeID, err := h.ownBillingScope(c, "manage_billing", "Insufficient permissions to manage billing")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var req models.CreateStripeSubscriptionRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	result, err := h.BillingService.CreateStripeSubscription(c.Request.Context(), scopeType, scopeID, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// CreateStripeCustomerPortal creates a Stripe customer portal session for organization or project.
+func (h *Handler) CreateStripeCustomerPortal(c *gin.Context) {
+	scopeType, scopeID, err := h.ownBillingScope(c, "manage_billing", "Insufficient permissions to manage billing")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	// Get return URL from request
+	type PortalRequest struct {
+		ReturnURL string `json:"return_url" binding:"required"`
+	}
+
+	var req PortalRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	portalURL, err := h.BillingService.CreateStripeCustomerPortal(c.Request.Context(), scopeType, scopeID, req.ReturnURL)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"portal_url": portalURL})
+}
+
+// CancelSubscription cancels a Stripe subscription for organization or project.
 func (h *Handler) CancelSubscription(c *gin.Context) {
-	// Determine scope type and ID from URL
-	var scopeType, scopeID string
+	scopeType, scopeID, err := h.ownBillingScope(c, "manage_billing", "Insufficient permissions to manage billing")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	account, err := h.BillingService.CancelSubscription(c.Request.Context(), scopeType, scopeID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// UpdateBillingInheritance moves a project between being billed to its organization and
+// being billed on its own, migrating its subscription items. Moving onto the organization
+// also requires manage_billing on the organization, since it will be charged.
+func (h *Handler) UpdateBillingInheritance(c *gin.Context) {
+	projectID := c.Param("projectId")
+
+	var req models.UpdateBillingInheritanceRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.requirePermission(c, user.ID, "manage_billing", "project", projectID, "Insufficient permissions to manage billing"); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if *req.InheritsBillingFromOrg {
+		project, err := h.ProjectService.GetProjectByID(c.Request.Context(), projectID, user.ID)
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		if project.OrgID == nil {
+			_ = c.Error(service.Validation("project %s does not belong to an organization", projectID))
+			return
+		}
+		if err := h.requirePermission(c, user.ID, "manage_billing", "organization", *project.OrgID, "Insufficient permissions to manage organization billing"); err != nil {
+			_ = c.Error(err)
+			return
+		}
+	}
+
+	account, err := h.BillingService.SetProjectBillingInheritance(c.Request.Context(), projectID, *req.InheritsBillingFromOrg)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// billingScope returns the billing scope of the request after checking that the user may
+// perform action on it and on the scope paying for it, which is the organization for a
+// project inheriting its billing. Permissions on a project never reach the organization's
+// billing account.
+func (h *Handler) billingScope(c *gin.Context, action, message string) (string, string, error) {
+	scopeType, scopeID, _, _, err := h.billingPayer(c, action, message)
+	return scopeType, scopeID, err
+}
+
+// ownBillingScope is billingScope for changes to the Stripe customer and subscription of the
+// scope itself. A project inheriting its billing has none of its own, so it is rejected rather
+// than set up apart from the organization paying for it.
+func (h *Handler) ownBillingScope(c *gin.Context, action, message string) (string, string, error) {
+	scopeType, scopeID, payerType, payerID, err := h.billingPayer(c, action, message)
+	if err != nil {
+		return "", "", err
+	}
+	if payerType != scopeType || payerID != scopeID {
+		return "", "", service.Validation("%s %s is billed to %s %s; manage billing there or stop inheriting billing first", scopeType, scopeID, payerType, payerID)
+	}
+	return scopeType, scopeID, nil
+}
+
+// billingPayer returns the billing scope of the request and the scope paying for it, after
+// the permission checks of billingScope.
+func (h *Handler) billingPayer(c *gin.Context, action, message string) (scopeType, scopeID, payerType, payerID string, err error) {
+	scopeType, scopeID, err = scopeFromParams(c)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	if err := h.requirePermission(c, user.ID, action, scopeType, scopeID, message); err != nil {
+		return "", "", "", "", err
+	}
+
+	var billingScopes billingScopeResolver = h.BillingService
+	if h.billingScopes != nil {
+		billingScopes = h.billingScopes
+	}
+	payerType, payerID, err = billingScopes.ResolveBillingScope(c.Request.Context(), scopeType, scopeID)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	if payerType != scopeType || payerID != scopeID {
+		if err := h.requirePermission(c, user.ID, action, payerType, payerID, message+" of the "+payerType+" paying for this "+scopeType); err != nil {
+			return "", "", "", "", err
+		}
+	}
+	return scopeType, scopeID, payerType, payerID, nil
+}
+
+// GetBillingTrial returns the trial granted to the billing account of an organization or
+// project and whether it has been used.
+func (h *Handler) GetBillingTrial(c *gin.Context) {
+	scopeType, scopeID, err := h.billingScope(c, "manage_billing", "Insufficient permissions to view billing information")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
 
-	if orgID := c.Param("orgId"); orgID != "" {
-		scopeType = "organization"
-		scopeID = orgID
-	} else if projectID := c.Param("projectId"); projectID != "" {
-		scopeType = "project"
-		scopeID = projectID
-	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope"})
+	trial, err := h.BillingService.GetBillingTrial(c.Request.Context(), scopeType, scopeID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, trial)
+}
+
+// UpdateBillingTrial grants a trial length to the billing account of an organization or
+// project. Trials are granted by platform staff, who hold manage_billing at global scope.
+func (h *Handler) UpdateBillingTrial(c *gin.Context) {
+	scopeType, scopeID, err := scopeFromParams(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var req models.UpdateBillingTrialRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
 
-	// Check manage_billing permission
-	hasPermission, err := h.RBACService.CheckPermission(c, user.ID, "manage_billing", scopeType, scopeID)
+	if err := h.requirePermission(c, user.ID, "manage_billing", "global", "global", "Insufficient permissions to grant trials"); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	trial, err := h.BillingService.SetBillingTrial(c.Request.Context(), scopeType, scopeID, req.TrialDays, user.ID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions", "details": err.Error()})
 		return
 	}
+	c.JSON(http.StatusOK, trial)
+}
 
-	if !hasPermission {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to manage billing"})
+// ApplyBillingDiscount applies a promotion code to the subscription of an organization or
+// project. Coupons can be applied directly by platform staff only.
+func (h *Handler) ApplyBillingDiscount(c *gin.Context) {
+	var req models.ApplyDiscountRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	scopeType, scopeID, err := h.billingScope(c, "manage_billing", "Insufficient permissions to manage billing")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if req.Coupon != "" {
+		if err := h.requirePermission(c, user.ID, "manage_billing", "global", "global", "Insufficient permissions to apply coupons"); err != nil {
+			_ = c.Error(err)
+			return
+		}
+	}
+
+	account, err := h.BillingService.ApplyDiscount(c.Request.Context(), scopeType, scopeID, req, user.ID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, account)
+}
+
+// UpdateBillingInterval switches the billing account of an organization or project between
+// monthly and annual billing, moving its subscription to the prices of the new interval.
+func (h *Handler) UpdateBillingInterval(c *gin.Context) {
+	var req models.UpdateBillingIntervalRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	scopeType, scopeID, err := h.billingScope(c, "manage_billing", "Insufficient permissions to manage billing")
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	account, err := h.BillingService.CancelSubscription(scopeType, scopeID)
+	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel subscription", "details": err.Error()})
 		return
 	}
 
+	account, err := h.BillingService.SetBillingInterval(c.Request.Context(), scopeType, scopeID, req.Interval, user.ID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
 	c.JSON(http.StatusOK, account)
 }
 
+// GetBillingAddress returns the billing address, tax IDs and currency of the billing account
+// of an organization or project.
+func (h *Handler) GetBillingAddress(c *gin.Context) {
+	scopeType, scopeID, err := h.billingScope(c, "manage_billing", "Insufficient permissions to view billing information")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	info, err := h.BillingService.GetBillingAddress(c.Request.Context(), scopeType, scopeID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// UpdateBillingAddress sets the billing address of the billing account of an organization or
+// project, and adds a tax ID when given.
+func (h *Handler) UpdateBillingAddress(c *gin.Context) {
+	var req models.UpdateBillingAddressRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	scopeType, scopeID, err := h.billingScope(c, "manage_billing", "Insufficient permissions to manage billing")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	info, err := h.BillingService.UpdateBillingAddress(c.Request.Context(), scopeType, scopeID, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// GetBillingContacts returns the billing contacts of the billing account of an organization
+// or project.
+func (h *Handler) GetBillingContacts(c *gin.Context) {
+	scopeType, scopeID, err := h.billingScope(c, "manage_billing", "Insufficient permissions to view billing information")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	contacts, err := h.BillingService.GetBillingContacts(c.Request.Context(), scopeType, scopeID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"contacts": contacts})
+}
+
+// UpdateBillingContacts replaces the billing contacts of the billing account of an
+// organization or project, and bills its invoices to them.
+func (h *Handler) UpdateBillingContacts(c *gin.Context) {
+	var req models.UpdateBillingContactsRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	scopeType, scopeID, err := h.billingScope(c, "manage_billing", "Insufficient permissions to manage billing")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	contacts, err := h.BillingService.SetBillingContacts(c.Request.Context(), scopeType, scopeID, req.Contacts, user.ID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"contacts": contacts})
+}
+
+// ListInvoices lists the invoices of an organization or project, newest first. The optional
+// limit and starting_after query parameters page through them.
+func (h *Handler) ListInvoices(c *gin.Context) {
+	var limit int64
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 1 {
+			_ = c.Error(service.Validation("limit must be a positive number"))
+			return
+		}
+		limit = parsed
+	}
+
+	scopeType, scopeID, err := h.billingScope(c, "manage_billing", "Insufficient permissions to view invoices")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	invoices, err := h.BillingService.ListInvoices(c.Request.Context(), scopeType, scopeID, limit, c.Query("starting_after"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, invoices)
+}
+
+// GetInvoice returns an invoice with its lines broken down by resource and project, its
+// credit notes and its PDF link.
+func (h *Handler) GetInvoice(c *gin.Context) {
+	scopeType, scopeID, err := h.billingScope(c, "manage_billing", "Insufficient permissions to view invoices")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	invoice, err := h.BillingService.GetInvoice(c.Request.Context(), scopeType, scopeID, c.Param("invoiceId"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, invoice)
+}
+
+// ExportInvoiceLines returns the lines of the invoices created between the from and to dates
+// (YYYY-MM-DD, both inclusive) as CSV.
+func (h *Handler) ExportInvoiceLines(c *gin.Context) {
+	from, err := time.Parse(time.DateOnly, c.Query("from"))
+	if err != nil {
+		_ = c.Error(service.Validation("from must be a date (YYYY-MM-DD)"))
+		return
+	}
+	to, err := time.Parse(time.DateOnly, c.Query("to"))
+	if err != nil {
+		_ = c.Error(service.Validation("to must be a date (YYYY-MM-DD)"))
+		return
+	}
+
+	scopeType, scopeID, err := h.billingScope(c, "manage_billing", "Insufficient permissions to export invoices")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	// Buffer the export so that a Stripe failure halfway still yields an error response
+	var buf bytes.Buffer
+	if err := h.BillingService.ExportInvoiceLines(c.Request.Context(), scopeType, scopeID, from, to.AddDate(0, 0, 1), &buf); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	filename := fmt.Sprintf("invoice-lines-%s-%s.csv", from.Format(time.DateOnly), to.Format(time.DateOnly))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// GetUsage lists the metered hourly usage of a project's resources. The optional from and to
+// query parameters (RFC 3339) select the period; it defaults to the current month.
+func (h *Handler) GetUsage(c *gin.Context) {
+	if h.MeteringService == nil {
+		_ = c.Error(service.NotFound("usage metering is not available"))
+		return
+	}
+	projectID := c.Param("projectId")
+
+	var from, to time.Time
+	for name, value := range map[string]*time.Time{"from": &from, "to": &to} {
+		raw := c.Query(name)
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			_ = c.Error(service.Validation("%s must be an RFC 3339 timestamp", name))
+			return
+		}
+		*value = parsed
+	}
+
+	user, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.requirePermission(c, user.ID, "manage_billing", "project", projectID, "Insufficient permissions to view usage"); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	summary, err := h.MeteringService.GetProjectUsage(c.Request.Context(), projectID, from, to)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
 // ListPermissionsHandler returns all permissions (actions) for a given scope.
 // Regular users can only check their own permissions.
 // Service accounts (M2M) with the "check_permissions_on_behalf_of" permission
@@ -1240,61 +2366,26 @@ func (h *Handler) ListPermissionsHandler(c *gin.Context) {
 	scopeType := c.Query("scopeType")
 	scopeID := c.Query("scopeId")
 	if scopeType == "" || scopeID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing scopeType or scopeId"})
+		_ = c.Error(service.Validation("Missing scopeType or scopeId"))
 		return
 	}
 
 	caller, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
 		return
 	}
 
 	// Determine whose permissions to check
-	targetUserID := caller.ID // Default to caller's own permissions
-	requestedUserID := c.Query("userId")
-
-	// If userId parameter is provided, verify authorization
-	if requestedUserID != "" {
-		// Check if requesting permissions for a different user
-		if requestedUserID != caller.ID {
-			// Only service accounts can check permissions on behalf of others
-			if !caller.IsServiceAccount {
-				c.JSON(http.StatusForbidden, gin.H{
-					"error": "Only service accounts can check permissions on behalf of other users",
-				})
-				return
-			}
-
-			// Verify the service account has the special permission
-			canCheck, err := h.RBACService.CanServiceAccountCheckPermissions(c.Request.Context(), caller.ID)
-			if err != nil {
-				_ = c.Error(err)
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error":   "Failed to verify service account permissions",
-					"details": err.Error(),
-				})
-				return
-			}
-
-			if !canCheck {
-				c.JSON(http.StatusForbidden, gin.H{
-					"error": "Service account does not have permission to check permissions on behalf of users",
-					"hint":  "The service account needs a role with 'check_permissions_on_behalf_of' permission at global scope",
-				})
-				return
-			}
-
-			// Authorization passed, check permissions for the requested user
-			targetUserID = requestedUserID
-		}
+	targetUserID, err := h.permissionSubject(c, caller, c.Query("userId"))
+	if err != nil {
+		_ = c.Error(err)
+		return
 	}
 
 	permissions, err := h.RBACService.ListPermissions(c.Request.Context(), targetUserID, scopeType, scopeID)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list permissions", "details": err.Error()})
 		return
 	}
 
@@ -1306,6 +2397,111 @@ func (h *Handler) ListPermissionsHandler(c *gin.Context) {
 	})
 }
 
+// permissionSubject returns the user whose permissions the caller may check.
+// Regular users can only check their own permissions. Service accounts (M2M) with the
+// "check_permissions_on_behalf_of" permission at global scope can check any user's.
+func (h *Handler) permissionSubject(c *gin.Context, caller *models.User, requestedUserID string) (string, error) {
+	if requestedUserID == "" || requestedUserID == caller.ID {
+		return caller.ID, nil
+	}
+
+	// Only service accounts can check permissions on behalf of others
+	if !caller.IsServiceAccount {
+		return "", service.Forbidden("Only service accounts can check permissions on behalf of other users")
+	}
+
+	// Verify the service account has the special permission
+	canCheck, err := h.RBACService.CanServiceAccountCheckPermissions(c.Request.Context(), caller.ID)
+	if err != nil {
+		return "", err
+	}
+	if !canCheck {
+		return "", service.Forbidden("Service account does not have permission to check permissions on behalf of users. " +
+			"The service account needs a role with 'check_permissions_on_behalf_of' permission at global scope")
+	}
+	return requestedUserID, nil
+}
+
+// ExplainPermissionHandler explains why a user can or cannot perform an action on a scope.
+// Callers can always explain their own access. Explaining another user's access requires
+// manage_access on the scope, or the service-account rules of ListPermissionsHandler.
+func (h *Handler) ExplainPermissionHandler(c *gin.Context) {
+	scopeType := c.Query("scopeType")
+	scopeID := c.Query("scopeId")
+	action := c.Query("action")
+	if scopeType == "" || scopeID == "" || action == "" {
+		_ = c.Error(service.Validation("Missing scopeType, scopeId or action"))
+		return
+	}
+
+	caller, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	targetUserID := caller.ID
+	if requestedUserID := c.Query("userId"); requestedUserID != "" && requestedUserID != caller.ID {
+		canManage, err := h.RBACService.CheckPermission(c, caller.ID, "manage_access", scopeType, scopeID)
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		if canManage {
+			targetUserID = requestedUserID
+		} else if targetUserID, err = h.permissionSubject(c, caller, requestedUserID); err != nil {
+			_ = c.Error(err)
+			return
+		}
+	}
+
+	explanation, err := h.RBACService.ExplainPermission(c.Request.Context(), targetUserID, action, scopeType, scopeID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, explanation)
+}
+
+// BatchCheckPermissionsHandler returns allow/deny for each (user, scope, action) tuple.
+// Tuples without a user_id check the caller; other users follow the same on-behalf-of
+// rules as ListPermissionsHandler. All tuples are evaluated in a single query.
+func (h *Handler) BatchCheckPermissionsHandler(c *gin.Context) {
+	caller, err := h.getUserFromContext(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var req models.BatchPermissionCheckRequest
+	if err := bindJSON(c, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	for i := range req.Checks {
+		subject, err := h.permissionSubject(c, caller, req.Checks[i].UserID)
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		req.Checks[i].UserID = subject
+	}
+
+	allowed, err := h.RBACService.CheckPermissions(c.Request.Context(), req.Checks)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	results := make([]models.PermissionCheckResult, len(req.Checks))
+	for i, check := range req.Checks {
+		results[i] = models.PermissionCheckResult{PermissionCheck: check, Allowed: allowed[i]}
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
 // --- Logging & Metrics Proxy Handlers ---
 
 // LogsProxyHandler proxies log requests to Loki with RBAC and multi-tenancy
@@ -1342,7 +2538,6 @@ func (h *Handler) GetProjectSecret(c *gin.Context) {
 	user, err := h.getUserFromContext(c)
 	if err != nil {
 		_ = c.Error(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
 
@@ -1354,11 +2549,6 @@ func (h *Handler) GetProjectSecret(c *gin.Context) {
 	secretData, err := h.SecretService.GetProjectSecret(c.Request.Context(), projectID, secretName, user.ID)
 	if err != nil {
 		_ = c.Error(err)
-		if strings.Contains(err.Error(), "not found") {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Secret not found", "details": err.Error()})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve secret", "details": err.Error()})
 		return
 	}
 
@@ -1,10 +1,16 @@
 package api
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
 
+	"ktrlplane/internal/models"
+	"ktrlplane/internal/service"
+
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
@@ -22,3 +28,421 @@ func TestHealthCheck(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code, "Health check should return status OK")
 	assert.JSONEq(t, `{"status": "UP"}`, w.Body.String(), "Health check response should match")
 }
+
+func newPermissionsRouter(user models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{RBACService: service.NewRBACService()}
+	r := gin.New()
+	r.Use(ErrorHandlerMiddleware())
+	r.Use(func(c *gin.Context) { c.Set("user", user) })
+	r.GET("/permissions/check", h.ListPermissionsHandler)
+	r.GET("/permissions/explain", h.ExplainPermissionHandler)
+	r.POST("/permissions/:collection", customMethods("collection", "check", map[string]gin.HandlerFunc{
+		"batch": h.BatchCheckPermissionsHandler,
+	}))
+	return r
+}
+
+func TestBatchCheckPermissions_RequestErrors(t *testing.T) {
+	r := newPermissionsRouter(models.User{ID: "auth0|u1"})
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{"unknown method", "/permissions/check:other", `{}`, http.StatusNotFound},
+		{"unknown collection", "/permissions/other:batch", `{}`, http.StatusNotFound},
+		{"empty batch", "/permissions/check:batch", `{"checks": []}`, http.StatusBadRequest},
+		{"missing action", "/permissions/check:batch", `{"checks": [{"scope_type": "project", "scope_id": "p1"}]}`, http.StatusBadRequest},
+		{
+			"other user without service account",
+			"/permissions/check:batch",
+			`{"checks": [{"user_id": "auth0|u2", "scope_type": "project", "scope_id": "p1", "action": "read"}]}`,
+			http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+		})
+	}
+}
+
+func TestListPermissionsHandler_OtherUserWithoutServiceAccount(t *testing.T) {
+	r := newPermissionsRouter(models.User{ID: "auth0|u1"})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/permissions/check?scopeType=project&scopeId=p1&userId=auth0|u2", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Only service accounts")
+}
+
+func TestExplainPermissionHandler_RequiresAction(t *testing.T) {
+	r := newPermissionsRouter(models.User{ID: "auth0|u1"})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/permissions/explain?scopeType=project&scopeId=p1", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "action")
+}
+
+func TestRBACScopeFromParams(t *testing.T) {
+	tests := []struct {
+		name      string
+		params    gin.Params
+		scopeType string
+		scopeID   string
+	}{
+		{"organization", gin.Params{{Key: "orgId", Value: "o1"}}, "organization", "o1"},
+		{"project", gin.Params{{Key: "projectId", Value: "p1"}}, "project", "p1"},
+		{"resource", gin.Params{{Key: "projectId", Value: "p1"}, {Key: "resourceId", Value: "r1"}}, "resource", "r1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Params = tt.params
+			scopeType, scopeID, err := rbacScopeFromParams(c)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.scopeType, scopeType)
+			assert.Equal(t, tt.scopeID, scopeID)
+		})
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	_, _, err := rbacScopeFromParams(c)
+	assert.ErrorIs(t, err, service.ErrValidation)
+}
+
+func TestAcceptInvitation_RejectsServiceAccounts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{}
+	r := gin.New()
+	r.Use(ErrorHandlerMiddleware())
+	r.Use(func(c *gin.Context) { c.Set("user", models.User{ID: "client@clients", IsServiceAccount: true}) })
+	r.POST("/invitations/accept", h.AcceptInvitation)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/invitations/accept", strings.NewReader(`{"token": "t"}`)))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestCurrentUserHandlers_RejectTokensAndServiceAccounts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name string
+		user models.User
+	}{
+		{"service account", models.User{ID: "client@clients", IsServiceAccount: true}},
+		{"personal access token", models.User{ID: "auth0|u1", AccessTokenID: "pat-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{}
+			r := gin.New()
+			r.Use(ErrorHandlerMiddleware())
+			r.Use(func(c *gin.Context) { c.Set("user", tt.user) })
+			r.PUT("/me", h.UpdateProfile)
+			r.DELETE("/me", h.DeleteAccount)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/me", strings.NewReader(`{"name": "New Name"}`)))
+			assert.Equal(t, http.StatusForbidden, w.Code)
+
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/me", nil))
+			assert.Equal(t, http.StatusForbidden, w.Code)
+		})
+	}
+}
+
+func TestGetUsage_RejectsInvalidPeriod(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{MeteringService: &service.MeteringService{}}
+	r := gin.New()
+	r.Use(ErrorHandlerMiddleware())
+	r.GET("/projects/:projectId/billing/usage", h.GetUsage)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/projects/p1/billing/usage?from=yesterday", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestInvoiceHandlers_RejectInvalidParameters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{}
+	r := gin.New()
+	r.Use(ErrorHandlerMiddleware())
+	r.GET("/organizations/:orgId/billing/invoices", h.ListInvoices)
+	r.GET("/organizations/:orgId/billing/invoices/export", h.ExportInvoiceLines)
+
+	for _, target := range []string{
+		"/organizations/acme/billing/invoices?limit=ten",
+		"/organizations/acme/billing/invoices?limit=0",
+		"/organizations/acme/billing/invoices/export?to=2026-03-31",
+		"/organizations/acme/billing/invoices/export?from=2026-03-01&to=March",
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, target)
+	}
+}
+
+func TestCustomMethods(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ErrorHandlerMiddleware())
+	reply := func(c *gin.Context) {
+		c.String(http.StatusOK, c.Param("projectId")+"/"+c.Param("collection")+c.Param("resourceId"))
+	}
+	project := r.Group("/projects/:projectId")
+	project.POST("/:collection", customMethods("collection", "resources", map[string]gin.HandlerFunc{"estimate": reply}))
+	project.POST("/resources", func(c *gin.Context) { c.String(http.StatusCreated, "create") })
+	project.POST("/resources/:resourceId", customMethods("resourceId", "", map[string]gin.HandlerFunc{"estimate-update": reply}))
+
+	tests := []struct {
+		target string
+		code   int
+		body   string
+	}{
+		{"/projects/p1/resources:estimate", http.StatusOK, "p1/resources"},
+		{"/projects/p1/resources/r1:estimate-update", http.StatusOK, "p1/r1"},
+		{"/projects/p1/resources", http.StatusCreated, "create"},
+		{"/projects/p1/secrets:estimate", http.StatusNotFound, ""},
+		{"/projects/p1/resources:delete", http.StatusNotFound, ""},
+		{"/projects/p1/resources/r1", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.target, nil))
+		assert.Equal(t, tt.code, w.Code, tt.target)
+		if tt.body != "" {
+			assert.Equal(t, tt.body, w.Body.String(), tt.target)
+		}
+	}
+}
+
+func TestUpdateBillingTrial_RejectsInvalidLength(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{}
+	r := gin.New()
+	r.Use(ErrorHandlerMiddleware())
+	r.PUT("/organizations/:orgId/billing/trial", h.UpdateBillingTrial)
+
+	for _, body := range []string{`{"trial_days": -1}`, `{"trial_days": 1000}`, `{"trial_days": "two weeks"}`} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/organizations/acme/billing/trial", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+func TestUpdateBillingInterval_RejectsUnknownInterval(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{}
+	r := gin.New()
+	r.Use(ErrorHandlerMiddleware())
+	r.PUT("/organizations/:orgId/billing/interval", h.UpdateBillingInterval)
+
+	for _, body := range []string{`{}`, `{"interval": "week"}`, `{"interval": "yearly"}`} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/organizations/acme/billing/interval", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+func TestUpdateBillingContacts_RejectsInvalidContacts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{}
+	r := gin.New()
+	r.Use(ErrorHandlerMiddleware())
+	r.PUT("/organizations/:orgId/billing/contacts", h.UpdateBillingContacts)
+
+	for _, body := range []string{
+		`{}`,
+		`{"contacts": []}`,
+		`{"contacts": [{"email": "not-an-email", "roles": ["invoices"]}]}`,
+		`{"contacts": [{"email": "billing@example.com", "roles": ["marketing"]}]}`,
+		`{"contacts": [{"email": "billing@example.com", "roles": []}]}`,
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/organizations/acme/billing/contacts", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+// fakePermissions grants the listed actions per "scopeType/scopeID".
+type fakePermissions map[string][]string
+
+func (f fakePermissions) CheckPermission(ctx context.Context, userID, action, scopeType, scopeID string) (bool, error) {
+	return slices.Contains(f[scopeType+"/"+scopeID], action), nil
+}
+
+// inheritingProjects resolves every project to the organization acme, which pays for it.
+type inheritingProjects struct{}
+
+func (inheritingProjects) ResolveBillingScope(ctx context.Context, scopeType, scopeID string) (string, string, error) {
+	if scopeType == "project" {
+		return "organization", "acme", nil
+	}
+	return scopeType, scopeID, nil
+}
+
+// newInheritingBillingRouter serves the billing handlers registered by routes under
+// /projects/:projectId/billing for a user holding permissions, where project p1 inherits
+// its billing from the organization acme.
+func newInheritingBillingRouter(permissions fakePermissions, routes func(billing *gin.RouterGroup, h *Handler)) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{permissions: permissions, billingScopes: inheritingProjects{}}
+	r := gin.New()
+	r.Use(ErrorHandlerMiddleware())
+	r.Use(func(c *gin.Context) { c.Set("user", models.User{ID: "auth0|u1"}) })
+	routes(r.Group("/projects/:projectId/billing"), h)
+	return r
+}
+
+func TestBillingHandlers_RequirePermissionOnPayingOrganization(t *testing.T) {
+	// A project billing manager who can only read the organization
+	r := newInheritingBillingRouter(fakePermissions{
+		"project/p1":        {"read", "manage_billing"},
+		"organization/acme": {"read"},
+	}, func(billing *gin.RouterGroup, h *Handler) {
+		billing.GET("", h.GetBillingInfo)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/projects/p1/billing", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "organization paying for this project")
+}
+
+func TestGetBillingStatus_RequiresReadOnPayingOrganization(t *testing.T) {
+	// A project reader outside the organization cannot see its payment methods
+	r := newInheritingBillingRouter(fakePermissions{"project/p1": {"read"}}, func(billing *gin.RouterGroup, h *Handler) {
+		billing.GET("/status", h.GetBillingStatus)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/projects/p1/billing/status", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/projects/p2/billing/status", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code, "the project itself is checked first")
+}
+
+func TestBillingAddressHandlers_RequireManageBillingOnPayingOrganization(t *testing.T) {
+	r := newInheritingBillingRouter(fakePermissions{"project/p1": {"read", "manage_billing"}}, func(billing *gin.RouterGroup, h *Handler) {
+		billing.GET("/address", h.GetBillingAddress)
+		billing.PUT("/address", h.UpdateBillingAddress)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/projects/p1/billing/address", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/projects/p1/billing/address", strings.NewReader(
+		`{"address": {"line1": "1 Main St", "city": "Ghent", "postal_code": "9000", "country": "BE"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+}
+
+func TestUpdateBillingInterval_RequiresManageBillingOnPayingOrganization(t *testing.T) {
+	r := newInheritingBillingRouter(fakePermissions{"project/p1": {"read", "manage_billing"}}, func(billing *gin.RouterGroup, h *Handler) {
+		billing.PUT("/interval", h.UpdateBillingInterval)
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/projects/p1/billing/interval", strings.NewReader(`{"interval": "year"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+}
+
+func TestBillingContactsHandlers_RequireManageBillingOnPayingOrganization(t *testing.T) {
+	r := newInheritingBillingRouter(fakePermissions{"project/p1": {"read", "manage_billing"}}, func(billing *gin.RouterGroup, h *Handler) {
+		billing.GET("/contacts", h.GetBillingContacts)
+		billing.PUT("/contacts", h.UpdateBillingContacts)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/projects/p1/billing/contacts", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/projects/p1/billing/contacts", strings.NewReader(
+		`{"contacts": [{"email": "billing@example.com", "roles": ["invoices"]}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+}
+
+func TestInvoiceHandlers_RequireManageBillingOnPayingOrganization(t *testing.T) {
+	r := newInheritingBillingRouter(fakePermissions{"project/p1": {"read", "manage_billing"}}, func(billing *gin.RouterGroup, h *Handler) {
+		billing.GET("/invoices", h.ListInvoices)
+		billing.GET("/invoices/export", h.ExportInvoiceLines)
+		billing.GET("/invoices/:invoiceId", h.GetInvoice)
+	})
+
+	for _, path := range []string{
+		"/projects/p1/billing/invoices",
+		"/projects/p1/billing/invoices/export?from=2026-01-01&to=2026-02-01",
+		"/projects/p1/billing/invoices/in_1",
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusForbidden, w.Code, "%s: %s", path, w.Body.String())
+	}
+}
+
+func TestStripeSetupHandlers_RejectProjectsInheritingBilling(t *testing.T) {
+	routes := func(billing *gin.RouterGroup, h *Handler) {
+		billing.POST("/setup-intent", h.CreateStripeSetupIntent)
+		billing.POST("/customer", h.CreateStripeCustomer)
+		billing.POST("/subscription", h.CreateStripeSubscription)
+		billing.POST("/portal", h.CreateStripeCustomerPortal)
+		billing.DELETE("/subscription", h.CancelSubscription)
+	}
+	requests := []struct{ method, path, body string }{
+		{http.MethodPost, "/projects/p1/billing/setup-intent", ""},
+		{http.MethodPost, "/projects/p1/billing/customer", `{}`},
+		{http.MethodPost, "/projects/p1/billing/subscription", `{}`},
+		{http.MethodPost, "/projects/p1/billing/portal", `{"return_url": "https://example.com"}`},
+		{http.MethodDelete, "/projects/p1/billing/subscription", ""},
+	}
+	serve := func(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// A project billing manager cannot manage the organization's Stripe customer
+	r := newInheritingBillingRouter(fakePermissions{"project/p1": {"read", "manage_billing"}}, routes)
+	for _, tt := range requests {
+		w := serve(r, tt.method, tt.path, tt.body)
+		assert.Equal(t, http.StatusForbidden, w.Code, "%s %s: %s", tt.method, tt.path, w.Body.String())
+	}
+
+	// Neither can an organization billing manager set one up apart for the project
+	r = newInheritingBillingRouter(fakePermissions{
+		"project/p1":        {"read", "manage_billing"},
+		"organization/acme": {"read", "manage_billing"},
+	}, routes)
+	for _, tt := range requests {
+		w := serve(r, tt.method, tt.path, tt.body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "%s %s: %s", tt.method, tt.path, w.Body.String())
+		assert.Contains(t, w.Body.String(), "billed to organization acme")
+	}
+}
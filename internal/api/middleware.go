@@ -2,6 +2,7 @@ package api
 
 import (
 	"fmt"
+	"ktrlplane/internal/service"
 	"log"
 	"runtime/debug"
 	"time"
@@ -21,7 +22,7 @@ func ErrorLoggerMiddleware() gin.HandlerFunc {
 	}
 }
 
-// CustomRecoveryMiddleWare recovers from panics and returns a JSON error response.
+// CustomRecoveryMiddleWare recovers from panics and returns a problem+json 500 response.
 func CustomRecoveryMiddleWare() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		defer func() {
@@ -29,13 +30,8 @@ func CustomRecoveryMiddleWare() gin.HandlerFunc {
 				// Log the error
  				log.Printf("Panic occurred: %v\nStacktrace:\n%s", err, debug.Stack())
 
-				// Return a unified error response
-				c.JSON(500, gin.H{
-					"code":    500,
-					"message": "Internal Server Error",
-					"error":   fmt.Sprintf("%v", err),
-				})
-				c.Abort() // Stop further execution
+				// Return a unified error response without exposing the panic value
+				writeProblem(c, fmt.Errorf("panic: %v", err))
 			}
 		}()
 		c.Next()
@@ -48,8 +44,17 @@ func CORSMiddleware() gin.HandlerFunc {
 		AllowAllOrigins:  true,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	})
 }
+
+// PermissionMemoMiddleware gives each request its own permission memo, so that a
+// scope is checked against the database at most once per request.
+func PermissionMemoMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(service.WithPermissionMemo(c.Request.Context()))
+		c.Next()
+	}
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"fmt"
 	"ktrlplane/internal/service"
+	"ktrlplane/internal/telemetry"
 	"log"
 	"net/http"
 	"net/http/httputil"
@@ -35,6 +36,7 @@ func (ps *ProxyService) LogsProxy() http.Handler {
 	}
 
 	proxy := httputil.NewSingleHostReverseProxy(ps.lokiURL)
+	proxy.Transport = telemetry.Transport("loki", nil, telemetry.PrometheusRoute)
 
 	proxy.Director = func(req *http.Request) {
 		ctx := req.Context()
@@ -118,6 +120,7 @@ func (ps *ProxyService) MetricsProxy() http.Handler {
 	}
 
 	proxy := httputil.NewSingleHostReverseProxy(ps.mimirURL)
+	proxy.Transport = telemetry.Transport("mimir", nil, telemetry.PrometheusRoute)
 
 	proxy.Director = func(req *http.Request) {
 		ctx := req.Context()
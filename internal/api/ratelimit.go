@@ -0,0 +1,72 @@
+package api
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ktrlplane/internal/models"
+	"ktrlplane/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitMiddleware applies group's token bucket budget to the caller.
+// Authenticated callers are limited per user or service account; anonymous
+// callers per client IP. A nil limiter disables rate limiting.
+// Store failures are logged and the request is let through.
+func RateLimitMiddleware(limiter *ratelimit.Limiter, group string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		result, err := limiter.Allow(c.Request.Context(), group, rateLimitKey(c))
+		if err != nil {
+			log.Printf("[RateLimit] %v", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			detail := "Rate limit exceeded. Please retry later."
+			c.Header("Content-Type", problemContentType)
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, Problem{
+				Type:     "urn:ktrlplane:problem:rate-limited",
+				Title:    http.StatusText(http.StatusTooManyRequests),
+				Status:   http.StatusTooManyRequests,
+				Detail:   detail,
+				Instance: c.Request.URL.Path,
+				Error:    detail,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimitKey identifies the caller: "sa:<client id>", "user:<id>" or "ip:<address>".
+func rateLimitKey(c *gin.Context) string {
+	if value, exists := c.Get("user"); exists {
+		if user, ok := value.(models.User); ok && user.ID != "" {
+			if user.IsServiceAccount {
+				return "sa:" + user.ID
+			}
+			return "user:" + user.ID
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// ceilSeconds rounds d up to whole seconds for use in headers.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ktrlplane/internal/config"
+	"ktrlplane/internal/models"
+	"ktrlplane/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRateLimitedRouter(limiter *ratelimit.Limiter, user *models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if user != nil {
+		r.Use(func(c *gin.Context) { c.Set("user", *user) })
+	}
+	r.Use(RateLimitMiddleware(limiter, ratelimit.GroupSearch))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func TestRateLimitMiddleware_Returns429WithHeaders(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), map[string]ratelimit.Limit{
+		ratelimit.GroupSearch: ratelimit.PerMinute(60, 1),
+	})
+	r := newRateLimitedRouter(limiter, &models.User{ID: "auth0|u1"})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, problemContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "Rate limit exceeded")
+}
+
+func TestRateLimitMiddleware_NilLimiter(t *testing.T) {
+	r := newRateLimitedRouter(nil, nil)
+	for i := 0; i < 5; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.RemoteAddr = "203.0.113.7:1234"
+	assert.Equal(t, "ip:203.0.113.7", rateLimitKey(c))
+
+	c.Set("user", models.User{ID: "auth0|u1"})
+	assert.Equal(t, "user:auth0|u1", rateLimitKey(c))
+
+	c.Set("user", models.User{ID: "client123@clients", IsServiceAccount: true})
+	assert.Equal(t, "sa:client123@clients", rateLimitKey(c))
+}
+
+func TestSetupRouter_SpoofedForwardedForSharesBucket(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), map[string]ratelimit.Limit{
+		ratelimit.GroupPublic: ratelimit.PerMinute(60, 1),
+	})
+	pricing := func(r *gin.Engine, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/resource-pricing", nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Without trusted proxies the header is ignored
+	r, err := SetupRouter(&Handler{RateLimiter: limiter}, config.ServerConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, pricing(r, "198.51.100.1"))
+	assert.Equal(t, http.StatusTooManyRequests, pricing(r, "198.51.100.2"))
+
+	// Behind a trusted proxy each forwarded client has its own bucket
+	limiter = ratelimit.NewLimiter(ratelimit.NewMemoryStore(), map[string]ratelimit.Limit{
+		ratelimit.GroupPublic: ratelimit.PerMinute(60, 1),
+	})
+	r, err = SetupRouter(&Handler{RateLimiter: limiter}, config.ServerConfig{TrustedProxies: []string{"203.0.113.0/24"}})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, pricing(r, "198.51.100.1"))
+	assert.Equal(t, http.StatusBadRequest, pricing(r, "198.51.100.2"))
+	assert.Equal(t, http.StatusTooManyRequests, pricing(r, "198.51.100.1"))
+
+	_, err = SetupRouter(&Handler{}, config.ServerConfig{TrustedProxies: []string{"not-an-ip"}})
+	assert.Error(t, err)
+}
@@ -3,20 +3,39 @@ package api
 
 import (
 	"context"
+	"fmt"
 	"ktrlplane/internal/auth" // Import auth package
+	"ktrlplane/internal/config"
 	"ktrlplane/internal/db"
+	"ktrlplane/internal/ratelimit"
+	"ktrlplane/internal/telemetry"
+	"ktrlplane/internal/service"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 // SetupRouter configures the Gin router with all routes and middleware.
-func SetupRouter(handler *Handler) *gin.Engine {
+func SetupRouter(handler *Handler, cfg config.ServerConfig) (*gin.Engine, error) {
 	r := gin.New()
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	// Handlers pass *gin.Context to services; fall back to the request context so
+	// that values such as the permission memo and trace span are visible.
+	r.ContextWithFallback = true
+	r.Use(otelgin.Middleware(telemetry.DefaultServiceName, otelgin.WithFilter(func(req *http.Request) bool {
+		return req.URL.Path != "/health"
+	})))
 	r.Use(gin.Logger())
 	r.Use(CustomRecoveryMiddleWare())
 	r.Use(ErrorLoggerMiddleware())
+	r.Use(ErrorHandlerMiddleware())
 	r.Use(CORSMiddleware())
+	r.Use(PermissionMemoMiddleware())
 
 	// --- Public Routes (Example: Health Check) ---
 	r.GET("/health", func(c *gin.Context) {
@@ -46,18 +65,41 @@ func SetupRouter(handler *Handler) *gin.Engine {
 	apiV1 := r.Group("/api/v1")
 	
 	// Public route to get resource tier pricing info
-	apiV1.GET("/resource-pricing", handler.GetResourceTierPrice) // Get resource tier pricing info
+	apiV1.GET("/resource-pricing", RateLimitMiddleware(handler.RateLimiter, ratelimit.GroupPublic), handler.GetResourceTierPrice) // Get resource tier pricing info
+	// Public OAuth 2.0 token endpoint for service account client secrets
+	apiV1.POST("/oauth/token", RateLimitMiddleware(handler.RateLimiter, ratelimit.GroupPublic), handler.IssueServiceAccountToken)
 
 	// Apply Auth middleware to all other /api/v1 routes
 	apiV1.Use(auth.Middleware()) // Enable Auth middleware
+	apiV1.Use(RateLimitMiddleware(handler.RateLimiter, ratelimit.GroupDefault))
 	{
 		// --- Global Resource Routes ---
 		apiV1.GET("/resources", handler.ListAllResources) // List all resources user has access to (across projects)
 		// --- Global RBAC Routes ---
 		apiV1.GET("/roles", handler.ListRoles)                               // List all available roles
 		apiV1.GET("/roles/:roleId/permissions", handler.ListRolePermissions) // List permissions for a specific role
-		apiV1.GET("/users/search", handler.SearchUsers)                      // Search users
+		apiV1.GET("/users/search", RateLimitMiddleware(handler.RateLimiter, ratelimit.GroupSearch), handler.SearchUsers) // Search users
 		apiV1.GET("/permissions/check", handler.ListPermissionsHandler)      // List all permissions for current user/scope
+		apiV1.GET("/permissions/explain", handler.ExplainPermissionHandler)  // Explain a permission decision
+		apiV1.POST("/permissions/:collection", customMethods("collection", "check", map[string]gin.HandlerFunc{
+			"batch": handler.BatchCheckPermissionsHandler, // POST /permissions/check:batch, check many permissions at once
+		}))
+		apiV1.POST("/invitations/accept", handler.AcceptInvitation)         // Accept an invitation token
+		apiV1.POST("/users/me/link-tokens", handler.CreateAccountLinkToken) // Issue a token to link this account to another identity
+		apiV1.POST("/users/me/links", handler.LinkAccount)                  // Merge the account that issued a link token into the current user
+		apiV1.POST("/admin/users/merge", handler.MergeUsers)                // Merge two user records (manage_users at global scope)
+
+		// --- Current User Routes ---
+		me := apiV1.Group("/me")
+		{
+			me.GET("", handler.GetProfile)                                   // Get the current user's profile
+			me.PUT("", handler.UpdateProfile)                                // Update the current user's display name
+			me.DELETE("", handler.DeleteAccount)                             // Delete the current user's account
+			me.GET("/access", handler.GetAccessSummary)                      // List reachable scopes with the effective role at each
+			me.GET("/tokens", handler.ListPersonalAccessTokens)              // List personal access tokens
+			me.POST("/tokens", handler.CreatePersonalAccessToken)            // Create personal access token
+			me.DELETE("/tokens/:tokenId", handler.RevokePersonalAccessToken) // Revoke personal access token
+		}
 
 		// --- Organization Routes ---
 		organizations := apiV1.Group("/organizations")
@@ -74,13 +116,47 @@ func SetupRouter(handler *Handler) *gin.Engine {
 				// Organization RBAC routes
 				orgRBAC := organizationDetail.Group("/rbac")
 				{
-					orgRBAC.GET("", handler.ListOrganizationRoleAssignments)                   // List role assignments
-					orgRBAC.POST("", handler.CreateOrganizationRoleAssignment)                 // Assign role
-					orgRBAC.DELETE("/:assignmentId", handler.DeleteOrganizationRoleAssignment) // Remove role assignment
+					orgRBAC.GET("", handler.ListOrganizationRoleAssignments)                          // List role assignments
+					orgRBAC.POST("", handler.CreateOrganizationRoleAssignment)                        // Assign role
+					orgRBAC.DELETE("/:assignmentId", handler.DeleteOrganizationRoleAssignment)        // Remove role assignment
+					orgRBAC.GET("/access-requests", handler.ListAccessRequests)                       // List access requests
+					orgRBAC.POST("/access-requests", handler.CreateAccessRequest)                     // Request temporary elevated access
+					orgRBAC.POST("/access-requests/:requestId/approve", handler.ApproveAccessRequest) // Approve access request (Owner)
+					orgRBAC.POST("/access-requests/:requestId/deny", handler.DenyAccessRequest)       // Deny access request (Owner)
+					orgRBAC.GET("/invitations", handler.ListInvitations)                              // List invitations
+					orgRBAC.POST("/invitations", handler.CreateInvitation)                            // Invite by email
+					orgRBAC.POST("/invitations/:invitationId/resend", handler.ResendInvitation)       // Resend invitation
+					orgRBAC.POST("/invitations/:invitationId/revoke", handler.RevokeInvitation)       // Revoke invitation
+				}
+
+				// Organization team routes
+				orgTeams := organizationDetail.Group("/teams")
+				{
+					orgTeams.GET("", handler.ListTeams)                                   // List teams
+					orgTeams.POST("", handler.CreateTeam)                                 // Create team
+					orgTeams.GET("/:teamId", handler.GetTeam)                             // Get team
+					orgTeams.PUT("/:teamId", handler.UpdateTeam)                          // Update team
+					orgTeams.DELETE("/:teamId", handler.DeleteTeam)                       // Delete team
+					orgTeams.GET("/:teamId/members", handler.ListTeamMembers)             // List team members
+					orgTeams.POST("/:teamId/members", handler.AddTeamMember)              // Add team member
+					orgTeams.DELETE("/:teamId/members/:userId", handler.RemoveTeamMember) // Remove team member
+				}
+
+				// Organization service account routes
+				orgServiceAccounts := organizationDetail.Group("/service-accounts")
+				{
+					orgServiceAccounts.GET("", handler.ListServiceAccounts)                                               // List service accounts
+					orgServiceAccounts.POST("", handler.CreateServiceAccount)                                             // Create service account
+					orgServiceAccounts.GET("/:serviceAccountId", handler.GetServiceAccount)                               // Get service account
+					orgServiceAccounts.PUT("/:serviceAccountId", handler.UpdateServiceAccount)                            // Update, disable or re-enable service account
+					orgServiceAccounts.DELETE("/:serviceAccountId", handler.DeleteServiceAccount)                         // Delete service account
+					orgServiceAccounts.GET("/:serviceAccountId/secrets", handler.ListServiceAccountSecrets)               // List client secrets
+					orgServiceAccounts.POST("/:serviceAccountId/secrets", handler.CreateServiceAccountSecret)             // Create client secret
+					orgServiceAccounts.DELETE("/:serviceAccountId/secrets/:secretId", handler.DeleteServiceAccountSecret) // Delete client secret
 				}
 
 				// Organization Billing routes
-				orgBilling := organizationDetail.Group("/billing")
+				orgBilling := organizationDetail.Group("/billing", RateLimitMiddleware(handler.RateLimiter, ratelimit.GroupBilling))
 				{
 					orgBilling.GET("", handler.GetBillingInfo)                                // Get billing information
 					orgBilling.POST("/customer", handler.CreateStripeCustomer)                // Create Stripe customer
@@ -89,6 +165,17 @@ func SetupRouter(handler *Handler) *gin.Engine {
 					orgBilling.POST("/cancel", handler.CancelSubscription)                    // Cancel subscription
 					orgBilling.GET("/billing/status", handler.GetBillingStatus)               // Billing status endpoint for onboarding/payment enforcement
 					orgBilling.POST("/billing/setup-intent", handler.CreateStripeSetupIntent) // Stripe SetupIntent endpoint for payment onboarding
+					orgBilling.GET("/invoices", handler.ListInvoices)                         // Invoice history
+					orgBilling.GET("/invoices/export", handler.ExportInvoiceLines)            // CSV export of invoice lines
+					orgBilling.GET("/invoices/:invoiceId", handler.GetInvoice)                // Invoice with lines, credit notes and PDF link
+					orgBilling.GET("/trial", handler.GetBillingTrial)                         // Trial granted to the account
+					orgBilling.PUT("/trial", handler.UpdateBillingTrial)                      // Grant a trial length (manage_billing at global scope)
+					orgBilling.POST("/discount", handler.ApplyBillingDiscount)                // Apply a promotion code or coupon to the subscription
+					orgBilling.PUT("/interval", handler.UpdateBillingInterval)                // Switch between monthly and annual billing
+					orgBilling.GET("/address", handler.GetBillingAddress)                     // Billing address, tax IDs and currency
+					orgBilling.PUT("/address", handler.UpdateBillingAddress)                  // Set the billing address and add a tax ID
+					orgBilling.GET("/contacts", handler.GetBillingContacts)                   // Emails receiving invoices and billing alerts
+					orgBilling.PUT("/contacts", handler.UpdateBillingContacts)                // Replace the billing contacts
 				}
 			}
 		}
@@ -108,13 +195,34 @@ func SetupRouter(handler *Handler) *gin.Engine {
 				// Project RBAC routes
 				projectRBAC := projectDetail.Group("/rbac")
 				{
-					projectRBAC.GET("", handler.ListProjectRoleAssignments)                   // List role assignments
-					projectRBAC.POST("", handler.CreateProjectRoleAssignment)                 // Assign role
-					projectRBAC.DELETE("/:assignmentId", handler.DeleteProjectRoleAssignment) // Remove role assignment
+					projectRBAC.GET("", handler.ListProjectRoleAssignments)                               // List role assignments
+					projectRBAC.POST("", handler.CreateProjectRoleAssignment)                             // Assign role
+					projectRBAC.DELETE("/:assignmentId", handler.DeleteProjectRoleAssignment)             // Remove role assignment
+					projectRBAC.GET("/access-requests", handler.ListAccessRequests)                       // List access requests
+					projectRBAC.POST("/access-requests", handler.CreateAccessRequest)                     // Request temporary elevated access
+					projectRBAC.POST("/access-requests/:requestId/approve", handler.ApproveAccessRequest) // Approve access request (Owner)
+					projectRBAC.POST("/access-requests/:requestId/deny", handler.DenyAccessRequest)       // Deny access request (Owner)
+					projectRBAC.GET("/invitations", handler.ListInvitations)                              // List invitations
+					projectRBAC.POST("/invitations", handler.CreateInvitation)                            // Invite by email
+					projectRBAC.POST("/invitations/:invitationId/resend", handler.ResendInvitation)       // Resend invitation
+					projectRBAC.POST("/invitations/:invitationId/revoke", handler.RevokeInvitation)       // Revoke invitation
+				}
+
+				// Project service account routes
+				projectServiceAccounts := projectDetail.Group("/service-accounts")
+				{
+					projectServiceAccounts.GET("", handler.ListServiceAccounts)                                               // List service accounts
+					projectServiceAccounts.POST("", handler.CreateServiceAccount)                                             // Create service account
+					projectServiceAccounts.GET("/:serviceAccountId", handler.GetServiceAccount)                               // Get service account
+					projectServiceAccounts.PUT("/:serviceAccountId", handler.UpdateServiceAccount)                            // Update, disable or re-enable service account
+					projectServiceAccounts.DELETE("/:serviceAccountId", handler.DeleteServiceAccount)                         // Delete service account
+					projectServiceAccounts.GET("/:serviceAccountId/secrets", handler.ListServiceAccountSecrets)               // List client secrets
+					projectServiceAccounts.POST("/:serviceAccountId/secrets", handler.CreateServiceAccountSecret)             // Create client secret
+					projectServiceAccounts.DELETE("/:serviceAccountId/secrets/:secretId", handler.DeleteServiceAccountSecret) // Delete client secret
 				}
 
 				// Project Billing routes
-				projectBilling := projectDetail.Group("/billing")
+				projectBilling := projectDetail.Group("/billing", RateLimitMiddleware(handler.RateLimiter, ratelimit.GroupBilling))
 				{
 					projectBilling.GET("", handler.GetBillingInfo)                         // Get billing information
 					projectBilling.POST("/customer", handler.CreateStripeCustomer)         // Create Stripe customer
@@ -123,13 +231,32 @@ func SetupRouter(handler *Handler) *gin.Engine {
 					projectBilling.POST("/cancel", handler.CancelSubscription)             // Cancel subscription
 					projectBilling.GET("/status", handler.GetBillingStatus)                // Billing status endpoint for onboarding/payment enforcement
 					projectBilling.POST("/setup-intent", handler.CreateStripeSetupIntent)  // Stripe SetupIntent endpoint for payment onboarding
+					projectBilling.PUT("/inheritance", handler.UpdateBillingInheritance)   // Move between organization and project billing
+					projectBilling.GET("/usage", handler.GetUsage)                         // Metered hourly usage of the project's resources
+					projectBilling.GET("/invoices", handler.ListInvoices)                  // Invoice history
+					projectBilling.GET("/invoices/export", handler.ExportInvoiceLines)     // CSV export of invoice lines
+					projectBilling.GET("/invoices/:invoiceId", handler.GetInvoice)         // Invoice with lines, credit notes and PDF link
+					projectBilling.GET("/trial", handler.GetBillingTrial)                  // Trial granted to the account
+					projectBilling.PUT("/trial", handler.UpdateBillingTrial)               // Grant a trial length (manage_billing at global scope)
+					projectBilling.POST("/discount", handler.ApplyBillingDiscount)         // Apply a promotion code or coupon to the subscription
+					projectBilling.PUT("/interval", handler.UpdateBillingInterval)         // Switch between monthly and annual billing
+					projectBilling.GET("/address", handler.GetBillingAddress)              // Billing address, tax IDs and currency
+					projectBilling.PUT("/address", handler.UpdateBillingAddress)           // Set the billing address and add a tax ID
+					projectBilling.GET("/contacts", handler.GetBillingContacts)            // Emails receiving invoices and billing alerts
+					projectBilling.PUT("/contacts", handler.UpdateBillingContacts)         // Replace the billing contacts
 				}
 
 				// --- Resource Routes (nested under project) ---
+				projectDetail.POST("/:collection", customMethods("collection", "resources", map[string]gin.HandlerFunc{
+					"estimate": handler.EstimateResource, // POST /resources:estimate, preview the cost of a new resource (Editor role)
+				}))
 				resources := projectDetail.Group("/resources")
 				{
 					resources.POST("", handler.CreateResource) // Create Resource (Editor role)
 					resources.GET("", handler.ListResources)   // List resources in the project (Viewer role)
+					resources.POST("/:resourceId", customMethods("resourceId", "", map[string]gin.HandlerFunc{
+						"estimate-update": handler.EstimateResourceUpdate, // POST /resources/:resourceId:estimate-update, preview the cost of a SKU change (Editor role)
+					}))
 
 					resourceDetail := resources.Group("/:resourceId")
 					{
@@ -140,9 +267,17 @@ func SetupRouter(handler *Handler) *gin.Engine {
 						// Resource RBAC routes
 						resourceRBAC := resourceDetail.Group("/rbac")
 						{
-							resourceRBAC.GET("", handler.ListResourceRoleAssignments)                   // List role assignments
-							resourceRBAC.POST("", handler.CreateResourceRoleAssignment)                 // Assign role
-							resourceRBAC.DELETE("/:assignmentId", handler.DeleteResourceRoleAssignment) // Remove role assignment
+							resourceRBAC.GET("", handler.ListResourceRoleAssignments)                              // List role assignments
+							resourceRBAC.POST("", handler.CreateResourceRoleAssignment)                            // Assign role
+							resourceRBAC.DELETE("/:assignmentId", handler.DeleteResourceRoleAssignment)            // Remove role assignment
+							resourceRBAC.GET("/access-requests", handler.ListAccessRequests)                       // List access requests
+							resourceRBAC.POST("/access-requests", handler.CreateAccessRequest)                     // Request temporary elevated access
+							resourceRBAC.POST("/access-requests/:requestId/approve", handler.ApproveAccessRequest) // Approve access request (Owner)
+							resourceRBAC.POST("/access-requests/:requestId/deny", handler.DenyAccessRequest)       // Deny access request (Owner)
+							resourceRBAC.GET("/invitations", handler.ListInvitations)                              // List invitations
+							resourceRBAC.POST("/invitations", handler.CreateInvitation)                            // Invite by email
+							resourceRBAC.POST("/invitations/:invitationId/resend", handler.ResendInvitation)       // Resend invitation
+							resourceRBAC.POST("/invitations/:invitationId/revoke", handler.RevokeInvitation)       // Revoke invitation
 						}
 
 						// --- Logging & Metrics Proxy Endpoints ---
@@ -162,5 +297,26 @@ func SetupRouter(handler *Handler) *gin.Engine {
 		}
 	}
 
-	return r
+	return r, nil
+}
+
+// customMethods serves custom methods such as POST /resources:estimate, where the method
+// follows a colon in the last path segment. Gin cannot route on a colon inside a segment, so
+// the whole segment is captured as param and split here; afterwards param holds the part
+// before the colon. With a collection, that part must be the collection name.
+func customMethods(param, collection string, methods map[string]gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name, method, ok := strings.Cut(c.Param(param), ":")
+		handler, found := methods[method]
+		if !ok || !found || (collection != "" && name != collection) {
+			_ = c.Error(service.NotFound("no route for %s %s", c.Request.Method, c.Request.URL.Path))
+			return
+		}
+		for i := range c.Params {
+			if c.Params[i].Key == param {
+				c.Params[i].Value = name
+			}
+		}
+		handler(c)
+	}
 }
@@ -2,38 +2,22 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"ktrlplane/internal/config"
 	"ktrlplane/internal/db"
 	"ktrlplane/internal/models"
+	"ktrlplane/internal/service"
 	"log"
-	"net/http"
-	"net/url"
 	"strings"
 	"sync"
-	"time"
 
-	"github.com/auth0/go-jwt-middleware/v2/jwks"
-	"github.com/auth0/go-jwt-middleware/v2/validator"
 	"github.com/gin-gonic/gin"
 )
 
-// CustomClaims contains custom data we want to get from the token.
-type CustomClaims struct {
-	Email string `json:"email"`
-	Name  string `json:"name"`
-	Gty   string `json:"gty"` // Grant type - "client-credentials" for M2M tokens
-}
-
-// Validate does nothing for this example, but we need
-// it to satisfy validator.CustomClaims interface.
-// Validate does nothing for this example, but we need it to satisfy validator.CustomClaims interface.
-func (c CustomClaims) Validate(ctx context.Context) error {
-	return nil
-}
-
-// Placeholder for Auth0 configuration needed by middleware
 var (
-	jwtValidator *validator.Validator
+	// trustedIssuers maps the iss claim of each trusted issuer to its validator.
+	trustedIssuers map[string]*trustedIssuer
 
 	// Cache for processed users to avoid repeated DB checks
 	processedUsers = make(map[string]bool)
@@ -43,91 +27,165 @@ var (
 	userLocks sync.Map // map[string]*sync.Mutex
 )
 
-// SetupAuth configures JWT validation for Auth0.
-func SetupAuth(audience, issuer string) error {
-	issuerURL, err := url.Parse(issuer)
-	if err != nil {
-		return fmt.Errorf("failed to parse the issuer url: %w", err)
+// SetupAuth configures JWT validation for every trusted issuer.
+func SetupAuth(cfg config.AuthConfig) error {
+	configs := issuerConfigs(cfg)
+	if len(configs) == 0 && cfg.ServiceAccountTokens.SigningKey == "" {
+		return errors.New("no token issuers configured: set auth.issuers or auth.issuer")
 	}
 
-	provider := jwks.NewCachingProvider(issuerURL, 5*time.Minute)
-
-	jwtValidator, err = validator.New(
-		provider.KeyFunc,
-		validator.RS256,
-		issuerURL.String(),
-		[]string{audience},
-		validator.WithCustomClaims(
-			func() validator.CustomClaims {
-				// Intentionally returns an empty CustomClaims struct to satisfy the validator.CustomClaims interface.
-				return &CustomClaims{}
-			},
-		),
-		validator.WithAllowedClockSkew(time.Minute),
-	)
-	if err != nil {
-		return fmt.Errorf("failed to set up the jwt validator: %w", err)
+	issuers := make(map[string]*trustedIssuer, len(configs))
+	for _, issuerCfg := range configs {
+		if _, exists := issuers[issuerCfg.Issuer]; exists {
+			return fmt.Errorf("issuer %s is configured more than once", issuerCfg.Issuer)
+		}
+		issuer, err := newTrustedIssuer(issuerCfg)
+		if err != nil {
+			return err
+		}
+		if issuerCfg.Issuer != cfg.Issuer {
+			issuer.subjectPrefix = subjectNamespace(issuerCfg.Issuer)
+		}
+		issuers[issuerCfg.Issuer] = issuer
+		log.Printf("Auth JWT validation configured for issuer: %s, audiences: %v, algorithms: %v",
+			issuerCfg.Issuer, issuerCfg.Audiences, issuerCfg.Algorithms)
 	}
 
-	log.Printf("Auth JWT validation configured for issuer: %s, audience: %s", issuer, audience)
+	if key := cfg.ServiceAccountTokens.SigningKey; key != "" {
+		if _, exists := issuers[service.ServiceAccountTokenIssuer]; exists {
+			return fmt.Errorf("issuer %s is reserved for service account tokens", service.ServiceAccountTokenIssuer)
+		}
+		issuer, err := newSigningKeyIssuer(service.ServiceAccountTokenIssuer, []byte(key))
+		if err != nil {
+			return err
+		}
+		issuers[service.ServiceAccountTokenIssuer] = issuer
+		log.Printf("Auth JWT validation configured for KtrlPlane-issued service account tokens")
+	}
+	trustedIssuers = issuers
 	return nil
 }
 
-// Middleware validates the JWT token.
+// validateToken routes a token to the validator of its issuer and maps its claims.
+func validateToken(ctx context.Context, token string) (*identity, error) {
+	alg, iss, err := peekToken(token)
+	if err != nil {
+		return nil, err
+	}
+	issuer, ok := trustedIssuers[iss]
+	if !ok {
+		return nil, errUnknownIssuer
+	}
+	return issuer.validate(ctx, token, alg)
+}
+
+// Middleware validates the JWT or personal access token.
 func Middleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Extract token from Authorization header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			_ = c.Error(service.Unauthorized("Authorization header required"))
 			c.Abort()
 			return
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		if tokenString == authHeader {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Bearer token required"})
+			_ = c.Error(service.Unauthorized("Bearer token required"))
 			c.Abort()
 			return
 		}
 
-		// Validate the token
-		token, err := jwtValidator.ValidateToken(c.Request.Context(), tokenString)
+		// Personal access tokens are opaque and act as their owner, within the token's scope
+		if strings.HasPrefix(tokenString, service.PersonalAccessTokenPrefix) {
+			token, err := service.ResolvePersonalAccessToken(c.Request.Context(), tokenString)
+			if err != nil {
+				_ = c.Error(fmt.Errorf("failed to process access token authentication: %w", err))
+				c.Abort()
+				return
+			}
+			if token == nil {
+				_ = c.Error(service.Unauthorized("Invalid or expired access token"))
+				c.Abort()
+				return
+			}
+			c.Request = c.Request.WithContext(service.WithAccessTokenRestriction(c.Request.Context(), &token.PersonalAccessToken))
+			c.Set("user", models.User{
+				ID:            token.UserID,
+				Email:         token.Email,
+				Name:          displayName(token.Name, token.Email),
+				AccessTokenID: token.TokenID,
+			})
+			c.Next()
+			return
+		}
+
+		// Validate the token against its issuer and map the issuer's claims
+		id, err := validateToken(c.Request.Context(), tokenString)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token", "details": err.Error()})
+			_ = c.Error(service.Wrap(service.ErrUnauthorized, err, "Invalid token"))
 			c.Abort()
 			return
 		}
 
-		// Extract claims
-		claims := token.(*validator.ValidatedClaims)
+		userID := id.UserID
+		name := displayName(id.Name, id.Email)
 
-		// Extract user information from token
-		userID := claims.RegisteredClaims.Subject
-		email := extractEmailFromClaims(claims)
-		name := extractNameFromClaims(claims)
-
-		// Detect if this is a service account (M2M client credentials flow)
-		// M2M tokens have gty (grant type) = "client-credentials"
-		isServiceAccount := isM2MToken(token)
+		// Service accounts (M2M clients) are detected by the issuer's service_account rules.
+		// Managed service accounts act under their own ID; unmanaged clients keep their subject.
+		if id.IsServiceAccount {
+			sa, err := service.ResolveServiceAccount(c.Request.Context(), id.Issuer, id.Subject, id.ClientID)
+			if err != nil {
+				_ = c.Error(fmt.Errorf("failed to process service account authentication: %w", err))
+				c.Abort()
+				return
+			}
+			if sa != nil {
+				if sa.Disabled {
+					_ = c.Error(service.Unauthorized("Service account %s is disabled", sa.ServiceAccountID))
+					c.Abort()
+					return
+				}
+				userID = sa.ServiceAccountID
+				name = sa.Name
+				service.TouchServiceAccount(c.Request.Context(), sa.ServiceAccountID)
+			}
+		}
 
 		// Only ensure user exists for regular users, not service accounts
-		if !isServiceAccount {
-			err = ensureUserExists(c.Request.Context(), userID, email, name)
+		if !id.IsServiceAccount {
+			// A subject linked to another account acts as that account
+			userID, err = service.ResolveUserID(c.Request.Context(), userID)
+			if err != nil {
+				_ = c.Error(fmt.Errorf("failed to process user authentication: %w", err))
+				c.Abort()
+				return
+			}
+
+			err = ensureUserExists(c.Request.Context(), userID, id.Email, name, id.EmailVerified)
 			if err != nil {
 				log.Printf("Failed to ensure user exists: %v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process user authentication"})
+				_ = c.Error(fmt.Errorf("failed to process user authentication: %w", err))
 				c.Abort()
 				return
 			}
+
+			// Teams mapped to IdP groups follow the issuer's groups claim
+			if id.Groups != nil {
+				if err := service.SyncTeamMemberships(c.Request.Context(), userID, id.Issuer, id.Groups); err != nil {
+					log.Printf("Failed to sync team memberships for %s: %v", userID, err)
+				}
+			}
 		}
 
 		// Create user object for context
 		user := models.User{
 			ID:               userID,
-			Email:            email,
+			Email:            id.Email,
 			Name:             name,
-			IsServiceAccount: isServiceAccount,
+			IsServiceAccount: id.IsServiceAccount,
+			Groups:           id.Groups,
 		}
 
 		// Store user in context
@@ -136,64 +194,30 @@ func Middleware() gin.HandlerFunc {
 	}
 }
 
-// isM2MToken checks if a token is from a machine-to-machine (M2M) client credentials flow.
-// M2M tokens from Auth0 contain a "gty" (grant type) claim set to "client-credentials".
-func isM2MToken(token interface{}) bool {
-	if claims, ok := token.(*validator.ValidatedClaims); ok {
-		// Check for gty claim in custom claims
-		if claims.CustomClaims != nil {
-			if customClaims, ok := claims.CustomClaims.(*CustomClaims); ok {
-				return customClaims.Gty == "client-credentials"
-			}
-		}
+// displayName returns the token's name, falling back to the local part of the email.
+func displayName(name, email string) string {
+	if name != "" {
+		return name
 	}
-	return false
-}
-
-// extractEmailFromClaims extracts email from JWT claims.
-func extractEmailFromClaims(claims *validator.ValidatedClaims) string {
-	// First try to get email from custom claims (Auth0 email claim)
-	if claims.CustomClaims != nil {
-		if customClaims, ok := claims.CustomClaims.(*CustomClaims); ok {
-			if customClaims.Email != "" {
-				return customClaims.Email
-			}
-		}
-	}
-
-	// Fallback: Try to get email from subject if it looks like an email
-	if claims.RegisteredClaims.Subject != "" && strings.Contains(claims.RegisteredClaims.Subject, "@") {
-		return claims.RegisteredClaims.Subject
+	if local, _, found := strings.Cut(email, "@"); found && local != "" {
+		return local
 	}
-
-	return "" // Return empty if email not found
+	return "User" // Default name
 }
 
-// extractNameFromClaims extracts name from JWT claims.
-func extractNameFromClaims(claims *validator.ValidatedClaims) string {
-	// First try to get name from custom claims (Auth0 name claim)
-	if claims.CustomClaims != nil {
-		if customClaims, ok := claims.CustomClaims.(*CustomClaims); ok {
-			if customClaims.Name != "" {
-				return customClaims.Name
-			}
-		}
-	}
-
-	// Fallback: extract name from email if available
-	email := extractEmailFromClaims(claims)
-	if email != "" {
-		// Extract name part from email (before @)
-		parts := strings.Split(email, "@")
-		if len(parts) > 0 {
-			return parts[0]
-		}
-	}
-	return "User" // Default name
+// ForgetUser drops userID from the processed-users cache, so that a later request
+// from the same identity creates the user again after it was deleted.
+func ForgetUser(userID string) {
+	userCacheMutex.Lock()
+	delete(processedUsers, userID)
+	userCacheMutex.Unlock()
 }
 
 // ensureUserExists creates or updates a user in the database.
-func ensureUserExists(ctx context.Context, userID, email, name string) error {
+// A placeholder user created for an invited email is only merged into the new user
+// when the IdP has verified that email; otherwise anyone could sign up with an
+// unverified victim address and inherit the victim's pending roles.
+func ensureUserExists(ctx context.Context, userID, email, name string, emailVerified bool) error {
 	// Check cache first to avoid repeated DB calls
 	userCacheMutex.RLock()
 	if processedUsers[userID] {
@@ -212,7 +236,7 @@ func ensureUserExists(ctx context.Context, userID, email, name string) error {
 
 	// First, check if there's a placeholder user with this email (user_id = email)
 	// This handles the invitation scenario where a user was invited before signing up
-	if email != "" {
+	if email != "" && emailVerified {
 		var placeholderUserID, placeholderEmail, placeholderName string
 		placeholderRows, err := pool.Query(ctx, db.FindPlaceholderUserByEmailQuery, email)
 		if err != nil {
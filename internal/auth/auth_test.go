@@ -0,0 +1,372 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ktrlplane/internal/config"
+	"ktrlplane/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testIDP is an OIDC issuer served by httptest, with discovery and a JWKS endpoint.
+type testIDP struct {
+	server *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+}
+
+func newTestIDP(t *testing.T) *testIDP {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	idp := &testIDP{rsaKey: rsaKey, ecKey: ecKey}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   idp.issuer(),
+			"jwks_uri": idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{
+				"kty": "RSA", "kid": "rsa-1", "alg": "RS256", "use": "sig",
+				"n": b64(rsaKey.N.Bytes()),
+				"e": b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				"kty": "EC", "kid": "ec-1", "alg": "ES256", "use": "sig", "crv": "P-256",
+				"x": b64(ecKey.X.FillBytes(make([]byte, 32))),
+				"y": b64(ecKey.Y.FillBytes(make([]byte, 32))),
+			},
+		}})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *testIDP) issuer() string {
+	return idp.server.URL + "/"
+}
+
+// token signs claims with the IdP's RS256 or ES256 key. iss, aud and exp are filled in
+// unless claims sets them.
+func (idp *testIDP) token(t *testing.T, alg string, claims map[string]any) string {
+	t.Helper()
+	payload := map[string]any{
+		"iss": idp.issuer(),
+		"aud": "ktrlplane",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	}
+	for k, v := range claims {
+		payload[k] = v
+	}
+	kid := map[string]string{"RS256": "rsa-1", "ES256": "ec-1"}[alg]
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT", "kid": kid})
+	require.NoError(t, err)
+	body, err := json.Marshal(payload)
+	require.NoError(t, err)
+
+	signingInput := b64(header) + "." + b64(body)
+	digest := sha256.Sum256([]byte(signingInput))
+	var signature []byte
+	switch alg {
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, idp.rsaKey, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, idp.ecKey, digest[:])
+		require.NoError(t, err)
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	default:
+		t.Fatalf("unsupported test algorithm %s", alg)
+	}
+	return signingInput + "." + b64(signature)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// setupIssuers configures the trusted issuers for one test.
+func setupIssuers(t *testing.T, cfg config.AuthConfig) {
+	t.Helper()
+	previous := trustedIssuers
+	require.NoError(t, SetupAuth(cfg))
+	t.Cleanup(func() { trustedIssuers = previous })
+}
+
+func TestValidateToken_MultipleIssuers(t *testing.T) {
+	auth0 := newTestIDP(t)
+	keycloak := newTestIDP(t)
+	setupIssuers(t, config.AuthConfig{Issuer: auth0.issuer(), Issuers: []config.OIDCIssuerConfig{
+		{
+			Issuer:         auth0.issuer(),
+			Audiences:      []string{"ktrlplane"},
+			ServiceAccount: []config.ServiceAccountRule{{Claim: "gty", Value: "client-credentials"}},
+		},
+		{
+			Issuer:         keycloak.issuer(),
+			Audiences:      []string{"other", "ktrlplane"},
+			Algorithms:     []string{"ES256"},
+			Claims:         config.OIDCClaimsConfig{Name: "preferred_username", Groups: "realm_access.roles"},
+			ServiceAccount: []config.ServiceAccountRule{{Claim: "client_id"}},
+		},
+	}})
+	ctx := context.Background()
+
+	id, err := validateToken(ctx, auth0.token(t, "RS256", map[string]any{
+		"sub": "auth0|alice", "email": "alice@example.com", "email_verified": true, "name": "Alice",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, &identity{Issuer: auth0.issuer(), Subject: "auth0|alice", UserID: "auth0|alice", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}, id)
+
+	id, err = validateToken(ctx, keycloak.token(t, "ES256", map[string]any{
+		"sub": "6a1f", "email": "bob@example.com", "preferred_username": "bob",
+		"realm_access": map[string]any{"roles": []string{"admins", "developers"}},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "bob", id.Name)
+	assert.Equal(t, strings.Trim(strings.TrimPrefix(keycloak.issuer(), "http://"), "/")+"|6a1f", id.UserID)
+	assert.False(t, id.EmailVerified, "email_verified is missing")
+	assert.Equal(t, []string{"admins", "developers"}, id.Groups)
+	assert.False(t, id.IsServiceAccount)
+
+	id, err = validateToken(ctx, keycloak.token(t, "ES256", map[string]any{"sub": "svc-1", "client_id": "deployer"}))
+	require.NoError(t, err)
+	assert.True(t, id.IsServiceAccount)
+
+	id, err = validateToken(ctx, auth0.token(t, "RS256", map[string]any{"sub": "m2m@clients", "gty": "client-credentials"}))
+	require.NoError(t, err)
+	assert.True(t, id.IsServiceAccount)
+	assert.Empty(t, id.Email, "the subject is never used as an email")
+}
+
+func TestValidateToken_SubjectsDoNotCollideAcrossIssuers(t *testing.T) {
+	legacy := newTestIDP(t)
+	keycloak := newTestIDP(t)
+	dex := newTestIDP(t)
+	setupIssuers(t, config.AuthConfig{Issuer: legacy.issuer(), Issuers: []config.OIDCIssuerConfig{
+		{Issuer: legacy.issuer(), Audiences: []string{"ktrlplane"}},
+		{Issuer: keycloak.issuer(), Audiences: []string{"ktrlplane"}},
+		{Issuer: dex.issuer(), Audiences: []string{"ktrlplane"}},
+	}})
+	ctx := context.Background()
+
+	// Every issuer vouches for the same subject
+	claims := map[string]any{"sub": "auth0|alice"}
+	userIDs := make(map[string]string)
+	for name, idp := range map[string]*testIDP{"legacy": legacy, "keycloak": keycloak, "dex": dex} {
+		id, err := validateToken(ctx, idp.token(t, "RS256", claims))
+		require.NoError(t, err)
+		assert.Equal(t, "auth0|alice", id.Subject)
+		for other, userID := range userIDs {
+			assert.NotEqual(t, userID, id.UserID, "%s and %s map to the same user", name, other)
+		}
+		userIDs[name] = id.UserID
+	}
+	assert.Equal(t, "auth0|alice", userIDs["legacy"], "the legacy issuer keeps existing user IDs")
+}
+
+func TestSubjectNamespace(t *testing.T) {
+	assert.Equal(t, "keycloak.example.com/realms/acme|", subjectNamespace("https://keycloak.example.com/realms/acme"))
+	assert.Equal(t, "dex.example.com|", subjectNamespace("https://dex.example.com/"))
+	assert.Equal(t, "login.microsoftonline.com/tenant/v2.0|", subjectNamespace("https://login.microsoftonline.com/tenant/v2.0"))
+}
+
+func TestValidateToken_Rejects(t *testing.T) {
+	idp := newTestIDP(t)
+	untrusted := newTestIDP(t)
+	setupIssuers(t, config.AuthConfig{Issuers: []config.OIDCIssuerConfig{
+		{Issuer: idp.issuer(), Audiences: []string{"ktrlplane"}},
+	}})
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"untrusted issuer", untrusted.token(t, "RS256", map[string]any{"sub": "u"})},
+		{"wrong audience", idp.token(t, "RS256", map[string]any{"sub": "u", "aud": "someone-else"})},
+		{"algorithm not allowed", idp.token(t, "ES256", map[string]any{"sub": "u"})},
+		{"expired", idp.token(t, "RS256", map[string]any{"sub": "u", "exp": time.Now().Add(-time.Hour).Unix()})},
+		{"signed by another key", untrusted.token(t, "RS256", map[string]any{"sub": "u", "iss": idp.issuer()})},
+		{"not a jwt", "not-a-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validateToken(ctx, tt.token)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSetupAuth_LegacyAuth0Issuer(t *testing.T) {
+	idp := newTestIDP(t)
+	setupIssuers(t, config.AuthConfig{Issuer: idp.issuer(), Audience: "ktrlplane"})
+
+	id, err := validateToken(context.Background(), idp.token(t, "RS256", map[string]any{"sub": "client", "gty": "client-credentials"}))
+	require.NoError(t, err)
+	assert.True(t, id.IsServiceAccount)
+}
+
+func TestSetupAuth_RequiresIssuer(t *testing.T) {
+	assert.Error(t, SetupAuth(config.AuthConfig{}))
+}
+
+// hs256Token signs claims with a shared key, as KtrlPlane does for service account tokens.
+func hs256Token(t *testing.T, key string, claims map[string]any) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	require.NoError(t, err)
+	body, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signingInput := b64(header) + "." + b64(body)
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + b64(mac.Sum(nil))
+}
+
+func TestValidateToken_ServiceAccountTokens(t *testing.T) {
+	setupIssuers(t, config.AuthConfig{ServiceAccountTokens: config.ServiceAccountTokensConfig{SigningKey: "signing-key"}})
+	claims := map[string]any{
+		"iss": service.ServiceAccountTokenIssuer, "aud": service.ServiceAccountTokenIssuer,
+		"sub": "sa-1", "client_id": "sa-1", "exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	id, err := validateToken(context.Background(), hs256Token(t, "signing-key", claims))
+	require.NoError(t, err)
+	assert.True(t, id.IsServiceAccount)
+	assert.Equal(t, service.ServiceAccountTokenIssuer, id.Issuer)
+	assert.Equal(t, "sa-1", id.ClientID)
+
+	_, err = validateToken(context.Background(), hs256Token(t, "another-key", claims))
+	assert.Error(t, err)
+}
+
+func TestSetupAuth_ReservesServiceAccountIssuer(t *testing.T) {
+	err := SetupAuth(config.AuthConfig{
+		Issuers:              []config.OIDCIssuerConfig{{Issuer: service.ServiceAccountTokenIssuer}},
+		ServiceAccountTokens: config.ServiceAccountTokensConfig{SigningKey: "k"},
+	})
+	assert.Error(t, err)
+}
+
+func TestIdentity_ClientID(t *testing.T) {
+	rules := []config.ServiceAccountRule{{Claim: "gty", Value: "client-credentials"}}
+	tests := []struct {
+		name    string
+		mapping config.OIDCClaimsConfig
+		claims  tokenClaims
+		want    string
+	}{
+		{"azp", config.OIDCClaimsConfig{}, tokenClaims{"gty": "client-credentials", "azp": "deployer"}, "deployer"},
+		{"entra appid", config.OIDCClaimsConfig{}, tokenClaims{"gty": "client-credentials", "appid": "app-1"}, "app-1"},
+		{"configured claim", config.OIDCClaimsConfig{ClientID: "cid"}, tokenClaims{"gty": "client-credentials", "azp": "x", "cid": "y"}, "y"},
+		{"user token", config.OIDCClaimsConfig{}, tokenClaims{"azp": "spa"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := &trustedIssuer{cfg: config.OIDCIssuerConfig{Claims: tt.mapping, ServiceAccount: rules}}
+			assert.Equal(t, tt.want, issuer.identity("sub", tt.claims).ClientID)
+		})
+	}
+}
+
+func TestIdentity_ServiceAccountRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   config.ServiceAccountRule
+		claims tokenClaims
+		want   bool
+	}{
+		{"entra app token", config.ServiceAccountRule{Claim: "idtyp", Value: "app"}, tokenClaims{"idtyp": "app"}, true},
+		{"entra user token", config.ServiceAccountRule{Claim: "idtyp", Value: "app"}, tokenClaims{"idtyp": "user"}, false},
+		{"azp equals subject", config.ServiceAccountRule{Claim: "azp", MatchSubject: true}, tokenClaims{"azp": "sub-1"}, true},
+		{"azp differs from subject", config.ServiceAccountRule{Claim: "azp", MatchSubject: true}, tokenClaims{"azp": "spa"}, false},
+		{"client_id present", config.ServiceAccountRule{Claim: "client_id"}, tokenClaims{"client_id": "x"}, true},
+		{"claim missing", config.ServiceAccountRule{Claim: "client_id"}, tokenClaims{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := &trustedIssuer{cfg: config.OIDCIssuerConfig{ServiceAccount: []config.ServiceAccountRule{tt.rule}}}
+			assert.Equal(t, tt.want, issuer.identity("sub-1", tt.claims).IsServiceAccount)
+		})
+	}
+}
+
+func TestIdentity_EmailVerification(t *testing.T) {
+	claims := issuerConfigs(config.AuthConfig{Issuers: []config.OIDCIssuerConfig{{Issuer: "x"}}})[0].Claims
+	trusting := claims
+	trusting.TrustEmail = true
+
+	tests := []struct {
+		name    string
+		mapping config.OIDCClaimsConfig
+		claims  tokenClaims
+		want    bool
+	}{
+		{"verified", claims, tokenClaims{"email": "a@example.com", "email_verified": true}, true},
+		{"verified as string", claims, tokenClaims{"email": "a@example.com", "email_verified": "true"}, true},
+		{"unverified", claims, tokenClaims{"email": "a@example.com", "email_verified": false}, false},
+		{"claim missing", claims, tokenClaims{"email": "a@example.com"}, false},
+		{"verified flag without email", claims, tokenClaims{"email_verified": true}, false},
+		{"trusted issuer", trusting, tokenClaims{"email": "a@example.com"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := &trustedIssuer{cfg: config.OIDCIssuerConfig{Claims: tt.mapping}}
+			assert.Equal(t, tt.want, issuer.identity("sub", tt.claims).EmailVerified)
+		})
+	}
+}
+
+func TestIdentity_Groups(t *testing.T) {
+	unmapped := &trustedIssuer{}
+	assert.Nil(t, unmapped.identity("sub", tokenClaims{"groups": []any{"a"}}).Groups)
+
+	mapped := &trustedIssuer{cfg: config.OIDCIssuerConfig{Claims: config.OIDCClaimsConfig{Groups: "groups"}}}
+	assert.Equal(t, []string{"a"}, mapped.identity("sub", tokenClaims{"groups": []any{"a"}}).Groups)
+	assert.Equal(t, []string{}, mapped.identity("sub", tokenClaims{}).Groups, "a missing claim means no groups, not unknown")
+}
+
+func TestClaimValue_Paths(t *testing.T) {
+	claims := tokenClaims{
+		"https://konnektr.io/groups": []any{"a", "b"},
+		"realm_access":               map[string]any{"roles": []any{"admin"}},
+		"group":                      "single",
+	}
+	assert.Equal(t, []string{"a", "b"}, claimStrings(claims, "https://konnektr.io/groups"), "namespaced claim names keep their dots")
+	assert.Equal(t, []string{"admin"}, claimStrings(claims, "realm_access.roles"))
+	assert.Equal(t, []string{"single"}, claimStrings(claims, "group"))
+	assert.Nil(t, claimStrings(claims, "realm_access.missing"))
+	assert.Empty(t, claimString(claims, "realm_access"), "objects are not strings")
+}
+
+func TestDisplayName(t *testing.T) {
+	assert.Equal(t, "Alice", displayName("Alice", "alice@example.com"))
+	assert.Equal(t, "alice", displayName("", "alice@example.com"))
+	assert.Equal(t, "User", displayName("", ""))
+}
@@ -0,0 +1,328 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ktrlplane/internal/config"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/auth0/go-jwt-middleware/v2/jwks"
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+)
+
+// jwksCacheTTL is how long an issuer's signing keys are cached before a background refresh.
+const jwksCacheTTL = 5 * time.Minute
+
+// errUnknownIssuer is returned for tokens from an issuer that is not configured.
+var errUnknownIssuer = errors.New("token issuer is not trusted")
+
+// identity is the caller described by a validated token, after claim mapping.
+type identity struct {
+	Issuer           string
+	Subject          string
+	UserID           string // Subject, prefixed with the issuer's namespace unless it is the legacy issuer
+	ClientID         string // OAuth client the token was issued to, for service accounts
+	Email            string
+	EmailVerified    bool
+	Name             string
+	Groups           []string // nil when the issuer has no groups claim configured
+	IsServiceAccount bool
+}
+
+// tokenClaims holds every claim of a token so that claim paths can be configured per issuer.
+type tokenClaims map[string]any
+
+// Validate satisfies validator.CustomClaims; registered claims are checked by the validator.
+func (c *tokenClaims) Validate(ctx context.Context) error {
+	return nil
+}
+
+// trustedIssuer validates tokens from one issuer and maps their claims.
+type trustedIssuer struct {
+	cfg config.OIDCIssuerConfig
+	// subjectPrefix namespaces the subjects of this issuer in user IDs, so that equal subjects
+	// from different issuers are different users. It is empty for the legacy issuer, whose
+	// subjects were the user IDs before multiple issuers were supported.
+	subjectPrefix string
+	// validators holds one validator per allowed algorithm, all sharing the issuer's key set.
+	validators map[string]*validator.Validator
+}
+
+// issuerConfigs returns the configured issuers with defaults applied. Without an
+// issuers list, the legacy issuer/audience pair configures a single Auth0 issuer.
+func issuerConfigs(cfg config.AuthConfig) []config.OIDCIssuerConfig {
+	issuers := cfg.Issuers
+	if len(issuers) == 0 && cfg.Issuer != "" {
+		issuers = []config.OIDCIssuerConfig{{
+			Issuer:    cfg.Issuer,
+			Audiences: []string{cfg.Audience},
+			ServiceAccount: []config.ServiceAccountRule{
+				{Claim: "gty", Value: "client-credentials"},
+			},
+		}}
+	}
+
+	out := make([]config.OIDCIssuerConfig, len(issuers))
+	for i, issuer := range issuers {
+		if len(issuer.Algorithms) == 0 {
+			issuer.Algorithms = []string{string(validator.RS256)}
+		}
+		if issuer.Claims.Email == "" {
+			issuer.Claims.Email = "email"
+		}
+		if issuer.Claims.EmailVerified == "" {
+			issuer.Claims.EmailVerified = "email_verified"
+		}
+		if issuer.Claims.Name == "" {
+			issuer.Claims.Name = "name"
+		}
+		out[i] = issuer
+	}
+	return out
+}
+
+// newTrustedIssuer builds the validators for one issuer.
+func newTrustedIssuer(cfg config.OIDCIssuerConfig) (*trustedIssuer, error) {
+	issuerURL, err := url.Parse(cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the issuer url %q: %w", cfg.Issuer, err)
+	}
+
+	var providerOpts []any
+	if cfg.JWKSURL != "" {
+		jwksURL, err := url.Parse(cfg.JWKSURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the jwks url %q: %w", cfg.JWKSURL, err)
+		}
+		providerOpts = append(providerOpts, jwks.WithCustomJWKSURI(jwksURL))
+	}
+	provider := jwks.NewCachingProvider(issuerURL, jwksCacheTTL, providerOpts...)
+
+	issuer := &trustedIssuer{cfg: cfg, validators: make(map[string]*validator.Validator)}
+	for _, alg := range cfg.Algorithms {
+		v, err := validator.New(
+			provider.KeyFunc,
+			validator.SignatureAlgorithm(alg),
+			cfg.Issuer,
+			cfg.Audiences,
+			validator.WithCustomClaims(func() validator.CustomClaims {
+				return &tokenClaims{}
+			}),
+			validator.WithAllowedClockSkew(time.Minute),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up the jwt validator for %s (%s): %w", cfg.Issuer, alg, err)
+		}
+		issuer.validators[alg] = v
+	}
+	return issuer, nil
+}
+
+// subjectNamespace derives the user ID prefix of an issuer from its host and path:
+// https://keycloak.example.com/realms/acme becomes "keycloak.example.com/realms/acme|".
+// Auth0 subjects such as "auth0|abc" never contain a dot or slash before the pipe, so
+// prefixed IDs cannot collide with the legacy issuer's.
+func subjectNamespace(issuer string) string {
+	u, err := url.Parse(issuer)
+	if err != nil || u.Host == "" {
+		return issuer + "|"
+	}
+	return u.Host + strings.TrimSuffix(u.Path, "/") + "|"
+}
+
+// newSigningKeyIssuer trusts HS256 tokens signed with key, as issued by KtrlPlane itself
+// for service accounts. Such tokens carry client_id = sub.
+func newSigningKeyIssuer(issuer string, key []byte) (*trustedIssuer, error) {
+	cfg := issuerConfigs(config.AuthConfig{Issuers: []config.OIDCIssuerConfig{{
+		Issuer:         issuer,
+		Audiences:      []string{issuer},
+		Algorithms:     []string{string(validator.HS256)},
+		ServiceAccount: []config.ServiceAccountRule{{Claim: "client_id", MatchSubject: true}},
+	}}})[0]
+
+	v, err := validator.New(
+		func(context.Context) (interface{}, error) { return key, nil },
+		validator.HS256,
+		cfg.Issuer,
+		cfg.Audiences,
+		validator.WithCustomClaims(func() validator.CustomClaims {
+			return &tokenClaims{}
+		}),
+		validator.WithAllowedClockSkew(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up the jwt validator for %s: %w", issuer, err)
+	}
+	return &trustedIssuer{cfg: cfg, validators: map[string]*validator.Validator{string(validator.HS256): v}}, nil
+}
+
+// validate checks the token signature and registered claims and maps it to an identity.
+func (i *trustedIssuer) validate(ctx context.Context, token, alg string) (*identity, error) {
+	v, ok := i.validators[alg]
+	if !ok {
+		return nil, fmt.Errorf("signing algorithm %q is not allowed for issuer %s", alg, i.cfg.Issuer)
+	}
+	validated, err := v.ValidateToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	claims := validated.(*validator.ValidatedClaims)
+	custom, _ := claims.CustomClaims.(*tokenClaims)
+	if custom == nil {
+		custom = &tokenClaims{}
+	}
+	return i.identity(claims.RegisteredClaims.Subject, *custom), nil
+}
+
+// defaultClientIDClaims are tried in order when an issuer does not configure a client ID claim.
+var defaultClientIDClaims = []string{"azp", "client_id", "appid"}
+
+// identity maps the claims of a validated token using the issuer's claim configuration.
+func (i *trustedIssuer) identity(subject string, claims tokenClaims) *identity {
+	mapping := i.cfg.Claims
+	id := &identity{
+		Issuer:  i.cfg.Issuer,
+		Subject: subject,
+		UserID:  i.subjectPrefix + subject,
+		Email:   claimString(claims, mapping.Email),
+		Name:    claimString(claims, mapping.Name),
+	}
+	id.EmailVerified = id.Email != "" && (mapping.TrustEmail || claimBool(claims, mapping.EmailVerified))
+	if mapping.Groups != "" {
+		// Non-nil even without the claim, so that team memberships synced from it are removed
+		id.Groups = claimStrings(claims, mapping.Groups)
+		if id.Groups == nil {
+			id.Groups = []string{}
+		}
+	}
+	for _, rule := range i.cfg.ServiceAccount {
+		if matchesServiceAccountRule(claims, subject, rule) {
+			id.IsServiceAccount = true
+			break
+		}
+	}
+	if id.IsServiceAccount {
+		paths := defaultClientIDClaims
+		if mapping.ClientID != "" {
+			paths = []string{mapping.ClientID}
+		}
+		for _, path := range paths {
+			if id.ClientID = claimString(claims, path); id.ClientID != "" {
+				break
+			}
+		}
+	}
+	return id
+}
+
+// matchesServiceAccountRule reports whether the token claims satisfy rule.
+func matchesServiceAccountRule(claims tokenClaims, subject string, rule config.ServiceAccountRule) bool {
+	value, ok := claimValue(claims, rule.Claim)
+	if !ok {
+		return false
+	}
+	switch {
+	case rule.MatchSubject:
+		return fmt.Sprint(value) == subject
+	case rule.Value != "":
+		return fmt.Sprint(value) == rule.Value
+	default:
+		return true
+	}
+}
+
+// claimValue looks up a claim by dot-separated path. A top-level claim whose name
+// contains dots (e.g. namespaced Auth0 claims) is matched before the path is split.
+func claimValue(claims tokenClaims, path string) (any, bool) {
+	if path == "" {
+		return nil, false
+	}
+	if value, ok := claims[path]; ok {
+		return value, true
+	}
+	var current any = map[string]any(claims)
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// claimString returns a string claim, or "" when it is missing or not a string.
+func claimString(claims tokenClaims, path string) string {
+	value, _ := claimValue(claims, path)
+	s, _ := value.(string)
+	return s
+}
+
+// claimBool returns a boolean claim. Some IdPs send "true" as a string.
+func claimBool(claims tokenClaims, path string) bool {
+	value, _ := claimValue(claims, path)
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	default:
+		return false
+	}
+}
+
+// claimStrings returns a list claim. A single string is treated as a one-element list.
+func claimStrings(claims tokenClaims, path string) []string {
+	value, _ := claimValue(claims, path)
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+// peekToken reads the signing algorithm and issuer of a compact JWT without verifying it,
+// so that the token can be routed to the right issuer's validator.
+func peekToken(token string) (alg, issuer string, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", "", errors.New("token is not a compact JWS")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", "", fmt.Errorf("could not parse the token header: %w", err)
+	}
+	var payload struct {
+		Iss string `json:"iss"`
+	}
+	if err := decodeSegment(parts[1], &payload); err != nil {
+		return "", "", fmt.Errorf("could not parse the token payload: %w", err)
+	}
+	return header.Alg, payload.Iss, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
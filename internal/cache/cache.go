@@ -0,0 +1,160 @@
+// Package cache provides a small in-process TTL cache with request deduplication.
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ktrlplane/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"golang.org/x/sync/singleflight"
+)
+
+type entry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// Stats are cumulative lookup counters for a cache.
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// Cache is a TTL cache keyed by string. Concurrent misses for the same key
+// share a single load. Errors are never cached.
+type Cache[V any] struct {
+	name    string
+	ttl     time.Duration
+	mu      sync.RWMutex
+	entries map[string]entry[V]
+	group   singleflight.Group
+	now     func() time.Time
+
+	// generation is bumped by Invalidate and Clear so that a load which started
+	// before the invalidation does not store its (possibly stale) result.
+	generation atomic.Uint64
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// New creates a cache. name labels the cache in metrics.
+func New[V any](name string, ttl time.Duration) *Cache[V] {
+	return &Cache[V]{
+		name:    name,
+		ttl:     ttl,
+		entries: make(map[string]entry[V]),
+		now:     time.Now,
+	}
+}
+
+// Get returns the cached value for key, if present and not expired.
+func (c *Cache[V]) Get(key string) (V, bool) {
+	c.mu.RLock()
+	e, ok := c.entries[key]
+	c.mu.RUnlock()
+	if !ok || !c.now().Before(e.expires) {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+// Set stores value under key for the cache TTL.
+func (c *Cache[V]) Set(key string, value V) {
+	c.mu.Lock()
+	c.entries[key] = entry[V]{value: value, expires: c.now().Add(c.ttl)}
+	c.mu.Unlock()
+}
+
+// GetOrLoad returns the cached value for key, calling load on a miss.
+// Concurrent callers missing the same key wait for one load.
+// When store is non-nil it decides whether a loaded value may be cached.
+func (c *Cache[V]) GetOrLoad(ctx context.Context, key string, load func() (V, error), store func(V) bool) (V, error) {
+	if value, ok := c.Get(key); ok {
+		c.record(ctx, true)
+		return value, nil
+	}
+	c.record(ctx, false)
+
+	generation := c.generation.Load()
+	result, err, _ := c.group.Do(key, func() (any, error) {
+		value, err := load()
+		if err != nil {
+			return value, err
+		}
+		if (store == nil || store(value)) && c.generation.Load() == generation {
+			c.Set(key, value)
+		}
+		return value, nil
+	})
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return result.(V), nil
+}
+
+// Invalidate removes key from the cache.
+func (c *Cache[V]) Invalidate(key string) {
+	c.generation.Add(1)
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+	c.group.Forget(key)
+}
+
+// InvalidateFunc removes every key for which match returns true.
+func (c *Cache[V]) InvalidateFunc(match func(key string) bool) {
+	c.generation.Add(1)
+	c.mu.Lock()
+	for key := range c.entries {
+		if match(key) {
+			delete(c.entries, key)
+			c.group.Forget(key)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// Clear removes all entries.
+func (c *Cache[V]) Clear() {
+	c.generation.Add(1)
+	c.mu.Lock()
+	c.entries = make(map[string]entry[V])
+	c.mu.Unlock()
+}
+
+// Stats returns the hit and miss counters.
+func (c *Cache[V]) Stats() Stats {
+	return Stats{Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
+
+func (c *Cache[V]) record(ctx context.Context, hit bool) {
+	result := "miss"
+	if hit {
+		c.hits.Add(1)
+		result = "hit"
+	} else {
+		c.misses.Add(1)
+	}
+	lookups().Add(ctx, 1, metric.WithAttributes(
+		attribute.String("cache", c.name),
+		attribute.String("result", result),
+	))
+}
+
+// lookups returns the shared lookup counter. It is resolved on every call so
+// that it follows the meter provider installed at startup (or by tests).
+func lookups() metric.Int64Counter {
+	counter, _ := telemetry.Meter().Int64Counter("ktrlplane.cache.lookups",
+		metric.WithDescription("Cache lookups by cache name and result (hit or miss)"),
+		metric.WithUnit("{lookup}"),
+	)
+	return counter
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ktrlplane/internal/telemetry"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestCache_TTL(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := New[string]("test", time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Set("k", "v")
+	value, ok := c.Get("k")
+	assert.True(t, ok)
+	assert.Equal(t, "v", value)
+
+	now = now.Add(time.Minute)
+	_, ok = c.Get("k")
+	assert.False(t, ok, "entry expires after the TTL")
+}
+
+func TestCache_GetOrLoadDeduplicatesConcurrentMisses(t *testing.T) {
+	c := New[int]("test", time.Minute)
+	var loads atomic.Int32
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := c.GetOrLoad(context.Background(), "k", func() (int, error) {
+				loads.Add(1)
+				<-release
+				return 42, nil
+			}, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, 42, value)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), loads.Load())
+	value, err := c.GetOrLoad(context.Background(), "k", func() (int, error) { return 0, errors.New("not called") }, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, value)
+}
+
+func TestCache_ErrorsAndRejectedValuesAreNotStored(t *testing.T) {
+	c := New[int]("test", time.Minute)
+	_, err := c.GetOrLoad(context.Background(), "k", func() (int, error) { return 0, errors.New("boom") }, nil)
+	assert.Error(t, err)
+	_, ok := c.Get("k")
+	assert.False(t, ok)
+
+	value, err := c.GetOrLoad(context.Background(), "k", func() (int, error) { return 7, nil }, func(v int) bool { return v > 10 })
+	assert.NoError(t, err)
+	assert.Equal(t, 7, value)
+	_, ok = c.Get("k")
+	assert.False(t, ok)
+}
+
+func TestCache_InvalidateDuringLoadDropsResult(t *testing.T) {
+	c := New[string]("test", time.Minute)
+	_, err := c.GetOrLoad(context.Background(), "k", func() (string, error) {
+		c.Invalidate("k") // a mutation lands while the load is in flight
+		return "stale", nil
+	}, nil)
+	assert.NoError(t, err)
+	_, ok := c.Get("k")
+	assert.False(t, ok)
+}
+
+func TestCache_InvalidateFunc(t *testing.T) {
+	c := New[string]("test", time.Minute)
+	c.Set("alice/1", "a")
+	c.Set("alice/2", "b")
+	c.Set("bob/1", "c")
+
+	c.InvalidateFunc(func(key string) bool { return strings.HasPrefix(key, "alice/") })
+
+	_, ok := c.Get("alice/1")
+	assert.False(t, ok)
+	_, ok = c.Get("alice/2")
+	assert.False(t, ok)
+	_, ok = c.Get("bob/1")
+	assert.True(t, ok)
+}
+
+func TestCache_Metrics(t *testing.T) {
+	reader, restore := telemetry.NewManualMetricReader()
+	defer restore()
+
+	c := New[string]("prices", time.Minute)
+	load := func() (string, error) { return "v", nil }
+	_, _ = c.GetOrLoad(context.Background(), "k", load, nil)
+	_, _ = c.GetOrLoad(context.Background(), "k", load, nil)
+	_, _ = c.GetOrLoad(context.Background(), "k", load, nil)
+	assert.Equal(t, Stats{Hits: 2, Misses: 1}, c.Stats())
+
+	var rm metricdata.ResourceMetrics
+	assert.NoError(t, reader.Collect(context.Background(), &rm))
+
+	counts := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "ktrlplane.cache.lookups" {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				result, _ := dp.Attributes.Value("result")
+				counts[result.AsString()] += dp.Value
+			}
+		}
+	}
+	assert.Equal(t, map[string]int64{"hit": 2, "miss": 1}, counts)
+}
@@ -13,12 +13,20 @@ type Config struct {
 	Database    DatabaseConfig    `mapstructure:"database"`
 	Auth        AuthConfig        `mapstructure:"auth"`
 	Stripe      StripeConfig      `mapstructure:"stripe"`
-	Observability ObservabilityConfig `mapstructure:"observability"`
+	Observability      ObservabilityConfig      `mapstructure:"observability"`
+	RateLimit          RateLimitConfig          `mapstructure:"rate_limit"`
+	Invitations        InvitationsConfig        `mapstructure:"invitations"`
+	Mail               MailConfig               `mapstructure:"mail"`
+	Metering           MeteringConfig           `mapstructure:"metering"`
+	PaymentEnforcement PaymentEnforcementConfig `mapstructure:"payment_enforcement"`
 }
 
 // ServerConfig holds server-related configuration.
+// TrustedProxies lists the addresses or CIDRs of the reverse proxies whose X-Forwarded-For
+// header identifies the client. Without it, the client is the peer of the connection.
 type ServerConfig struct {
-	Port string `mapstructure:"port"`
+	Port           string   `mapstructure:"port"`
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 // DatabaseConfig holds database-related configuration.
@@ -32,9 +40,53 @@ type DatabaseConfig struct {
 }
 
 // AuthConfig holds authentication-related configuration.
+// Issuers lists every trusted OIDC issuer. When it is empty, Issuer and Audience
+// configure a single Auth0 issuer, as before multiple issuers were supported.
+// User IDs are token subjects prefixed with a namespace derived from the issuer URL,
+// except for Issuer, whose subjects stay unprefixed so that existing users keep their IDs.
 type AuthConfig struct {
-	Issuer   string `mapstructure:"issuer"`
-	Audience string `mapstructure:"audience"`
+	Issuer               string                     `mapstructure:"issuer"`
+	Audience             string                     `mapstructure:"audience"`
+	Issuers              []OIDCIssuerConfig         `mapstructure:"issuers"`
+	ServiceAccountTokens ServiceAccountTokensConfig `mapstructure:"service_account_tokens"`
+}
+
+// ServiceAccountTokensConfig enables KtrlPlane-signed access tokens for service accounts,
+// obtained by exchanging a client secret. Tokens are only issued and accepted when
+// SigningKey is set; share it across replicas.
+type ServiceAccountTokensConfig struct {
+	SigningKey string `mapstructure:"signing_key"` // HMAC-SHA256 key
+	TTLMinutes int    `mapstructure:"ttl_minutes"` // Access token lifetime; defaults to 60
+}
+
+// OIDCIssuerConfig describes one trusted token issuer (Auth0, Keycloak, Entra ID, Zitadel, Dex, ...).
+type OIDCIssuerConfig struct {
+	Issuer         string               `mapstructure:"issuer"`          // Must match the token's iss claim exactly
+	Audiences      []string             `mapstructure:"audiences"`       // Tokens must carry at least one of these
+	Algorithms     []string             `mapstructure:"algorithms"`      // Allowed signing algorithms; defaults to RS256
+	JWKSURL        string               `mapstructure:"jwks_url"`        // Defaults to the jwks_uri from OIDC discovery
+	Claims         OIDCClaimsConfig     `mapstructure:"claims"`
+	ServiceAccount []ServiceAccountRule `mapstructure:"service_account"` // A token matching any rule is a service account
+}
+
+// OIDCClaimsConfig maps token claims to user attributes. Paths are dot-separated,
+// e.g. "realm_access.roles"; a claim name containing dots can be given as-is.
+type OIDCClaimsConfig struct {
+	Email         string `mapstructure:"email"`          // Defaults to "email"
+	EmailVerified string `mapstructure:"email_verified"` // Defaults to "email_verified"
+	TrustEmail    bool   `mapstructure:"trust_email"`    // Treat every email as verified; only for IdPs that never issue unverified emails
+	Name          string `mapstructure:"name"`           // Defaults to "name"
+	Groups        string `mapstructure:"groups"`         // Claim holding group names; empty disables groups
+	ClientID      string `mapstructure:"client_id"`      // Client ID of service account tokens; defaults to azp, then client_id, then appid
+}
+
+// ServiceAccountRule marks a token as a service account when Claim is present and,
+// if set, equals Value, or equals the token subject when MatchSubject is set.
+// Examples: gty=client-credentials (Auth0), idtyp=app (Entra ID), client_id present (Keycloak).
+type ServiceAccountRule struct {
+	Claim        string `mapstructure:"claim"`
+	Value        string `mapstructure:"value"`
+	MatchSubject bool   `mapstructure:"match_subject"`
 }
 
 // StripeConfig holds Stripe-related configuration.
@@ -42,20 +94,56 @@ type StripeConfig struct {
 	SecretKey      string          `mapstructure:"secret_key"`
 	PublishableKey string          `mapstructure:"publishable_key"`
 	// WebhookSecret  string          `mapstructure:"webhook_secret"`
-	Products       []StripeProduct `mapstructure:"products"`
+	Products        []StripeProduct `mapstructure:"products"`
+	DefaultCurrency string          `mapstructure:"default_currency"` // Currency of accounts that did not choose one; empty uses each product's first price
+	AutomaticTax    bool            `mapstructure:"automatic_tax"`    // Calculate and collect tax (e.g. VAT) with Stripe Tax
 }
 
 // StripeProduct represents a Stripe product configuration.
 type StripeProduct struct {
-	ResourceType string `mapstructure:"resource_type"`
-	SKU          string `mapstructure:"sku"`
-	ProductID    string `mapstructure:"product_id"`
+	ResourceType string            `mapstructure:"resource_type"`
+	SKU          string            `mapstructure:"sku"`
+	ProductID    string            `mapstructure:"product_id"`
+	TrialDays    int               `mapstructure:"trial_days"` // Free trial of a new subscription that includes the product
+	Prices       map[string]string `mapstructure:"prices"`     // Price IDs by billing interval ("month", "year"); unset uses the product's active prices
+}
+
+// PaymentEnforcementConfig configures how unpaid subscriptions are enforced. When enabled, new
+// paid resources are refused while the paying subscription is past due, unpaid or canceled, and
+// its paid resources are suspended once the problem outlasts the grace period.
+type PaymentEnforcementConfig struct {
+	Enabled          bool `mapstructure:"enabled"`
+	GracePeriodHours int  `mapstructure:"grace_period_hours"` // Defaults to 168 (7 days)
+	IntervalMinutes  int  `mapstructure:"interval_minutes"`   // How often subscriptions are checked; defaults to 15
+}
+
+// MeteringConfig configures usage-based billing. Every interval, each meter's query is
+// evaluated through Mimir for every paid resource of its type and completed hour, stored as
+// a usage record and reported to the meter's Stripe billing meter. Requires observability.mimir.
+type MeteringConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	IntervalMinutes int           `mapstructure:"interval_minutes"` // How often usage is collected and reported; defaults to 15
+	Meters          []MeterConfig `mapstructure:"meters"`
+}
+
+// MeterConfig maps a PromQL query to a Stripe billing meter. The query is evaluated at the end
+// of each hour in the resource's project tenant and should return that hour's usage, e.g.
+// sum(increase(flow_events_total{resource_id="{{resource_id}}"}[1h])).
+// Stripe meter values are whole numbers, so the query should return the billed unit; the
+// fractions of a unit left over each hour are carried to the next.
+type MeterConfig struct {
+	Name         string `mapstructure:"name"`          // Identifies the meter in usage records, e.g. "flow_events"
+	ResourceType string `mapstructure:"resource_type"` // Resources the meter applies to, e.g. "Konnektr.Flow"
+	Query        string `mapstructure:"query"`         // {{resource_id}} is replaced with the resource ID
+	EventName    string `mapstructure:"event_name"`    // Stripe billing meter event name
 }
 
 // ObservabilityConfig holds observability backend configuration.
 type ObservabilityConfig struct {
-	Loki  LokiConfig  `mapstructure:"loki"`
-	Mimir MimirConfig `mapstructure:"mimir"`
+	Loki    LokiConfig    `mapstructure:"loki"`
+	Mimir   MimirConfig   `mapstructure:"mimir"`
+	Tracing TracingConfig `mapstructure:"tracing"`
+	Metrics MetricsConfig `mapstructure:"metrics"`
 }
 
 // LokiConfig holds Loki (logging) backend configuration.
@@ -70,6 +158,64 @@ type MimirConfig struct {
 	Enabled bool   `mapstructure:"enabled"`
 }
 
+// TracingConfig holds OpenTelemetry trace export configuration.
+// When Enabled is false no exporter is installed and all spans are no-ops.
+type TracingConfig struct {
+	Enabled     bool    `mapstructure:"enabled"`
+	Endpoint    string  `mapstructure:"endpoint"`     // OTLP/HTTP collector endpoint, e.g. "otel-collector:4318"
+	Insecure    bool    `mapstructure:"insecure"`     // Use plain HTTP instead of HTTPS
+	ServiceName string  `mapstructure:"service_name"` // Defaults to "ktrlplane"
+	SampleRatio float64 `mapstructure:"sample_ratio"` // 0 < ratio <= 1; defaults to 1 (sample everything)
+}
+
+// MetricsConfig holds OpenTelemetry metric export configuration.
+// When Enabled is false instruments are no-ops.
+type MetricsConfig struct {
+	Enabled         bool   `mapstructure:"enabled"`
+	Endpoint        string `mapstructure:"endpoint"`         // OTLP/HTTP collector endpoint, e.g. "otel-collector:4318"
+	Insecure        bool   `mapstructure:"insecure"`         // Use plain HTTP instead of HTTPS
+	IntervalSeconds int    `mapstructure:"interval_seconds"` // Export interval; defaults to 60
+}
+
+// RateLimitConfig holds API rate limiting configuration.
+// Store selects where token buckets live: "memory" (per replica, default) or
+// "postgres" (shared across replicas). Groups override the built-in budgets
+// per route group ("default", "public", "search", "billing").
+type RateLimitConfig struct {
+	Enabled bool                       `mapstructure:"enabled"`
+	Store   string                     `mapstructure:"store"`
+	Groups  map[string]RateLimitBudget `mapstructure:"groups"`
+}
+
+// RateLimitBudget is a token bucket budget: a sustained request rate and a burst size.
+type RateLimitBudget struct {
+	RequestsPerMinute float64 `mapstructure:"requests_per_minute"`
+	Burst             int     `mapstructure:"burst"`
+}
+
+// InvitationsConfig holds configuration for email invitations.
+type InvitationsConfig struct {
+	SigningKey string `mapstructure:"signing_key"` // HMAC key for invitation tokens; invitations are disabled without one. Share it across replicas
+	TTLHours   int    `mapstructure:"ttl_hours"`   // How long an invitation stays valid; defaults to 168 (7 days)
+	AcceptURL  string `mapstructure:"accept_url"`  // Frontend page that accepts invitations; the token is appended as ?token=
+}
+
+// MailConfig holds outgoing email configuration.
+// Driver is "log" (write messages to the server log, default) or "smtp".
+type MailConfig struct {
+	Driver string     `mapstructure:"driver"`
+	From   string     `mapstructure:"from"`
+	SMTP   SMTPConfig `mapstructure:"smtp"`
+}
+
+// SMTPConfig holds SMTP server settings for the "smtp" mail driver.
+type SMTPConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
 // LoadConfig loads configuration from the given path.
 func LoadConfig(path string) (config Config, err error) {
 	viper.AddConfigPath(path)
@@ -92,13 +238,42 @@ func LoadConfig(path string) (config Config, err error) {
 	       "database.sslmode",
 	       "auth.issuer",
 	       "auth.audience",
+	       "auth.service_account_tokens.signing_key",
+	       "auth.service_account_tokens.ttl_minutes",
 	       "stripe.secret_key",
 	       "stripe.publishable_key",
+	       "stripe.default_currency",
+	       "stripe.automatic_tax",
 	    //    "stripe.webhook_secret",
 	       "observability.loki.url",
 	       "observability.loki.enabled",
 	       "observability.mimir.url",
 	       "observability.mimir.enabled",
+	       "observability.tracing.enabled",
+	       "observability.tracing.endpoint",
+	       "observability.tracing.insecure",
+	       "observability.tracing.service_name",
+	       "observability.tracing.sample_ratio",
+	       "observability.metrics.enabled",
+	       "observability.metrics.endpoint",
+	       "observability.metrics.insecure",
+	       "observability.metrics.interval_seconds",
+	       "rate_limit.enabled",
+	       "rate_limit.store",
+	       "invitations.signing_key",
+	       "invitations.ttl_hours",
+	       "invitations.accept_url",
+	       "mail.driver",
+	       "mail.from",
+	       "mail.smtp.host",
+	       "mail.smtp.port",
+	       "mail.smtp.username",
+	       "mail.smtp.password",
+	       "metering.enabled",
+	       "metering.interval_minutes",
+	       "payment_enforcement.enabled",
+	       "payment_enforcement.grace_period_hours",
+	       "payment_enforcement.interval_minutes",
        }
        for _, key := range envVars {
 	       if err := viper.BindEnv(key); err != nil {
@@ -106,6 +281,18 @@ func LoadConfig(path string) (config Config, err error) {
 	       }
        }
 
+	// Rate limiting is on unless explicitly disabled
+	viper.SetDefault("rate_limit.enabled", true)
+	viper.SetDefault("rate_limit.store", "memory")
+
+	viper.SetDefault("auth.service_account_tokens.ttl_minutes", 60)
+	viper.SetDefault("invitations.ttl_hours", 168)
+	viper.SetDefault("mail.driver", "log")
+	viper.SetDefault("mail.smtp.port", 587)
+	viper.SetDefault("metering.interval_minutes", 15)
+	viper.SetDefault("payment_enforcement.grace_period_hours", 168)
+	viper.SetDefault("payment_enforcement.interval_minutes", 15)
+
 	err = viper.ReadInConfig()
 	if err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
@@ -0,0 +1,32 @@
+package db
+
+// Access request (just-in-time elevation) SQL queries
+const (
+	// CreateAccessRequestQuery inserts a pending access request.
+	CreateAccessRequestQuery = `
+		INSERT INTO ktrlplane.access_requests (request_id, user_id, role_id, scope_type, scope_id, justification, duration_hours, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, 'pending', NOW())
+		RETURNING request_id, user_id, role_id, scope_type, scope_id, justification, duration_hours, status, decided_by, decided_at, expires_at, created_at`
+
+	// ListAccessRequestsForScopeQuery lists access requests on a scope, optionally filtered by status ($3, '' for all).
+	ListAccessRequestsForScopeQuery = `
+		SELECT request_id, user_id, role_id, scope_type, scope_id, justification, duration_hours, status, decided_by, decided_at, expires_at, created_at
+		FROM ktrlplane.access_requests
+		WHERE scope_type = $1 AND scope_id = $2
+		  AND ($3 = '' OR status = $3)
+		ORDER BY created_at DESC`
+
+	// LockAccessRequestQuery selects an access request on a scope for update.
+	LockAccessRequestQuery = `
+		SELECT request_id, user_id, role_id, scope_type, scope_id, justification, duration_hours, status, decided_by, decided_at, expires_at, created_at
+		FROM ktrlplane.access_requests
+		WHERE request_id = $1 AND scope_type = $2 AND scope_id = $3
+		FOR UPDATE`
+
+	// DecideAccessRequestQuery records the decision on a pending access request.
+	DecideAccessRequestQuery = `
+		UPDATE ktrlplane.access_requests
+		SET status = $2, decided_by = $3, decided_at = NOW(), expires_at = $4
+		WHERE request_id = $1 AND status = 'pending'
+		RETURNING decided_at`
+)
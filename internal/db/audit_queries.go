@@ -0,0 +1,30 @@
+package db
+
+// Audit event SQL queries
+const (
+	// InsertAuditEventQuery records an audit event. $6 is a JSON object with event details.
+	InsertAuditEventQuery = `
+		INSERT INTO ktrlplane.audit_events (event_type, actor_id, subject_id, scope_type, scope_id, details)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	// SweepExpiredRoleAssignmentsQuery deletes expired role assignments and records a
+	// 'role_assignment.expired' audit event for each, archiving the deleted row in its details.
+	// It returns the user IDs whose assignments were removed.
+	SweepExpiredRoleAssignmentsQuery = `
+		WITH expired AS (
+			DELETE FROM ktrlplane.role_assignments
+			WHERE expires_at IS NOT NULL AND expires_at <= NOW()
+			RETURNING assignment_id, user_id, role_id, scope_type, scope_id, assigned_by, created_at, expires_at
+		)
+		INSERT INTO ktrlplane.audit_events (event_type, actor_id, subject_id, scope_type, scope_id, details)
+		SELECT 'role_assignment.expired', 'system', user_id, scope_type, scope_id,
+			jsonb_build_object(
+				'assignment_id', assignment_id,
+				'role_id', role_id,
+				'assigned_by', assigned_by,
+				'created_at', created_at,
+				'expires_at', expires_at
+			)
+		FROM expired
+		RETURNING subject_id`
+)
@@ -4,7 +4,7 @@ package db
 
 const GetBillingAccountQuery = `
 SELECT billing_account_id, scope_type, scope_id, stripe_customer_id, 
-       stripe_subscription_id, created_at, updated_at
+       stripe_subscription_id, created_at, updated_at, currency, billing_interval
 FROM ktrlplane.billing_accounts 
 WHERE scope_type = $1 AND scope_id = $2
 `
@@ -14,7 +14,7 @@ INSERT INTO ktrlplane.billing_accounts
 (billing_account_id, scope_type, scope_id, created_at, updated_at)
 VALUES ($1, $2, $3, NOW(), NOW())
 RETURNING billing_account_id, scope_type, scope_id, stripe_customer_id, 
-          stripe_subscription_id, created_at, updated_at
+          stripe_subscription_id, created_at, updated_at, currency, billing_interval
 `
 
 const UpdateBillingAccountQuery = `
@@ -22,15 +22,15 @@ UPDATE ktrlplane.billing_accounts
 SET updated_at = NOW()
 WHERE scope_type = $1 AND scope_id = $2
 RETURNING billing_account_id, scope_type, scope_id, stripe_customer_id, 
-          stripe_subscription_id, created_at, updated_at
+          stripe_subscription_id, created_at, updated_at, currency, billing_interval
 `
 
 const UpdateBillingAccountStripeQuery = `
 UPDATE ktrlplane.billing_accounts 
-SET stripe_customer_id = $3, stripe_subscription_id = $4, updated_at = NOW()
+SET stripe_customer_id = $3, stripe_subscription_id = $4, currency = COALESCE($5, currency), updated_at = NOW()
 WHERE scope_type = $1 AND scope_id = $2
 RETURNING billing_account_id, scope_type, scope_id, stripe_customer_id, 
-          stripe_subscription_id, created_at, updated_at
+          stripe_subscription_id, created_at, updated_at, currency, billing_interval
 `
 
 const UpdateBillingAccountSubscriptionQuery = `
@@ -38,7 +38,7 @@ UPDATE ktrlplane.billing_accounts
 SET stripe_subscription_id = $3, updated_at = NOW()
 WHERE scope_type = $1 AND scope_id = $2
 RETURNING billing_account_id, scope_type, scope_id, stripe_customer_id, 
-          stripe_subscription_id, created_at, updated_at
+          stripe_subscription_id, created_at, updated_at, currency, billing_interval
 `
 
 const UpdateBillingAccountStatusQuery = `
@@ -46,20 +46,192 @@ UPDATE ktrlplane.billing_accounts
 SET updated_at = NOW()
 WHERE scope_type = $1 AND scope_id = $2
 RETURNING billing_account_id, scope_type, scope_id, stripe_customer_id, 
-          stripe_subscription_id, created_at, updated_at
+          stripe_subscription_id, created_at, updated_at, currency, billing_interval
 `
 
+// GetResourceCountsOrgQuery counts resources by type, SKU and project for the projects
+// billed to organization $1.
 const GetResourceCountsOrgQuery = `
-SELECT r.type, COALESCE(r.sku, 'free') as sku, COUNT(*) as count
+SELECT r.type, COALESCE(r.sku, 'free') as sku, r.project_id, COUNT(*) as count
 FROM ktrlplane.resources r
 JOIN ktrlplane.projects p ON r.project_id = p.project_id
-WHERE p.org_id = $1
-GROUP BY r.type, COALESCE(r.sku, 'free')
+WHERE p.org_id = $1 AND p.inherits_billing_from_org
+GROUP BY r.type, COALESCE(r.sku, 'free'), r.project_id
 `
 
+// GetResourceCountsProjectQuery counts resources by type and SKU for project $1, unless
+// the project is billed to its organization.
 const GetResourceCountsProjectQuery = `
-SELECT r.type, COALESCE(r.sku, 'free') as sku, COUNT(*) as count
+SELECT r.type, COALESCE(r.sku, 'free') as sku, r.project_id, COUNT(*) as count
 FROM ktrlplane.resources r
-WHERE r.project_id = $1
-GROUP BY r.type, COALESCE(r.sku, 'free')
+JOIN ktrlplane.projects p ON r.project_id = p.project_id
+WHERE r.project_id = $1 AND (p.org_id IS NULL OR NOT p.inherits_billing_from_org)
+GROUP BY r.type, COALESCE(r.sku, 'free'), r.project_id
+`
+
+// GetProjectBillingScopeQuery returns the organization of project $1 and whether the
+// project is billed to it.
+const GetProjectBillingScopeQuery = `
+SELECT org_id, inherits_billing_from_org
+FROM ktrlplane.projects
+WHERE project_id = $1
+`
+
+// LockProjectBillingScopeQuery is GetProjectBillingScopeQuery holding a row lock, so that
+// concurrent moves of the same project are serialized.
+const LockProjectBillingScopeQuery = GetProjectBillingScopeQuery + `FOR UPDATE
+`
+
+// UpdateProjectBillingInheritanceQuery sets whether project $1 is billed to its organization.
+const UpdateProjectBillingInheritanceQuery = `
+UPDATE ktrlplane.projects
+SET inherits_billing_from_org = $2, updated_at = NOW()
+WHERE project_id = $1
+`
+
+// GetProjectPaidResourceCountsQuery counts the paid resources of project $1 by Stripe price.
+const GetProjectPaidResourceCountsQuery = `
+SELECT stripe_price_id, COUNT(*) as count
+FROM ktrlplane.resources
+WHERE project_id = $1 AND stripe_price_id IS NOT NULL AND COALESCE(sku, 'free') <> 'free'
+GROUP BY stripe_price_id
+`
+
+// GetProjectPaidResourceGroupsQuery counts the paid resources of project $1 by type, SKU and
+// Stripe price.
+const GetProjectPaidResourceGroupsQuery = `
+SELECT type, sku, stripe_price_id, COUNT(*) as count
+FROM ktrlplane.resources
+WHERE project_id = $1 AND stripe_price_id IS NOT NULL AND COALESCE(sku, 'free') <> 'free'
+GROUP BY type, sku, stripe_price_id
+`
+
+// UpdateProjectResourcePriceQuery moves the paid resources of project $1 with type $2 and SKU $3
+// from Stripe price $4 to price $5.
+const UpdateProjectResourcePriceQuery = `
+UPDATE ktrlplane.resources
+SET stripe_price_id = $5, updated_at = NOW()
+WHERE project_id = $1 AND type = $2 AND sku = $3 AND stripe_price_id = $4
+`
+
+// ListEnforcedBillingAccountsQuery lists the billing accounts payment enforcement checks:
+// accounts with a subscription and accounts with an unresolved payment issue.
+const ListEnforcedBillingAccountsQuery = `
+SELECT billing_account_id, scope_type, scope_id, stripe_customer_id,
+       stripe_subscription_id, created_at, updated_at, currency, billing_interval
+FROM ktrlplane.billing_accounts
+WHERE stripe_subscription_id IS NOT NULL
+   OR payment_issue_since IS NOT NULL
+   OR resources_suspended_at IS NOT NULL
+`
+
+// GetPaymentEnforcementQuery returns the payment enforcement state of a billing account.
+const GetPaymentEnforcementQuery = `
+SELECT stripe_subscription_id, subscription_status, payment_issue_since, resources_suspended_at
+FROM ktrlplane.billing_accounts
+WHERE scope_type = $1 AND scope_id = $2
+`
+
+// LockPaymentEnforcementQuery is GetPaymentEnforcementQuery holding a row lock, so that
+// replicas apply each enforcement transition once.
+const LockPaymentEnforcementQuery = GetPaymentEnforcementQuery + `FOR UPDATE
+`
+
+// UpdatePaymentEnforcementQuery stores the payment enforcement state of a billing account.
+const UpdatePaymentEnforcementQuery = `
+UPDATE ktrlplane.billing_accounts
+SET subscription_status = $3, payment_issue_since = $4, resources_suspended_at = $5, updated_at = NOW()
+WHERE scope_type = $1 AND scope_id = $2
+`
+
+// billedResourcesFilter matches the resources r of projects p billed to scope $1/$2.
+const billedResourcesFilter = `
+r.project_id = p.project_id
+AND (($1 = 'organization' AND p.org_id = $2 AND p.inherits_billing_from_org)
+  OR ($1 = 'project' AND p.project_id = $2 AND (p.org_id IS NULL OR NOT p.inherits_billing_from_org)))
+`
+
+// SuspendBilledResourcesQuery suspends the paid resources billed to scope $1/$2.
+const SuspendBilledResourcesQuery = `
+UPDATE ktrlplane.resources r
+SET status = 'Suspended', updated_at = NOW()
+FROM ktrlplane.projects p
+WHERE ` + billedResourcesFilter + `AND COALESCE(r.sku, 'free') <> 'free' AND r.status <> 'Suspended'
+RETURNING r.resource_id
+`
+
+// ReactivateBilledResourcesQuery returns the suspended resources billed to scope $1/$2 to
+// 'Updating', so that the operator redeploys them.
+const ReactivateBilledResourcesQuery = `
+UPDATE ktrlplane.resources r
+SET status = 'Updating', updated_at = NOW()
+FROM ktrlplane.projects p
+WHERE ` + billedResourcesFilter + `AND r.status = 'Suspended'
+RETURNING r.resource_id
+`
+
+// ListBilledProjectIDsQuery lists the projects whose resources may appear on the invoices of
+// scope $1/$2: every project of an organization, or the project itself.
+const ListBilledProjectIDsQuery = `
+SELECT project_id
+FROM ktrlplane.projects
+WHERE ($1 = 'organization' AND org_id = $2) OR ($1 = 'project' AND project_id = $2)
+`
+
+// InsertSubscriptionItemSharesQuery records the project shares $3 of subscription item $1 from
+// time $2 on.
+const InsertSubscriptionItemSharesQuery = `
+INSERT INTO ktrlplane.subscription_item_shares (subscription_item_id, effective_at, shares)
+VALUES ($1, $2, $3)
+ON CONFLICT (subscription_item_id, effective_at) DO UPDATE SET shares = EXCLUDED.shares
+`
+
+// ListSubscriptionItemSharesQuery lists the share snapshots of subscription item $1, oldest first.
+const ListSubscriptionItemSharesQuery = `
+SELECT effective_at, shares
+FROM ktrlplane.subscription_item_shares
+WHERE subscription_item_id = $1
+ORDER BY effective_at
+`
+
+// GetBillingTrialQuery returns the trial granted to billing account $1/$2 and when its trial
+// was used.
+const GetBillingTrialQuery = `
+SELECT trial_days, trial_used_at
+FROM ktrlplane.billing_accounts
+WHERE scope_type = $1 AND scope_id = $2
+`
+
+// UpdateBillingTrialDaysQuery grants trial length $3 to billing account $1/$2; NULL restores
+// the product defaults.
+const UpdateBillingTrialDaysQuery = `
+UPDATE ktrlplane.billing_accounts
+SET trial_days = $3, updated_at = NOW()
+WHERE scope_type = $1 AND scope_id = $2
+RETURNING trial_days, trial_used_at
+`
+
+// MarkBillingTrialUsedQuery records that billing account $1/$2 has had its trial.
+const MarkBillingTrialUsedQuery = `
+UPDATE ktrlplane.billing_accounts
+SET trial_used_at = COALESCE(trial_used_at, NOW()), updated_at = NOW()
+WHERE scope_type = $1 AND scope_id = $2
+`
+
+// UpdateBillingIntervalQuery sets the billing interval of billing account $1/$2 to $3.
+const UpdateBillingIntervalQuery = `
+UPDATE ktrlplane.billing_accounts
+SET billing_interval = $3, updated_at = NOW()
+WHERE scope_type = $1 AND scope_id = $2
+RETURNING billing_account_id, scope_type, scope_id, stripe_customer_id,
+          stripe_subscription_id, created_at, updated_at, currency, billing_interval
+`
+
+// UpdateBilledResourcePriceQuery moves the resources billed to scope $1/$2 from Stripe price
+// $3 to price $4.
+const UpdateBilledResourcePriceQuery = `
+UPDATE ktrlplane.resources r
+SET stripe_price_id = $4, updated_at = NOW()
+FROM ktrlplane.projects p
+WHERE ` + billedResourcesFilter + `AND r.stripe_price_id = $3
 `
@@ -0,0 +1,50 @@
+package db
+
+// Invitation SQL queries
+const (
+	// invitationColumns is the column list scanned into models.Invitation.
+	invitationColumns = `invitation_id, email, role_id, scope_type, scope_id, invited_by, status, expires_at,
+		sent_count, last_sent_at, accepted_by, accepted_at, revoked_by, revoked_at, created_at`
+
+	// CreateInvitationQuery inserts a pending invitation.
+	CreateInvitationQuery = `
+		INSERT INTO ktrlplane.invitations (invitation_id, email, role_id, scope_type, scope_id, invited_by, token_hash, status, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, 'pending', $8)
+		RETURNING ` + invitationColumns
+
+	// ListInvitationsForScopeQuery lists invitations on a scope, optionally filtered by status ($3, '' for all).
+	ListInvitationsForScopeQuery = `
+		SELECT ` + invitationColumns + `
+		FROM ktrlplane.invitations
+		WHERE scope_type = $1 AND scope_id = $2
+		  AND ($3 = '' OR status = $3)
+		ORDER BY created_at DESC`
+
+	// LockInvitationQuery selects an invitation and its token hash for update.
+	LockInvitationQuery = `
+		SELECT ` + invitationColumns + `, token_hash
+		FROM ktrlplane.invitations
+		WHERE invitation_id = $1
+		FOR UPDATE`
+
+	// ResendInvitationQuery rotates the token of a pending invitation and extends its expiry.
+	ResendInvitationQuery = `
+		UPDATE ktrlplane.invitations
+		SET token_hash = $2, expires_at = $3, sent_count = sent_count + 1, last_sent_at = NOW()
+		WHERE invitation_id = $1 AND status = 'pending'
+		RETURNING ` + invitationColumns
+
+	// RevokeInvitationQuery revokes a pending invitation.
+	RevokeInvitationQuery = `
+		UPDATE ktrlplane.invitations
+		SET status = 'revoked', revoked_by = $2, revoked_at = NOW()
+		WHERE invitation_id = $1 AND status = 'pending'
+		RETURNING ` + invitationColumns
+
+	// AcceptInvitationQuery marks a pending invitation as accepted by a user.
+	AcceptInvitationQuery = `
+		UPDATE ktrlplane.invitations
+		SET status = 'accepted', accepted_by = $2, accepted_at = NOW()
+		WHERE invitation_id = $1 AND status = 'pending'
+		RETURNING ` + invitationColumns
+)
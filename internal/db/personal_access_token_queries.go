@@ -0,0 +1,53 @@
+package db
+
+// Personal access token SQL queries
+const (
+	// personalAccessTokenColumns is the column list scanned by the service layer for a token.
+	personalAccessTokenColumns = `token_id, user_id, name, scope_type, scope_id, actions, expires_at, last_used_at, created_at`
+
+	// CreatePersonalAccessTokenQuery stores the hash of a new personal access token.
+	CreatePersonalAccessTokenQuery = `
+		INSERT INTO ktrlplane.personal_access_tokens
+			(token_id, user_id, name, token_hash, scope_type, scope_id, actions, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING ` + personalAccessTokenColumns
+
+	// ListPersonalAccessTokensQuery lists the tokens of a user, including expired ones.
+	ListPersonalAccessTokensQuery = `
+		SELECT ` + personalAccessTokenColumns + `
+		FROM ktrlplane.personal_access_tokens
+		WHERE user_id = $1
+		ORDER BY created_at DESC`
+
+	// DeletePersonalAccessTokenQuery revokes a token of a user.
+	DeletePersonalAccessTokenQuery = `
+		DELETE FROM ktrlplane.personal_access_tokens
+		WHERE token_id = $1 AND user_id = $2`
+
+	// GetPersonalAccessTokenByHashQuery looks up an unexpired token with its owner's email and name.
+	GetPersonalAccessTokenByHashQuery = `
+		SELECT t.token_id, t.user_id, t.name, t.scope_type, t.scope_id, t.actions, t.expires_at, t.last_used_at, t.created_at,
+			u.email, u.name
+		FROM ktrlplane.personal_access_tokens t
+		JOIN ktrlplane.users u ON u.user_id = t.user_id
+		WHERE t.token_hash = $1 AND t.expires_at > NOW()`
+
+	// TouchPersonalAccessTokenQuery records that a token was used.
+	TouchPersonalAccessTokenQuery = `
+		UPDATE ktrlplane.personal_access_tokens
+		SET last_used_at = NOW()
+		WHERE token_id = $1`
+
+	// ScopeWithinQuery reports whether scope ($3, $4) is scope ($1, $2) or one of its descendants
+	// (organization > project > resource).
+	ScopeWithinQuery = `
+		SELECT ($1::text = $3::text AND $2::text = $4::text)
+			OR ($1 = 'organization' AND $3 = 'project' AND EXISTS (
+				SELECT 1 FROM ktrlplane.projects WHERE project_id = $4 AND org_id = $2))
+			OR ($1 = 'organization' AND $3 = 'resource' AND EXISTS (
+				SELECT 1 FROM ktrlplane.resources r
+				JOIN ktrlplane.projects p ON p.project_id = r.project_id
+				WHERE r.resource_id = $4 AND p.org_id = $2))
+			OR ($1 = 'project' AND $3 = 'resource' AND EXISTS (
+				SELECT 1 FROM ktrlplane.resources WHERE resource_id = $4 AND project_id = $2))`
+)
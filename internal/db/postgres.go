@@ -46,6 +46,7 @@ func InitDB(cfg config.DatabaseConfig) error {
 	// Configure connection pool limits
 	poolConfig.MaxConns = 20 // Increase from default 4 to handle concurrent requests
 	poolConfig.MinConns = 2  // Keep minimum connections warm
+	poolConfig.ConnConfig.Tracer = queryTracer{}
 
 	dbPool, err = pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
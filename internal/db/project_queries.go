@@ -5,10 +5,10 @@ const (
 	CreateProjectWithTimestampsQuery = `
 		INSERT INTO ktrlplane.projects (project_id, org_id, name, status, created_at, updated_at) 
 		VALUES ($1, $2, $3, $4, NOW(), NOW()) 
-		RETURNING created_at, updated_at`
+		RETURNING inherits_billing_from_org, created_at, updated_at`
 
 	GetProjectByIDQuery = `
-		SELECT project_id, org_id, name, status, created_at, updated_at FROM ktrlplane.projects WHERE project_id = $1`
+		SELECT project_id, org_id, name, status, inherits_billing_from_org, created_at, updated_at FROM ktrlplane.projects WHERE project_id = $1`
 
 	UpdateProjectQuery = `
 		UPDATE ktrlplane.projects SET name = $2, updated_at = NOW() WHERE project_id = $1`
@@ -17,7 +17,7 @@ const (
 		DELETE FROM ktrlplane.projects WHERE project_id = $1`
 
 	ListProjectsForUserQuery = `
-		SELECT DISTINCT p.project_id, p.org_id, p.name, p.status, p.created_at, p.updated_at
+		SELECT DISTINCT p.project_id, p.org_id, p.name, p.status, p.inherits_billing_from_org, p.created_at, p.updated_at
 		FROM ktrlplane.projects p
 		LEFT JOIN ktrlplane.role_assignments ra_proj ON ra_proj.scope_id = p.project_id AND ra_proj.scope_type = 'project'
 		LEFT JOIN ktrlplane.role_assignments ra_org ON ra_org.scope_id = p.org_id AND ra_org.scope_type = 'organization'
@@ -0,0 +1,204 @@
+package db
+
+import "strings"
+
+// namedQueries lists every SQL constant in this package by name so that
+// traces can identify a statement by its constant rather than its text.
+// Add new query constants here when they are introduced.
+// When two constants share identical SQL, the first entry wins.
+var namedQueries = []struct {
+	name string
+	sql  string
+}{
+	// Organizations
+	{"CreateOrganization", CreateOrganization},
+	{"GetOrganizationsForUserQuery", GetOrganizationsForUserQuery},
+	{"GetOrganizationByIDQuery", GetOrganizationByIDQuery},
+
+	// Projects
+	{"CreateProjectWithTimestampsQuery", CreateProjectWithTimestampsQuery},
+	{"GetProjectByIDQuery", GetProjectByIDQuery},
+	{"UpdateProjectQuery", UpdateProjectQuery},
+	{"DeleteProjectQuery", DeleteProjectQuery},
+	{"ListProjectsForUserQuery", ListProjectsForUserQuery},
+
+	// Resources
+	{"CreateResourceQuery", CreateResourceQuery},
+	{"GetResourceByIDQuery", GetResourceByIDQuery},
+	{"ListResourcesQuery", ListResourcesQuery},
+	{"UpdateResourceQuery", UpdateResourceQuery},
+	{"DeleteResourceQuery", DeleteResourceQuery},
+	{"ListAllUserResourcesQuery", ListAllUserResourcesQuery},
+
+	// Users
+	{"CreateUserQuery", CreateUserQuery},
+	{"GetUserByIDQuery", GetUserByIDQuery},
+	{"UpdateUserEmailQuery", UpdateUserEmailQuery},
+	{"UpdateUserNameQuery", UpdateUserNameQuery},
+	{"SearchUsersQuery", SearchUsersQuery},
+	{"FindPlaceholderUserByEmailQuery", FindPlaceholderUserByEmailQuery},
+	{"TransferRoleAssignmentsQuery", TransferRoleAssignmentsQuery},
+	{"DeletePlaceholderUserQuery", DeletePlaceholderUserQuery},
+	{"CreatePlaceholderUserQuery", CreatePlaceholderUserQuery},
+	{"GetUserIDForIdentityQuery", GetUserIDForIdentityQuery},
+	{"LockUsersForMergeQuery", LockUsersForMergeQuery},
+	{"MergeDuplicateRoleAssignmentsQuery", MergeDuplicateRoleAssignmentsQuery},
+	{"DeleteDuplicateRoleAssignmentsQuery", DeleteDuplicateRoleAssignmentsQuery},
+	{"ReassignRoleAssignmentGrantorQuery", ReassignRoleAssignmentGrantorQuery},
+	{"ReassignAccessRequestsQuery", ReassignAccessRequestsQuery},
+	{"ReassignAccessRequestDeciderQuery", ReassignAccessRequestDeciderQuery},
+	{"ReassignInvitationsQuery", ReassignInvitationsQuery},
+	{"ReassignIdentityLinksQuery", ReassignIdentityLinksQuery},
+	{"UpsertIdentityLinkQuery", UpsertIdentityLinkQuery},
+	{"CreateAccountLinkTokenQuery", CreateAccountLinkTokenQuery},
+	{"ConsumeAccountLinkTokenQuery", ConsumeAccountLinkTokenQuery},
+	{"GetUserProfileQuery", GetUserProfileQuery},
+	{"SetUserDisplayNameQuery", SetUserDisplayNameQuery},
+	{"ListUserRoleNamesQuery", ListUserRoleNamesQuery},
+	{"ListUserAccessQuery", ListUserAccessQuery},
+	{"ListOwnersOfOwnedScopesQuery", ListOwnersOfOwnedScopesQuery},
+
+	// RBAC
+	{"GetAllRolesQuery", GetAllRolesQuery},
+	{"GetPermissionsForRoleQuery", GetPermissionsForRoleQuery},
+	{"AssignRoleWithTransactionQuery", AssignRoleWithTransactionQuery},
+	{"CheckPermissionWithInheritanceQuery", CheckPermissionWithInheritanceQuery},
+	{"ListPermissionsWithInheritanceQuery", ListPermissionsWithInheritanceQuery},
+	{"ListPermissionsWithExpiryQuery", ListPermissionsWithExpiryQuery},
+	{"BatchCheckPermissionsQuery", BatchCheckPermissionsQuery},
+	{"ExplainPermissionGrantsQuery", ExplainPermissionGrantsQuery},
+	{"GetRolesGrantingActionQuery", GetRolesGrantingActionQuery},
+	{"GetUserRolesQuery", GetUserRolesQuery},
+	{"GetRoleAssignmentsWithDetailsQuery", GetRoleAssignmentsWithDetailsQuery},
+	{"GetRoleAssignmentsWithInheritanceQuery", GetRoleAssignmentsWithInheritanceQuery},
+	{"DeleteRoleAssignmentQuery", DeleteRoleAssignmentQuery},
+
+	// Billing
+	{"GetBillingAccountQuery", GetBillingAccountQuery},
+	{"CreateBillingAccountQuery", CreateBillingAccountQuery},
+	{"UpdateBillingAccountStatusQuery", UpdateBillingAccountStatusQuery},
+	{"UpdateBillingAccountQuery", UpdateBillingAccountQuery},
+	{"UpdateBillingAccountStripeQuery", UpdateBillingAccountStripeQuery},
+	{"UpdateBillingAccountSubscriptionQuery", UpdateBillingAccountSubscriptionQuery},
+	{"GetResourceCountsOrgQuery", GetResourceCountsOrgQuery},
+	{"GetResourceCountsProjectQuery", GetResourceCountsProjectQuery},
+	{"GetProjectBillingScopeQuery", GetProjectBillingScopeQuery},
+	{"LockProjectBillingScopeQuery", LockProjectBillingScopeQuery},
+	{"UpdateProjectBillingInheritanceQuery", UpdateProjectBillingInheritanceQuery},
+	{"GetProjectPaidResourceCountsQuery", GetProjectPaidResourceCountsQuery},
+	{"GetProjectPaidResourceGroupsQuery", GetProjectPaidResourceGroupsQuery},
+	{"UpdateProjectResourcePriceQuery", UpdateProjectResourcePriceQuery},
+	{"ListEnforcedBillingAccountsQuery", ListEnforcedBillingAccountsQuery},
+	{"GetPaymentEnforcementQuery", GetPaymentEnforcementQuery},
+	{"LockPaymentEnforcementQuery", LockPaymentEnforcementQuery},
+	{"UpdatePaymentEnforcementQuery", UpdatePaymentEnforcementQuery},
+	{"SuspendBilledResourcesQuery", SuspendBilledResourcesQuery},
+	{"ReactivateBilledResourcesQuery", ReactivateBilledResourcesQuery},
+	{"ListBilledProjectIDsQuery", ListBilledProjectIDsQuery},
+	{"InsertSubscriptionItemSharesQuery", InsertSubscriptionItemSharesQuery},
+	{"ListSubscriptionItemSharesQuery", ListSubscriptionItemSharesQuery},
+	{"GetBillingTrialQuery", GetBillingTrialQuery},
+	{"UpdateBillingTrialDaysQuery", UpdateBillingTrialDaysQuery},
+	{"MarkBillingTrialUsedQuery", MarkBillingTrialUsedQuery},
+	{"UpdateBillingIntervalQuery", UpdateBillingIntervalQuery},
+	{"UpdateBilledResourcePriceQuery", UpdateBilledResourcePriceQuery},
+
+	// Usage metering
+	{"ListMeteredResourcesQuery", ListMeteredResourcesQuery},
+	{"ListRecordedUsageHoursQuery", ListRecordedUsageHoursQuery},
+	{"InsertUsageRecordQuery", InsertUsageRecordQuery},
+	{"LockPendingUsageRecordsQuery", LockPendingUsageRecordsQuery},
+	{"MarkUsageRecordReportedQuery", MarkUsageRecordReportedQuery},
+	{"MarkUsageRecordFailedQuery", MarkUsageRecordFailedQuery},
+	{"LockUsageRemainderQuery", LockUsageRemainderQuery},
+	{"UpdateUsageRemainderQuery", UpdateUsageRemainderQuery},
+	{"ListProjectUsageQuery", ListProjectUsageQuery},
+
+	// Rate limiting
+	{"TakeRateLimitTokenQuery", TakeRateLimitTokenQuery},
+	{"DeleteStaleRateLimitBucketsQuery", DeleteStaleRateLimitBucketsQuery},
+
+	// Access requests
+	{"CreateAccessRequestQuery", CreateAccessRequestQuery},
+	{"ListAccessRequestsForScopeQuery", ListAccessRequestsForScopeQuery},
+	{"LockAccessRequestQuery", LockAccessRequestQuery},
+	{"DecideAccessRequestQuery", DecideAccessRequestQuery},
+
+	// Invitations
+	{"CreateInvitationQuery", CreateInvitationQuery},
+	{"ListInvitationsForScopeQuery", ListInvitationsForScopeQuery},
+	{"LockInvitationQuery", LockInvitationQuery},
+	{"ResendInvitationQuery", ResendInvitationQuery},
+	{"RevokeInvitationQuery", RevokeInvitationQuery},
+	{"AcceptInvitationQuery", AcceptInvitationQuery},
+
+	// Service accounts
+	{"CreateServiceAccountUserQuery", CreateServiceAccountUserQuery},
+	{"CreateServiceAccountQuery", CreateServiceAccountQuery},
+	{"ListServiceAccountsForScopeQuery", ListServiceAccountsForScopeQuery},
+	{"GetServiceAccountQuery", GetServiceAccountQuery},
+	{"GetServiceAccountByIDQuery", GetServiceAccountByIDQuery},
+	{"GetServiceAccountScopeQuery", GetServiceAccountScopeQuery},
+	{"GetServiceAccountByClientIDQuery", GetServiceAccountByClientIDQuery},
+	{"UpdateServiceAccountQuery", UpdateServiceAccountQuery},
+	{"UpdateServiceAccountUserNameQuery", UpdateServiceAccountUserNameQuery},
+	{"DeleteServiceAccountQuery", DeleteServiceAccountQuery},
+	{"DeleteServiceAccountsForOrganizationQuery", DeleteServiceAccountsForOrganizationQuery},
+	{"DeleteServiceAccountsForProjectQuery", DeleteServiceAccountsForProjectQuery},
+	{"TouchServiceAccountQuery", TouchServiceAccountQuery},
+	{"CreateServiceAccountSecretQuery", CreateServiceAccountSecretQuery},
+	{"ListServiceAccountSecretsQuery", ListServiceAccountSecretsQuery},
+	{"DeleteServiceAccountSecretQuery", DeleteServiceAccountSecretQuery},
+	{"UseServiceAccountSecretQuery", UseServiceAccountSecretQuery},
+
+	// Personal access tokens
+	{"CreatePersonalAccessTokenQuery", CreatePersonalAccessTokenQuery},
+	{"ListPersonalAccessTokensQuery", ListPersonalAccessTokensQuery},
+	{"DeletePersonalAccessTokenQuery", DeletePersonalAccessTokenQuery},
+	{"GetPersonalAccessTokenByHashQuery", GetPersonalAccessTokenByHashQuery},
+	{"TouchPersonalAccessTokenQuery", TouchPersonalAccessTokenQuery},
+	{"ScopeWithinQuery", ScopeWithinQuery},
+
+	// Teams
+	{"CreateTeamQuery", CreateTeamQuery},
+	{"ListTeamsForOrganizationQuery", ListTeamsForOrganizationQuery},
+	{"GetTeamQuery", GetTeamQuery},
+	{"GetTeamOrganizationQuery", GetTeamOrganizationQuery},
+	{"UpdateTeamQuery", UpdateTeamQuery},
+	{"DeleteTeamQuery", DeleteTeamQuery},
+	{"DeleteTeamsForOrganizationQuery", DeleteTeamsForOrganizationQuery},
+	{"ListTeamMembersQuery", ListTeamMembersQuery},
+	{"ListMembersOfTeamsQuery", ListMembersOfTeamsQuery},
+	{"AddTeamMemberQuery", AddTeamMemberQuery},
+	{"RemoveTeamMemberQuery", RemoveTeamMemberQuery},
+	{"SyncIdPTeamMembershipsQuery", SyncIdPTeamMembershipsQuery},
+	{"ReassignTeamMembershipsQuery", ReassignTeamMembershipsQuery},
+
+	// Audit events
+	{"InsertAuditEventQuery", InsertAuditEventQuery},
+	{"SweepExpiredRoleAssignmentsQuery", SweepExpiredRoleAssignmentsQuery},
+}
+
+// queryNamesBySQL is the reverse index of namedQueries.
+var queryNamesBySQL = func() map[string]string {
+	m := make(map[string]string, len(namedQueries))
+	for _, q := range namedQueries {
+		if _, exists := m[q.sql]; !exists {
+			m[q.sql] = q.name
+		}
+	}
+	return m
+}()
+
+// QueryName returns the name of the constant holding sql. Statements that are
+// not declared in this package are named after their leading SQL keyword.
+func QueryName(sql string) string {
+	if name, ok := queryNamesBySQL[sql]; ok {
+		return name
+	}
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "query"
+	}
+	return strings.ToUpper(fields[0])
+}
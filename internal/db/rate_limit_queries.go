@@ -0,0 +1,24 @@
+package db
+
+// Rate limiting SQL queries
+
+// TakeRateLimitTokenQuery refills the bucket $1 (capacity $2, refill $3 tokens per second)
+// for the time elapsed since its last update and takes one token if available.
+// It returns the tokens left and whether the request was allowed.
+const TakeRateLimitTokenQuery = `
+INSERT INTO ktrlplane.rate_limit_buckets AS b (bucket_key, tokens, allowed, updated_at)
+VALUES ($1, $2::double precision - 1, TRUE, NOW())
+ON CONFLICT (bucket_key) DO UPDATE SET
+    allowed = LEAST($2::double precision, b.tokens + EXTRACT(EPOCH FROM (NOW() - b.updated_at))::double precision * $3::double precision) >= 1,
+    tokens = LEAST($2::double precision, b.tokens + EXTRACT(EPOCH FROM (NOW() - b.updated_at))::double precision * $3::double precision)
+             - CASE WHEN LEAST($2::double precision, b.tokens + EXTRACT(EPOCH FROM (NOW() - b.updated_at))::double precision * $3::double precision) >= 1
+                    THEN 1 ELSE 0 END,
+    updated_at = NOW()
+RETURNING tokens, allowed
+`
+
+// DeleteStaleRateLimitBucketsQuery removes buckets untouched for longer than $1 seconds.
+const DeleteStaleRateLimitBucketsQuery = `
+DELETE FROM ktrlplane.rate_limit_buckets
+WHERE updated_at < NOW() - make_interval(secs => $1)
+`
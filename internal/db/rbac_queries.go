@@ -18,20 +18,35 @@ const (
 		WHERE rp.role_id = $1;`
 
 	// AssignRoleWithTransactionQuery inserts a role assignment within a transaction.
+	// $7 is the expiry (NULL for a permanent assignment). Re-assigning an existing role never
+	// shortens it: a permanent assignment stays permanent and the later expiry wins.
 	AssignRoleWithTransactionQuery = `
-		INSERT INTO ktrlplane.role_assignments (assignment_id, user_id, role_id, scope_type, scope_id, assigned_by, created_at) 
-		VALUES ($1, $2, $3, $4, $5, $6, NOW()) 
-		ON CONFLICT (user_id, role_id, scope_type, scope_id) DO NOTHING`
+		INSERT INTO ktrlplane.role_assignments (assignment_id, user_id, role_id, scope_type, scope_id, assigned_by, created_at, expires_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), $7) 
+		ON CONFLICT (user_id, role_id, scope_type, scope_id) DO UPDATE
+		SET expires_at = CASE
+				WHEN EXCLUDED.expires_at IS NULL THEN NULL
+				ELSE GREATEST(role_assignments.expires_at, EXCLUDED.expires_at)
+			END,
+			updated_at = NOW()
+		WHERE role_assignments.expires_at IS NOT NULL`
 
 	// AllPermissionsWithInheritanceCTE is the base CTE for permission inheritance logic.
+	// Roles are resolved for the user and the teams the user belongs to.
+	// Each row carries the expiry of the granting assignment (NULL for permanent ones).
 	AllPermissionsWithInheritanceCTE = `
-			WITH all_permissions AS (
+			WITH principals AS (
+				SELECT $1::text AS principal_id
+				UNION ALL
+				SELECT tm.team_id FROM ktrlplane.team_members tm WHERE tm.user_id = $1
+			),
+			all_permissions AS (
 				-- Direct permissions on the requested scope
-				SELECT DISTINCT p.action
+				SELECT DISTINCT p.action, ra.expires_at
 				FROM ktrlplane.role_assignments ra
 				JOIN ktrlplane.role_permissions rp ON ra.role_id = rp.role_id
 				JOIN ktrlplane.permissions p ON rp.permission_id = p.permission_id
-				WHERE ra.user_id = $1
+				WHERE ra.user_id IN (SELECT principal_id FROM principals)
 				  AND ra.scope_type = $2
 				  AND ra.scope_id = $3
 				  AND (ra.expires_at IS NULL OR ra.expires_at > NOW())
@@ -39,12 +54,12 @@ const (
 				UNION
 
 				-- Inherited permissions from organization (if checking project/resource)
-				SELECT DISTINCT p.action
+				SELECT DISTINCT p.action, ra.expires_at
 				FROM ktrlplane.role_assignments ra
 				JOIN ktrlplane.role_permissions rp ON ra.role_id = rp.role_id
 				JOIN ktrlplane.permissions p ON rp.permission_id = p.permission_id
 				JOIN ktrlplane.projects proj ON proj.project_id = $3 -- if scopeType is project
-				WHERE ra.user_id = $1
+				WHERE ra.user_id IN (SELECT principal_id FROM principals)
 				  AND ra.scope_type = 'organization'
 				  AND ra.scope_id = proj.org_id
 				  AND (ra.expires_at IS NULL OR ra.expires_at > NOW())
@@ -53,12 +68,12 @@ const (
 				UNION
 
 				-- Inherited permissions from project (if checking resource)
-				SELECT DISTINCT p.action
+				SELECT DISTINCT p.action, ra.expires_at
 				FROM ktrlplane.role_assignments ra
 				JOIN ktrlplane.role_permissions rp ON ra.role_id = rp.role_id
 				JOIN ktrlplane.permissions p ON rp.permission_id = p.permission_id
 				JOIN ktrlplane.resources res ON res.resource_id = $3 -- if scopeType is resource
-				WHERE ra.user_id = $1
+				WHERE ra.user_id IN (SELECT principal_id FROM principals)
 				  AND ra.scope_type = 'project'
 				  AND ra.scope_id = res.project_id
 				  AND (ra.expires_at IS NULL OR ra.expires_at > NOW())
@@ -67,13 +82,13 @@ const (
 				UNION
 
 				-- Inherited permissions from organization (if checking resource)
-				SELECT DISTINCT p.action
+				SELECT DISTINCT p.action, ra.expires_at
 				FROM ktrlplane.role_assignments ra
 				JOIN ktrlplane.role_permissions rp ON ra.role_id = rp.role_id
 				JOIN ktrlplane.permissions p ON rp.permission_id = p.permission_id
 				JOIN ktrlplane.resources res ON res.resource_id = $3 -- if scopeType is resource
 				JOIN ktrlplane.projects proj ON proj.project_id = res.project_id
-				WHERE ra.user_id = $1
+				WHERE ra.user_id IN (SELECT principal_id FROM principals)
 				  AND ra.scope_type = 'organization'
 				  AND ra.scope_id = proj.org_id
 				  AND (ra.expires_at IS NULL OR ra.expires_at > NOW())
@@ -89,6 +104,115 @@ const (
 	ListPermissionsWithInheritanceQuery = AllPermissionsWithInheritanceCTE + `
 		SELECT DISTINCT action FROM all_permissions`
 
+	// ListPermissionsWithExpiryQuery lists all actions for a user/scope with inheritance,
+	// together with the earliest expiry of an assignment granting each action.
+	ListPermissionsWithExpiryQuery = AllPermissionsWithInheritanceCTE + `
+		SELECT action, MIN(expires_at) FROM all_permissions GROUP BY action`
+
+	// BatchCheckPermissionsQuery checks many (user, scope type, scope ID, action) tuples at once,
+	// with the same inheritance and team rules as AllPermissionsWithInheritanceCTE. The four parameters are
+	// parallel text arrays; one row is returned per tuple, ordered by its zero-based position.
+	BatchCheckPermissionsQuery = `
+		WITH checks AS (
+			SELECT c.user_id, c.scope_type, c.scope_id, c.action, c.ord - 1 AS idx
+			FROM unnest($1::text[], $2::text[], $3::text[], $4::text[])
+				WITH ORDINALITY AS c(user_id, scope_type, scope_id, action, ord)
+		)
+		SELECT checks.idx, EXISTS(
+			SELECT 1
+			FROM ktrlplane.role_assignments ra
+			JOIN ktrlplane.role_permissions rp ON ra.role_id = rp.role_id
+			JOIN ktrlplane.permissions p ON rp.permission_id = p.permission_id
+			WHERE (ra.user_id = checks.user_id OR ra.user_id IN (
+				SELECT tm.team_id FROM ktrlplane.team_members tm WHERE tm.user_id = checks.user_id))
+			  AND p.action = checks.action
+			  AND (ra.expires_at IS NULL OR ra.expires_at > NOW())
+			  AND (
+				-- Direct permissions on the requested scope
+				(ra.scope_type = checks.scope_type AND ra.scope_id = checks.scope_id)
+				-- Inherited from organization (if checking project)
+				OR (checks.scope_type = 'project' AND ra.scope_type = 'organization' AND ra.scope_id IN (
+					SELECT proj.org_id FROM ktrlplane.projects proj WHERE proj.project_id = checks.scope_id))
+				-- Inherited from project (if checking resource)
+				OR (checks.scope_type = 'resource' AND ra.scope_type = 'project' AND ra.scope_id IN (
+					SELECT res.project_id FROM ktrlplane.resources res WHERE res.resource_id = checks.scope_id))
+				-- Inherited from organization (if checking resource)
+				OR (checks.scope_type = 'resource' AND ra.scope_type = 'organization' AND ra.scope_id IN (
+					SELECT proj.org_id
+					FROM ktrlplane.resources res
+					JOIN ktrlplane.projects proj ON proj.project_id = res.project_id
+					WHERE res.resource_id = checks.scope_id))
+			  )
+		) AS allowed
+		FROM checks
+		ORDER BY checks.idx`
+
+	// ExplainPermissionGrantsQuery selects the active role assignments of a user and the user's
+	// teams on a scope and its parent scopes whose role includes an action, nearest scope first.
+	ExplainPermissionGrantsQuery = `
+		WITH principals AS (
+			SELECT $1::text AS principal_id
+			UNION ALL
+			SELECT tm.team_id FROM ktrlplane.team_members tm WHERE tm.user_id = $1
+		),
+		scope_chain AS (
+			SELECT $2::text AS scope_type, $3::text AS scope_id, 0 AS depth
+
+			UNION ALL
+
+			-- Organization of a project
+			SELECT 'organization', proj.org_id, 1
+			FROM ktrlplane.projects proj
+			WHERE $2 = 'project' AND proj.project_id = $3
+
+			UNION ALL
+
+			-- Project of a resource
+			SELECT 'project', res.project_id, 1
+			FROM ktrlplane.resources res
+			WHERE $2 = 'resource' AND res.resource_id = $3
+
+			UNION ALL
+
+			-- Organization of a resource
+			SELECT 'organization', proj.org_id, 2
+			FROM ktrlplane.resources res
+			JOIN ktrlplane.projects proj ON proj.project_id = res.project_id
+			WHERE $2 = 'resource' AND res.resource_id = $3
+		)
+		SELECT ra.assignment_id, ra.role_id, r.name, r.display_name, ra.scope_type, ra.scope_id,
+			CASE WHEN sc.depth = 0 THEN 'direct' ELSE 'inherited' END AS inheritance_type,
+			ra.assigned_by, ra.created_at, ra.expires_at, t.team_id, t.name
+		FROM scope_chain sc
+		JOIN ktrlplane.role_assignments ra ON ra.scope_type = sc.scope_type AND ra.scope_id = sc.scope_id
+		JOIN ktrlplane.roles r ON r.role_id = ra.role_id
+		LEFT JOIN ktrlplane.teams t ON t.team_id = ra.user_id
+		WHERE ra.user_id IN (SELECT principal_id FROM principals)
+		  AND (ra.expires_at IS NULL OR ra.expires_at > NOW())
+		  AND EXISTS (
+			SELECT 1
+			FROM ktrlplane.role_permissions rp
+			JOIN ktrlplane.permissions p ON rp.permission_id = p.permission_id
+			WHERE rp.role_id = ra.role_id AND p.action = $4
+		  )
+		ORDER BY sc.depth ASC, r.display_order ASC`
+
+	// GetRolesGrantingActionQuery selects visible roles that include an action, least privileged
+	// (fewest permissions) first.
+	GetRolesGrantingActionQuery = `
+		SELECT r.role_id, r.name, r.display_name, r.description, r.is_system, r.is_hidden, r.created_at, r.updated_at
+		FROM ktrlplane.roles r
+		WHERE r.is_hidden = false
+		  AND EXISTS (
+			SELECT 1
+			FROM ktrlplane.role_permissions rp
+			JOIN ktrlplane.permissions p ON rp.permission_id = p.permission_id
+			WHERE rp.role_id = r.role_id AND p.action = $1
+		  )
+		ORDER BY (SELECT COUNT(*) FROM ktrlplane.role_permissions rp WHERE rp.role_id = r.role_id) ASC,
+			r.display_order ASC
+		LIMIT $2`
+
 	// GetUserRolesQuery selects all roles assigned to a user.
 	GetUserRolesQuery = `
 		SELECT ra.assignment_id, ra.user_id, ra.role_id, ra.scope_type, ra.scope_id, ra.assigned_by, ra.created_at, ra.expires_at
@@ -98,11 +222,13 @@ const (
 		ORDER BY ra.created_at DESC`
 
 	// GetRoleAssignmentsWithDetailsQuery selects role assignments with details.
+	// is_team is true for assignments whose principal is a team.
 	GetRoleAssignmentsWithDetailsQuery = `
 		SELECT 
 			ra.assignment_id, ra.user_id, ra.role_id, ra.scope_type, ra.scope_id, ra.assigned_by, ra.created_at, ra.expires_at,
 			r.name as role_name, r.display_name as role_display_name, r.description as role_description, r.is_system,
-			u.email, u.name
+			u.email, u.name,
+			EXISTS(SELECT 1 FROM ktrlplane.teams t WHERE t.team_id = ra.user_id) as is_team
 		FROM ktrlplane.role_assignments ra
 		JOIN ktrlplane.roles r ON ra.role_id = r.role_id
 		JOIN ktrlplane.users u ON ra.user_id = u.user_id
@@ -111,6 +237,7 @@ const (
 		ORDER BY ra.created_at DESC`
 
 	// GetRoleAssignmentsWithInheritanceQuery selects role assignments with inheritance.
+	// is_team is true for assignments whose principal is a team; see ListMembersOfTeamsQuery.
 	GetRoleAssignmentsWithInheritanceQuery = `
 		WITH role_assignments_with_inheritance AS (
 			-- Direct assignments to the specified scope
@@ -189,11 +316,13 @@ const (
 			  AND (ra.expires_at IS NULL OR ra.expires_at > NOW())
 			  AND $1 = 'project'
 		)
-		SELECT * FROM role_assignments_with_inheritance
-		ORDER BY inheritance_type ASC, created_at DESC`
+		SELECT rai.*, EXISTS(SELECT 1 FROM ktrlplane.teams t WHERE t.team_id = rai.user_id) as is_team
+		FROM role_assignments_with_inheritance rai
+		ORDER BY rai.inheritance_type ASC, rai.created_at DESC`
 
-	// DeleteRoleAssignmentQuery deletes a role assignment by assignment ID, scope type, and scope ID.
+	// DeleteRoleAssignmentQuery deletes a role assignment by assignment ID and returns its user.
 	DeleteRoleAssignmentQuery = `
 		DELETE FROM role_assignments
-		WHERE assignment_id = $1`
+		WHERE assignment_id = $1
+		RETURNING user_id`
 )
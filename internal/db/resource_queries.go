@@ -14,8 +14,11 @@ const (
 		SELECT resource_id, project_id, name, type, status, sku, stripe_price_id, settings_json, error_message, created_at, updated_at
 		FROM ktrlplane.resources WHERE project_id = $1`
 
+	// UpdateResourceQuery keeps a resource suspended for non-payment unless it moves to the free tier.
 	UpdateResourceQuery = `
-		UPDATE ktrlplane.resources SET name = $3, sku = $4, stripe_price_id = $5, settings_json = $6, status = 'Updating', updated_at = NOW() WHERE project_id = $1 AND resource_id = $2`
+		UPDATE ktrlplane.resources SET name = $3, sku = $4, stripe_price_id = $5, settings_json = $6,
+			status = CASE WHEN status = 'Suspended' AND $4 <> 'free' THEN status ELSE 'Updating' END,
+			updated_at = NOW() WHERE project_id = $1 AND resource_id = $2`
 
 	DeleteResourceQuery = `
 		DELETE FROM ktrlplane.resources WHERE project_id = $1 AND resource_id = $2`
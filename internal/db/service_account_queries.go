@@ -0,0 +1,136 @@
+package db
+
+// Service account SQL queries
+const (
+	// serviceAccountColumns is the column list scanned by the service layer for a service account.
+	serviceAccountColumns = `service_account_id, name, description, scope_type, scope_id, external_issuer, external_client_id,
+		disabled, created_by, last_used_at, created_at, updated_at`
+
+	// CreateServiceAccountUserQuery creates the users row backing a service account.
+	CreateServiceAccountUserQuery = `
+		INSERT INTO ktrlplane.users (user_id, email, name, created_at)
+		VALUES ($1, '', $2, NOW())`
+
+	// CreateServiceAccountQuery inserts a service account.
+	CreateServiceAccountQuery = `
+		INSERT INTO ktrlplane.service_accounts
+			(service_account_id, name, description, scope_type, scope_id, external_issuer, external_client_id, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING ` + serviceAccountColumns
+
+	// ListServiceAccountsForScopeQuery lists the service accounts owned by a scope.
+	ListServiceAccountsForScopeQuery = `
+		SELECT ` + serviceAccountColumns + `
+		FROM ktrlplane.service_accounts
+		WHERE scope_type = $1 AND scope_id = $2
+		ORDER BY name, service_account_id`
+
+	// GetServiceAccountQuery selects a service account owned by a scope.
+	GetServiceAccountQuery = `
+		SELECT ` + serviceAccountColumns + `
+		FROM ktrlplane.service_accounts
+		WHERE service_account_id = $1 AND scope_type = $2 AND scope_id = $3`
+
+	// GetServiceAccountByIDQuery selects a service account by ID, for KtrlPlane-issued tokens.
+	GetServiceAccountByIDQuery = `
+		SELECT ` + serviceAccountColumns + `
+		FROM ktrlplane.service_accounts
+		WHERE service_account_id = $1`
+
+	// GetServiceAccountScopeQuery selects the scope owning service account $1.
+	GetServiceAccountScopeQuery = `
+		SELECT scope_type, scope_id
+		FROM ktrlplane.service_accounts
+		WHERE service_account_id = $1`
+
+	// GetServiceAccountByClientIDQuery selects the service account mapped to an external OIDC
+	// client, identified by its issuer and client ID.
+	GetServiceAccountByClientIDQuery = `
+		SELECT ` + serviceAccountColumns + `
+		FROM ktrlplane.service_accounts
+		WHERE external_issuer = $1 AND external_client_id = $2`
+
+	// UpdateServiceAccountQuery updates the mutable fields of a service account.
+	// NULL arguments keep the current value; $6 = true clears the external client.
+	UpdateServiceAccountQuery = `
+		UPDATE ktrlplane.service_accounts
+		SET name = COALESCE($4, name),
+			description = COALESCE($5, description),
+			external_issuer = CASE WHEN $6::boolean THEN NULL ELSE COALESCE($9, external_issuer) END,
+			external_client_id = CASE WHEN $6::boolean THEN NULL ELSE COALESCE($7, external_client_id) END,
+			disabled = COALESCE($8, disabled),
+			updated_at = NOW()
+		WHERE service_account_id = $1 AND scope_type = $2 AND scope_id = $3
+		RETURNING ` + serviceAccountColumns
+
+	// UpdateServiceAccountUserNameQuery keeps the backing user's name in sync.
+	UpdateServiceAccountUserNameQuery = `
+		UPDATE ktrlplane.users
+		SET name = $2, updated_at = NOW()
+		WHERE user_id = $1`
+
+	// DeleteServiceAccountQuery deletes a service account owned by a scope through its users row,
+	// which cascades to the account, its secrets and its role assignments.
+	DeleteServiceAccountQuery = `
+		DELETE FROM ktrlplane.users u
+		USING ktrlplane.service_accounts sa
+		WHERE u.user_id = sa.service_account_id
+			AND sa.service_account_id = $1 AND sa.scope_type = $2 AND sa.scope_id = $3`
+
+	// DeleteServiceAccountsForOrganizationQuery deletes the service accounts owned by an
+	// organization or any of its projects. Run it before deleting the organization.
+	DeleteServiceAccountsForOrganizationQuery = `
+		DELETE FROM ktrlplane.users u
+		USING ktrlplane.service_accounts sa
+		WHERE u.user_id = sa.service_account_id
+			AND ((sa.scope_type = 'organization' AND sa.scope_id = $1)
+				OR (sa.scope_type = 'project' AND sa.scope_id IN (
+					SELECT project_id FROM ktrlplane.projects WHERE org_id = $1)))`
+
+	// DeleteServiceAccountsForProjectQuery deletes the service accounts owned by a project.
+	DeleteServiceAccountsForProjectQuery = `
+		DELETE FROM ktrlplane.users u
+		USING ktrlplane.service_accounts sa
+		WHERE u.user_id = sa.service_account_id
+			AND sa.scope_type = 'project' AND sa.scope_id = $1`
+
+	// TouchServiceAccountQuery records that a service account authenticated.
+	TouchServiceAccountQuery = `
+		UPDATE ktrlplane.service_accounts
+		SET last_used_at = NOW()
+		WHERE service_account_id = $1`
+
+	// serviceAccountSecretColumns is the column list scanned for a client secret.
+	serviceAccountSecretColumns = `secret_id, service_account_id, description, expires_at, last_used_at, created_by, created_at`
+
+	// CreateServiceAccountSecretQuery stores the hash of a new client secret.
+	CreateServiceAccountSecretQuery = `
+		INSERT INTO ktrlplane.service_account_secrets
+			(secret_id, service_account_id, secret_hash, description, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING ` + serviceAccountSecretColumns
+
+	// ListServiceAccountSecretsQuery lists the client secrets of a service account.
+	ListServiceAccountSecretsQuery = `
+		SELECT ` + serviceAccountSecretColumns + `
+		FROM ktrlplane.service_account_secrets
+		WHERE service_account_id = $1
+		ORDER BY created_at DESC`
+
+	// DeleteServiceAccountSecretQuery deletes a client secret of a service account.
+	DeleteServiceAccountSecretQuery = `
+		DELETE FROM ktrlplane.service_account_secrets
+		WHERE secret_id = $1 AND service_account_id = $2`
+
+	// UseServiceAccountSecretQuery looks up an unexpired client secret by hash for an
+	// enabled service account, and records its use.
+	UseServiceAccountSecretQuery = `
+		UPDATE ktrlplane.service_account_secrets s
+		SET last_used_at = NOW()
+		FROM ktrlplane.service_accounts sa
+		WHERE s.service_account_id = sa.service_account_id
+			AND s.service_account_id = $1 AND s.secret_hash = $2
+			AND (s.expires_at IS NULL OR s.expires_at > NOW())
+			AND NOT sa.disabled
+		RETURNING s.secret_id`
+)
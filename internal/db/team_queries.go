@@ -0,0 +1,120 @@
+package db
+
+// Team SQL queries
+const (
+	// teamColumns is the column list scanned by the service layer for a team aliased as t.
+	teamColumns = `t.team_id, t.org_id, t.name, t.description, t.idp_issuer, t.idp_group,
+		(SELECT COUNT(*) FROM ktrlplane.team_members tm WHERE tm.team_id = t.team_id),
+		t.created_by, t.created_at, t.updated_at`
+
+	// CreateTeamQuery inserts a team. The backing users row is created with CreateUserQuery.
+	CreateTeamQuery = `
+		INSERT INTO ktrlplane.teams AS t (team_id, org_id, name, description, idp_issuer, idp_group, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING ` + teamColumns
+
+	// ListTeamsForOrganizationQuery lists the teams of an organization.
+	ListTeamsForOrganizationQuery = `
+		SELECT ` + teamColumns + `
+		FROM ktrlplane.teams t
+		WHERE t.org_id = $1
+		ORDER BY t.name`
+
+	// GetTeamQuery selects a team of an organization.
+	GetTeamQuery = `
+		SELECT ` + teamColumns + `
+		FROM ktrlplane.teams t
+		WHERE t.team_id = $1 AND t.org_id = $2`
+
+	// GetTeamOrganizationQuery selects the organization of a team.
+	GetTeamOrganizationQuery = `
+		SELECT org_id FROM ktrlplane.teams WHERE team_id = $1`
+
+	// UpdateTeamQuery updates the mutable fields of a team.
+	// NULL arguments keep the current value; $5 = true clears the IdP issuer and group.
+	UpdateTeamQuery = `
+		UPDATE ktrlplane.teams t
+		SET name = COALESCE($3, t.name),
+			description = COALESCE($4, t.description),
+			idp_issuer = CASE WHEN $5::boolean THEN NULL ELSE COALESCE($7, t.idp_issuer) END,
+			idp_group = CASE WHEN $5::boolean THEN NULL ELSE COALESCE($6, t.idp_group) END,
+			updated_at = NOW()
+		WHERE t.team_id = $1 AND t.org_id = $2
+		RETURNING ` + teamColumns
+
+	// DeleteTeamQuery deletes a team of an organization through its users row,
+	// which cascades to the team, its members and its role assignments.
+	DeleteTeamQuery = `
+		DELETE FROM ktrlplane.users u
+		USING ktrlplane.teams t
+		WHERE u.user_id = t.team_id
+			AND t.team_id = $1 AND t.org_id = $2`
+
+	// DeleteTeamsForOrganizationQuery deletes the teams of an organization through their
+	// users rows. Run it before deleting the organization.
+	DeleteTeamsForOrganizationQuery = `
+		DELETE FROM ktrlplane.users u
+		USING ktrlplane.teams t
+		WHERE u.user_id = t.team_id AND t.org_id = $1`
+
+	// ListTeamMembersQuery lists the members of a team.
+	ListTeamMembersQuery = `
+		SELECT tm.user_id, u.email, u.name, tm.source, tm.added_by, tm.created_at
+		FROM ktrlplane.team_members tm
+		JOIN ktrlplane.users u ON u.user_id = tm.user_id
+		WHERE tm.team_id = $1
+		ORDER BY u.email, tm.user_id`
+
+	// ListMembersOfTeamsQuery lists the members of several teams ($1 text array).
+	ListMembersOfTeamsQuery = `
+		SELECT tm.team_id, u.user_id, u.email, u.name
+		FROM ktrlplane.team_members tm
+		JOIN ktrlplane.users u ON u.user_id = tm.user_id
+		WHERE tm.team_id = ANY($1::text[])
+		ORDER BY tm.team_id, u.email, u.user_id`
+
+	// AddTeamMemberQuery adds a user to a team. A member synced from the IdP becomes a
+	// manual member, so that it is no longer removed by the sync.
+	AddTeamMemberQuery = `
+		INSERT INTO ktrlplane.team_members (team_id, user_id, source, added_by)
+		VALUES ($1, $2, 'manual', $3)
+		ON CONFLICT (team_id, user_id) DO UPDATE
+		SET source = 'manual', added_by = EXCLUDED.added_by
+		WHERE team_members.source <> 'manual'`
+
+	// RemoveTeamMemberQuery removes a user from a team.
+	RemoveTeamMemberQuery = `
+		DELETE FROM ktrlplane.team_members
+		WHERE team_id = $1 AND user_id = $2`
+
+	// SyncIdPTeamMembershipsQuery makes a user's IdP-synced memberships match the groups in
+	// $2 (text array) of issuer $3: the user joins every team mapped to one of the groups of
+	// that issuer and leaves the IdP-synced teams mapped to none. Manual memberships are kept.
+	// Returns the number of changes.
+	SyncIdPTeamMembershipsQuery = `
+		WITH removed AS (
+			DELETE FROM ktrlplane.team_members tm
+			USING ktrlplane.teams t
+			WHERE tm.team_id = t.team_id
+				AND tm.user_id = $1 AND tm.source = 'idp'
+				AND (t.idp_issuer IS DISTINCT FROM $3 OR t.idp_group IS NULL OR NOT t.idp_group = ANY($2::text[]))
+			RETURNING tm.team_id
+		), added AS (
+			INSERT INTO ktrlplane.team_members (team_id, user_id, source)
+			SELECT t.team_id, $1, 'idp'
+			FROM ktrlplane.teams t
+			WHERE t.idp_issuer = $3 AND t.idp_group = ANY($2::text[])
+			ON CONFLICT (team_id, user_id) DO NOTHING
+			RETURNING team_id
+		)
+		SELECT (SELECT COUNT(*) FROM removed) + (SELECT COUNT(*) FROM added)`
+
+	// ReassignTeamMembershipsQuery copies the memberships of a merged user ($1) to the
+	// surviving user ($2). The originals are removed with the merged user.
+	ReassignTeamMembershipsQuery = `
+		INSERT INTO ktrlplane.team_members (team_id, user_id, source, added_by, created_at)
+		SELECT team_id, $2, source, added_by, created_at
+		FROM ktrlplane.team_members
+		WHERE user_id = $1
+		ON CONFLICT (team_id, user_id) DO NOTHING`
+)
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"ktrlplane/internal/telemetry"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestQueryName(t *testing.T) {
+	assert.Equal(t, "CheckPermissionWithInheritanceQuery", QueryName(CheckPermissionWithInheritanceQuery))
+	assert.Equal(t, "GetProjectByIDQuery", QueryName(GetProjectByIDQuery))
+	// Identical SQL resolves to the first registered constant
+	assert.Equal(t, "UpdateBillingAccountStatusQuery", QueryName(UpdateBillingAccountQuery))
+	assert.Equal(t, "SELECT", QueryName("  select 1"))
+	assert.Equal(t, "query", QueryName(""))
+}
+
+func TestNamedQueriesAreUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, q := range namedQueries {
+		assert.False(t, seen[q.name], "duplicate query name %s", q.name)
+		assert.NotEmpty(t, q.sql, "empty SQL for %s", q.name)
+		seen[q.name] = true
+	}
+}
+
+func TestQueryTracer_Span(t *testing.T) {
+	exporter, restore := telemetry.NewInMemoryProvider()
+	defer restore()
+
+	tracer := queryTracer{}
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: GetProjectByIDQuery})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1"), Err: pgx.ErrNoRows})
+
+	ctx = tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: DeleteProjectQuery})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: assert.AnError})
+
+	spans := exporter.GetSpans()
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, "db GetProjectByIDQuery", spans[0].Name)
+		assert.Equal(t, codes.Unset, spans[0].Status.Code, "no rows is not an error")
+		assert.Equal(t, "db DeleteProjectQuery", spans[1].Name)
+		assert.Equal(t, codes.Error, spans[1].Status.Code)
+	}
+}
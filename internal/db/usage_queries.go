@@ -0,0 +1,70 @@
+package db
+
+// Usage metering SQL queries
+const (
+	// ListMeteredResourcesQuery lists the paid resources of type $1 with their creation time.
+	ListMeteredResourcesQuery = `
+		SELECT resource_id, project_id, created_at
+		FROM ktrlplane.resources
+		WHERE type = $1 AND COALESCE(sku, 'free') <> 'free'`
+
+	// ListRecordedUsageHoursQuery lists the hours from $2 on already recorded for meter $1.
+	ListRecordedUsageHoursQuery = `
+		SELECT resource_id, hour_start
+		FROM ktrlplane.usage_records
+		WHERE meter = $1 AND hour_start >= $2`
+
+	// InsertUsageRecordQuery records the usage of a resource for one hour. A record that
+	// another replica already inserted is kept as is.
+	InsertUsageRecordQuery = `
+		INSERT INTO ktrlplane.usage_records
+			(resource_id, meter, hour_start, project_id, quantity, event_name, stripe_customer_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (resource_id, meter, hour_start) DO NOTHING`
+
+	// LockPendingUsageRecordsQuery locks up to $1 records awaiting a report to Stripe, skipping
+	// records locked by other replicas. Stripe rejects meter events older than 35 days, so
+	// older records and records that failed $2 times are given up on.
+	LockPendingUsageRecordsQuery = `
+		SELECT resource_id, meter, hour_start, quantity, event_name, stripe_customer_id
+		FROM ktrlplane.usage_records
+		WHERE reported_at IS NULL AND stripe_customer_id IS NOT NULL
+		  AND report_attempts < $2
+		  AND hour_start > (NOW() AT TIME ZONE 'UTC') - INTERVAL '34 days'
+		ORDER BY hour_start
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`
+
+	// MarkUsageRecordReportedQuery marks a record as reported to Stripe.
+	MarkUsageRecordReportedQuery = `
+		UPDATE ktrlplane.usage_records
+		SET reported_at = NOW(), report_attempts = report_attempts + 1, last_error = NULL
+		WHERE resource_id = $1 AND meter = $2 AND hour_start = $3`
+
+	// MarkUsageRecordFailedQuery records a failed report attempt.
+	MarkUsageRecordFailedQuery = `
+		UPDATE ktrlplane.usage_records
+		SET report_attempts = report_attempts + 1, last_error = $4
+		WHERE resource_id = $1 AND meter = $2 AND hour_start = $3`
+
+	// LockUsageRemainderQuery locks and returns the usage of resource $1 on meter $2 left over
+	// from earlier reports.
+	LockUsageRemainderQuery = `
+		INSERT INTO ktrlplane.usage_remainders (resource_id, meter)
+		VALUES ($1, $2)
+		ON CONFLICT (resource_id, meter) DO UPDATE SET resource_id = EXCLUDED.resource_id
+		RETURNING remainder`
+
+	// UpdateUsageRemainderQuery sets the usage of resource $1 on meter $2 left over to $3.
+	UpdateUsageRemainderQuery = `
+		UPDATE ktrlplane.usage_remainders
+		SET remainder = $3, updated_at = NOW()
+		WHERE resource_id = $1 AND meter = $2`
+
+	// ListProjectUsageQuery lists the usage records of project $1 for hours in [$2, $3).
+	ListProjectUsageQuery = `
+		SELECT resource_id, meter, hour_start, quantity, reported_at
+		FROM ktrlplane.usage_records
+		WHERE project_id = $1 AND hour_start >= $2 AND hour_start < $3
+		ORDER BY resource_id, meter, hour_start`
+)
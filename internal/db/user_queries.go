@@ -19,20 +19,23 @@ const (
 		SET email = $2 
 		WHERE user_id = $1`
 
-	// UpdateUserNameQuery updates a user's name.
+	// UpdateUserNameQuery updates a user's name. Names chosen by the user are kept.
 	UpdateUserNameQuery = `
 		UPDATE ktrlplane.users 
 		SET name = $2 
-		WHERE user_id = $1`
+		WHERE user_id = $1 AND NOT name_is_custom`
 
-	// SearchUsersQuery searches for users by email, name, or user ID.
+	// SearchUsersQuery searches for users by email, name, or user ID. Teams and service
+	// accounts, which also have a users row, are not users and are left out.
 	SearchUsersQuery = `
-		SELECT user_id, email, name
-		FROM ktrlplane.users
-		WHERE LOWER(email) LIKE LOWER($1)
-			OR LOWER(name) LIKE LOWER($1)
-			OR LOWER(user_id) LIKE LOWER($1)
-		ORDER BY email
+		SELECT u.user_id, u.email, u.name
+		FROM ktrlplane.users u
+		WHERE (LOWER(u.email) LIKE LOWER($1)
+				OR LOWER(u.name) LIKE LOWER($1)
+				OR LOWER(u.user_id) LIKE LOWER($1))
+			AND NOT EXISTS (SELECT 1 FROM ktrlplane.teams t WHERE t.team_id = u.user_id)
+			AND NOT EXISTS (SELECT 1 FROM ktrlplane.service_accounts sa WHERE sa.service_account_id = u.user_id)
+		ORDER BY u.email
 		LIMIT 10`
 
 	// FindPlaceholderUserByEmailQuery finds a placeholder user (user_id = email)
@@ -57,4 +60,196 @@ const (
 		INSERT INTO ktrlplane.users (user_id, email, name, created_at)
 		VALUES ($1, $1, $2, NOW())
 		ON CONFLICT (user_id) DO NOTHING`
+
+	// GetUserIDForIdentityQuery resolves a linked token subject to the user it belongs to.
+	GetUserIDForIdentityQuery = `
+		SELECT user_id
+		FROM ktrlplane.user_identity_links
+		WHERE subject = $1`
+
+	// LockUsersForMergeQuery locks the two users being merged ($1 source, $2 target).
+	LockUsersForMergeQuery = `
+		SELECT user_id
+		FROM ktrlplane.users
+		WHERE user_id IN ($1, $2)
+		ORDER BY user_id
+		FOR UPDATE`
+
+	// MergeDuplicateRoleAssignmentsQuery extends assignments of $2 that $1 also holds,
+	// keeping the longer-lived of the two (a permanent assignment stays permanent).
+	MergeDuplicateRoleAssignmentsQuery = `
+		UPDATE ktrlplane.role_assignments t
+		SET expires_at = CASE
+				WHEN t.expires_at IS NULL OR s.expires_at IS NULL THEN NULL
+				ELSE GREATEST(t.expires_at, s.expires_at)
+			END,
+			updated_at = NOW()
+		FROM ktrlplane.role_assignments s
+		WHERE s.user_id = $1 AND t.user_id = $2
+			AND s.role_id = t.role_id AND s.scope_type = t.scope_type AND s.scope_id = t.scope_id`
+
+	// DeleteDuplicateRoleAssignmentsQuery deletes assignments of $1 that $2 also holds,
+	// so that the remaining ones can be transferred without conflicts.
+	DeleteDuplicateRoleAssignmentsQuery = `
+		DELETE FROM ktrlplane.role_assignments s
+		USING ktrlplane.role_assignments t
+		WHERE s.user_id = $1 AND t.user_id = $2
+			AND s.role_id = t.role_id AND s.scope_type = t.scope_type AND s.scope_id = t.scope_id`
+
+	// ReassignRoleAssignmentGrantorQuery moves assigned_by references from $1 to $2.
+	ReassignRoleAssignmentGrantorQuery = `
+		UPDATE ktrlplane.role_assignments
+		SET assigned_by = $2
+		WHERE assigned_by = $1`
+
+	// ReassignAccessRequestsQuery moves access requests from $1 to $2. Pending requests
+	// that $2 already has pending are left behind and deleted with $1.
+	ReassignAccessRequestsQuery = `
+		UPDATE ktrlplane.access_requests s
+		SET user_id = $2
+		WHERE s.user_id = $1
+			AND NOT (s.status = 'pending' AND EXISTS (
+				SELECT 1 FROM ktrlplane.access_requests t
+				WHERE t.user_id = $2 AND t.status = 'pending'
+					AND t.role_id = s.role_id AND t.scope_type = s.scope_type AND t.scope_id = s.scope_id
+			))`
+
+	// ReassignAccessRequestDeciderQuery moves decided_by references from $1 to $2.
+	ReassignAccessRequestDeciderQuery = `
+		UPDATE ktrlplane.access_requests
+		SET decided_by = $2
+		WHERE decided_by = $1`
+
+	// ReassignInvitationsQuery moves invited_by, accepted_by and revoked_by references from $1 to $2.
+	ReassignInvitationsQuery = `
+		UPDATE ktrlplane.invitations
+		SET invited_by = CASE WHEN invited_by = $1 THEN $2 ELSE invited_by END,
+			accepted_by = CASE WHEN accepted_by = $1 THEN $2 ELSE accepted_by END,
+			revoked_by = CASE WHEN revoked_by = $1 THEN $2 ELSE revoked_by END
+		WHERE invited_by = $1 OR accepted_by = $1 OR revoked_by = $1`
+
+	// ReassignIdentityLinksQuery moves identities linked to $1 over to $2.
+	ReassignIdentityLinksQuery = `
+		UPDATE ktrlplane.user_identity_links
+		SET user_id = $2
+		WHERE user_id = $1`
+
+	// UpsertIdentityLinkQuery links token subject $1 to user $2.
+	UpsertIdentityLinkQuery = `
+		INSERT INTO ktrlplane.user_identity_links (subject, user_id, linked_by, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (subject) DO UPDATE
+		SET user_id = EXCLUDED.user_id, linked_by = EXCLUDED.linked_by, created_at = NOW()`
+
+	// CreateAccountLinkTokenQuery stores the hash of a link token for user $2,
+	// replacing any token the user issued before.
+	CreateAccountLinkTokenQuery = `
+		WITH previous AS (
+			DELETE FROM ktrlplane.account_link_tokens WHERE user_id = $2
+		)
+		INSERT INTO ktrlplane.account_link_tokens (token_hash, user_id, expires_at, created_at)
+		VALUES ($1, $2, $3, NOW())`
+
+	// ConsumeAccountLinkTokenQuery deletes a link token by hash and returns its user
+	// and expiry, so that each token can only be used once.
+	ConsumeAccountLinkTokenQuery = `
+		DELETE FROM ktrlplane.account_link_tokens
+		WHERE token_hash = $1
+		RETURNING user_id, expires_at`
+
+	// GetUserProfileQuery selects the profile of user $1.
+	GetUserProfileQuery = `
+		SELECT user_id, email, COALESCE(name, ''), created_at
+		FROM ktrlplane.users
+		WHERE user_id = $1`
+
+	// SetUserDisplayNameQuery sets the name chosen by user $1, which sign-ins no longer overwrite.
+	SetUserDisplayNameQuery = `
+		UPDATE ktrlplane.users
+		SET name = $2, name_is_custom = true, updated_at = NOW()
+		WHERE user_id = $1
+		RETURNING user_id, email, COALESCE(name, ''), created_at`
+
+	// ListUserRoleNamesQuery lists the roles user $1 holds anywhere, directly or through a team.
+	ListUserRoleNamesQuery = `
+		SELECT r.name
+		FROM ktrlplane.role_assignments ra
+		JOIN ktrlplane.roles r ON r.role_id = ra.role_id
+		WHERE (ra.user_id = $1 OR ra.user_id IN (
+				SELECT tm.team_id FROM ktrlplane.team_members tm WHERE tm.user_id = $1))
+		  AND (ra.expires_at IS NULL OR ra.expires_at > NOW())
+		GROUP BY r.name
+		ORDER BY MIN(r.display_order), r.name`
+
+	// ListUserAccessQuery lists every organization, project and resource user $1 can reach,
+	// directly or through a team, with the highest role (lowest display_order) that applies
+	// there and the scope type of the assignment granting it. parent_id is the organization of
+	// a project and the project of a resource.
+	ListUserAccessQuery = `
+		WITH grants AS (
+			SELECT ra.scope_type, ra.scope_id, r.name AS role, r.display_order
+			FROM ktrlplane.role_assignments ra
+			JOIN ktrlplane.roles r ON r.role_id = ra.role_id
+			WHERE (ra.user_id = $1 OR ra.user_id IN (
+					SELECT tm.team_id FROM ktrlplane.team_members tm WHERE tm.user_id = $1))
+			  AND ra.scope_type IN ('organization', 'project', 'resource')
+			  AND (ra.expires_at IS NULL OR ra.expires_at > NOW())
+		),
+		reachable AS (
+			SELECT 'organization' AS scope_type, o.org_id AS scope_id, o.name, NULL::text AS parent_id,
+				g.role, g.display_order, g.scope_type AS granted_at
+			FROM ktrlplane.organizations o
+			JOIN grants g ON g.scope_type = 'organization' AND g.scope_id = o.org_id
+
+			UNION ALL
+
+			SELECT 'project', p.project_id, p.name, p.org_id, g.role, g.display_order, g.scope_type
+			FROM ktrlplane.projects p
+			JOIN grants g ON (g.scope_type = 'project' AND g.scope_id = p.project_id)
+				OR (g.scope_type = 'organization' AND g.scope_id = p.org_id)
+
+			UNION ALL
+
+			SELECT 'resource', res.resource_id, res.name, res.project_id, g.role, g.display_order, g.scope_type
+			FROM ktrlplane.resources res
+			JOIN ktrlplane.projects p ON p.project_id = res.project_id
+			JOIN grants g ON (g.scope_type = 'resource' AND g.scope_id = res.resource_id)
+				OR (g.scope_type = 'project' AND g.scope_id = res.project_id)
+				OR (g.scope_type = 'organization' AND g.scope_id = p.org_id)
+		)
+		SELECT DISTINCT ON (scope_type, name, scope_id) scope_type, scope_id, name, parent_id, role, granted_at
+		FROM reachable
+		ORDER BY scope_type, name, scope_id, display_order, role`
+
+	// ListOwnersOfOwnedScopesQuery lists, for every organization, project and resource that user
+	// $1 owns directly or through a team, the Owner assignments of the scope and of the scopes it
+	// inherits from: the scope, the holder, whether the holder is a team and how many members
+	// other than $1 it has. The service decides which scopes only $1 owns.
+	ListOwnersOfOwnedScopesQuery = `
+		WITH owner_assignments AS (
+			SELECT ra.user_id AS holder, ra.scope_type, ra.scope_id,
+				EXISTS (SELECT 1 FROM ktrlplane.teams t WHERE t.team_id = ra.user_id) AS is_team,
+				EXISTS (SELECT 1 FROM ktrlplane.team_members tm WHERE tm.team_id = ra.user_id AND tm.user_id = $1) AS includes_user,
+				(SELECT COUNT(*) FROM ktrlplane.team_members tm WHERE tm.team_id = ra.user_id AND tm.user_id <> $1) AS other_members
+			FROM ktrlplane.role_assignments ra
+			JOIN ktrlplane.roles r ON r.role_id = ra.role_id
+			WHERE r.name = 'Owner'
+			  AND (ra.expires_at IS NULL OR ra.expires_at > NOW())
+		),
+		owned AS (
+			SELECT DISTINCT oa.scope_type, oa.scope_id
+			FROM owner_assignments oa
+			WHERE (oa.holder = $1 OR oa.includes_user)
+			  AND oa.scope_type IN ('organization', 'project', 'resource')
+		)
+		SELECT o.scope_type, o.scope_id, oa.holder, oa.is_team, oa.other_members
+		FROM owned o
+		LEFT JOIN ktrlplane.projects proj ON o.scope_type = 'project' AND proj.project_id = o.scope_id
+		LEFT JOIN ktrlplane.resources res ON o.scope_type = 'resource' AND res.resource_id = o.scope_id
+		LEFT JOIN ktrlplane.projects res_proj ON res_proj.project_id = res.project_id
+		JOIN owner_assignments oa
+			ON (oa.scope_type = o.scope_type AND oa.scope_id = o.scope_id)
+			OR (oa.scope_type = 'organization' AND oa.scope_id IN (proj.org_id, res_proj.org_id))
+			OR (oa.scope_type = 'project' AND oa.scope_id = res.project_id)
+		ORDER BY o.scope_type, o.scope_id, oa.holder`
 )
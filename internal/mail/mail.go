@@ -0,0 +1,134 @@
+// Package mail sends transactional email such as invitations.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"ktrlplane/internal/config"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewFromConfig returns the Mailer selected by cfg.Driver.
+func NewFromConfig(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "", "log":
+		return LogMailer{}, nil
+	case "smtp":
+		if cfg.SMTP.Host == "" {
+			return nil, fmt.Errorf("mail.smtp.host is required for the smtp driver")
+		}
+		if cfg.From == "" {
+			return nil, fmt.Errorf("mail.from is required for the smtp driver")
+		}
+		return NewSMTPMailer(cfg.SMTP, cfg.From), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
+
+// LogMailer writes messages to the server log instead of sending them.
+// It is the default, for development and installations without SMTP.
+type LogMailer struct{}
+
+// Send implements Mailer.
+func (LogMailer) Send(_ context.Context, msg Message) error {
+	if err := validateHeaders(msg); err != nil {
+		return err
+	}
+	log.Printf("[Mail] To: %s\nSubject: %s\n\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// SMTPMailer sends messages through an SMTP server, using STARTTLS when offered.
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer creates an SMTPMailer. Authentication is used when a username is set.
+func NewSMTPMailer(cfg config.SMTPConfig, from string) *SMTPMailer {
+	m := &SMTPMailer{
+		addr: net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		from: from,
+	}
+	if cfg.Username != "" {
+		m.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return m
+}
+
+// Send implements Mailer.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	data, err := buildMessage(m.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	sender, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return fmt.Errorf("invalid sender address %q: %w", m.from, err)
+	}
+
+	// net/smtp does not take a context; run the send so that cancellation returns early.
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(m.addr, m.auth, sender.Address, []string{msg.To}, data)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("failed to send email to %s: %w", msg.To, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// validateHeaders rejects messages whose header fields could inject extra headers.
+func validateHeaders(msg Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return fmt.Errorf("email headers must not contain line breaks")
+	}
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return fmt.Errorf("invalid recipient address %q: %w", msg.To, err)
+	}
+	return nil
+}
+
+// buildMessage renders msg as an RFC 5322 message with a UTF-8 plain-text body.
+func buildMessage(from string, msg Message, date time.Time) ([]byte, error) {
+	if err := validateHeaders(msg); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return buf.Bytes(), nil
+}
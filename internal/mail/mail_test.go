@@ -0,0 +1,61 @@
+package mail
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"ktrlplane/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildMessage(t *testing.T) {
+	date := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	data, err := buildMessage("Konnektr <no-reply@example.com>", Message{
+		To:      "alice@example.com",
+		Subject: "Invitation to Café",
+		Body:    "Hello\nWorld",
+	}, date)
+	require.NoError(t, err)
+
+	text := string(data)
+	assert.Contains(t, text, "From: Konnektr <no-reply@example.com>\r\n")
+	assert.Contains(t, text, "To: alice@example.com\r\n")
+	assert.Contains(t, text, "Subject: =?utf-8?q?Invitation_to_Caf=C3=A9?=\r\n")
+	assert.Contains(t, text, "Date: Thu, 02 Jan 2025 03:04:05 +0000\r\n")
+	assert.True(t, strings.HasSuffix(text, "\r\n\r\nHello\r\nWorld"))
+}
+
+func TestBuildMessage_RejectsHeaderInjection(t *testing.T) {
+	_, err := buildMessage("no-reply@example.com", Message{
+		To:      "alice@example.com\r\nBcc: eve@example.com",
+		Subject: "Hi",
+	}, time.Now())
+	assert.Error(t, err)
+
+	_, err = buildMessage("no-reply@example.com", Message{
+		To:      "alice@example.com",
+		Subject: "Hi\nBcc: eve@example.com",
+	}, time.Now())
+	assert.Error(t, err)
+}
+
+func TestNewFromConfig(t *testing.T) {
+	m, err := NewFromConfig(config.MailConfig{})
+	require.NoError(t, err)
+	assert.IsType(t, LogMailer{}, m)
+	assert.NoError(t, m.Send(context.Background(), Message{To: "alice@example.com", Subject: "Hi", Body: "Hello"}))
+
+	_, err = NewFromConfig(config.MailConfig{Driver: "smtp", From: "no-reply@example.com"})
+	assert.Error(t, err, "smtp requires a host")
+
+	m, err = NewFromConfig(config.MailConfig{Driver: "smtp", From: "no-reply@example.com", SMTP: config.SMTPConfig{Host: "smtp.example.com", Port: 587}})
+	require.NoError(t, err)
+	assert.Equal(t, "smtp.example.com:587", m.(*SMTPMailer).addr)
+
+	_, err = NewFromConfig(config.MailConfig{Driver: "carrier-pigeon"})
+	assert.Error(t, err)
+}
@@ -12,7 +12,7 @@ type Project struct {
 	Name      string  `json:"name"`
 	Status    string  `json:"status"`
 	// StripeCustomerID and StripeSubscriptionID removed; use BillingAccount
-	BillingEmail           *string   `json:"billing_email,omitempty"`
+	// BillingEmail removed; use the billing contacts of the BillingAccount
 	InheritsBillingFromOrg bool      `json:"inherits_billing_from_org"`
 	CreatedAt              time.Time `json:"created_at"`
 	UpdatedAt              time.Time `json:"updated_at"`
@@ -99,7 +99,9 @@ type User struct {
 	Email            string   `json:"email"`              // Email from JWT
 	Name             string   `json:"name"`               // Name from JWT
 	IsServiceAccount bool     `json:"is_service_account"` // True if this is an M2M service account (client credentials)
-	Roles            []string `json:"roles,omitempty"`    // Roles derived from JWT or DB lookup (placeholder)
+	Roles            []string `json:"roles,omitempty"`    // Names of the roles held anywhere, set on the /me profile
+	Groups           []string `json:"groups,omitempty"`   // Groups from the issuer's groups claim, if configured
+	AccessTokenID    string   `json:"-"`                  // Set when authenticated with a personal access token
 }
 
 // RBAC Models
@@ -109,9 +111,9 @@ type Organization struct {
 	OrgID string `json:"org_id" db:"org_id"`
 	Name  string `json:"name" db:"name"`
 	// StripeCustomerID and StripeSubscriptionID removed; use BillingAccount
-	BillingEmail *string   `json:"billing_email,omitempty" db:"billing_email"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	// BillingEmail removed; use the billing contacts of the BillingAccount
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
 // Role represents a role in the RBAC system.
@@ -155,7 +157,7 @@ type RoleAssignment struct {
 	RoleID       string     `json:"role_id" db:"role_id"`
 	ScopeType    string     `json:"scope_type" db:"scope_type"` // "organization", "project", "resource", "global"
 	ScopeID      string     `json:"scope_id" db:"scope_id"`
-	AssignedBy   string     `json:"assigned_by" db:"assigned_by"`
+	AssignedBy   *string    `json:"assigned_by" db:"assigned_by"` // nil once the granting user is deleted
 	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
 	ExpiresAt    *time.Time `json:"expires_at,omitempty" db:"expires_at"`
 	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
@@ -168,7 +170,7 @@ type RoleAssignmentWithDetails struct {
 	RoleID       string     `json:"role_id"`
 	ScopeType    string     `json:"scope_type"`
 	ScopeID      string     `json:"scope_id"`
-	AssignedBy   string     `json:"assigned_by"`
+	AssignedBy   *string    `json:"assigned_by"` // nil once the granting user is deleted
 	CreatedAt    time.Time  `json:"created_at"`
 	ExpiresAt    *time.Time `json:"expires_at"`
 
@@ -176,6 +178,10 @@ type RoleAssignmentWithDetails struct {
 	User User `json:"user"`
 	Role Role `json:"role"`
 
+	// Principal information
+	PrincipalType string `json:"principal_type"`         // "user" or "team"
+	TeamMembers   []User `json:"team_members,omitempty"` // Members of a team principal
+
 	// Inheritance information
 	InheritanceType        string `json:"inheritance_type"`                    // "direct" or "inherited"
 	InheritedFromScopeType string `json:"inherited_from_scope_type,omitempty"` // "organization" or "project"
@@ -193,6 +199,358 @@ type UserPermission struct {
 	HasPermission bool   `json:"has_permission"`
 }
 
+// CreateRoleAssignmentRequest is the payload for assigning a role on a scope.
+type CreateRoleAssignmentRequest struct {
+	UserID    string     `json:"user_id" binding:"required"`
+	RoleID    string     `json:"role_id" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Optional; the assignment is removed after this time
+}
+
+// Access request statuses.
+const (
+	AccessRequestPending  = "pending"
+	AccessRequestApproved = "approved"
+	AccessRequestDenied   = "denied"
+)
+
+// AccessRequest is a user's request for a temporary role on a scope.
+// Database table: ktrlplane.access_requests
+type AccessRequest struct {
+	RequestID     string     `json:"request_id"`
+	UserID        string     `json:"user_id"`
+	RoleID        string     `json:"role_id"`
+	ScopeType     string     `json:"scope_type"`
+	ScopeID       string     `json:"scope_id"`
+	Justification string     `json:"justification"`
+	DurationHours int        `json:"duration_hours"`
+	Status        string     `json:"status"` // "pending", "approved" or "denied"
+	DecidedBy     *string    `json:"decided_by,omitempty"`
+	DecidedAt     *time.Time `json:"decided_at,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"` // Expiry of the granted assignment, once approved
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// CreateAccessRequestRequest is the payload for requesting temporary elevated access.
+type CreateAccessRequestRequest struct {
+	RoleID        string `json:"role_id" binding:"required"`
+	DurationHours int    `json:"duration_hours" binding:"required,min=1,max=720"`
+	Justification string `json:"justification" binding:"required,max=1000"`
+}
+
+// Invitation statuses.
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+)
+
+// Invitation invites an email address to take a role on a scope.
+// Database table: ktrlplane.invitations (the token itself is never stored or returned)
+type Invitation struct {
+	InvitationID string     `json:"invitation_id"`
+	Email        string     `json:"email"`
+	RoleID       string     `json:"role_id"`
+	ScopeType    string     `json:"scope_type"`
+	ScopeID      string     `json:"scope_id"`
+	InvitedBy    string     `json:"invited_by"`
+	Status       string     `json:"status"` // "pending", "accepted" or "revoked"
+	ExpiresAt    time.Time  `json:"expires_at"`
+	SentCount    int        `json:"sent_count"`
+	LastSentAt   time.Time  `json:"last_sent_at"`
+	AcceptedBy   *string    `json:"accepted_by,omitempty"`
+	AcceptedAt   *time.Time `json:"accepted_at,omitempty"`
+	RevokedBy    *string    `json:"revoked_by,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// CreateInvitationRequest is the payload for inviting an email address to a scope.
+type CreateInvitationRequest struct {
+	Email  string `json:"email" binding:"required,email"`
+	RoleID string `json:"role_id" binding:"required"`
+}
+
+// AcceptInvitationRequest is the payload for accepting an invitation.
+type AcceptInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// AccountLinkToken proves control of an account for a short time. Redeeming it while
+// signed in with another identity merges the issuing account into that identity.
+type AccountLinkToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// LinkAccountRequest is the payload for linking another account to the current user.
+type LinkAccountRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// MergeUsersRequest is the payload for merging one user record into another.
+type MergeUsersRequest struct {
+	SourceUserID string `json:"source_user_id" binding:"required"`
+	TargetUserID string `json:"target_user_id" binding:"required"`
+}
+
+// UserMerge describes a completed merge of SourceUserID into TargetUserID.
+type UserMerge struct {
+	SourceUserID         string `json:"source_user_id"`
+	TargetUserID         string `json:"target_user_id"`
+	RoleAssignmentsMoved int64  `json:"role_assignments_moved"`
+	IdentityLinked       bool   `json:"identity_linked"` // The source subject now signs in as the target
+}
+
+// Account types reported on the /me profile.
+const (
+	AccountTypeUser           = "user"
+	AccountTypeServiceAccount = "service_account"
+)
+
+// UserProfile is the current user as returned by GET /me.
+type UserProfile struct {
+	User
+	AccountType string    `json:"account_type"` // AccountTypeUser or AccountTypeServiceAccount
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// UpdateProfileRequest is the payload for PUT /me.
+type UpdateProfileRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+// AccessEntry is a scope the current user can reach, with the highest role that applies there.
+type AccessEntry struct {
+	ScopeID   string  `json:"scope_id"`
+	Name      string  `json:"name"`
+	ParentID  *string `json:"parent_id,omitempty"` // Organization of a project, project of a resource
+	Role      string  `json:"role"`
+	GrantedAt string  `json:"granted_at"` // Scope type of the assignment granting Role
+	Inherited bool    `json:"inherited"`  // Role is granted on a parent scope
+}
+
+// AccessSummary lists everything the current user can reach, as returned by GET /me/access.
+type AccessSummary struct {
+	Organizations []AccessEntry `json:"organizations"`
+	Projects      []AccessEntry `json:"projects"`
+	Resources     []AccessEntry `json:"resources"`
+}
+
+// ServiceAccount is a non-human identity owned by an organization or project.
+// Its ServiceAccountID is also its user ID, so roles are assigned to it like to a user.
+type ServiceAccount struct {
+	ServiceAccountID string     `json:"service_account_id"`
+	Name             string     `json:"name"`
+	Description      string     `json:"description"`
+	ScopeType        string     `json:"scope_type"` // "organization" or "project"
+	ScopeID          string     `json:"scope_id"`
+	ExternalIssuer   *string    `json:"external_issuer,omitempty"`    // Issuer of the external OIDC client acting as this account
+	ExternalClientID  *string    `json:"external_client_id,omitempty"` // Client ID of an external OIDC client acting as this account
+	Disabled         bool       `json:"disabled"`
+	CreatedBy        string     `json:"created_by"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// CreateServiceAccountRequest is the payload for creating a service account.
+// external_issuer and external_client_id are set together, by platform administrators only.
+type CreateServiceAccountRequest struct {
+	Name            string  `json:"name" binding:"required,max=255"`
+	Description     string  `json:"description"`
+	ExternalIssuer  *string `json:"external_issuer,omitempty"`
+	ExternalClientID *string `json:"external_client_id,omitempty"`
+}
+
+// UpdateServiceAccountRequest is the payload for updating a service account.
+// Omitted fields are left unchanged; an empty external_client_id removes the mapping.
+// Changing the mapping is reserved to platform administrators.
+type UpdateServiceAccountRequest struct {
+	Name            *string `json:"name" binding:"omitempty,min=1,max=255"`
+	Description     *string `json:"description"`
+	ExternalIssuer  *string `json:"external_issuer"`
+	ExternalClientID *string `json:"external_client_id"`
+	Disabled        *bool   `json:"disabled"`
+}
+
+// ServiceAccountSecret describes a client secret without revealing it.
+type ServiceAccountSecret struct {
+	SecretID         string     `json:"secret_id"`
+	ServiceAccountID string     `json:"service_account_id"`
+	Description      string     `json:"description"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty"`
+	CreatedBy        string     `json:"created_by"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// CreateServiceAccountSecretRequest is the payload for issuing a client secret.
+type CreateServiceAccountSecretRequest struct {
+	Description   string `json:"description"`
+	ExpiresInDays int    `json:"expires_in_days" binding:"omitempty,min=1,max=730"` // Omit for a secret that does not expire
+}
+
+// CreatedServiceAccountSecret is returned once when a client secret is issued.
+type CreatedServiceAccountSecret struct {
+	ServiceAccountSecret
+	Secret string `json:"secret"` // Only shown once
+}
+
+// ServiceAccountTokenRequest is an OAuth 2.0 client credentials token request.
+// Credentials may also be sent with HTTP Basic authentication.
+type ServiceAccountTokenRequest struct {
+	GrantType    string `json:"grant_type" form:"grant_type" binding:"required"`
+	ClientID     string `json:"client_id" form:"client_id"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
+}
+
+// ServiceAccountToken is an OAuth 2.0 access token response.
+type ServiceAccountToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Principal types of role assignments.
+const (
+	PrincipalUser = "user"
+	PrincipalTeam = "team"
+)
+
+// Team member sources.
+const (
+	TeamMemberManual = "manual"
+	TeamMemberIDP    = "idp"
+)
+
+// Team is a group of users within an organization. Roles assigned to a team apply
+// to all of its members.
+// Database table: ktrlplane.teams
+type Team struct {
+	TeamID      string    `json:"team_id"`
+	OrgID       string    `json:"org_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	IDPIssuer   *string   `json:"idp_issuer,omitempty"` // Issuer whose groups claim carries IDPGroup
+	IDPGroup    *string   `json:"idp_group,omitempty"`  // Members are synced from this IdP group at login
+	MemberCount int       `json:"member_count"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// CreateTeamRequest is the payload for creating a team.
+// idp_issuer and idp_group are set together, by platform administrators only.
+type CreateTeamRequest struct {
+	Name        string  `json:"name" binding:"required,max=255"`
+	Description string  `json:"description"`
+	IDPIssuer   *string `json:"idp_issuer,omitempty" binding:"omitempty,max=255"`
+	IDPGroup    *string `json:"idp_group,omitempty" binding:"omitempty,max=255"`
+}
+
+// UpdateTeamRequest is the payload for updating a team. Omitted fields are unchanged.
+// Changing the IdP mapping is reserved to platform administrators.
+type UpdateTeamRequest struct {
+	Name        *string `json:"name" binding:"omitempty,min=1,max=255"`
+	Description *string `json:"description"`
+	IDPIssuer   *string `json:"idp_issuer" binding:"omitempty,max=255"`
+	IDPGroup    *string `json:"idp_group" binding:"omitempty,max=255"` // "" stops syncing from the IdP
+}
+
+// TeamMember is a user's membership of a team.
+type TeamMember struct {
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Source    string    `json:"source"` // "manual" or "idp"
+	AddedBy   *string   `json:"added_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddTeamMemberRequest is the payload for adding a user to a team.
+type AddTeamMemberRequest struct {
+	UserID string `json:"user_id" binding:"required"` // User ID or email of an existing user
+}
+
+// PersonalAccessToken describes a personal access token without revealing it.
+// A token without scope acts on every scope of its owner; a token without actions
+// carries every action of its owner.
+type PersonalAccessToken struct {
+	TokenID    string     `json:"token_id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	ScopeType  *string    `json:"scope_type,omitempty"`
+	ScopeID    *string    `json:"scope_id,omitempty"`
+	Actions    []string   `json:"actions,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreatePersonalAccessTokenRequest is the payload for creating a personal access token.
+type CreatePersonalAccessTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=255"`
+	ScopeType     string   `json:"scope_type" binding:"omitempty,oneof=organization project resource"`
+	ScopeID       string   `json:"scope_id" binding:"required_with=ScopeType"`
+	Actions       []string `json:"actions" binding:"omitempty,dive,required"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=365"` // Defaults to 30 days
+}
+
+// CreatedPersonalAccessToken is returned once when a personal access token is created.
+type CreatedPersonalAccessToken struct {
+	PersonalAccessToken
+	Token string `json:"token"` // Only shown once
+}
+
+// PermissionCheck is one (user, scope, action) tuple in a batch permission check.
+type PermissionCheck struct {
+	UserID    string `json:"user_id,omitempty"` // Defaults to the caller
+	ScopeType string `json:"scope_type" binding:"required"`
+	ScopeID   string `json:"scope_id" binding:"required"`
+	Action    string `json:"action" binding:"required"`
+}
+
+// BatchPermissionCheckRequest is the payload for a batch permission check.
+type BatchPermissionCheckRequest struct {
+	Checks []PermissionCheck `json:"checks" binding:"required,min=1,max=500,dive"`
+}
+
+// PermissionCheckResult is the decision for one tuple of a batch permission check.
+type PermissionCheckResult struct {
+	PermissionCheck
+	Allowed bool `json:"allowed"`
+}
+
+// PermissionGrant is a role assignment that grants an action on a scope, directly or
+// through inheritance from a parent scope.
+type PermissionGrant struct {
+	AssignmentID    string     `json:"assignment_id"`
+	RoleID          string     `json:"role_id"`
+	RoleName        string     `json:"role_name"`
+	RoleDisplayName string     `json:"role_display_name"`
+	ScopeType       string     `json:"scope_type"`       // Scope the role is assigned on
+	ScopeID         string     `json:"scope_id"`
+	InheritanceType string     `json:"inheritance_type"` // "direct" or "inherited"
+	AssignedBy      *string    `json:"assigned_by"` // nil once the granting user is deleted
+	CreatedAt       time.Time  `json:"created_at"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	TeamID          *string    `json:"team_id,omitempty"` // Set when the role is held through team membership
+	TeamName        *string    `json:"team_name,omitempty"`
+}
+
+// PermissionExplanation explains why a user can or cannot perform an action on a scope.
+type PermissionExplanation struct {
+	UserID    string            `json:"user_id"`
+	ScopeType string            `json:"scope_type"`
+	ScopeID   string            `json:"scope_id"`
+	Action    string            `json:"action"`
+	Allowed   bool              `json:"allowed"`
+	Grants    []PermissionGrant `json:"grants"`                    // Assignments granting the action, nearest scope first
+	Suggested []Role            `json:"suggested_roles,omitempty"` // Least-privileged roles granting the action, when no assignment does
+
+	RestrictedByToken bool `json:"restricted_by_token,omitempty"` // Grants exist, but the personal access token in use excludes the action or scope
+}
+
 // BillingAccount represents a billing account for an organization or project.
 type BillingAccount struct {
 	BillingAccountID     string    `json:"billing_account_id" db:"billing_account_id"`
@@ -202,17 +560,130 @@ type BillingAccount struct {
 	StripeSubscriptionID *string   `json:"stripe_subscription_id,omitempty" db:"stripe_subscription_id"`
 	CreatedAt            time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt            time.Time `json:"updated_at" db:"updated_at"`
+	Currency             *string   `json:"currency,omitempty" db:"currency"`                 // Currency of the account's prices; unset uses the default
+	BillingInterval      *string   `json:"billing_interval,omitempty" db:"billing_interval"` // "month" or "year"; unset uses monthly prices
 }
 
 // CreateStripeCustomerRequest is the payload for creating a Stripe customer.
 type CreateStripeCustomerRequest struct {
-	Description string `json:"description,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Currency    string          `json:"currency,omitempty"` // ISO 4217 code such as "eur"; defaults to the configured currency
+	Address     *BillingAddress `json:"address,omitempty"`
+	TaxID       *TaxIDInput     `json:"tax_id,omitempty"`
+	// Contacts default to the creating user's email, receiving invoices and alerts
+	Contacts []BillingContact `json:"contacts,omitempty" binding:"omitempty,max=10,dive"`
+}
+
+// BillingAddress is the billing address of a Stripe customer. It determines the tax applied
+// when Stripe Tax is enabled.
+type BillingAddress struct {
+	Line1      string `json:"line1" binding:"required"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city" binding:"required"`
+	State      string `json:"state,omitempty"`
+	PostalCode string `json:"postal_code" binding:"required"`
+	Country    string `json:"country" binding:"required,len=2"` // ISO 3166-1 alpha-2
+}
+
+// TaxIDInput is a tax ID to add to a Stripe customer, such as a VAT number.
+type TaxIDInput struct {
+	Type  string `json:"type" binding:"required"` // Stripe tax ID type, e.g. "eu_vat"
+	Value string `json:"value" binding:"required"`
+}
+
+// TaxID is a tax ID of a Stripe customer.
+type TaxID struct {
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	Value        string `json:"value"`
+	Verification string `json:"verification,omitempty"` // pending, verified, unverified or unavailable
+}
+
+// UpdateBillingAddressRequest sets the billing address of a billing account and optionally
+// adds a tax ID.
+type UpdateBillingAddressRequest struct {
+	Address BillingAddress `json:"address" binding:"required"`
+	TaxID   *TaxIDInput    `json:"tax_id,omitempty"`
+}
+
+// BillingAddressInfo is the billing address, tax IDs and tax status of a billing account.
+type BillingAddressInfo struct {
+	Currency     string          `json:"currency,omitempty"`
+	Address      *BillingAddress `json:"address,omitempty"`
+	TaxIDs       []TaxID         `json:"tax_ids"`
+	AutomaticTax string          `json:"automatic_tax,omitempty"` // Whether Stripe Tax can locate the customer, e.g. "supported"
 }
 
 // CreateStripeSubscriptionRequest is the payload for creating a Stripe subscription.
 type CreateStripeSubscriptionRequest struct {
 	PriceID         string `json:"price_id,omitempty"`
 	PaymentMethodID string `json:"payment_method_id,omitempty"`
+	PromotionCode   string `json:"promotion_code,omitempty"` // Customer-facing code, e.g. "LAUNCH20"
+}
+
+// StripeSubscriptionResult is the billing account of a created subscription. A subscription
+// that awaits a payment method carries the client secret to collect it with Stripe.js.
+type StripeSubscriptionResult struct {
+	BillingAccount
+	SubscriptionStatus string `json:"subscription_status"`
+	ClientSecret       string `json:"client_secret,omitempty"`
+}
+
+// ApplyDiscountRequest applies a promotion code or, for platform staff, a coupon to the
+// subscription of a billing account. Exactly one of them must be set.
+type ApplyDiscountRequest struct {
+	PromotionCode string `json:"promotion_code,omitempty"`
+	Coupon        string `json:"coupon,omitempty"` // Stripe coupon ID
+}
+
+// UpdateBillingTrialRequest grants a trial length to a billing account. A null trial_days
+// restores the trial lengths configured for the products; 0 gives no trial.
+type UpdateBillingTrialRequest struct {
+	TrialDays *int `json:"trial_days" binding:"omitempty,min=0,max=730"`
+}
+
+// BillingTrial is the trial of a billing account.
+type BillingTrial struct {
+	TrialDays   *int       `json:"trial_days"`              // Granted length; null uses the product defaults
+	TrialUsedAt *time.Time `json:"trial_used_at,omitempty"` // Set once a subscription has started with a trial
+}
+
+// UpdateBillingInheritanceRequest moves a project between being billed to its organization
+// and being billed on its own.
+type UpdateBillingInheritanceRequest struct {
+	InheritsBillingFromOrg *bool `json:"inherits_billing_from_org" binding:"required"`
+}
+
+// PaymentEnforcementStatus reports whether payment enforcement affects a billing account.
+type PaymentEnforcementStatus struct {
+	SubscriptionStatus *string    `json:"subscription_status,omitempty"` // As last checked
+	PaymentIssueSince  *time.Time `json:"payment_issue_since,omitempty"` // When the subscription became past due, unpaid or canceled
+	SuspendAt          *time.Time `json:"suspend_at,omitempty"`          // When paid resources will be suspended unless payment recovers
+	SuspendedAt        *time.Time `json:"suspended_at,omitempty"`
+}
+
+// UsageRecord is the metered usage of a resource during one hour.
+type UsageRecord struct {
+	ResourceID string    `json:"resource_id"`
+	Meter      string    `json:"meter"`
+	HourStart  time.Time `json:"hour_start"`
+	Quantity   float64   `json:"quantity"`
+	Reported   bool      `json:"reported"` // Whether the usage was reported to Stripe
+}
+
+// UsageTotal is the metered usage of a resource over a usage summary's period.
+type UsageTotal struct {
+	ResourceID string  `json:"resource_id"`
+	Meter      string  `json:"meter"`
+	Quantity   float64 `json:"quantity"`
+}
+
+// UsageSummary lists the hourly usage of a project's resources in [From, To).
+type UsageSummary struct {
+	From    time.Time     `json:"from"`
+	To      time.Time     `json:"to"`
+	Totals  []UsageTotal  `json:"totals"`
+	Records []UsageRecord `json:"records"`
 }
 
 // BillingInfo contains billing information for an organization or project.
@@ -224,6 +695,7 @@ type BillingInfo struct {
 	PaymentMethods       []StripePaymentMethod      `json:"payment_methods,omitempty"`
 	SubscriptionItems    []StripeSubscriptionItem   `json:"subscription_items,omitempty"`
 	SubscriptionDetails  *StripeSubscriptionDetails `json:"subscription_details,omitempty"`
+	PaymentStatus        string                     `json:"payment_status"` // requires_customer, requires_payment_method, requires_action or ready
 }
 
 // StripeInvoice represents a Stripe invoice.
@@ -237,6 +709,75 @@ type StripeInvoice struct {
 	HostedInvoiceURL *string `json:"hosted_invoice_url,omitempty"`
 }
 
+// Invoice is a Stripe invoice of a billing account. Amounts are in the smallest unit of the
+// currency. Lines and credit notes are only included when a single invoice is requested.
+type Invoice struct {
+	ID                string        `json:"id"`
+	Number            string        `json:"number,omitempty"`
+	Status            string        `json:"status"`
+	Currency          string        `json:"currency"`
+	Created           int64         `json:"created"`
+	PeriodStart       int64         `json:"period_start"`
+	PeriodEnd         int64         `json:"period_end"`
+	Subtotal          int64         `json:"subtotal"`
+	Tax               int64         `json:"tax"`
+	Total             int64         `json:"total"`
+	AmountDue         int64         `json:"amount_due"`
+	AmountPaid        int64         `json:"amount_paid"`
+	AmountRemaining   int64         `json:"amount_remaining"`
+	CreditNotesAmount int64         `json:"credit_notes_amount"` // Total of credit notes issued for the invoice
+	HostedInvoiceURL  string        `json:"hosted_invoice_url,omitempty"`
+	InvoicePDF        string        `json:"invoice_pdf,omitempty"` // Download link for the PDF
+	Lines             []InvoiceLine `json:"lines,omitempty"`
+	CreditNotes       []CreditNote  `json:"credit_notes,omitempty"`
+}
+
+// InvoiceLine is a line of an invoice. Lines for resource subscriptions name the resource
+// type and SKU of their price and are split across the projects billed for them when the
+// line's period started. Lines of subscription items whose shares were not recorded at the
+// time are split by the item's current shares, which may differ from those billed, and are
+// marked with ProjectsEstimated.
+type InvoiceLine struct {
+	ID                string               `json:"id"`
+	Description       string               `json:"description"`
+	ResourceType      string               `json:"resource_type,omitempty"`
+	SKU               string               `json:"sku,omitempty"`
+	PriceID           string               `json:"price_id,omitempty"`
+	Quantity          int64                `json:"quantity"`
+	Amount            int64                `json:"amount"`
+	PeriodStart       int64                `json:"period_start"`
+	PeriodEnd         int64                `json:"period_end"`
+	Proration         bool                 `json:"proration"`
+	Projects          []InvoiceLineProject `json:"projects,omitempty"`
+	ProjectsEstimated bool                 `json:"projects_estimated,omitempty"` // Projects split by current rather than historical shares
+}
+
+// InvoiceLineProject is the share of an invoice line billed for one project.
+type InvoiceLineProject struct {
+	ProjectID string `json:"project_id"`
+	Quantity  int64  `json:"quantity"`
+	Amount    int64  `json:"amount"`
+}
+
+// CreditNote is a Stripe credit note reducing the amount of an invoice.
+type CreditNote struct {
+	ID      string `json:"id"`
+	Number  string `json:"number"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Total   int64  `json:"total"`
+	Created int64  `json:"created"`
+	PDF     string `json:"pdf,omitempty"`
+}
+
+// InvoiceList is a page of invoices, newest first. Pass NextCursor as starting_after to
+// fetch the next page.
+type InvoiceList struct {
+	Invoices   []Invoice `json:"invoices"`
+	HasMore    bool      `json:"has_more"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
 // StripePaymentMethod represents a Stripe payment method.
 type StripePaymentMethod struct {
 	ID   string `json:"id"`
@@ -271,11 +812,27 @@ type StripeSubscriptionItem struct {
 
 // StripeSubscriptionDetails contains details about a Stripe subscription.
 type StripeSubscriptionDetails struct {
-	ID                 string `json:"id"`
-	Status             string `json:"status"`
-	CurrentPeriodStart int64  `json:"current_period_start"`
-	CurrentPeriodEnd   int64  `json:"current_period_end"`
-	CancelAtPeriodEnd  bool   `json:"cancel_at_period_end"`
+	ID                 string                       `json:"id"`
+	Status             string                       `json:"status"`
+	CurrentPeriodStart int64                        `json:"current_period_start"`
+	CurrentPeriodEnd   int64                        `json:"current_period_end"`
+	CancelAtPeriodEnd  bool                         `json:"cancel_at_period_end"`
+	TrialStart         int64                        `json:"trial_start,omitempty"` // Set while or after the subscription trials
+	TrialEnd           int64                        `json:"trial_end,omitempty"`
+	Discounts          []StripeSubscriptionDiscount `json:"discounts,omitempty"`
+}
+
+// StripeSubscriptionDiscount is a coupon applied to a subscription, possibly through a
+// promotion code.
+type StripeSubscriptionDiscount struct {
+	ID            string  `json:"id"`
+	Coupon        string  `json:"coupon"`
+	Name          string  `json:"name,omitempty"`
+	PromotionCode string  `json:"promotion_code,omitempty"`
+	PercentOff    float64 `json:"percent_off,omitempty"`
+	AmountOff     int64   `json:"amount_off,omitempty"`
+	Currency      string  `json:"currency,omitempty"`
+	End           int64   `json:"end,omitempty"` // Unset for discounts that last forever
 }
 
 // StripeCustomer represents a Stripe customer for billing info
@@ -287,10 +844,65 @@ type StripeCustomer struct {
 }
 
 type ResourceTierPrice struct {
-	PriceID      string `json:"price_id"`
-	Amount       int64  `json:"amount"`
-	Currency     string `json:"currency"`
-	Interval     string `json:"interval"`
-	SKU          string `json:"sku"`
-	ResourceType string `json:"resource_type"`
+	PriceID      string                  `json:"price_id"`
+	Amount       int64                   `json:"amount"`
+	Currency     string                  `json:"currency"`
+	Interval     string                  `json:"interval"`
+	SKU          string                  `json:"sku"`
+	ResourceType string                  `json:"resource_type"`
+	TaxBehavior  string                  `json:"tax_behavior,omitempty"` // "exclusive" when tax is added to the amount, "inclusive" when included
+	Prices       []ResourceIntervalPrice `json:"prices"`                 // Price for each billing interval the product offers
+}
+
+// ResourceIntervalPrice is the price of a resource type and SKU for one billing interval.
+type ResourceIntervalPrice struct {
+	PriceID  string `json:"price_id"`
+	Amount   int64  `json:"amount"`
+	Interval string `json:"interval"`
+}
+
+// UpdateBillingIntervalRequest switches a billing account between monthly and annual billing.
+type UpdateBillingIntervalRequest struct {
+	Interval string `json:"interval" binding:"required,oneof=month year"`
+}
+
+// BillingContact is an email address notified about the billing of an account. Contacts with
+// the invoices role receive invoices and receipts, those with the alerts role receive billing
+// notifications such as payment problems.
+type BillingContact struct {
+	Email string   `json:"email" binding:"required,email"`
+	Roles []string `json:"roles" binding:"required,min=1,dive,oneof=invoices alerts"`
+}
+
+// UpdateBillingContactsRequest replaces the billing contacts of a billing account. At least
+// one contact must receive invoices.
+type UpdateBillingContactsRequest struct {
+	Contacts []BillingContact `json:"contacts" binding:"required,min=1,max=10,dive"`
+}
+
+// EstimateResourceRequest is the payload for estimating the cost of a new resource.
+type EstimateResourceRequest struct {
+	Type string `json:"type" binding:"required"`
+	SKU  string `json:"sku" binding:"required"`
+}
+
+// EstimateResourceUpdateRequest is the payload for estimating the cost of a SKU change.
+type EstimateResourceUpdateRequest struct {
+	SKU string `json:"sku" binding:"required"`
+}
+
+// ResourceEstimate is the price impact of creating a resource or changing its SKU. Amounts are
+// in the smallest unit of the currency.
+type ResourceEstimate struct {
+	ResourceType          string `json:"resource_type"`
+	SKU                   string `json:"sku"`
+	CurrentSKU            string `json:"current_sku,omitempty"`   // Set for SKU changes
+	PriceID               string `json:"price_id,omitempty"`      // Empty for the free SKU
+	UnitAmount            int64  `json:"unit_amount"`             // Price of the SKU per interval
+	Currency              string `json:"currency,omitempty"`      // Empty when nothing is billed
+	Interval              string `json:"interval,omitempty"`      // Billing interval of the price
+	ProratedAmount        int64  `json:"prorated_amount"`         // Charged (credited when negative) for the rest of the current period
+	CurrentRecurringTotal int64  `json:"current_recurring_total"` // Subscription total per interval before the change
+	RecurringTotal        int64  `json:"recurring_total"`         // Subscription total per interval after the change
+	NewSubscription       bool   `json:"new_subscription"`        // The change starts a new subscription, charged right away
 }
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"ktrlplane/internal/db"
+	"log"
+	"time"
+)
+
+// staleBucketAge is how long a Postgres bucket may stay unused before it is deleted.
+const staleBucketAge = time.Hour
+
+// PostgresStore keeps token buckets in the rate_limit_buckets table so that all
+// replicas share the same budget. Each Take is a single atomic upsert.
+type PostgresStore struct{}
+
+// NewPostgresStore creates a PostgresStore. Call StartCleanup to delete stale buckets.
+func NewPostgresStore() *PostgresStore {
+	return &PostgresStore{}
+}
+
+// StartCleanup deletes buckets unused for staleBucketAge every interval until ctx is done.
+func (s *PostgresStore) StartCleanup(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.cleanup(ctx); err != nil {
+					log.Printf("[RateLimit] Failed to delete stale buckets: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Take implements Store.
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (float64, bool, error) {
+	var tokens float64
+	var allowed bool
+	err := db.GetDB().QueryRow(ctx, db.TakeRateLimitTokenQuery, key, limit.Burst, limit.Rate).Scan(&tokens, &allowed)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+	return tokens, allowed, nil
+}
+
+func (s *PostgresStore) cleanup(ctx context.Context) error {
+	pool := db.GetDB()
+	if pool == nil {
+		return nil
+	}
+	_, err := pool.Exec(ctx, db.DeleteStaleRateLimitBucketsQuery, staleBucketAge.Seconds())
+	return err
+}
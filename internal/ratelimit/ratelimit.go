@@ -0,0 +1,139 @@
+// Package ratelimit implements token bucket rate limiting for the API.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"ktrlplane/internal/config"
+	"log"
+	"math"
+	"time"
+)
+
+// Route groups with their own budgets.
+const (
+	GroupDefault = "default" // All authenticated API routes
+	GroupPublic  = "public"  // Unauthenticated routes such as /resource-pricing
+	GroupSearch  = "search"  // User search, which could otherwise be used to enumerate emails
+	GroupBilling = "billing" // Billing routes that fan out to Stripe
+)
+
+// Limit is a token bucket budget: Burst tokens, refilled at Rate tokens per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute returns a Limit allowing requests per minute with the given burst.
+func PerMinute(requests float64, burst int) Limit {
+	return Limit{Rate: requests / 60, Burst: burst}
+}
+
+// Result describes the outcome of taking a token.
+type Result struct {
+	Allowed    bool
+	Limit      int           // Bucket capacity
+	Remaining  int           // Whole tokens left after this request
+	RetryAfter time.Duration // Time until the next token is available; zero when allowed
+	Reset      time.Duration // Time until the bucket is full again
+}
+
+// Store holds token buckets.
+type Store interface {
+	// Take refills the bucket identified by key and takes one token if available.
+	// It returns the tokens left (possibly fractional) and whether a token was taken.
+	Take(ctx context.Context, key string, limit Limit) (tokens float64, allowed bool, err error)
+}
+
+// DefaultBudgets returns the budgets used for groups without configuration.
+func DefaultBudgets() map[string]Limit {
+	return map[string]Limit{
+		GroupDefault: PerMinute(600, 100),
+		GroupPublic:  PerMinute(60, 20),
+		GroupSearch:  PerMinute(30, 10),
+		GroupBilling: PerMinute(120, 30),
+	}
+}
+
+// Limiter applies per-group budgets to keys using a Store.
+type Limiter struct {
+	store   Store
+	budgets map[string]Limit
+}
+
+// NewLimiter creates a Limiter. Groups missing from budgets use DefaultBudgets,
+// and unknown groups fall back to the "default" budget.
+func NewLimiter(store Store, budgets map[string]Limit) *Limiter {
+	merged := DefaultBudgets()
+	for group, limit := range budgets {
+		merged[group] = limit
+	}
+	return &Limiter{store: store, budgets: merged}
+}
+
+// NewFromConfig builds a Limiter from configuration. It returns nil when rate limiting is disabled.
+// Background cleanup of a shared store runs until ctx is done.
+func NewFromConfig(ctx context.Context, cfg config.RateLimitConfig) (*Limiter, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	budgets := make(map[string]Limit, len(cfg.Groups))
+	for group, budget := range cfg.Groups {
+		if budget.RequestsPerMinute <= 0 || budget.Burst <= 0 {
+			return nil, fmt.Errorf("invalid rate limit budget for group %s: requests_per_minute and burst must be positive", group)
+		}
+		budgets[group] = PerMinute(budget.RequestsPerMinute, budget.Burst)
+	}
+
+	var store Store
+	switch cfg.Store {
+	case "", "memory":
+		store = NewMemoryStore()
+	case "postgres":
+		postgres := NewPostgresStore()
+		postgres.StartCleanup(ctx, staleBucketAge/4)
+		store = postgres
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q (expected \"memory\" or \"postgres\")", cfg.Store)
+	}
+
+	log.Printf("Rate limiting enabled (store: %s)", cfg.Store)
+	return NewLimiter(store, budgets), nil
+}
+
+// Budget returns the limit applied to group.
+func (l *Limiter) Budget(group string) Limit {
+	if limit, ok := l.budgets[group]; ok {
+		return limit
+	}
+	return l.budgets[GroupDefault]
+}
+
+// Allow takes a token for key from group's bucket.
+func (l *Limiter) Allow(ctx context.Context, group, key string) (Result, error) {
+	limit := l.Budget(group)
+	tokens, allowed, err := l.store.Take(ctx, group+":"+key, limit)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     refillTime(float64(limit.Burst)-tokens, limit.Rate),
+	}
+	if !allowed {
+		result.RetryAfter = refillTime(1-tokens, limit.Rate)
+	}
+	return result, nil
+}
+
+// refillTime returns how long it takes to refill missing tokens at rate tokens per second.
+func refillTime(missing, rate float64) time.Duration {
+	if missing <= 0 || rate <= 0 {
+		return 0
+	}
+	return time.Duration(missing / rate * float64(time.Second))
+}
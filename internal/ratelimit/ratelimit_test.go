@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ktrlplane/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestStore returns a MemoryStore whose clock is advanced manually.
+func newTestStore() (*MemoryStore, *time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	store.lastSweep = now
+	return store, &now
+}
+
+func TestMemoryStore_BurstThenRefill(t *testing.T) {
+	store, now := newTestStore()
+	limit := Limit{Rate: 1, Burst: 3}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, allowed, err := store.Take(ctx, "k", limit)
+		assert.NoError(t, err)
+		assert.True(t, allowed, "request %d should be within burst", i)
+	}
+	_, allowed, _ := store.Take(ctx, "k", limit)
+	assert.False(t, allowed, "burst exhausted")
+
+	// Other keys have their own bucket
+	_, allowed, _ = store.Take(ctx, "other", limit)
+	assert.True(t, allowed)
+
+	*now = now.Add(time.Second)
+	_, allowed, _ = store.Take(ctx, "k", limit)
+	assert.True(t, allowed, "one token refilled after one second")
+}
+
+func TestMemoryStore_SweepsIdleBuckets(t *testing.T) {
+	store, now := newTestStore()
+	_, _, _ = store.Take(context.Background(), "k", Limit{Rate: 1, Burst: 1})
+	assert.Len(t, store.buckets, 1)
+
+	*now = now.Add(2 * sweepInterval)
+	_, _, _ = store.Take(context.Background(), "fresh", Limit{Rate: 1, Burst: 1})
+	assert.Len(t, store.buckets, 1)
+	assert.Contains(t, store.buckets, "fresh")
+}
+
+func TestLimiter_AllowResult(t *testing.T) {
+	store, _ := newTestStore()
+	limiter := NewLimiter(store, map[string]Limit{GroupSearch: PerMinute(60, 2)})
+	ctx := context.Background()
+
+	result, err := limiter.Allow(ctx, GroupSearch, "user:u1")
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Limit)
+	assert.Equal(t, 1, result.Remaining)
+	assert.Equal(t, time.Second, result.Reset)
+
+	_, _ = limiter.Allow(ctx, GroupSearch, "user:u1")
+	result, _ = limiter.Allow(ctx, GroupSearch, "user:u1")
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	assert.Equal(t, 2*time.Second, result.Reset)
+
+	// Groups do not share buckets for the same caller
+	result, _ = limiter.Allow(ctx, GroupDefault, "user:u1")
+	assert.True(t, result.Allowed)
+}
+
+func TestLimiter_Budget(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), nil)
+	assert.Equal(t, DefaultBudgets()[GroupPublic], limiter.Budget(GroupPublic))
+	assert.Equal(t, DefaultBudgets()[GroupDefault], limiter.Budget("unknown"))
+}
+
+func TestNewFromConfig(t *testing.T) {
+	limiter, err := NewFromConfig(context.Background(), config.RateLimitConfig{Enabled: false})
+	assert.NoError(t, err)
+	assert.Nil(t, limiter)
+
+	limiter, err = NewFromConfig(context.Background(), config.RateLimitConfig{
+		Enabled: true,
+		Groups:  map[string]config.RateLimitBudget{GroupPublic: {RequestsPerMinute: 120, Burst: 5}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, Limit{Rate: 2, Burst: 5}, limiter.Budget(GroupPublic))
+
+	_, err = NewFromConfig(context.Background(), config.RateLimitConfig{Enabled: true, Store: "redis"})
+	assert.Error(t, err)
+
+	_, err = NewFromConfig(context.Background(), config.RateLimitConfig{
+		Enabled: true,
+		Groups:  map[string]config.RateLimitBudget{GroupSearch: {RequestsPerMinute: 0, Burst: 1}},
+	})
+	assert.Error(t, err)
+}
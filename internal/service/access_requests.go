@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ktrlplane/internal/db"
+	"ktrlplane/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// scanAccessRequest scans a row selected with the access request column list.
+func scanAccessRequest(row pgx.Row) (*models.AccessRequest, error) {
+	var req models.AccessRequest
+	err := row.Scan(
+		&req.RequestID, &req.UserID, &req.RoleID, &req.ScopeType, &req.ScopeID,
+		&req.Justification, &req.DurationHours, &req.Status,
+		&req.DecidedBy, &req.DecidedAt, &req.ExpiresAt, &req.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// RequestAccess files a request for a temporary role on a scope. The requester must
+// already be able to read the scope; an Owner (manage_access) approves or denies it.
+func (s *RBACService) RequestAccess(ctx context.Context, userID, scopeType, scopeID string, req models.CreateAccessRequestRequest) (*models.AccessRequest, error) {
+	canRead, err := s.CheckPermission(ctx, userID, "read", scopeType, scopeID)
+	if err != nil {
+		return nil, err
+	}
+	if !canRead {
+		return nil, Forbidden("insufficient permissions to request access on this %s", scopeType)
+	}
+
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	created, err := scanAccessRequest(tx.QueryRow(ctx, db.CreateAccessRequestQuery,
+		uuid.New().String(), userID, req.RoleID, scopeType, scopeID, req.Justification, req.DurationHours))
+	if isUniqueViolation(err) {
+		return nil, Conflict("an access request for this role is already pending")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create access request: %w", err)
+	}
+
+	err = recordAuditEvent(ctx, tx, AuditAccessRequestCreated, userID, userID, scopeType, scopeID, map[string]any{
+		"request_id":     created.RequestID,
+		"role_id":        created.RoleID,
+		"duration_hours": created.DurationHours,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit access request: %w", err)
+	}
+	return created, nil
+}
+
+// ListAccessRequests lists access requests on a scope, optionally filtered by status.
+// Requires manage_access on the scope.
+func (s *RBACService) ListAccessRequests(ctx context.Context, userID, scopeType, scopeID, status string) ([]models.AccessRequest, error) {
+	if err := s.requireManageAccess(ctx, userID, scopeType, scopeID); err != nil {
+		return nil, err
+	}
+
+	pool := db.GetDB()
+	rows, err := pool.Query(ctx, db.ListAccessRequestsForScopeQuery, scopeType, scopeID, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list access requests: %w", err)
+	}
+	defer rows.Close()
+
+	requests := make([]models.AccessRequest, 0)
+	for rows.Next() {
+		req, err := scanAccessRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan access request: %w", err)
+		}
+		requests = append(requests, *req)
+	}
+	return requests, rows.Err()
+}
+
+// ApproveAccessRequest grants the requested role until now plus the requested duration.
+// Requires manage_access on the scope; users cannot approve their own requests.
+func (s *RBACService) ApproveAccessRequest(ctx context.Context, approverID, scopeType, scopeID, requestID string) (*models.AccessRequest, error) {
+	return s.decideAccessRequest(ctx, approverID, scopeType, scopeID, requestID, true)
+}
+
+// DenyAccessRequest rejects a pending access request. Requires manage_access on the scope.
+func (s *RBACService) DenyAccessRequest(ctx context.Context, approverID, scopeType, scopeID, requestID string) (*models.AccessRequest, error) {
+	return s.decideAccessRequest(ctx, approverID, scopeType, scopeID, requestID, false)
+}
+
+func (s *RBACService) decideAccessRequest(ctx context.Context, approverID, scopeType, scopeID, requestID string, approve bool) (*models.AccessRequest, error) {
+	if err := s.requireManageAccess(ctx, approverID, scopeType, scopeID); err != nil {
+		return nil, err
+	}
+
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	req, err := scanAccessRequest(tx.QueryRow(ctx, db.LockAccessRequestQuery, requestID, scopeType, scopeID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, NotFound("access request %s not found", requestID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access request: %w", err)
+	}
+	if req.Status != models.AccessRequestPending {
+		return nil, Conflict("access request %s is already %s", requestID, req.Status)
+	}
+	if approve && req.UserID == approverID {
+		return nil, Forbidden("you cannot approve your own access request")
+	}
+
+	status, eventType := models.AccessRequestDenied, AuditAccessRequestDenied
+	var expiresAt *time.Time
+	if approve {
+		status, eventType = models.AccessRequestApproved, AuditAccessRequestApproved
+		expires := time.Now().UTC().Add(time.Duration(req.DurationHours) * time.Hour)
+		expiresAt = &expires
+		err = s.assignRoleInTx(ctx, tx, req.UserID, req.RoleID, req.ScopeType, req.ScopeID, approverID, expiresAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var decidedAt time.Time
+	err = tx.QueryRow(ctx, db.DecideAccessRequestQuery, requestID, status, approverID, expiresAt).Scan(&decidedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update access request: %w", err)
+	}
+
+	details := map[string]any{"request_id": req.RequestID, "role_id": req.RoleID}
+	if expiresAt != nil {
+		details["expires_at"] = expiresAt
+	}
+	if err := recordAuditEvent(ctx, tx, eventType, approverID, req.UserID, req.ScopeType, req.ScopeID, details); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit access request decision: %w", err)
+	}
+	InvalidateUserPermissions(ctx, req.UserID)
+
+	req.Status = status
+	req.DecidedBy = &approverID
+	req.DecidedAt = &decidedAt
+	req.ExpiresAt = expiresAt
+	return req, nil
+}
+
+// requireManageAccess returns a Forbidden error unless userID holds manage_access on the scope.
+func (s *RBACService) requireManageAccess(ctx context.Context, userID, scopeType, scopeID string) error {
+	canManage, err := s.CheckPermission(ctx, userID, "manage_access", scopeType, scopeID)
+	if err != nil {
+		return err
+	}
+	if !canManage {
+		return Forbidden("insufficient permissions to manage access requests")
+	}
+	return nil
+}
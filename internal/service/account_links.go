@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"ktrlplane/internal/cache"
+	"ktrlplane/internal/db"
+	"ktrlplane/internal/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Audit event types for account linking.
+const (
+	AuditUserLinked = "user.linked"
+	AuditUserMerged = "user.merged"
+)
+
+// accountLinkTokenTTL bounds how long a link token can be redeemed after it is issued.
+const accountLinkTokenTTL = 10 * time.Minute
+
+// identityLinkCacheTTL bounds how long another replica may keep resolving a freshly
+// linked subject to itself.
+const identityLinkCacheTTL = 5 * time.Minute
+
+// identityLinks maps a token subject to the user it is linked to, or "" when it is not linked.
+var identityLinks = cache.New[string]("identity-links", identityLinkCacheTTL)
+
+// ResolveUserID returns the user a token subject is linked to, or the subject itself
+// when it has not been linked to another account.
+func ResolveUserID(ctx context.Context, subject string) (string, error) {
+	linked, err := identityLinks.GetOrLoad(ctx, subject, func() (string, error) {
+		var userID string
+		err := db.GetDB().QueryRow(ctx, db.GetUserIDForIdentityQuery, subject).Scan(&userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve identity link: %w", err)
+		}
+		return userID, nil
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+	if linked == "" {
+		return subject, nil
+	}
+	return linked, nil
+}
+
+// CreateAccountLinkToken issues a short-lived, single-use token proving control of
+// userID's account. Signing in with another identity and redeeming it through
+// LinkAccount merges userID into that identity. Issuing a token revokes the previous one.
+func (s *RBACService) CreateAccountLinkToken(ctx context.Context, userID string) (*models.AccountLinkToken, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate account link token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	expires := time.Now().UTC().Add(accountLinkTokenTTL)
+
+	if err := db.ExecQuery(ctx, db.CreateAccountLinkTokenQuery, hashToken(token), userID, expires); err != nil {
+		return nil, fmt.Errorf("failed to store account link token: %w", err)
+	}
+	return &models.AccountLinkToken{Token: token, ExpiresAt: expires}, nil
+}
+
+// LinkAccount merges the account that issued token into userID. All role assignments
+// move to userID, the old account is deleted and its subject resolves to userID from then on.
+func (s *RBACService) LinkAccount(ctx context.Context, userID, token string) (*models.UserMerge, error) {
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var sourceID string
+	var expires time.Time
+	err = tx.QueryRow(ctx, db.ConsumeAccountLinkTokenQuery, hashToken(token)).Scan(&sourceID, &expires)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, Validation("Invalid or expired account link token")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem account link token: %w", err)
+	}
+	if !time.Now().Before(expires) {
+		return nil, Validation("Invalid or expired account link token")
+	}
+	if sourceID == userID {
+		return nil, Validation("This token was issued by the account you are signed in with. Sign in with the other account to link them.")
+	}
+
+	merge, err := mergeUsersInTx(ctx, tx, sourceID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordAuditEvent(ctx, tx, AuditUserLinked, userID, userID, "", "", mergeDetails(merge)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit account link: %w", err)
+	}
+	invalidateMergedUsers(ctx, merge)
+	return merge, nil
+}
+
+// MergeUsers merges sourceID into targetID on behalf of a platform administrator,
+// who needs the manage_users permission at global scope.
+func (s *RBACService) MergeUsers(ctx context.Context, adminID, sourceID, targetID string) (*models.UserMerge, error) {
+	canManage, err := s.CheckPermission(ctx, adminID, "manage_users", "global", "global")
+	if err != nil {
+		return nil, err
+	}
+	if !canManage {
+		return nil, Forbidden("merging users requires the 'manage_users' permission at global scope")
+	}
+	if sourceID == targetID {
+		return nil, Validation("cannot merge a user into itself")
+	}
+
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	merge, err := mergeUsersInTx(ctx, tx, sourceID, targetID, adminID)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordAuditEvent(ctx, tx, AuditUserMerged, adminID, targetID, "global", "global", mergeDetails(merge)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit user merge: %w", err)
+	}
+	invalidateMergedUsers(ctx, merge)
+	return merge, nil
+}
+
+// mergeUsersInTx moves everything owned by sourceID to targetID and deletes sourceID.
+// Role assignments held by both keep the longer-lived grant. Unless sourceID is a
+// placeholder (user_id = email), its subject is linked to targetID so that later
+// sign-ins with the old identity reach the merged account. Teams and service accounts,
+// which are also users rows, cannot be merged.
+func mergeUsersInTx(ctx context.Context, tx pgx.Tx, sourceID, targetID, actorID string) (*models.UserMerge, error) {
+	for _, id := range []string{sourceID, targetID} {
+		if isTeamID(id) || isServiceAccountID(id) {
+			return nil, Validation("%s is not a user account and cannot be merged", id)
+		}
+	}
+
+	rows, err := tx.Query(ctx, db.LockUsersForMergeQuery, sourceID, targetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock users: %w", err)
+	}
+	found := make(map[string]bool, 2)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		found[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to lock users: %w", err)
+	}
+	for _, id := range []string{sourceID, targetID} {
+		if !found[id] {
+			return nil, NotFound("user %s not found", id)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, db.MergeDuplicateRoleAssignmentsQuery, sourceID, targetID); err != nil {
+		return nil, fmt.Errorf("failed to merge duplicate role assignments: %w", err)
+	}
+	duplicates, err := tx.Exec(ctx, db.DeleteDuplicateRoleAssignmentsQuery, sourceID, targetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete duplicate role assignments: %w", err)
+	}
+	transferred, err := tx.Exec(ctx, db.TransferRoleAssignmentsQuery, sourceID, targetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transfer role assignments: %w", err)
+	}
+
+	for _, query := range []string{
+		db.ReassignRoleAssignmentGrantorQuery,
+		db.ReassignAccessRequestsQuery,
+		db.ReassignAccessRequestDeciderQuery,
+		db.ReassignInvitationsQuery,
+		db.ReassignIdentityLinksQuery,
+		db.ReassignTeamMembershipsQuery,
+	} {
+		if _, err := tx.Exec(ctx, query, sourceID, targetID); err != nil {
+			return nil, fmt.Errorf("failed to reassign user references (%s): %w", db.QueryName(query), err)
+		}
+	}
+
+	placeholder, err := isPlaceholderUser(ctx, tx, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	if !placeholder {
+		if _, err := tx.Exec(ctx, db.UpsertIdentityLinkQuery, sourceID, targetID, actorID); err != nil {
+			return nil, fmt.Errorf("failed to link identity: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, db.DeletePlaceholderUserQuery, sourceID); err != nil {
+		return nil, fmt.Errorf("failed to delete merged user: %w", err)
+	}
+
+	return &models.UserMerge{
+		SourceUserID:         sourceID,
+		TargetUserID:         targetID,
+		RoleAssignmentsMoved: transferred.RowsAffected() + duplicates.RowsAffected(),
+		IdentityLinked:       !placeholder,
+	}, nil
+}
+
+// isPlaceholderUser reports whether userID is a placeholder created for an invited email.
+func isPlaceholderUser(ctx context.Context, tx pgx.Tx, userID string) (bool, error) {
+	rows, err := tx.Query(ctx, db.FindPlaceholderUserByEmailQuery, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check for placeholder user: %w", err)
+	}
+	defer rows.Close()
+	found := rows.Next()
+	rows.Close()
+	return found, rows.Err()
+}
+
+func mergeDetails(merge *models.UserMerge) map[string]any {
+	return map[string]any{
+		"source_user_id":         merge.SourceUserID,
+		"target_user_id":         merge.TargetUserID,
+		"role_assignments_moved": merge.RoleAssignmentsMoved,
+	}
+}
+
+// invalidateMergedUsers drops cached permissions and identity links for both users.
+func invalidateMergedUsers(ctx context.Context, merge *models.UserMerge) {
+	InvalidateUserPermissions(ctx, merge.SourceUserID)
+	InvalidateUserPermissions(ctx, merge.TargetUserID)
+	// Subjects previously linked to the source now resolve to the target
+	identityLinks.Clear()
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"ktrlplane/internal/db"
+	"time"
+)
+
+// DefaultAssignmentSweepInterval is how often expired role assignments are removed.
+// Expired assignments already grant nothing; sweeping keeps the table and listings clean.
+const DefaultAssignmentSweepInterval = time.Minute
+
+// SweepExpiredAssignments deletes expired role assignments and records a
+// role_assignment.expired audit event for each, in a single statement.
+// It returns the number of assignments removed.
+func (s *RBACService) SweepExpiredAssignments(ctx context.Context) (int, error) {
+	pool := db.GetDB()
+	rows, err := pool.Query(ctx, db.SweepExpiredRoleAssignmentsQuery)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sweep expired role assignments: %w", err)
+	}
+	defer rows.Close()
+
+	removed := 0
+	users := make(map[string]struct{})
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return removed, fmt.Errorf("failed to scan expired role assignment: %w", err)
+		}
+		removed++
+		users[userID] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return removed, fmt.Errorf("failed to sweep expired role assignments: %w", err)
+	}
+
+	for userID := range users {
+		InvalidateUserPermissions(ctx, userID)
+	}
+	return removed, nil
+}
+
+// StartAssignmentSweeper runs SweepExpiredAssignments every interval until ctx is done.
+// Running it on every replica is safe: each expired row is deleted exactly once.
+func (s *RBACService) StartAssignmentSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				removed, err := s.SweepExpiredAssignments(ctx)
+				if err != nil {
+					fmt.Printf("[RBACService] Failed to sweep expired role assignments: %v\n", err)
+				} else if removed > 0 {
+					fmt.Printf("[RBACService] Removed %d expired role assignments\n", removed)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"ktrlplane/internal/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Audit event types.
+const (
+	AuditRoleAssignmentExpired = "role_assignment.expired"
+	AuditAccessRequestCreated  = "access_request.created"
+	AuditAccessRequestApproved = "access_request.approved"
+	AuditAccessRequestDenied   = "access_request.denied"
+)
+
+// auditActorSystem is the actor recorded for events raised by background jobs.
+const auditActorSystem = "system"
+
+// execer is satisfied by both the connection pool and a transaction.
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// querier is satisfied by both the connection pool and a transaction.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// recordAuditEvent writes an audit event through q. Pass the transaction that made the
+// change so that the event is only recorded if the change commits.
+func recordAuditEvent(ctx context.Context, q execer, eventType, actorID, subjectID, scopeType, scopeID string, details map[string]any) error {
+	if details == nil {
+		details = map[string]any{}
+	}
+	payload, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit event details: %w", err)
+	}
+	_, err = q.Exec(ctx, db.InsertAuditEventQuery, eventType, actorID, subjectID, scopeType, scopeID, string(payload))
+	if err != nil {
+		return fmt.Errorf("failed to record audit event %s: %w", eventType, err)
+	}
+	return nil
+}
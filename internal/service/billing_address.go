@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"ktrlplane/internal/models"
+	"strings"
+
+	"github.com/stripe/stripe-go/v84"
+	"github.com/stripe/stripe-go/v84/customer"
+	"github.com/stripe/stripe-go/v84/taxid"
+)
+
+// GetBillingAddress returns the billing address, tax IDs and currency of the billing account
+// paying for a scope.
+func (s *BillingService) GetBillingAddress(ctx context.Context, scopeType, scopeID string) (*models.BillingAddressInfo, error) {
+	account, err := s.stripeCustomerAccount(ctx, scopeType, scopeID)
+	if err != nil {
+		return nil, err
+	}
+
+	params := &stripe.CustomerParams{}
+	params.Context = ctx
+	params.AddExpand("tax_ids")
+	params.AddExpand("tax")
+	cust, err := customer.Get(*account.StripeCustomerID, params)
+	if err != nil {
+		return nil, Upstream(err, "failed to fetch Stripe customer")
+	}
+
+	info := convertBillingAddress(cust)
+	info.Currency = s.accountCurrency(account)
+	return info, nil
+}
+
+// UpdateBillingAddress sets the billing address of the billing account paying for a scope and
+// adds the tax ID, if given. With Stripe Tax enabled, addresses it cannot locate are rejected.
+func (s *BillingService) UpdateBillingAddress(ctx context.Context, scopeType, scopeID string, req models.UpdateBillingAddressRequest) (*models.BillingAddressInfo, error) {
+	account, err := s.stripeCustomerAccount(ctx, scopeType, scopeID)
+	if err != nil {
+		return nil, err
+	}
+	customerID := *account.StripeCustomerID
+
+	params := &stripe.CustomerParams{Address: addressParams(&req.Address)}
+	params.Context = ctx
+	if s.automaticTax() {
+		params.Tax = &stripe.CustomerTaxParams{ValidateLocation: stripe.String("immediately")}
+	}
+	if _, err := customer.Update(customerID, params); err != nil {
+		return nil, stripeRequestError(err, "failed to update billing address")
+	}
+	InvalidateBillingInfo(account.ScopeType, account.ScopeID)
+
+	if req.TaxID != nil {
+		taxParams := &stripe.TaxIDParams{
+			Customer: stripe.String(customerID),
+			Type:     stripe.String(req.TaxID.Type),
+			Value:    stripe.String(req.TaxID.Value),
+		}
+		taxParams.Context = ctx
+		if _, err := taxid.New(taxParams); err != nil {
+			return nil, stripeRequestError(err, "failed to add tax ID")
+		}
+	}
+
+	return s.GetBillingAddress(ctx, account.ScopeType, account.ScopeID)
+}
+
+// stripeCustomerAccount returns the billing account paying for a scope, which must have a
+// Stripe customer.
+func (s *BillingService) stripeCustomerAccount(ctx context.Context, scopeType, scopeID string) (*models.BillingAccount, error) {
+	scopeType, scopeID, err := s.ResolveBillingScope(ctx, scopeType, scopeID)
+	if err != nil {
+		return nil, err
+	}
+	account, err := s.GetBillingAccount(ctx, scopeType, scopeID)
+	if err != nil {
+		return nil, err
+	}
+	if account.StripeCustomerID == nil || *account.StripeCustomerID == "" {
+		return nil, NotFound("no Stripe customer found for billing account")
+	}
+	return account, nil
+}
+
+// addressParams converts a billing address to Stripe params.
+func addressParams(address *models.BillingAddress) *stripe.AddressParams {
+	params := &stripe.AddressParams{
+		Line1:      stripe.String(address.Line1),
+		City:       stripe.String(address.City),
+		PostalCode: stripe.String(address.PostalCode),
+		Country:    stripe.String(strings.ToUpper(address.Country)),
+	}
+	// Empty strings clear the optional fields of an earlier address
+	params.Line2 = stripe.String(address.Line2)
+	params.State = stripe.String(address.State)
+	return params
+}
+
+// convertBillingAddress converts the address, expanded tax IDs and tax status of a customer.
+func convertBillingAddress(cust *stripe.Customer) *models.BillingAddressInfo {
+	info := &models.BillingAddressInfo{TaxIDs: []models.TaxID{}}
+	if a := cust.Address; a != nil && (a.Line1 != "" || a.Country != "") {
+		info.Address = &models.BillingAddress{
+			Line1:      a.Line1,
+			Line2:      a.Line2,
+			City:       a.City,
+			State:      a.State,
+			PostalCode: a.PostalCode,
+			Country:    a.Country,
+		}
+	}
+	if cust.TaxIDs != nil {
+		for _, t := range cust.TaxIDs.Data {
+			taxID := models.TaxID{ID: t.ID, Type: string(t.Type), Value: t.Value}
+			if t.Verification != nil {
+				taxID.Verification = string(t.Verification.Status)
+			}
+			info.TaxIDs = append(info.TaxIDs, taxID)
+		}
+	}
+	if cust.Tax != nil {
+		info.AutomaticTax = string(cust.Tax.AutomaticTax)
+	}
+	return info
+}
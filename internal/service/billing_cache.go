@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"ktrlplane/internal/cache"
+	"ktrlplane/internal/models"
+	"time"
+
+	"github.com/stripe/stripe-go/v84"
+	"github.com/stripe/stripe-go/v84/price"
+)
+
+// Cache TTLs for Stripe lookups. Prices and product defaults change rarely and only
+// through the Stripe dashboard; billing info is refreshed often so that changes
+// made in the Stripe customer portal show up quickly.
+const (
+	priceCacheTTL       = time.Hour
+	billingInfoCacheTTL = 30 * time.Second
+)
+
+// Billing caches are shared by all BillingService instances, since other services
+// create their own BillingService per call.
+var (
+	productPricesCache = cache.New[[]*stripe.Price]("stripe_product_prices", priceCacheTTL)
+	priceCache         = cache.New[*stripe.Price]("stripe_price", priceCacheTTL)
+	billingInfoCache   = cache.New[*models.BillingInfo]("billing_info", billingInfoCacheTTL)
+)
+
+// billingInfoKey returns the billing info cache key for a scope.
+func billingInfoKey(scopeType, scopeID string) string {
+	return scopeType + ":" + scopeID
+}
+
+// InvalidateBillingInfo drops cached billing info for a scope.
+// Call it after changing the scope's Stripe customer or subscription.
+func InvalidateBillingInfo(scopeType, scopeID string) {
+	billingInfoCache.Invalidate(billingInfoKey(scopeType, scopeID))
+}
+
+// ClearBillingCaches drops all cached Stripe prices and billing info.
+func ClearBillingCaches() {
+	productPricesCache.Clear()
+	priceCache.Clear()
+	billingInfoCache.Clear()
+}
+
+// cacheableBillingInfo reports whether billing info may be cached. Info without a
+// payment method is not cached: the frontend attaches one through Stripe.js and
+// then polls billing status, which must reflect the new method immediately.
+func cacheableBillingInfo(info *models.BillingInfo) bool {
+	return info != nil && len(info.PaymentMethods) > 0
+}
+
+// getPrice fetches a Stripe price by ID, with its currency options, through the price cache.
+func getPrice(ctx context.Context, priceID string) (*stripe.Price, error) {
+	return priceCache.GetOrLoad(ctx, priceID, func() (*stripe.Price, error) {
+		params := &stripe.PriceParams{Params: stripe.Params{Context: ctx}}
+		params.AddExpand("currency_options")
+		return price.Get(priceID, params)
+	}, nil)
+}
+
+// getProductPrices lists the active prices of a Stripe product, with their currency options,
+// through the product prices cache. Products without prices are not cached, so that prices
+// created afterwards are picked up right away.
+func getProductPrices(ctx context.Context, productID string) ([]*stripe.Price, error) {
+	return productPricesCache.GetOrLoad(ctx, productID, func() ([]*stripe.Price, error) {
+		params := &stripe.PriceListParams{
+			Product: stripe.String(productID),
+			Active:  stripe.Bool(true),
+		}
+		params.Context = ctx
+		params.AddExpand("data.currency_options")
+
+		var prices []*stripe.Price
+		iter := price.List(params)
+		for iter.Next() {
+			prices = append(prices, iter.Price())
+		}
+		return prices, iter.Err()
+	}, func(prices []*stripe.Price) bool { return len(prices) > 0 })
+}
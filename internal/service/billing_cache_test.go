@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"ktrlplane/internal/config"
+	"ktrlplane/internal/models"
+	"ktrlplane/internal/telemetry"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v84"
+)
+
+func newPricingBillingService() *BillingService {
+	return NewBillingService(&config.Config{
+		Stripe: config.StripeConfig{
+			Products: []config.StripeProduct{
+				{ResourceType: "Konnektr.Graph", SKU: "standard", ProductID: "prod_graph_std"},
+			},
+		},
+	})
+}
+
+func TestBillingService_PriceLookupsAreCached(t *testing.T) {
+	ClearBillingCaches()
+	defer ClearBillingCaches()
+
+	fs := newFakeStripe(t)
+	fs.handle("GET /v1/prices", func(r *http.Request) (int, any) {
+		assert.Equal(t, "prod_graph_std", r.URL.Query().Get("product"))
+		return http.StatusOK, stripeList("/v1/prices", map[string]any{"id": "price_std", "object": "price"})
+	})
+	fs.handle("GET /v1/prices/price_std", func(r *http.Request) (int, any) {
+		return http.StatusOK, map[string]any{
+			"id": "price_std", "object": "price", "unit_amount": 4900, "currency": "eur",
+			"recurring": map[string]any{"interval": "month", "interval_count": 1},
+		}
+	})
+
+	svc := newPricingBillingService()
+	for i := 0; i < 3; i++ {
+		tierPrice, err := svc.GetResourceTierPrice(context.Background(), "Konnektr.Graph", "standard", "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4900), tierPrice.Amount)
+		assert.Equal(t, "month", tierPrice.Interval)
+	}
+
+	assert.Equal(t, 1, fs.count("GET /v1/prices"))
+	assert.Equal(t, 1, fs.count("GET /v1/prices/price_std"))
+	assert.Equal(t, uint64(2), priceCache.Stats().Hits)
+}
+
+func TestBillingService_PriceLookupErrorsAreNotCached(t *testing.T) {
+	ClearBillingCaches()
+	defer ClearBillingCaches()
+
+	fs := newFakeStripe(t)
+	fs.handle("GET /v1/prices", func(r *http.Request) (int, any) {
+		return http.StatusOK, stripeList("/v1/prices")
+	})
+
+	svc := newPricingBillingService()
+	_, err := svc.GetPriceIDForResourceType(context.Background(), "Konnektr.Graph", "standard", "", "")
+	assert.Error(t, err)
+	_, err = svc.GetPriceIDForResourceType(context.Background(), "Konnektr.Graph", "standard", "", "")
+	assert.Error(t, err)
+	assert.Equal(t, 2, fs.count("GET /v1/prices"))
+}
+
+func TestCacheableBillingInfo(t *testing.T) {
+	assert.False(t, cacheableBillingInfo(nil))
+	assert.False(t, cacheableBillingInfo(&models.BillingInfo{}))
+	assert.True(t, cacheableBillingInfo(&models.BillingInfo{
+		PaymentMethods: []models.StripePaymentMethod{{ID: "pm_1", Type: "card"}},
+	}))
+}
+
+func TestInvalidateBillingInfo(t *testing.T) {
+	ClearBillingCaches()
+	defer ClearBillingCaches()
+
+	info := &models.BillingInfo{BillingAccount: models.BillingAccount{ScopeType: "project", ScopeID: "p1"}}
+	billingInfoCache.Set(billingInfoKey("project", "p1"), info)
+	billingInfoCache.Set(billingInfoKey("project", "p2"), info)
+
+	InvalidateBillingInfo("project", "p1")
+	_, ok := billingInfoCache.Get(billingInfoKey("project", "p1"))
+	assert.False(t, ok)
+	_, ok = billingInfoCache.Get(billingInfoKey("project", "p2"))
+	assert.True(t, ok)
+}
+
+func TestGetResourceTierPrice_StripeSpansHaveRequestParent(t *testing.T) {
+	ClearBillingCaches()
+	defer ClearBillingCaches()
+
+	fs := newFakeStripe(t)
+	fs.handle("GET /v1/prices", func(r *http.Request) (int, any) {
+		return http.StatusOK, stripeList("/v1/prices", map[string]any{"id": "price_std", "object": "price", "currency": "eur"})
+	})
+	fs.handle("GET /v1/prices/price_std", func(r *http.Request) (int, any) {
+		return http.StatusOK, map[string]any{"id": "price_std", "object": "price", "unit_amount": 4900, "currency": "eur"}
+	})
+	stripe.SetBackend(stripe.APIBackend, telemetry.WrapStripeBackend(stripe.GetBackend(stripe.APIBackend)))
+	exporter, restore := telemetry.NewInMemoryProvider()
+	defer restore()
+
+	ctx, parent := telemetry.Tracer().Start(context.Background(), "request")
+	_, err := newPricingBillingService().GetResourceTierPrice(ctx, "Konnektr.Graph", "standard", "")
+	parent.End()
+	require.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	require.NotEmpty(t, spans)
+	for _, span := range spans[:len(spans)-1] {
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent.SpanID(), span.Name)
+	}
+}
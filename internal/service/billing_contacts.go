@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"ktrlplane/internal/db"
+	"ktrlplane/internal/models"
+	"ktrlplane/internal/utils"
+	"slices"
+	"strings"
+
+	"github.com/stripe/stripe-go/v84"
+	"github.com/stripe/stripe-go/v84/customer"
+)
+
+// Roles of billing contacts.
+const (
+	ContactRoleInvoices = "invoices" // Receives invoices and receipts
+	ContactRoleAlerts   = "alerts"   // Receives billing notifications such as payment problems
+)
+
+// AuditBillingContactsUpdated records a change of the billing contacts of a billing account.
+const AuditBillingContactsUpdated = "billing.contacts_updated"
+
+// contactRoles lists the roles of billing contacts in the order they are reported.
+var contactRoles = []string{ContactRoleInvoices, ContactRoleAlerts}
+
+const (
+	// contactMetadataPrefix prefixes the Stripe customer metadata keys that hold the
+	// comma-separated contacts of each role, such as billing_contacts_invoices.
+	contactMetadataPrefix = "billing_contacts_"
+	// contactFieldName names the invoice custom field listing the invoice contacts.
+	contactFieldName = "Billing contacts"
+	// Stripe limits metadata values to 500 and custom field values to 140 characters.
+	maxContactMetadataLength = 500
+	maxContactFieldLength    = 140
+)
+
+// GetBillingContacts returns the billing contacts of the billing account paying for a scope.
+func (s *BillingService) GetBillingContacts(ctx context.Context, scopeType, scopeID string) ([]models.BillingContact, error) {
+	account, err := s.stripeCustomerAccount(ctx, scopeType, scopeID)
+	if err != nil {
+		return nil, err
+	}
+	cust, err := customer.Get(*account.StripeCustomerID, &stripe.CustomerParams{Params: stripe.Params{Context: ctx}})
+	if err != nil {
+		return nil, Upstream(err, "failed to fetch Stripe customer")
+	}
+	return customerContacts(cust), nil
+}
+
+// SetBillingContacts replaces the billing contacts of the billing account paying for a scope.
+// The first invoices contact becomes the email of the Stripe customer, and all of them are
+// listed on its invoices.
+func (s *BillingService) SetBillingContacts(ctx context.Context, scopeType, scopeID string, contacts []models.BillingContact, actorID string) ([]models.BillingContact, error) {
+	contacts, err := normalizeContacts(contacts)
+	if err != nil {
+		return nil, err
+	}
+	account, err := s.stripeCustomerAccount(ctx, scopeType, scopeID)
+	if err != nil {
+		return nil, err
+	}
+	cust, err := customer.Get(*account.StripeCustomerID, &stripe.CustomerParams{Params: stripe.Params{Context: ctx}})
+	if err != nil {
+		return nil, Upstream(err, "failed to fetch Stripe customer")
+	}
+	previous := customerContacts(cust)
+
+	params := customerContactParams(cust, contacts)
+	params.Context = ctx
+	if _, err := customer.Update(cust.ID, params); err != nil {
+		return nil, stripeRequestError(err, "failed to update billing contacts")
+	}
+	InvalidateBillingInfo(account.ScopeType, account.ScopeID)
+
+	if err := recordAuditEvent(ctx, db.GetDB(), AuditBillingContactsUpdated, actorID, account.ScopeID, account.ScopeType, account.ScopeID, map[string]any{
+		"from": previous,
+		"to":   contacts,
+	}); err != nil {
+		fmt.Printf("[BillingService] %v\n", err)
+	}
+	return contacts, nil
+}
+
+// normalizeContacts trims and lowercases the emails of contacts and merges the roles of
+// repeated emails, keeping the order in which emails first appear. At least one contact must
+// receive invoices, and each role's contacts must fit in the customer metadata.
+func normalizeContacts(contacts []models.BillingContact) ([]models.BillingContact, error) {
+	normalized := make([]models.BillingContact, 0, len(contacts))
+	index := make(map[string]int)
+	for _, c := range contacts {
+		email := strings.ToLower(strings.TrimSpace(c.Email))
+		if !utils.IsValidEmail(email) {
+			return nil, Validation("billing contact email %q is not valid", c.Email)
+		}
+		for _, role := range c.Roles {
+			if !slices.Contains(contactRoles, role) {
+				return nil, Validation("billing contact role must be %q or %q", ContactRoleInvoices, ContactRoleAlerts)
+			}
+		}
+		i, seen := index[email]
+		if !seen {
+			i = len(normalized)
+			index[email] = i
+			normalized = append(normalized, models.BillingContact{Email: email})
+		}
+		normalized[i].Roles = append(normalized[i].Roles, c.Roles...)
+	}
+	for i := range normalized {
+		normalized[i].Roles = orderedRoles(normalized[i].Roles)
+	}
+
+	if len(contactsWithRole(normalized, ContactRoleInvoices)) == 0 {
+		return nil, Validation("at least one billing contact must receive invoices")
+	}
+	for _, role := range contactRoles {
+		if len(strings.Join(contactsWithRole(normalized, role), ",")) > maxContactMetadataLength {
+			return nil, Validation("too many billing contacts receive %s", role)
+		}
+	}
+	return normalized, nil
+}
+
+// orderedRoles returns the distinct roles in roles, in the order of contactRoles.
+func orderedRoles(roles []string) []string {
+	ordered := make([]string, 0, len(contactRoles))
+	for _, role := range contactRoles {
+		if slices.Contains(roles, role) {
+			ordered = append(ordered, role)
+		}
+	}
+	return ordered
+}
+
+// contactsWithRole returns the emails of the contacts that have role.
+func contactsWithRole(contacts []models.BillingContact, role string) []string {
+	var emails []string
+	for _, c := range contacts {
+		if slices.Contains(c.Roles, role) {
+			emails = append(emails, c.Email)
+		}
+	}
+	return emails
+}
+
+// customerContacts returns the billing contacts stored in the metadata of a customer.
+// Customers created before billing contacts existed have their email as the only contact.
+func customerContacts(cust *stripe.Customer) []models.BillingContact {
+	var contacts []models.BillingContact
+	index := make(map[string]int)
+	for _, role := range contactRoles {
+		value := cust.Metadata[contactMetadataPrefix+role]
+		if value == "" {
+			continue
+		}
+		for _, email := range strings.Split(value, ",") {
+			i, seen := index[email]
+			if !seen {
+				i = len(contacts)
+				index[email] = i
+				contacts = append(contacts, models.BillingContact{Email: email})
+			}
+			contacts[i].Roles = append(contacts[i].Roles, role)
+		}
+	}
+	if contacts == nil && cust.Email != "" {
+		return []models.BillingContact{{Email: cust.Email, Roles: slices.Clone(contactRoles)}}
+	}
+	if contacts == nil {
+		return []models.BillingContact{}
+	}
+	return contacts
+}
+
+// customerContactParams returns the customer params that store contacts on cust, which is nil
+// for a new customer: the metadata of each role, the customer email, and the invoice custom
+// field listing the invoice contacts. Other custom fields of cust are kept.
+func customerContactParams(cust *stripe.Customer, contacts []models.BillingContact) *stripe.CustomerParams {
+	invoices := contactsWithRole(contacts, ContactRoleInvoices)
+	params := &stripe.CustomerParams{Email: stripe.String(invoices[0])}
+	for _, role := range contactRoles {
+		// An empty value removes the key
+		params.AddMetadata(contactMetadataPrefix+role, strings.Join(contactsWithRole(contacts, role), ","))
+	}
+
+	var fields []*stripe.CustomerInvoiceSettingsCustomFieldParams
+	if cust != nil && cust.InvoiceSettings != nil {
+		for _, f := range cust.InvoiceSettings.CustomFields {
+			if f.Name != contactFieldName {
+				fields = append(fields, &stripe.CustomerInvoiceSettingsCustomFieldParams{
+					Name:  stripe.String(f.Name),
+					Value: stripe.String(f.Value),
+				})
+			}
+		}
+	}
+	value := strings.Join(invoices, ", ")
+	if len(value) > maxContactFieldLength {
+		value = value[:maxContactFieldLength-3] + "..."
+	}
+	fields = append(fields, &stripe.CustomerInvoiceSettingsCustomFieldParams{
+		Name:  stripe.String(contactFieldName),
+		Value: stripe.String(value),
+	})
+	params.InvoiceSettings = &stripe.CustomerInvoiceSettingsParams{CustomFields: fields}
+	return params
+}
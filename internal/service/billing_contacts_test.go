@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"ktrlplane/internal/config"
+	"ktrlplane/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v84"
+)
+
+func TestNormalizeContacts(t *testing.T) {
+	contacts, err := normalizeContacts([]models.BillingContact{
+		{Email: " Finance@Example.com ", Roles: []string{"alerts"}},
+		{Email: "ops@example.com", Roles: []string{"alerts"}},
+		{Email: "finance@example.com", Roles: []string{"invoices", "alerts"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []models.BillingContact{
+		{Email: "finance@example.com", Roles: []string{"invoices", "alerts"}},
+		{Email: "ops@example.com", Roles: []string{"alerts"}},
+	}, contacts)
+
+	_, err = normalizeContacts([]models.BillingContact{{Email: "ops@example.com", Roles: []string{"alerts"}}})
+	assert.True(t, errors.Is(err, ErrValidation), "someone must receive invoices")
+	_, err = normalizeContacts([]models.BillingContact{{Email: "a@example.com", Roles: []string{"invoices", "marketing"}}})
+	assert.True(t, errors.Is(err, ErrValidation))
+	for _, email := range []string{"", "finance", "a@example.com,b@example.com", "a b@example.com"} {
+		_, err = normalizeContacts([]models.BillingContact{{Email: email, Roles: []string{"invoices"}}})
+		assert.True(t, errors.Is(err, ErrValidation), "email %q", email)
+	}
+}
+
+func TestCustomerContacts(t *testing.T) {
+	cust := &stripe.Customer{Email: "finance@example.com", Metadata: map[string]string{
+		"billing_contacts_invoices": "finance@example.com",
+		"billing_contacts_alerts":   "finance@example.com,ops@example.com",
+	}}
+	assert.Equal(t, []models.BillingContact{
+		{Email: "finance@example.com", Roles: []string{"invoices", "alerts"}},
+		{Email: "ops@example.com", Roles: []string{"alerts"}},
+	}, customerContacts(cust))
+
+	// Customers without contacts bill their email
+	assert.Equal(t, []models.BillingContact{{Email: "a@example.com", Roles: []string{"invoices", "alerts"}}},
+		customerContacts(&stripe.Customer{Email: "a@example.com"}))
+	assert.Empty(t, customerContacts(&stripe.Customer{}))
+}
+
+func TestCustomerContactParams(t *testing.T) {
+	cust := &stripe.Customer{InvoiceSettings: &stripe.CustomerInvoiceSettings{CustomFields: []*stripe.CustomerInvoiceSettingsCustomField{
+		{Name: "PO number", Value: "PO-42"},
+		{Name: contactFieldName, Value: "old@example.com"},
+	}}}
+	params := customerContactParams(cust, []models.BillingContact{
+		{Email: "ops@example.com", Roles: []string{"alerts"}},
+		{Email: "finance@example.com", Roles: []string{"invoices"}},
+		{Email: "ap@example.com", Roles: []string{"invoices", "alerts"}},
+	})
+	assert.Equal(t, "finance@example.com", *params.Email)
+	assert.Equal(t, "finance@example.com,ap@example.com", params.Metadata["billing_contacts_invoices"])
+	assert.Equal(t, "ops@example.com,ap@example.com", params.Metadata["billing_contacts_alerts"])
+
+	fields := params.InvoiceSettings.CustomFields
+	require.Len(t, fields, 2)
+	assert.Equal(t, "PO number", *fields[0].Name, "other custom fields are kept")
+	assert.Equal(t, "finance@example.com, ap@example.com", *fields[1].Value)
+
+	// Removed roles clear their metadata, and long lists are cut to Stripe's limit
+	long := strings.Repeat("a", 150) + "@example.com"
+	params = customerContactParams(nil, []models.BillingContact{{Email: long, Roles: []string{"invoices"}}})
+	assert.Equal(t, "", params.Metadata["billing_contacts_alerts"])
+	assert.Len(t, *params.InvoiceSettings.CustomFields[0].Value, maxContactFieldLength)
+}
+
+func TestCreateStripeCustomer_RequiresInvoiceContact(t *testing.T) {
+	fs := newFakeStripe(t)
+	_, err := NewBillingService(&config.Config{}).CreateStripeCustomer(context.Background(), "organization", "acme", "a@example.com", "Acme",
+		models.CreateStripeCustomerRequest{Contacts: []models.BillingContact{{Email: "ops@example.com", Roles: []string{"alerts"}}}})
+	assert.True(t, errors.Is(err, ErrValidation))
+	assert.Zero(t, fs.count("POST /v1/customers"))
+}
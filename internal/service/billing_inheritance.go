@@ -0,0 +1,458 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"ktrlplane/internal/db"
+	"ktrlplane/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stripe/stripe-go/v84"
+	"github.com/stripe/stripe-go/v84/subscription"
+	"github.com/stripe/stripe-go/v84/subscriptionitem"
+)
+
+// Stripe limits metadata keys to 40 characters.
+const (
+	projectMetadataPrefix   = "project:"
+	stripeMetadataKeyLength = 40
+)
+
+// projectMetadataKey returns the subscription item metadata key holding how many of the
+// item's quantity belong to projectID. A subscription has one item per price, shared by all
+// projects billed to it, so these counts keep invoices attributable to projects. Project IDs
+// too long for a key are shortened and suffixed with a hash.
+func projectMetadataKey(projectID string) string {
+	key := projectMetadataPrefix + projectID
+	if len(key) <= stripeMetadataKeyLength {
+		return key
+	}
+	sum := sha256.Sum256([]byte(projectID))
+	suffix := "~" + hex.EncodeToString(sum[:4])
+	return key[:stripeMetadataKeyLength-len(suffix)] + suffix
+}
+
+// projectItemMetadata returns the metadata update adding delta to projectID's share of an
+// item. A share dropping to zero removes the key.
+func projectItemMetadata(item *stripe.SubscriptionItem, projectID string, delta int64) map[string]string {
+	key := projectMetadataKey(projectID)
+	var current int64
+	if item != nil {
+		current, _ = strconv.ParseInt(item.Metadata[key], 10, 64)
+	}
+	if current+delta <= 0 {
+		return map[string]string{key: ""}
+	}
+	return map[string]string{key: strconv.FormatInt(current+delta, 10)}
+}
+
+// projectResourceCounts maps a "resourceType:sku" key to the number of resources per project.
+type projectResourceCounts map[string]map[string]int
+
+// total returns the number of resources for a key across projects.
+func (c projectResourceCounts) total(resourceKey string) int {
+	total := 0
+	for _, count := range c[resourceKey] {
+		total += count
+	}
+	return total
+}
+
+// metadata returns the subscription item metadata for a key.
+func (c projectResourceCounts) metadata(resourceKey string) map[string]string {
+	metadata := make(map[string]string, len(c[resourceKey]))
+	for projectID, count := range c[resourceKey] {
+		if count > 0 {
+			metadata[projectMetadataKey(projectID)] = strconv.Itoa(count)
+		}
+	}
+	return metadata
+}
+
+// projectBillingScope returns the organization of a project and whether the project is
+// billed to it. A project without an organization is always billed on its own.
+func projectBillingScope(ctx context.Context, q querier, query, projectID string) (orgID *string, inherits bool, err error) {
+	err = q.QueryRow(ctx, query, projectID).Scan(&orgID, &inherits)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, NotFound("project not found: %s", projectID)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get project billing scope: %w", err)
+	}
+	return orgID, inherits && orgID != nil, nil
+}
+
+// ResolveBillingScope returns the scope whose billing account pays for scopeType/scopeID:
+// the organization for a project that inherits billing from it, otherwise the scope itself.
+func (s *BillingService) ResolveBillingScope(ctx context.Context, scopeType, scopeID string) (string, string, error) {
+	if scopeType != "project" {
+		return scopeType, scopeID, nil
+	}
+	orgID, inherits, err := projectBillingScope(ctx, db.GetDB(), db.GetProjectBillingScopeQuery, scopeID)
+	if err != nil {
+		return "", "", err
+	}
+	if inherits {
+		return "organization", *orgID, nil
+	}
+	return scopeType, scopeID, nil
+}
+
+// ResolveProjectBillingAccount returns the billing account paying for a project's resources.
+func (s *BillingService) ResolveProjectBillingAccount(ctx context.Context, projectID string) (*models.BillingAccount, error) {
+	scopeType, scopeID, err := s.ResolveBillingScope(ctx, "project", projectID)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetBillingAccount(ctx, scopeType, scopeID)
+}
+
+// unusableSubscription reports whether no items can be added to a subscription anymore.
+func unusableSubscription(sub *stripe.Subscription) bool {
+	return sub.Status == stripe.SubscriptionStatusCanceled ||
+		sub.Status == stripe.SubscriptionStatusIncompleteExpired ||
+		sub.Status == stripe.SubscriptionStatusUnpaid
+}
+
+// addSubscriptionItems bills quantity more resources at priceID to account on behalf of
+// projectID. A subscription is created when the account has none or it can no longer be used,
+// in the account's currency and with the trial the account is due.
+// With payment enforcement, a subscription that is not being paid takes no more items.
+func (s *BillingService) addSubscriptionItems(ctx context.Context, account *models.BillingAccount, projectID, priceID string, quantity int64) error {
+	if account.StripeCustomerID == nil {
+		return PaymentRequired("billing account with Stripe customer required for paid resources")
+	}
+	defer InvalidateBillingInfo(account.ScopeType, account.ScopeID)
+
+	if account.StripeSubscriptionID != nil && *account.StripeSubscriptionID != "" {
+		subID := *account.StripeSubscriptionID
+		sub, err := subscription.Get(subID, &stripe.SubscriptionParams{Params: stripe.Params{Context: ctx}})
+		if err != nil {
+			return Upstream(err, "failed to fetch Stripe subscription")
+		}
+		if err := s.requireHealthySubscription(sub); err != nil {
+			return err
+		}
+		if !unusableSubscription(sub) {
+			// Prorate from the time the new shares are recorded at
+			now := time.Now().Unix()
+			for _, item := range sub.Items.Data {
+				if item.Price != nil && item.Price.ID == priceID {
+					updated, err := subscriptionitem.Update(item.ID, &stripe.SubscriptionItemParams{
+						Params:        stripe.Params{Context: ctx},
+						Quantity:      stripe.Int64(item.Quantity + quantity),
+						Metadata:      projectItemMetadata(item, projectID, quantity),
+						ProrationDate: stripe.Int64(now),
+					})
+					if err != nil {
+						return Upstream(err, "failed to update Stripe subscription item quantity")
+					}
+					recordItemShares(ctx, updated, now)
+					return nil
+				}
+			}
+			added, err := subscriptionitem.New(&stripe.SubscriptionItemParams{
+				Params:        stripe.Params{Context: ctx},
+				Subscription:  stripe.String(subID),
+				Price:         stripe.String(priceID),
+				Quantity:      stripe.Int64(quantity),
+				Metadata:      projectItemMetadata(nil, projectID, quantity),
+				ProrationDate: stripe.Int64(now),
+			})
+			if err != nil {
+				return Upstream(err, "failed to add new Stripe subscription item")
+			}
+			recordItemShares(ctx, added, now)
+			return nil
+		}
+	}
+
+	// Create a subscription with these resources as the first item
+	params := &stripe.SubscriptionParams{
+		Params:   stripe.Params{Context: ctx},
+		Customer: stripe.String(*account.StripeCustomerID),
+		Items: []*stripe.SubscriptionItemsParams{
+			{
+				Price:    stripe.String(priceID),
+				Quantity: stripe.Int64(quantity),
+				Metadata: projectItemMetadata(nil, projectID, quantity),
+			},
+		},
+		BillingMode: &stripe.SubscriptionBillingModeParams{
+			Type: stripe.String(stripe.SubscriptionBillingModeTypeFlexible),
+		},
+	}
+	paymentMethodID, err := firstPaymentMethod(ctx, *account.StripeCustomerID)
+	if err != nil {
+		return err
+	}
+	setPaymentBehavior(params, paymentMethodID)
+	if err := s.prepareSubscription(ctx, account.ScopeType, account.ScopeID, s.accountCurrency(account), params); err != nil {
+		return err
+	}
+	sub, err := subscription.New(params)
+	if err != nil {
+		return Upstream(err, "failed to create Stripe subscription")
+	}
+	recordSubscriptionShares(ctx, sub)
+	markTrialUsed(ctx, account.ScopeType, account.ScopeID, sub)
+	return s.setSubscription(ctx, account, &sub.ID)
+}
+
+// removeSubscriptionItems stops billing quantity resources at priceID to account on behalf
+// of projectID. The subscription is cancelled when nothing would be left on it.
+func (s *BillingService) removeSubscriptionItems(ctx context.Context, account *models.BillingAccount, projectID, priceID string, quantity int64) error {
+	if account.StripeSubscriptionID == nil || *account.StripeSubscriptionID == "" {
+		return nil
+	}
+	defer InvalidateBillingInfo(account.ScopeType, account.ScopeID)
+
+	subID := *account.StripeSubscriptionID
+	sub, err := subscription.Get(subID, &stripe.SubscriptionParams{Params: stripe.Params{Context: ctx}})
+	if err != nil {
+		return Upstream(err, "failed to fetch Stripe subscription")
+	}
+	for _, item := range sub.Items.Data {
+		if item.Price == nil || item.Price.ID != priceID {
+			continue
+		}
+		switch {
+		case item.Quantity > quantity:
+			// Prorate from the time the new shares are recorded at
+			now := time.Now().Unix()
+			updated, err := subscriptionitem.Update(item.ID, &stripe.SubscriptionItemParams{
+				Params:        stripe.Params{Context: ctx},
+				Quantity:      stripe.Int64(item.Quantity - quantity),
+				Metadata:      projectItemMetadata(item, projectID, -quantity),
+				ProrationDate: stripe.Int64(now),
+			})
+			if err != nil {
+				return Upstream(err, "failed to decrement Stripe subscription item quantity")
+			}
+			recordItemShares(ctx, updated, now)
+		case len(sub.Items.Data) == 1:
+			// Stripe does not remove the last item of a subscription; cancel it instead
+			_, err = subscription.Cancel(subID, &stripe.SubscriptionCancelParams{Params: stripe.Params{Context: ctx}})
+			if err != nil {
+				return Upstream(err, "failed to cancel Stripe subscription")
+			}
+			return s.setSubscription(ctx, account, nil)
+		default:
+			_, err = subscriptionitem.Del(item.ID, &stripe.SubscriptionItemParams{Params: stripe.Params{Context: ctx}})
+			if err != nil {
+				return Upstream(err, "failed to remove Stripe subscription item")
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// setSubscription records the subscription of a billing account; nil clears it.
+func (s *BillingService) setSubscription(ctx context.Context, account *models.BillingAccount, subscriptionID *string) error {
+	return saveAccountSubscription(ctx, account, subscriptionID)
+}
+
+// saveAccountSubscription stores the subscription of a billing account and reads the account
+// back into account. Tests replace it.
+var saveAccountSubscription = updateAccountSubscription
+
+func updateAccountSubscription(ctx context.Context, account *models.BillingAccount, subscriptionID *string) error {
+	row := db.GetDB().QueryRow(ctx, db.UpdateBillingAccountSubscriptionQuery, account.ScopeType, account.ScopeID, subscriptionID)
+	err := row.Scan(
+		&account.BillingAccountID,
+		&account.ScopeType,
+		&account.ScopeID,
+		&account.StripeCustomerID,
+		&account.StripeSubscriptionID,
+		&account.CreatedAt,
+		&account.UpdatedAt,
+		&account.Currency,
+		&account.BillingInterval,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update billing account subscription: %w", err)
+	}
+	return nil
+}
+
+// projectPaidResources counts the paid resources of a project by Stripe price.
+func projectPaidResources(ctx context.Context, q querier, projectID string) (map[string]int64, error) {
+	rows, err := q.Query(ctx, db.GetProjectPaidResourceCountsQuery, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count paid resources: %w", err)
+	}
+	defer rows.Close()
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var priceID string
+		var count int64
+		if err := rows.Scan(&priceID, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan paid resource count: %w", err)
+		}
+		counts[priceID] = count
+	}
+	return counts, rows.Err()
+}
+
+// paidResources counts the paid resources of a project with one type and SKU billed at a price.
+type paidResources struct {
+	resourceType string
+	sku          string
+	priceID      string
+	count        int64
+}
+
+// projectPaidResourceGroups counts the paid resources of a project by type, SKU and Stripe price.
+func projectPaidResourceGroups(ctx context.Context, q querier, projectID string) ([]paidResources, error) {
+	rows, err := q.Query(ctx, db.GetProjectPaidResourceGroupsQuery, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count paid resources: %w", err)
+	}
+	defer rows.Close()
+	var groups []paidResources
+	for rows.Next() {
+		var g paidResources
+		if err := rows.Scan(&g.resourceType, &g.sku, &g.priceID, &g.count); err != nil {
+			return nil, fmt.Errorf("failed to scan paid resource count: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// accountPrices returns the price account bills each group of paid resources at, in its
+// currency and billing interval.
+func (s *BillingService) accountPrices(ctx context.Context, account *models.BillingAccount, groups []paidResources) ([]string, error) {
+	prices := make([]string, len(groups))
+	for i, g := range groups {
+		priceID, err := s.accountPriceID(ctx, account, g.resourceType, g.sku)
+		if err != nil {
+			return nil, err
+		}
+		prices[i] = priceID
+	}
+	return prices, nil
+}
+
+// RemoveProjectItems stops billing all paid resources of a project to account, for
+// example before the project is deleted. Failures are logged and skipped.
+func (s *BillingService) RemoveProjectItems(ctx context.Context, account *models.BillingAccount, projectID string) {
+	counts, err := projectPaidResources(ctx, db.GetDB(), projectID)
+	if err != nil {
+		fmt.Printf("[BillingService] Failed to count paid resources of project %s: %v\n", projectID, err)
+		return
+	}
+	for priceID, count := range counts {
+		if err := s.removeSubscriptionItems(ctx, account, projectID, priceID, count); err != nil {
+			fmt.Printf("[BillingService] Failed to remove %s items of project %s: %v\n", priceID, projectID, err)
+		}
+	}
+}
+
+// SetProjectBillingInheritance moves a project between being billed to its organization
+// and being billed on its own, migrating the subscription items of its paid resources to
+// the new payer at the new payer's prices, which can differ in currency and billing interval.
+// The new payer needs a Stripe customer when the project has paid resources.
+// It returns the billing account that pays for the project afterwards.
+func (s *BillingService) SetProjectBillingInheritance(ctx context.Context, projectID string, inherit bool) (*models.BillingAccount, error) {
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	orgID, inherits, err := projectBillingScope(ctx, tx, db.LockProjectBillingScopeQuery, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if inherit && orgID == nil {
+		return nil, Validation("project %s does not belong to an organization", projectID)
+	}
+
+	sourceType, sourceID, targetType, targetID := "project", projectID, "organization", ""
+	if orgID != nil {
+		targetID = *orgID
+	}
+	if inherits {
+		sourceType, sourceID, targetType, targetID = targetType, targetID, sourceType, sourceID
+	}
+	if inherits == inherit {
+		return s.GetBillingAccount(ctx, sourceType, sourceID)
+	}
+
+	source, err := s.GetBillingAccount(ctx, sourceType, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.GetBillingAccount(ctx, targetType, targetID)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := projectPaidResourceGroups(ctx, tx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) > 0 && target.StripeCustomerID == nil {
+		return nil, PaymentRequired("the %s needs a billing account with a Stripe customer to take over paid resources", targetType)
+	}
+	targetPrices, err := s.accountPrices(ctx, target, groups)
+	if err != nil {
+		return nil, err
+	}
+	sourceCounts := make(map[string]int64, len(groups))
+	targetCounts := make(map[string]int64, len(groups))
+	for i, g := range groups {
+		sourceCounts[g.priceID] += g.count
+		targetCounts[targetPrices[i]] += g.count
+	}
+
+	// Bill the new payer first, so that a failure never leaves resources unbilled
+	added := make(map[string]int64, len(targetCounts))
+	rollback := func() {
+		for addedPrice, addedCount := range added {
+			if rollbackErr := s.removeSubscriptionItems(ctx, target, projectID, addedPrice, addedCount); rollbackErr != nil {
+				fmt.Printf("[BillingService] Failed to roll back %s items of project %s: %v\n", addedPrice, projectID, rollbackErr)
+			}
+		}
+	}
+	for priceID, count := range targetCounts {
+		if err := s.addSubscriptionItems(ctx, target, projectID, priceID, count); err != nil {
+			rollback()
+			return nil, err
+		}
+		added[priceID] = count
+	}
+
+	for i, g := range groups {
+		if targetPrices[i] == g.priceID {
+			continue
+		}
+		if _, err := tx.Exec(ctx, db.UpdateProjectResourcePriceQuery, projectID, g.resourceType, g.sku, g.priceID, targetPrices[i]); err != nil {
+			rollback()
+			return nil, fmt.Errorf("failed to update resource prices: %w", err)
+		}
+	}
+	if _, err := tx.Exec(ctx, db.UpdateProjectBillingInheritanceQuery, projectID, inherit); err != nil {
+		rollback()
+		return nil, fmt.Errorf("failed to update project billing inheritance: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		rollback()
+		return nil, fmt.Errorf("failed to commit project billing inheritance: %w", err)
+	}
+	InvalidateBillingInfo("project", projectID)
+
+	for priceID, count := range sourceCounts {
+		if err := s.removeSubscriptionItems(ctx, source, projectID, priceID, count); err != nil {
+			fmt.Printf("[BillingService] Failed to remove %s items of project %s from %s %s: %v\n", priceID, projectID, sourceType, sourceID, err)
+		}
+	}
+	return target, nil
+}
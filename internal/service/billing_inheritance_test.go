@@ -0,0 +1,121 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"ktrlplane/internal/config"
+	"ktrlplane/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v84"
+)
+
+func TestProjectMetadataKey(t *testing.T) {
+	assert.Equal(t, "project:p1", projectMetadataKey("p1"))
+
+	long := strings.Repeat("a", 63)
+	key := projectMetadataKey(long)
+	assert.Len(t, key, stripeMetadataKeyLength)
+	assert.True(t, strings.HasPrefix(key, projectMetadataPrefix+"aaaa"))
+	assert.NotEqual(t, key, projectMetadataKey(strings.Repeat("a", 62)+"b"), "shortened keys stay distinct")
+}
+
+func TestProjectItemMetadata(t *testing.T) {
+	item := &stripe.SubscriptionItem{Metadata: map[string]string{"project:p1": "2", "project:p2": "1"}}
+	assert.Equal(t, map[string]string{"project:p1": "3"}, projectItemMetadata(item, "p1", 1))
+	assert.Equal(t, map[string]string{"project:p2": ""}, projectItemMetadata(item, "p2", -1))
+	assert.Equal(t, map[string]string{"project:p3": "4"}, projectItemMetadata(nil, "p3", 4))
+}
+
+func TestProjectResourceCounts(t *testing.T) {
+	counts := projectResourceCounts{"Konnektr.Graph:standard": {"p1": 2, "p2": 1}}
+	assert.Equal(t, 3, counts.total("Konnektr.Graph:standard"))
+	assert.Equal(t, 0, counts.total("Konnektr.Graph:free"))
+	assert.Equal(t, map[string]string{"project:p1": "2", "project:p2": "1"}, counts.metadata("Konnektr.Graph:standard"))
+}
+
+func TestSubscriptionItems_TagProjects(t *testing.T) {
+	ClearBillingCaches()
+	defer ClearBillingCaches()
+
+	fs := newFakeStripe(t)
+	snapshots := fakeItemShares(t)
+	fs.handle("GET /v1/subscriptions/sub_org", func(r *http.Request) (int, any) {
+		return http.StatusOK, map[string]any{
+			"id": "sub_org", "object": "subscription", "status": "active",
+			"items": stripeList("/v1/subscription_items",
+				map[string]any{
+					"id": "si_std", "object": "subscription_item", "quantity": 3,
+					"price":    map[string]any{"id": "price_std", "object": "price"},
+					"metadata": map[string]any{"project:p1": "2", "project:p2": "1"},
+				},
+				map[string]any{"id": "si_pro", "object": "subscription_item", "quantity": 1,
+					"price": map[string]any{"id": "price_pro", "object": "price"}},
+			),
+		}
+	})
+	var forms []map[string]string
+	fs.handle("POST /v1/subscription_items/si_std", func(r *http.Request) (int, any) {
+		require.NoError(t, r.ParseForm())
+		form := map[string]string{}
+		for key := range r.PostForm {
+			form[key] = r.PostForm.Get(key)
+		}
+		forms = append(forms, form)
+		return http.StatusOK, map[string]any{"id": "si_std", "object": "subscription_item",
+			"metadata": map[string]any{"project:p1": "2", "project:p2": "3"}}
+	})
+
+	svc := NewBillingService(&config.Config{})
+	account := &models.BillingAccount{
+		ScopeType: "organization", ScopeID: "org-1",
+		StripeCustomerID: stripe.String("cus_1"), StripeSubscriptionID: stripe.String("sub_org"),
+	}
+	require.NoError(t, svc.addSubscriptionItems(t.Context(), account, "p2", "price_std", 2))
+	require.NoError(t, svc.removeSubscriptionItems(t.Context(), account, "p1", "price_std", 2))
+
+	require.Len(t, forms, 2)
+	assert.Equal(t, "5", forms[0]["quantity"])
+	assert.Equal(t, "3", forms[0]["metadata[project:p2]"])
+	assert.Equal(t, "1", forms[1]["quantity"])
+	assert.Equal(t, "", forms[1]["metadata[project:p1]"])
+	assert.Contains(t, forms[1], "metadata[project:p1]")
+
+	// Each change snapshots the shares from the time it is prorated at
+	require.Len(t, snapshots["si_std"], 2)
+	assert.Equal(t, forms[0]["proration_date"], strconv.FormatInt(snapshots["si_std"][0].effectiveAt, 10))
+	assert.Equal(t, map[string]int64{"project:p1": 2, "project:p2": 3}, snapshots["si_std"][0].shares)
+}
+
+func TestAddSubscriptionItems_RequiresCustomer(t *testing.T) {
+	err := NewBillingService(&config.Config{}).addSubscriptionItems(t.Context(), &models.BillingAccount{}, "p1", "price_std", 1)
+	assert.ErrorIs(t, err, ErrPaymentRequired)
+}
+
+func TestAccountPrices_UseTheNewPayersInterval(t *testing.T) {
+	ClearBillingCaches()
+	defer ClearBillingCaches()
+
+	fs := newFakeStripe(t)
+	intervalPrices(fs)
+	svc := newPricingBillingService()
+	groups := []paidResources{{resourceType: "Konnektr.Graph", sku: "standard", priceID: "price_std_month", count: 2}}
+
+	year := IntervalYear
+	prices, err := svc.accountPrices(t.Context(), &models.BillingAccount{BillingInterval: &year}, groups)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"price_std_year"}, prices)
+
+	prices, err = svc.accountPrices(t.Context(), &models.BillingAccount{}, groups)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"price_std_month"}, prices)
+
+	groups = append(groups, paidResources{resourceType: "Konnektr.Graph", sku: "unknown", priceID: "price_old", count: 1})
+	_, err = svc.accountPrices(t.Context(), &models.BillingAccount{}, groups)
+	assert.True(t, errors.Is(err, ErrNotFound), "every resource needs a price from the new payer")
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ktrlplane/internal/db"
+	"ktrlplane/internal/models"
+
+	"github.com/stripe/stripe-go/v84"
+	"github.com/stripe/stripe-go/v84/subscription"
+)
+
+// AuditBillingIntervalChanged records a billing account switching between monthly and annual
+// billing.
+const AuditBillingIntervalChanged = "billing.interval_changed"
+
+// validateInterval checks that interval is a billing interval accounts can choose.
+func validateInterval(interval string) error {
+	for _, valid := range billingIntervals {
+		if interval == valid {
+			return nil
+		}
+	}
+	return Validation("billing interval must be %q or %q", IntervalMonth, IntervalYear)
+}
+
+// SetBillingInterval switches the billing account paying for a scope to monthly or annual
+// billing. The items of its subscription move to the prices of the new interval right away,
+// with prorations for the rest of the current period, and so do its resources.
+func (s *BillingService) SetBillingInterval(ctx context.Context, scopeType, scopeID, interval, actorID string) (*models.BillingAccount, error) {
+	if err := validateInterval(interval); err != nil {
+		return nil, err
+	}
+	scopeType, scopeID, err := s.ResolveBillingScope(ctx, scopeType, scopeID)
+	if err != nil {
+		return nil, err
+	}
+	account, err := s.GetBillingAccount(ctx, scopeType, scopeID)
+	if err != nil {
+		return nil, err
+	}
+	previous := s.accountInterval(account)
+	if previous == interval {
+		return account, nil
+	}
+
+	tx, err := db.GetDB().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var updated models.BillingAccount
+	err = tx.QueryRow(ctx, db.UpdateBillingIntervalQuery, scopeType, scopeID, interval).Scan(
+		&updated.BillingAccountID,
+		&updated.ScopeType,
+		&updated.ScopeID,
+		&updated.StripeCustomerID,
+		&updated.StripeSubscriptionID,
+		&updated.CreatedAt,
+		&updated.UpdatedAt,
+		&updated.Currency,
+		&updated.BillingInterval,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update billing interval: %w", err)
+	}
+
+	// Move the subscription last, once nothing but the commit can fail
+	var items []*stripe.SubscriptionItemsParams
+	var sub *stripe.Subscription
+	if account.StripeSubscriptionID != nil && *account.StripeSubscriptionID != "" {
+		sub, err = subscription.Get(*account.StripeSubscriptionID, &stripe.SubscriptionParams{Params: stripe.Params{Context: ctx}})
+		if err != nil {
+			return nil, Upstream(err, "failed to fetch Stripe subscription")
+		}
+		if !unusableSubscription(sub) {
+			var moved map[string]string
+			items, moved, err = s.intervalItems(ctx, sub, interval)
+			if err != nil {
+				return nil, err
+			}
+			for oldPriceID, newPriceID := range moved {
+				if _, err := tx.Exec(ctx, db.UpdateBilledResourcePriceQuery, scopeType, scopeID, oldPriceID, newPriceID); err != nil {
+					return nil, fmt.Errorf("failed to move resources to price %s: %w", newPriceID, err)
+				}
+			}
+		}
+	}
+
+	if err := recordAuditEvent(ctx, tx, AuditBillingIntervalChanged, actorID, scopeID, scopeType, scopeID, map[string]any{
+		"from": previous,
+		"to":   interval,
+	}); err != nil {
+		return nil, err
+	}
+
+	if len(items) > 0 {
+		_, err = subscription.Update(sub.ID, &stripe.SubscriptionParams{
+			Params:            stripe.Params{Context: ctx},
+			Items:             items,
+			ProrationBehavior: stripe.String("create_prorations"),
+		})
+		if err != nil {
+			return nil, stripeRequestError(err, "failed to move Stripe subscription to the new billing interval")
+		}
+		InvalidateBillingInfo(scopeType, scopeID)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit billing interval: %w", err)
+	}
+	return &updated, nil
+}
+
+// intervalItems returns the subscription item changes that move sub to the prices of interval,
+// in the subscription's currency, and the price each moved price is replaced by. Stripe bills
+// all items of a subscription on one interval, so every product needs a price for it.
+func (s *BillingService) intervalItems(ctx context.Context, sub *stripe.Subscription, interval string) ([]*stripe.SubscriptionItemsParams, map[string]string, error) {
+	currency := string(sub.Currency)
+	var items []*stripe.SubscriptionItemsParams
+	moved := make(map[string]string)
+	for _, item := range sub.Items.Data {
+		if item.Price == nil || item.Price.Product == nil {
+			continue
+		}
+		productID := item.Price.Product.ID
+		p, err := s.getPriceForProduct(ctx, productID, currency, interval)
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil, Wrap(ErrValidation, err, "product %s has no %s price in %s", productID, interval, currency)
+		}
+		if err != nil {
+			return nil, nil, Upstream(err, "failed to get %s price for product %s", interval, productID)
+		}
+		if p.ID == item.Price.ID {
+			continue
+		}
+		items = append(items, &stripe.SubscriptionItemsParams{
+			ID:       stripe.String(item.ID),
+			Price:    stripe.String(p.ID),
+			Quantity: stripe.Int64(item.Quantity),
+		})
+		moved[item.Price.ID] = p.ID
+	}
+	return items, moved, nil
+}
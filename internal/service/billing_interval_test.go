@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"ktrlplane/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v84"
+)
+
+// intervalPrices serves monthly and annual prices for the standard Graph product and only a
+// monthly price for the premium one.
+func intervalPrices(fs *fakeStripe) {
+	fs.handle("GET /v1/prices", func(r *http.Request) (int, any) {
+		recurring := func(interval string) map[string]any { return map[string]any{"interval": interval} }
+		if r.URL.Query().Get("product") == "prod_graph_pro" {
+			return http.StatusOK, stripeList("/v1/prices",
+				map[string]any{"id": "price_pro_month", "object": "price", "currency": "eur", "unit_amount": 9900, "recurring": recurring("month")},
+			)
+		}
+		return http.StatusOK, stripeList("/v1/prices",
+			map[string]any{"id": "price_std_year", "object": "price", "currency": "eur", "unit_amount": 49000, "recurring": recurring("year")},
+			map[string]any{"id": "price_std_month", "object": "price", "currency": "eur", "unit_amount": 4900, "recurring": recurring("month")},
+		)
+	})
+}
+
+func TestValidateInterval(t *testing.T) {
+	assert.NoError(t, validateInterval(IntervalMonth))
+	assert.NoError(t, validateInterval(IntervalYear))
+	assert.True(t, errors.Is(validateInterval("week"), ErrValidation))
+	assert.True(t, errors.Is(validateInterval(""), ErrValidation))
+}
+
+func TestGetPriceForProduct_Interval(t *testing.T) {
+	ClearBillingCaches()
+	defer ClearBillingCaches()
+
+	fs := newFakeStripe(t)
+	intervalPrices(fs)
+	svc := newPricingBillingService()
+
+	p, err := svc.getPriceForProduct(context.Background(), "prod_graph_std", "eur", "")
+	require.NoError(t, err)
+	assert.Equal(t, "price_std_month", p.ID, "monthly prices are preferred")
+
+	p, err = svc.getPriceForProduct(context.Background(), "prod_graph_std", "eur", IntervalYear)
+	require.NoError(t, err)
+	assert.Equal(t, "price_std_year", p.ID)
+
+	_, err = svc.getPriceForProduct(context.Background(), "prod_graph_pro", "eur", IntervalYear)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Equal(t, 2, fs.count("GET /v1/prices"), "prices are listed once per product")
+}
+
+func TestGetPriceForProduct_ConfiguredPrices(t *testing.T) {
+	ClearBillingCaches()
+	defer ClearBillingCaches()
+
+	fs := newFakeStripe(t)
+	fs.handle("GET /v1/prices/price_cfg_year", func(r *http.Request) (int, any) {
+		return http.StatusOK, map[string]any{"id": "price_cfg_year", "object": "price", "currency": "eur", "unit_amount": 45000,
+			"recurring": map[string]any{"interval": "year"}}
+	})
+	svc := NewBillingService(&config.Config{Stripe: config.StripeConfig{Products: []config.StripeProduct{
+		{ResourceType: "Konnektr.Graph", SKU: "standard", ProductID: "prod_graph_std", Prices: map[string]string{"year": "price_cfg_year"}},
+	}}})
+
+	priceID, err := svc.GetPriceIDForResourceType(context.Background(), "Konnektr.Graph", "standard", "eur", IntervalYear)
+	require.NoError(t, err)
+	assert.Equal(t, "price_cfg_year", priceID)
+
+	_, err = svc.GetPriceIDForResourceType(context.Background(), "Konnektr.Graph", "standard", "usd", IntervalYear)
+	assert.True(t, errors.Is(err, ErrNotFound), "the configured price has no amount in usd")
+	assert.Zero(t, fs.count("GET /v1/prices"), "configured prices are not looked up")
+}
+
+func TestIntervalItems(t *testing.T) {
+	ClearBillingCaches()
+	defer ClearBillingCaches()
+
+	fs := newFakeStripe(t)
+	intervalPrices(fs)
+	svc := newPricingBillingService()
+
+	sub := &stripe.Subscription{ID: "sub_1", Currency: "eur", Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{
+		{ID: "si_std", Quantity: 3, Price: &stripe.Price{ID: "price_std_month", Product: &stripe.Product{ID: "prod_graph_std"}}},
+	}}}
+	items, moved, err := svc.intervalItems(context.Background(), sub, IntervalYear)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "si_std", *items[0].ID)
+	assert.Equal(t, "price_std_year", *items[0].Price)
+	assert.Equal(t, int64(3), *items[0].Quantity)
+	assert.Equal(t, map[string]string{"price_std_month": "price_std_year"}, moved)
+
+	items, moved, err = svc.intervalItems(context.Background(), sub, IntervalMonth)
+	require.NoError(t, err)
+	assert.Empty(t, items, "items already on the interval stay")
+	assert.Empty(t, moved)
+
+	sub.Items.Data = append(sub.Items.Data, &stripe.SubscriptionItem{
+		ID: "si_pro", Quantity: 1, Price: &stripe.Price{ID: "price_pro_month", Product: &stripe.Product{ID: "prod_graph_pro"}},
+	})
+	_, _, err = svc.intervalItems(context.Background(), sub, IntervalYear)
+	assert.True(t, errors.Is(err, ErrValidation), "every product needs a price for the interval")
+}
@@ -9,12 +9,12 @@ import (
 	"ktrlplane/internal/models"
 	"strings"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/stripe/stripe-go/v84"
 	"github.com/stripe/stripe-go/v84/billingportal/session"
 	"github.com/stripe/stripe-go/v84/customer"
 	"github.com/stripe/stripe-go/v84/invoice"
 	"github.com/stripe/stripe-go/v84/paymentmethod"
-	"github.com/stripe/stripe-go/v84/price"
 	"github.com/stripe/stripe-go/v84/setupintent"
 	"github.com/stripe/stripe-go/v84/subscription"
 )
@@ -32,11 +32,19 @@ func NewBillingService(cfg *config.Config) *BillingService {
 }
 
 // GetBillingAccount retrieves billing information for a scope (organization or project)
-func (s *BillingService) GetBillingAccount(scopeType, scopeID string) (*models.BillingAccount, error) {
+func (s *BillingService) GetBillingAccount(ctx context.Context, scopeType, scopeID string) (*models.BillingAccount, error) {
+	return loadBillingAccount(ctx, scopeType, scopeID)
+}
+
+// loadBillingAccount reads the billing account of a scope, creating it if it does not exist.
+// Tests replace it.
+var loadBillingAccount = queryBillingAccount
+
+func queryBillingAccount(ctx context.Context, scopeType, scopeID string) (*models.BillingAccount, error) {
 	query := db.GetBillingAccountQuery
 
 	var account models.BillingAccount
-	row := db.GetDB().QueryRow(context.Background(), query, scopeType, scopeID)
+	row := db.GetDB().QueryRow(ctx, query, scopeType, scopeID)
 
 	err := row.Scan(
 		&account.BillingAccountID,
@@ -46,12 +54,14 @@ func (s *BillingService) GetBillingAccount(scopeType, scopeID string) (*models.B
 		&account.StripeSubscriptionID,
 		&account.CreatedAt,
 		&account.UpdatedAt,
+		&account.Currency,
+		&account.BillingInterval,
 	)
 
 	if err != nil {
-		if err.Error() == "no rows in result set" {
+		if errors.Is(err, pgx.ErrNoRows) {
 			// Create billing account if it doesn't exist
-			return s.createBillingAccount(scopeType, scopeID)
+			return createBillingAccount(ctx, scopeType, scopeID)
 		}
 		return nil, fmt.Errorf("failed to get billing account: %w", err)
 	}
@@ -60,13 +70,13 @@ func (s *BillingService) GetBillingAccount(scopeType, scopeID string) (*models.B
 }
 
 // createBillingAccount creates a new billing account for a scope
-func (s *BillingService) createBillingAccount(scopeType, scopeID string) (*models.BillingAccount, error) {
+func createBillingAccount(ctx context.Context, scopeType, scopeID string) (*models.BillingAccount, error) {
 	billingAccountID := fmt.Sprintf("bill_%s", scopeID)
 
 	query := db.CreateBillingAccountQuery
 
 	var account models.BillingAccount
-	row := db.GetDB().QueryRow(context.Background(), query, billingAccountID, scopeType, scopeID)
+	row := db.GetDB().QueryRow(ctx, query, billingAccountID, scopeType, scopeID)
 
 	err := row.Scan(
 		&account.BillingAccountID,
@@ -76,6 +86,8 @@ func (s *BillingService) createBillingAccount(scopeType, scopeID string) (*model
 		&account.StripeSubscriptionID,
 		&account.CreatedAt,
 		&account.UpdatedAt,
+		&account.Currency,
+		&account.BillingInterval,
 	)
 
 	if err != nil {
@@ -85,35 +97,71 @@ func (s *BillingService) createBillingAccount(scopeType, scopeID string) (*model
 	return &account, nil
 }
 
-// CreateStripeCustomer creates a Stripe customer and updates the billing account
-func (s *BillingService) CreateStripeCustomer(scopeType, scopeID, email, name, description string) (*models.BillingAccount, error) {
-	// Create Stripe customer
-	params := &stripe.CustomerParams{
-		Email: stripe.String(email),
-		Name:  stripe.String(name),
+// CreateStripeCustomer creates a Stripe customer billed in the requested currency, with its
+// billing address, tax ID and billing contacts when given, and updates the billing account.
+// Without contacts, email receives invoices and alerts.
+func (s *BillingService) CreateStripeCustomer(ctx context.Context, scopeType, scopeID, email, name string, req models.CreateStripeCustomerRequest) (*models.BillingAccount, error) {
+	currency := normalizeCurrency(req.Currency)
+	if err := validateCurrency(currency); err != nil {
+		return nil, err
+	}
+	if currency == "" {
+		currency = s.defaultCurrency()
+	}
+	contacts := req.Contacts
+	if len(contacts) == 0 {
+		contacts = []models.BillingContact{{Email: email, Roles: contactRoles}}
+	}
+	contacts, err := normalizeContacts(contacts)
+	if err != nil {
+		return nil, err
+	}
+	// The account may have chosen its billing interval before it had a Stripe customer
+	interval := ""
+	if existing, err := s.GetBillingAccount(ctx, scopeType, scopeID); err == nil {
+		interval = s.accountInterval(existing)
 	}
 
-	if description != "" {
-		params.Description = stripe.String(description)
+	// Create Stripe customer, billed to its contacts
+	params := customerContactParams(nil, contacts)
+	params.Context = ctx
+	params.Name = stripe.String(name)
+
+	if req.Description != "" {
+		params.Description = stripe.String(req.Description)
+	}
+	if req.Address != nil {
+		params.Address = addressParams(req.Address)
+		if s.automaticTax() {
+			// Reject addresses Stripe Tax cannot locate now rather than at the first invoice
+			params.Tax = &stripe.CustomerTaxParams{ValidateLocation: stripe.String("immediately")}
+		}
+	}
+	if req.TaxID != nil {
+		params.TaxIDData = []*stripe.CustomerTaxIDDataParams{{
+			Type:  stripe.String(req.TaxID.Type),
+			Value: stripe.String(req.TaxID.Value),
+		}}
 	}
 
 	stripeCustomer, err := customer.New(params)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Stripe customer: %w", err)
+		return nil, stripeRequestError(err, "failed to create Stripe customer")
 	}
+	defer InvalidateBillingInfo(scopeType, scopeID)
 
 	// Get existing resources to create subscription items
-	resourceCounts, err := s.getResourceCounts(scopeType, scopeID)
+	resourceCounts, err := s.getResourceCounts(ctx, scopeType, scopeID)
 	if err != nil {
 		fmt.Printf("Warning: Failed to get resource counts: %v\n", err)
-		resourceCounts = make(map[string]int)
+		resourceCounts = make(projectResourceCounts)
 	}
 
 	// Create subscription with resource-based items if we have resources
 	var subscriptionID *string
 
 	if len(resourceCounts) > 0 {
-		subscription, err := s.createSubscriptionWithResources(stripeCustomer.ID, resourceCounts)
+		subscription, err := s.createSubscriptionWithResources(ctx, scopeType, scopeID, stripeCustomer.ID, currency, interval, resourceCounts)
 		if err != nil {
 			fmt.Printf("Warning: Failed to create subscription: %v\n", err)
 		} else if subscription != nil {
@@ -121,11 +169,16 @@ func (s *BillingService) CreateStripeCustomer(scopeType, scopeID, email, name, d
 		}
 	}
 
-	// Update billing account with Stripe customer ID and subscription ID (if created)
+	// Update billing account with Stripe customer ID, subscription ID (if created) and currency
 	query := db.UpdateBillingAccountStripeQuery
 
+	var accountCurrency *string
+	if currency != "" {
+		accountCurrency = &currency
+	}
+
 	var account models.BillingAccount
-	row := db.GetDB().QueryRow(context.Background(), query, scopeType, scopeID, stripeCustomer.ID, subscriptionID)
+	row := db.GetDB().QueryRow(ctx, query, scopeType, scopeID, stripeCustomer.ID, subscriptionID, accountCurrency)
 
 	err = row.Scan(
 		&account.BillingAccountID,
@@ -135,6 +188,8 @@ func (s *BillingService) CreateStripeCustomer(scopeType, scopeID, email, name, d
 		&account.StripeSubscriptionID,
 		&account.CreatedAt,
 		&account.UpdatedAt,
+		&account.Currency,
+		&account.BillingInterval,
 	)
 
 	if err != nil {
@@ -144,147 +199,168 @@ func (s *BillingService) CreateStripeCustomer(scopeType, scopeID, email, name, d
 	return &account, nil
 }
 
-// CreateStripeSubscription creates a Stripe subscription
-func (s *BillingService) CreateStripeSubscription(scopeType, scopeID string, req models.CreateStripeSubscriptionRequest) (*models.BillingAccount, error) {
+// CreateStripeSubscription creates a Stripe subscription. Without a payment method the
+// subscription starts incomplete, and the result carries the client secret with which the
+// customer completes it; an incomplete subscription is returned again rather than replaced.
+func (s *BillingService) CreateStripeSubscription(ctx context.Context, scopeType, scopeID string, req models.CreateStripeSubscriptionRequest) (*models.StripeSubscriptionResult, error) {
 	// Get billing account
-	account, err := s.GetBillingAccount(scopeType, scopeID)
+	account, err := s.GetBillingAccount(ctx, scopeType, scopeID)
 	if err != nil {
 		return nil, err
 	}
 
 	if account.StripeCustomerID == nil {
-		return nil, errors.New("stripe customer not found")
+		return nil, NotFound("stripe customer not found")
+	}
+
+	if account.StripeSubscriptionID != nil && *account.StripeSubscriptionID != "" {
+		params := &stripe.SubscriptionParams{Params: stripe.Params{Context: ctx}}
+		params.AddExpand("latest_invoice.confirmation_secret")
+		params.AddExpand("pending_setup_intent")
+		existing, err := subscription.Get(*account.StripeSubscriptionID, params)
+		if err != nil {
+			return nil, Upstream(err, "failed to fetch Stripe subscription")
+		}
+		if existing.Status == stripe.SubscriptionStatusIncomplete {
+			return &models.StripeSubscriptionResult{
+				BillingAccount:     *account,
+				SubscriptionStatus: string(existing.Status),
+				ClientSecret:       subscriptionClientSecret(existing),
+			}, nil
+		}
 	}
 
 	// Get resource counts for subscription items
-	resourceCounts, err := s.getResourceCounts(scopeType, scopeID)
+	resourceCounts, err := s.getResourceCounts(ctx, scopeType, scopeID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get resource counts: %w", err)
 	}
 
-	// Build subscription items based on resources
+	// Build subscription items based on resources, priced in the account's currency and interval
+	currency := s.accountCurrency(account)
 	var items []*stripe.SubscriptionItemsParams
-	for resourceKey, count := range resourceCounts {
-		if count > 0 {
+	for resourceKey := range resourceCounts {
+		if count := resourceCounts.total(resourceKey); count > 0 {
 			// Parse resourceKey which is now "resourceType:sku"
 			resourceType, sku := parseResourceKey(resourceKey)
-			priceID, err := s.GetPriceIDForResourceType(resourceType, sku)
+			priceID, err := s.accountPriceID(ctx, account, resourceType, sku)
 			if err != nil {
 				return nil, fmt.Errorf("failed to get price ID for resource type %s with SKU %s: %w", resourceType, sku, err)
 			}
 			items = append(items, &stripe.SubscriptionItemsParams{
 				Price:    stripe.String(priceID),
 				Quantity: stripe.Int64(int64(count)),
+				Metadata: resourceCounts.metadata(resourceKey),
 			})
 		}
 	}
 
 	if len(items) == 0 {
-		return nil, errors.New("no resources found to create subscription items")
-	}
-
-	// List existing payment methods for customer
-	pmParams := &stripe.CustomerListPaymentMethodsParams{
-		Customer: stripe.String(*account.StripeCustomerID),
+		return nil, Validation("no resources found to create subscription items")
 	}
-	pmParams.Limit = stripe.Int64(3)
-	pmIter := customer.ListPaymentMethods(pmParams)
 
-	var paymentMethods []*stripe.PaymentMethod
-	for pmIter.Next() {
-		paymentMethods = append(paymentMethods, pmIter.PaymentMethod())
-	}
-
-	if len(paymentMethods) == 0 {
-		fmt.Printf("Warning: No payment methods found for customer %s\n", *account.StripeCustomerID)
+	// Charge the requested payment method, or else one the customer has
+	paymentMethodID := req.PaymentMethodID
+	if paymentMethodID == "" {
+		paymentMethodID, err = firstPaymentMethod(ctx, *account.StripeCustomerID)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Create Stripe subscription
+	// Create Stripe subscription, on a trial if the account is due one
 	params := &stripe.SubscriptionParams{
+		Params:   stripe.Params{Context: ctx},
 		Customer: stripe.String(*account.StripeCustomerID),
 		Items:    items,
-		DefaultPaymentMethod: stripe.String(paymentMethods[0].ID),
+	}
+	setPaymentBehavior(params, paymentMethodID)
+	if err := s.prepareSubscription(ctx, scopeType, scopeID, currency, params); err != nil {
+		return nil, err
+	}
+	if req.PromotionCode != "" {
+		discount, err := subscriptionDiscount(ctx, req.PromotionCode, "")
+		if err != nil {
+			return nil, err
+		}
+		params.Discounts = []*stripe.SubscriptionDiscountParams{discount}
 	}
 
 	stripeSubscription, err := subscription.New(params)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Stripe subscription: %w", err)
+		return nil, Upstream(err, "failed to create Stripe subscription")
 	}
+	defer InvalidateBillingInfo(scopeType, scopeID)
+	recordSubscriptionShares(ctx, stripeSubscription)
+	markTrialUsed(ctx, scopeType, scopeID, stripeSubscription)
 
 	// Update billing account with subscription ID
-	query := db.UpdateBillingAccountSubscriptionQuery
-
-	row := db.GetDB().QueryRow(context.Background(), query, scopeType, scopeID, stripeSubscription.ID)
-
-	err = row.Scan(
-		&account.BillingAccountID,
-		&account.ScopeType,
-		&account.ScopeID,
-		&account.StripeCustomerID,
-		&account.StripeSubscriptionID,
-		&account.CreatedAt,
-		&account.UpdatedAt,
-	)
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to update billing account with subscription: %w", err)
+	if err := s.setSubscription(ctx, account, &stripeSubscription.ID); err != nil {
+		return nil, err
 	}
 
-	return account, nil
+	return &models.StripeSubscriptionResult{
+		BillingAccount:     *account,
+		SubscriptionStatus: string(stripeSubscription.Status),
+		ClientSecret:       subscriptionClientSecret(stripeSubscription),
+	}, nil
 }
 
 // CreateStripeCustomerPortal creates a Stripe customer portal session
-func (s *BillingService) CreateStripeCustomerPortal(scopeType, scopeID, returnURL string) (string, error) {
+func (s *BillingService) CreateStripeCustomerPortal(ctx context.Context, scopeType, scopeID, returnURL string) (string, error) {
 	// Get billing account
-	account, err := s.GetBillingAccount(scopeType, scopeID)
+	account, err := s.GetBillingAccount(ctx, scopeType, scopeID)
 	if err != nil {
 		return "", err
 	}
 
 	if account.StripeCustomerID == nil {
-		return "", errors.New("stripe customer not found")
+		return "", NotFound("stripe customer not found")
 	}
 
 	// Create customer portal session
 	params := &stripe.BillingPortalSessionParams{
+		Params:    stripe.Params{Context: ctx},
 		Customer:  stripe.String(*account.StripeCustomerID),
 		ReturnURL: stripe.String(returnURL),
 	}
 
 	portalSession, err := session.New(params)
 	if err != nil {
-		return "", fmt.Errorf("failed to create customer portal session: %w", err)
+		return "", Upstream(err, "failed to create customer portal session")
 	}
 
 	return portalSession.URL, nil
 }
 
 // CancelSubscription cancels a Stripe subscription
-func (s *BillingService) CancelSubscription(scopeType, scopeID string) (*models.BillingAccount, error) {
+func (s *BillingService) CancelSubscription(ctx context.Context, scopeType, scopeID string) (*models.BillingAccount, error) {
 	// Get billing account
-	account, err := s.GetBillingAccount(scopeType, scopeID)
+	account, err := s.GetBillingAccount(ctx, scopeType, scopeID)
 	if err != nil {
 		return nil, err
 	}
 
 	if account.StripeSubscriptionID == nil {
-		return nil, errors.New("no active subscription found")
+		return nil, NotFound("no active subscription found")
 	}
 
 	// Cancel Stripe subscription
 	params := &stripe.SubscriptionParams{
+		Params:            stripe.Params{Context: ctx},
 		CancelAtPeriodEnd: stripe.Bool(true),
 	}
 
 	_, err = subscription.Update(*account.StripeSubscriptionID, params)
 	if err != nil {
-		return nil, fmt.Errorf("failed to cancel Stripe subscription: %w", err)
+		return nil, Upstream(err, "failed to cancel Stripe subscription")
 	}
+	defer InvalidateBillingInfo(scopeType, scopeID)
 
 	// Update billing account
 	query := db.UpdateBillingAccountStatusQuery
 
-	row := db.GetDB().QueryRow(context.Background(), query, scopeType, scopeID)
+	row := db.GetDB().QueryRow(ctx, query, scopeType, scopeID)
 
 	err = row.Scan(
 		&account.BillingAccountID,
@@ -294,6 +370,8 @@ func (s *BillingService) CancelSubscription(scopeType, scopeID string) (*models.
 		&account.StripeSubscriptionID,
 		&account.CreatedAt,
 		&account.UpdatedAt,
+		&account.Currency,
+		&account.BillingInterval,
 	)
 
 	if err != nil {
@@ -303,10 +381,23 @@ func (s *BillingService) CancelSubscription(scopeType, scopeID string) (*models.
 	return account, nil
 }
 
-// GetBillingInfo retrieves comprehensive billing information including Stripe data
-func (s *BillingService) GetBillingInfo(scopeType, scopeID string) (*models.BillingInfo, error) {
+// GetBillingInfo retrieves comprehensive billing information including Stripe data.
+// For a project billed to its organization this is the organization's billing info.
+// Results are cached briefly per scope; see cacheableBillingInfo.
+func (s *BillingService) GetBillingInfo(ctx context.Context, scopeType, scopeID string) (*models.BillingInfo, error) {
+	scopeType, scopeID, err := s.ResolveBillingScope(ctx, scopeType, scopeID)
+	if err != nil {
+		return nil, err
+	}
+	return billingInfoCache.GetOrLoad(ctx, billingInfoKey(scopeType, scopeID), func() (*models.BillingInfo, error) {
+		return s.loadBillingInfo(ctx, scopeType, scopeID)
+	}, cacheableBillingInfo)
+}
+
+// loadBillingInfo fetches billing information from the database and Stripe
+func (s *BillingService) loadBillingInfo(ctx context.Context, scopeType, scopeID string) (*models.BillingInfo, error) {
 	// Get billing account
-	account, err := s.GetBillingAccount(scopeType, scopeID)
+	account, err := s.GetBillingAccount(ctx, scopeType, scopeID)
 	if err != nil {
 		return nil, err
 	}
@@ -317,7 +408,7 @@ func (s *BillingService) GetBillingInfo(scopeType, scopeID string) (*models.Bill
 
 	// Add Stripe customer info
 	if account.StripeCustomerID != nil {
-		cust, err := customer.Get(*account.StripeCustomerID, nil)
+		cust, err := customer.Get(*account.StripeCustomerID, &stripe.CustomerParams{Params: stripe.Params{Context: ctx}})
 		if err == nil {
 			billingInfo.StripeCustomer = &models.StripeCustomer{
 				ID:          cust.ID,
@@ -333,6 +424,7 @@ func (s *BillingService) GetBillingInfo(scopeType, scopeID string) (*models.Bill
 		// Get latest invoice using invoice.List
 		if account.StripeSubscriptionID != nil {
 			params := &stripe.InvoiceListParams{
+				ListParams:   stripe.ListParams{Context: ctx},
 				Customer:     stripe.String(*account.StripeCustomerID),
 				Subscription: stripe.String(*account.StripeSubscriptionID),
 			}
@@ -353,7 +445,8 @@ func (s *BillingService) GetBillingInfo(scopeType, scopeID string) (*models.Bill
 
 		// Get payment methods (all types: card, link, us_bank_account, etc.)
 		pmParams := &stripe.PaymentMethodListParams{
-			Customer: stripe.String(*account.StripeCustomerID),
+			ListParams: stripe.ListParams{Context: ctx},
+			Customer:   stripe.String(*account.StripeCustomerID),
 		}
 
 		pmIterator := paymentmethod.List(pmParams)
@@ -389,7 +482,8 @@ func (s *BillingService) GetBillingInfo(scopeType, scopeID string) (*models.Bill
 	// Get subscription details and items if subscription exists
 	if account.StripeSubscriptionID != nil && *account.StripeSubscriptionID != "" {
 		sub, err := subscription.Get(*account.StripeSubscriptionID, &stripe.SubscriptionParams{
-			Expand: []*string{stripe.String("items.data.price.product")},
+			Params: stripe.Params{Context: ctx},
+			Expand: []*string{stripe.String("items.data.price.product"), stripe.String("discounts.promotion_code")},
 		})
 		if err != nil {
 			fmt.Printf("Warning: Failed to get subscription details: %v\n", err)
@@ -457,23 +551,28 @@ func (s *BillingService) GetBillingInfo(scopeType, scopeID string) (*models.Bill
 				CurrentPeriodStart: 0, // Not available in this SDK version
 				CurrentPeriodEnd:   0, // Not available in this SDK version
 				CancelAtPeriodEnd:  sub.CancelAtPeriodEnd,
+				TrialStart:         sub.TrialStart,
+				TrialEnd:           sub.TrialEnd,
+				Discounts:          convertDiscounts(sub.Discounts),
 			}
 		}
 	}
+	billingInfo.PaymentStatus = paymentStatus(billingInfo)
 
 	return billingInfo, nil
 }
 
 // CreateStripeSetupIntent creates a Stripe SetupIntent for payment onboarding
-func (s *BillingService) CreateStripeSetupIntent(scopeType, scopeID string) (string, error) {
-	account, err := s.GetBillingAccount(scopeType, scopeID)
+func (s *BillingService) CreateStripeSetupIntent(ctx context.Context, scopeType, scopeID string) (string, error) {
+	account, err := s.GetBillingAccount(ctx, scopeType, scopeID)
 	if err != nil {
 		return "", err
 	}
 	if account.StripeCustomerID == nil {
-		return "", fmt.Errorf("stripe customer not found for scope")
+		return "", NotFound("stripe customer not found for scope")
 	}
 	params := &stripe.SetupIntentParams{
+		Params:   stripe.Params{Context: ctx},
 		Customer: stripe.String(*account.StripeCustomerID),
 		Usage:    stripe.String("off_session"),
 		AutomaticPaymentMethods: &stripe.SetupIntentAutomaticPaymentMethodsParams{
@@ -482,8 +581,10 @@ func (s *BillingService) CreateStripeSetupIntent(scopeType, scopeID string) (str
 	}
 	intent, err := setupintent.New(params)
 	if err != nil {
-		return "", fmt.Errorf("failed to create Stripe SetupIntent: %w", err)
+		return "", Upstream(err, "failed to create Stripe SetupIntent")
 	}
+	// A payment method is about to be attached client-side
+	InvalidateBillingInfo(scopeType, scopeID)
 	return intent.ClientSecret, nil
 }
 
@@ -497,38 +598,82 @@ func (s *BillingService) getProductIDForResourceType(resourceType, sku string) s
 	return ""
 }
 
-// GetPriceIDForResourceType gets the default price ID for a resource type and SKU
-func (s *BillingService) GetPriceIDForResourceType(resourceType, sku string) (string, error) {
+// GetPriceIDForResourceType gets the price ID for a resource type and SKU in a currency and
+// billing interval. Empty values select the default currency price and the monthly price.
+func (s *BillingService) GetPriceIDForResourceType(ctx context.Context, resourceType, sku, currency, interval string) (string, error) {
 	productID := s.getProductIDForResourceType(resourceType, sku)
 	if productID == "" {
-		return "", fmt.Errorf("no product ID configured for resource type %s with SKU %s", resourceType, sku)
+		return "", NotFound("no product ID configured for resource type %s with SKU %s", resourceType, sku)
 	}
 
-	priceID, err := s.getDefaultPriceForProduct(productID)
+	p, err := s.getPriceForProduct(ctx, productID, currency, interval)
+	if errors.Is(err, ErrNotFound) {
+		return "", err
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to get price for product %s: %w", productID, err)
+		return "", Upstream(err, "failed to get price for product %s", productID)
 	}
 
-	return priceID, nil
+	return p.ID, nil
 }
 
-func (s *BillingService) GetResourceTierPrice(resourceType, sku string) (*models.ResourceTierPrice, error) {
-	priceID, err := s.GetPriceIDForResourceType(resourceType, sku)
-	if err != nil || priceID == "" {
-		return nil, fmt.Errorf("no product ID configured for resource type %s with SKU %s", resourceType, sku)
+// accountPriceID gets the price ID a billing account is charged for a resource type and SKU,
+// in its currency and billing interval.
+func (s *BillingService) accountPriceID(ctx context.Context, account *models.BillingAccount, resourceType, sku string) (string, error) {
+	return s.GetPriceIDForResourceType(ctx, resourceType, sku, s.accountCurrency(account), s.accountInterval(account))
+}
+
+// GetResourceTierPrice returns the monthly price of a resource type and SKU in a currency, or
+// in the default currency when empty, along with its price for every billing interval.
+func (s *BillingService) GetResourceTierPrice(ctx context.Context, resourceType, sku, currency string) (*models.ResourceTierPrice, error) {
+	currency = normalizeCurrency(currency)
+	if err := validateCurrency(currency); err != nil {
+		return nil, err
+	}
+	if currency == "" {
+		currency = s.defaultCurrency()
+	}
+	priceID, err := s.GetPriceIDForResourceType(ctx, resourceType, sku, currency, "")
+	if err != nil {
+		return nil, err
 	}
-	priceObj, err := price.Get(priceID, nil)
+	priceObj, err := getPrice(ctx, priceID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get price details for price ID %s: %w", priceID, err)
+		return nil, Upstream(err, "failed to get price details for price ID %s", priceID)
 	}
+	if currency == "" {
+		currency = string(priceObj.Currency)
+	}
+	amount, taxBehavior, _ := priceIn(priceObj, currency)
 
 	resourceTierPrice := &models.ResourceTierPrice{
 		PriceID:      priceObj.ID,
-		Amount:       priceObj.UnitAmount,
-		Currency:     string(priceObj.Currency),
-		Interval:     string(priceObj.Recurring.Interval),
+		Amount:       amount,
+		Currency:     currency,
+		TaxBehavior:  taxBehavior,
 		SKU:          sku,
 		ResourceType: resourceType,
+		Prices:       []models.ResourceIntervalPrice{},
+	}
+	if priceObj.Recurring != nil {
+		resourceTierPrice.Interval = string(priceObj.Recurring.Interval)
+	}
+
+	productID := s.getProductIDForResourceType(resourceType, sku)
+	for _, interval := range billingIntervals {
+		p, err := s.getPriceForProduct(ctx, productID, currency, interval)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, Upstream(err, "failed to get %s price for product %s", interval, productID)
+		}
+		amount, _, _ := priceIn(p, currency)
+		resourceTierPrice.Prices = append(resourceTierPrice.Prices, models.ResourceIntervalPrice{
+			PriceID:  p.ID,
+			Amount:   amount,
+			Interval: interval,
+		})
 	}
 
 	return resourceTierPrice, nil
@@ -544,30 +689,65 @@ func parseResourceKey(resourceKey string) (resourceType, sku string) {
 	return resourceKey, "free"
 }
 
-// getDefaultPriceForProduct fetches the default price for a Stripe product
-func (s *BillingService) getDefaultPriceForProduct(productID string) (string, error) {
-	// List prices for this product
-	params := &stripe.PriceListParams{
-		Product: stripe.String(productID),
-		Active:  stripe.Bool(true),
+// getPriceForProduct returns the price of a Stripe product in a currency and billing interval:
+// the price configured for the interval, or else a matching active price of the product.
+// Without an interval the monthly price is preferred.
+func (s *BillingService) getPriceForProduct(ctx context.Context, productID, currency, interval string) (*stripe.Price, error) {
+	if priceID := s.configuredPriceID(productID, interval); priceID != "" {
+		p, err := getPrice(ctx, priceID)
+		if err != nil {
+			return nil, err
+		}
+		if _, _, ok := priceIn(p, currency); !ok {
+			return nil, NotFound("price %s of product %s has no amount in %s", priceID, productID, currency)
+		}
+		return p, nil
 	}
 
-	iter := price.List(params)
-	if iter.Next() {
-		// Return the first active price (typically the default)
-		return iter.Price().ID, nil
+	prices, err := getProductPrices(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if len(prices) == 0 {
+		return nil, NotFound("no active prices found for product %s", productID)
+	}
+	var p *stripe.Price
+	if interval == "" {
+		p = selectPrice(prices, currency, IntervalMonth)
+	}
+	if p == nil {
+		p = selectPrice(prices, currency, interval)
 	}
+	if p == nil {
+		return nil, NotFound("no active %s price found for product %s", strings.TrimSpace(interval+" "+currency), productID)
+	}
+	return p, nil
+}
 
-	if iter.Err() != nil {
-		return "", fmt.Errorf("error listing prices for product %s: %w", productID, iter.Err())
+// configuredPriceID returns the price ID configured for a product and billing interval, if
+// any. Without an interval the monthly price is used.
+func (s *BillingService) configuredPriceID(productID, interval string) string {
+	if interval == "" {
+		interval = IntervalMonth
+	}
+	for _, product := range s.config.Stripe.Products {
+		if product.ProductID == productID {
+			return product.Prices[interval]
+		}
 	}
+	return ""
+}
 
-	return "", fmt.Errorf("no active prices found for product %s", productID)
+// getResourceCounts counts the resources billed to a scope (organization or project) by type, SKU and project
+func (s *BillingService) getResourceCounts(ctx context.Context, scopeType, scopeID string) (projectResourceCounts, error) {
+	return loadResourceCounts(ctx, scopeType, scopeID)
 }
 
-// getResourceCounts counts resources by type and SKU for a given scope (organization or project)
-func (s *BillingService) getResourceCounts(scopeType, scopeID string) (map[string]int, error) {
-	resourceCounts := make(map[string]int)
+// loadResourceCounts reads the resource counts of a scope. Tests replace it.
+var loadResourceCounts = queryResourceCounts
+
+func queryResourceCounts(ctx context.Context, scopeType, scopeID string) (projectResourceCounts, error) {
+	resourceCounts := make(projectResourceCounts)
 
 	var query string
 	if scopeType == "organization" {
@@ -576,32 +756,37 @@ func (s *BillingService) getResourceCounts(scopeType, scopeID string) (map[strin
 		query = db.GetResourceCountsProjectQuery
 	}
 
-	rows, err := db.GetDB().Query(context.Background(), query, scopeID)
+	rows, err := db.GetDB().Query(ctx, query, scopeID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query resource counts: %w", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var resourceType, sku string
+		var resourceType, sku, projectID string
 		var count int
-		if err := rows.Scan(&resourceType, &sku, &count); err != nil {
+		if err := rows.Scan(&resourceType, &sku, &projectID, &count); err != nil {
 			return nil, fmt.Errorf("failed to scan resource count: %w", err)
 		}
 		// Create composite key: "resourceType:sku"
 		resourceKey := fmt.Sprintf("%s:%s", resourceType, sku)
-		resourceCounts[resourceKey] = count
+		if resourceCounts[resourceKey] == nil {
+			resourceCounts[resourceKey] = make(map[string]int)
+		}
+		resourceCounts[resourceKey][projectID] = count
 	}
 
-	return resourceCounts, nil
+	return resourceCounts, rows.Err()
 }
 
-// createSubscriptionWithResources creates a Stripe subscription with items based on resource counts
-func (s *BillingService) createSubscriptionWithResources(customerID string, resourceCounts map[string]int) (*stripe.Subscription, error) {
+// createSubscriptionWithResources creates a Stripe subscription in currency and billing interval
+// with items based on resource counts, on a trial if billing account scopeType/scopeID is due one
+func (s *BillingService) createSubscriptionWithResources(ctx context.Context, scopeType, scopeID, customerID, currency, interval string, resourceCounts projectResourceCounts) (*stripe.Subscription, error) {
 	var subscriptionItems []*stripe.SubscriptionItemsParams
 
 	// Create subscription items for each resource type:sku combination
-	for resourceKey, count := range resourceCounts {
+	for resourceKey := range resourceCounts {
+		count := resourceCounts.total(resourceKey)
 		if count <= 0 {
 			continue
 		}
@@ -616,16 +801,17 @@ func (s *BillingService) createSubscriptionWithResources(customerID string, reso
 			continue
 		}
 
-		// Get the default price for this product from Stripe
-		priceID, err := s.getDefaultPriceForProduct(productID)
+		// Get the price for this product in the account's currency and interval from Stripe
+		p, err := s.getPriceForProduct(ctx, productID, currency, interval)
 		if err != nil {
 			fmt.Printf("Warning: Failed to get price for product %s: %v\n", productID, err)
 			continue
 		}
 
 		subscriptionItems = append(subscriptionItems, &stripe.SubscriptionItemsParams{
-			Price:    stripe.String(priceID),
+			Price:    stripe.String(p.ID),
 			Quantity: stripe.Int64(int64(count)),
+			Metadata: resourceCounts.metadata(resourceKey),
 		})
 	}
 
@@ -633,6 +819,7 @@ func (s *BillingService) createSubscriptionWithResources(customerID string, reso
 	if len(subscriptionItems) == 0 {
 		fmt.Printf("No subscription items found, creating empty subscription for future use\n")
 		subParams := &stripe.SubscriptionParams{
+			Params:   stripe.Params{Context: ctx},
 			Customer: stripe.String(customerID),
 			Items:    []*stripe.SubscriptionItemsParams{},
 			BillingMode: &stripe.SubscriptionBillingModeParams{
@@ -642,33 +829,28 @@ func (s *BillingService) createSubscriptionWithResources(customerID string, reso
 		return subscription.New(subParams)
 	}
 
-	// List existing payment methods for customer
-	pmParams := &stripe.CustomerListPaymentMethodsParams{
-		Customer: stripe.String(customerID),
-	}
-	pmParams.Limit = stripe.Int64(3)
-	pmIter := customer.ListPaymentMethods(pmParams)
-
-	var paymentMethods []*stripe.PaymentMethod
-	for pmIter.Next() {
-		paymentMethods = append(paymentMethods, pmIter.PaymentMethod())
-	}
-
-	if len(paymentMethods) == 0 {
-		fmt.Printf("Warning: No payment methods found for customer %s\n", customerID)
+	paymentMethodID, err := firstPaymentMethod(ctx, customerID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create the subscription with items
+	// Create the subscription with items, incomplete until the customer adds a payment method
 	subParams := &stripe.SubscriptionParams{
+		Params:   stripe.Params{Context: ctx},
 		Customer: stripe.String(customerID),
 		Items:    subscriptionItems,
-		DefaultPaymentMethod: stripe.String(paymentMethods[0].ID),
+	}
+	setPaymentBehavior(subParams, paymentMethodID)
+	if err := s.prepareSubscription(ctx, scopeType, scopeID, currency, subParams); err != nil {
+		return nil, err
 	}
 
 	subscription, err := subscription.New(subParams)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create subscription: %w", err)
+		return nil, Upstream(err, "failed to create subscription")
 	}
+	recordSubscriptionShares(ctx, subscription)
+	markTrialUsed(ctx, scopeType, scopeID, subscription)
 
 	return subscription, nil
 }
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Sentinel error kinds returned by services. Callers test for them with errors.Is;
+// the API layer maps each kind to an HTTP status.
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrForbidden       = errors.New("forbidden")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrConflict        = errors.New("conflict")
+	ErrValidation      = errors.New("validation failed")
+	ErrPaymentRequired = errors.New("payment required")
+	ErrUpstream        = errors.New("upstream service error")
+)
+
+// Error is a domain error. Message is safe to show to API clients; the wrapped
+// Err carries internal detail (SQL, Stripe or Kubernetes errors) for logs only.
+type Error struct {
+	Kind    error
+	Message string
+	Err     error
+}
+
+// Error returns the client message followed by the wrapped cause, if any.
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap exposes both the kind and the cause to errors.Is and errors.As.
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+// PublicMessage returns the message that may be shown to API clients.
+func (e *Error) PublicMessage() string {
+	return e.Message
+}
+
+func newError(kind error, format string, args ...any) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+// NotFound returns an ErrNotFound domain error.
+func NotFound(format string, args ...any) error { return newError(ErrNotFound, format, args...) }
+
+// Forbidden returns an ErrForbidden domain error.
+func Forbidden(format string, args ...any) error { return newError(ErrForbidden, format, args...) }
+
+// Unauthorized returns an ErrUnauthorized domain error.
+func Unauthorized(format string, args ...any) error {
+	return newError(ErrUnauthorized, format, args...)
+}
+
+// Conflict returns an ErrConflict domain error.
+func Conflict(format string, args ...any) error { return newError(ErrConflict, format, args...) }
+
+// Validation returns an ErrValidation domain error.
+func Validation(format string, args ...any) error { return newError(ErrValidation, format, args...) }
+
+// PaymentRequired returns an ErrPaymentRequired domain error.
+func PaymentRequired(format string, args ...any) error {
+	return newError(ErrPaymentRequired, format, args...)
+}
+
+// Upstream wraps a failure from an external dependency (Stripe, Kubernetes, ...).
+// The message is shown to clients; err is kept for logging.
+func Upstream(err error, format string, args ...any) error {
+	e := newError(ErrUpstream, format, args...)
+	e.Err = err
+	return e
+}
+
+// Wrap attaches kind and a client message to err.
+func Wrap(kind, err error, format string, args ...any) error {
+	e := newError(kind, format, args...)
+	e.Err = err
+	return e
+}
+
+// isUniqueViolation reports whether err is a Postgres unique constraint violation.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// isForeignKeyViolation reports whether err is a Postgres foreign key violation.
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDomainErrors(t *testing.T) {
+	err := NotFound("project not found: %s", "p1")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.False(t, errors.Is(err, ErrForbidden))
+	assert.Equal(t, "project not found: p1", err.Error())
+
+	// Kinds survive further wrapping
+	wrapped := fmt.Errorf("handler: %w", Forbidden("insufficient permissions to delete project"))
+	assert.True(t, errors.Is(wrapped, ErrForbidden))
+
+	cause := errors.New("stripe: connection reset")
+	upstream := Upstream(cause, "failed to create Stripe customer")
+	assert.True(t, errors.Is(upstream, ErrUpstream))
+	assert.True(t, errors.Is(upstream, cause))
+
+	var domainErr *Error
+	assert.True(t, errors.As(upstream, &domainErr))
+	assert.Equal(t, "failed to create Stripe customer", domainErr.PublicMessage())
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	assert.True(t, isUniqueViolation(fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23505"})))
+	assert.False(t, isUniqueViolation(&pgconn.PgError{Code: "23503"}))
+	assert.False(t, isUniqueViolation(errors.New("duplicate")))
+}
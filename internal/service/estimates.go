@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"ktrlplane/internal/models"
+	"time"
+
+	"github.com/stripe/stripe-go/v84"
+	"github.com/stripe/stripe-go/v84/invoice"
+	"github.com/stripe/stripe-go/v84/subscription"
+)
+
+// EstimateResource previews what creating a resource of a type and SKU in a project would
+// cost, without touching the subscription. It fails where CreateResource would.
+func (s *ResourceService) EstimateResource(ctx context.Context, projectID string, req models.EstimateResourceRequest, userID string) (*models.ResourceEstimate, error) {
+	hasPermission, err := s.rbacService.CheckPermission(ctx, userID, "write", "project", projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check permissions: %w", err)
+	}
+	if !hasPermission {
+		return nil, Forbidden("insufficient permissions to create resource")
+	}
+
+	estimate := &models.ResourceEstimate{ResourceType: req.Type, SKU: req.SKU}
+	if req.SKU == "free" {
+		return estimate, nil
+	}
+
+	billingSvc := NewBillingService(s.config)
+	billingAccount, err := billingSvc.ResolveProjectBillingAccount(ctx, projectID)
+	if err != nil || billingAccount == nil || billingAccount.StripeCustomerID == nil {
+		return nil, PaymentRequired("billing account with Stripe customer required for paid resources")
+	}
+	priceID, err := billingSvc.accountPriceID(ctx, billingAccount, req.Type, req.SKU)
+	if err != nil || priceID == "" {
+		return nil, Validation("no Stripe price ID configured for resource type '%s' and SKU '%s'", req.Type, req.SKU)
+	}
+
+	if err := billingSvc.estimateChange(ctx, billingAccount, priceID, "", estimate); err != nil {
+		return nil, err
+	}
+	return estimate, nil
+}
+
+// EstimateResourceUpdate previews what moving a resource to another SKU would cost, without
+// touching the subscription. It fails where UpdateResource would.
+func (s *ResourceService) EstimateResourceUpdate(ctx context.Context, projectID, resourceID string, req models.EstimateResourceUpdateRequest, userID string) (*models.ResourceEstimate, error) {
+	hasPermission, err := s.rbacService.CheckPermission(ctx, userID, "write", "project", projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check permissions: %w", err)
+	}
+	if !hasPermission {
+		return nil, Forbidden("insufficient permissions to update resource")
+	}
+
+	currentResource, err := s.GetResourceByID(ctx, projectID, resourceID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch current resource: %w", err)
+	}
+
+	estimate := &models.ResourceEstimate{ResourceType: currentResource.Type, SKU: req.SKU, CurrentSKU: currentResource.SKU}
+	if req.SKU == currentResource.SKU {
+		return estimate, nil
+	}
+
+	billingSvc := NewBillingService(s.config)
+	billingAccount, err := billingSvc.ResolveProjectBillingAccount(ctx, projectID)
+	if err != nil || billingAccount == nil || billingAccount.StripeCustomerID == nil || billingAccount.StripeSubscriptionID == nil {
+		return nil, PaymentRequired("billing account with active subscription required for tier changes")
+	}
+	newPriceID, err := billingSvc.accountPriceID(ctx, billingAccount, currentResource.Type, req.SKU)
+	if err != nil || newPriceID == "" {
+		return nil, Validation("no Stripe price ID configured for resource type '%s' and SKU '%s'", currentResource.Type, req.SKU)
+	}
+
+	var addPriceID, removePriceID string
+	if req.SKU != "free" {
+		addPriceID = newPriceID
+	}
+	if currentResource.SKU != "free" && currentResource.StripePriceID != nil {
+		removePriceID = *currentResource.StripePriceID
+	}
+	if err := billingSvc.estimateChange(ctx, billingAccount, addPriceID, removePriceID, estimate); err != nil {
+		return nil, err
+	}
+	return estimate, nil
+}
+
+// estimateChange fills in the cost of billing one more resource at addPriceID and one less
+// at removePriceID (either may be empty) to a billing account. Changes to a subscription in
+// use are previewed through Stripe's upcoming invoice; otherwise the resource would start a
+// new subscription, charged in full right away.
+func (s *BillingService) estimateChange(ctx context.Context, account *models.BillingAccount, addPriceID, removePriceID string, estimate *models.ResourceEstimate) error {
+	var sub *stripe.Subscription
+	if account.StripeSubscriptionID != nil && *account.StripeSubscriptionID != "" {
+		var err error
+		params := &stripe.SubscriptionParams{Params: stripe.Params{Context: ctx}}
+		// Item prices are in their default currency; the subscription's may be an option
+		params.AddExpand("items.data.price.currency_options")
+		sub, err = subscription.Get(*account.StripeSubscriptionID, params)
+		if err != nil {
+			return Upstream(err, "failed to fetch Stripe subscription")
+		}
+		if addPriceID != "" {
+			if err := s.requireHealthySubscription(sub); err != nil {
+				return err
+			}
+		}
+	}
+	usable := sub != nil && !unusableSubscription(sub)
+
+	if addPriceID != "" {
+		p, err := getPrice(ctx, addPriceID)
+		if err != nil {
+			return Upstream(err, "failed to get price details for price ID %s", addPriceID)
+		}
+		// A subscription bills in one currency; a new one in the account's
+		currency := s.accountCurrency(account)
+		if usable && sub.Currency != "" {
+			currency = string(sub.Currency)
+		}
+		amount, _, ok := priceIn(p, currency)
+		if !ok {
+			amount, currency = p.UnitAmount, string(p.Currency)
+		}
+		estimate.PriceID = p.ID
+		estimate.UnitAmount = amount
+		estimate.Currency = normalizeCurrency(currency)
+		if estimate.Currency == "" {
+			estimate.Currency = string(p.Currency)
+		}
+		if p.Recurring != nil {
+			estimate.Interval = string(p.Recurring.Interval)
+		}
+	}
+
+	if !usable {
+		if addPriceID != "" {
+			estimate.NewSubscription = true
+			estimate.ProratedAmount = estimate.UnitAmount
+			estimate.RecurringTotal = estimate.UnitAmount
+		}
+		return nil
+	}
+
+	if estimate.Currency == "" {
+		estimate.Currency = string(sub.Currency)
+	}
+	items, changed, remaining := previewItems(sub, addPriceID, removePriceID)
+	estimate.CurrentRecurringTotal = recurringTotal(sub.Items.Data, string(sub.Currency), nil)
+	if !changed {
+		estimate.RecurringTotal = estimate.CurrentRecurringTotal
+		return nil
+	}
+	if remaining == 0 {
+		// Removing the last item cancels the subscription without a refund
+		return nil
+	}
+	estimate.RecurringTotal = recurringTotal(sub.Items.Data, string(sub.Currency), map[string]int64{addPriceID: 1, removePriceID: -1}) +
+		newItemTotal(sub.Items.Data, addPriceID, estimate.UnitAmount)
+
+	params := &stripe.InvoiceCreatePreviewParams{
+		Customer:     account.StripeCustomerID,
+		Subscription: stripe.String(sub.ID),
+		SubscriptionDetails: &stripe.InvoiceCreatePreviewSubscriptionDetailsParams{
+			Items:             items,
+			ProrationBehavior: stripe.String("create_prorations"),
+			ProrationDate:     stripe.Int64(time.Now().Unix()),
+		},
+	}
+	params.Context = ctx
+	preview, err := invoice.CreatePreview(params)
+	if err != nil {
+		return Upstream(err, "failed to preview Stripe invoice")
+	}
+	estimate.ProratedAmount = prorationAmount(preview, addPriceID, removePriceID)
+	return nil
+}
+
+// previewItems returns the subscription items of sub after adding one resource at addPriceID
+// and removing one at removePriceID, in the form Stripe previews them. It also reports whether
+// anything changes and how many items would be left.
+func previewItems(sub *stripe.Subscription, addPriceID, removePriceID string) ([]*stripe.InvoiceCreatePreviewSubscriptionDetailsItemParams, bool, int) {
+	var items []*stripe.InvoiceCreatePreviewSubscriptionDetailsItemParams
+	if addPriceID == removePriceID {
+		return nil, false, len(sub.Items.Data)
+	}
+	remaining := len(sub.Items.Data)
+	added := addPriceID == ""
+	for _, item := range sub.Items.Data {
+		if item.Price == nil {
+			continue
+		}
+		switch item.Price.ID {
+		case addPriceID:
+			added = true
+			items = append(items, &stripe.InvoiceCreatePreviewSubscriptionDetailsItemParams{
+				ID: stripe.String(item.ID), Quantity: stripe.Int64(item.Quantity + 1),
+			})
+		case removePriceID:
+			if item.Quantity > 1 {
+				items = append(items, &stripe.InvoiceCreatePreviewSubscriptionDetailsItemParams{
+					ID: stripe.String(item.ID), Quantity: stripe.Int64(item.Quantity - 1),
+				})
+				continue
+			}
+			remaining--
+			items = append(items, &stripe.InvoiceCreatePreviewSubscriptionDetailsItemParams{
+				ID: stripe.String(item.ID), Deleted: stripe.Bool(true),
+			})
+		}
+	}
+	if !added {
+		remaining++
+		items = append(items, &stripe.InvoiceCreatePreviewSubscriptionDetailsItemParams{
+			Price: stripe.String(addPriceID), Quantity: stripe.Int64(1),
+		})
+	}
+	return items, len(items) > 0, remaining
+}
+
+// recurringTotal sums the per-period amount in currency of subscription items, with their
+// quantities adjusted by deltas (keyed by price ID).
+func recurringTotal(items []*stripe.SubscriptionItem, currency string, deltas map[string]int64) int64 {
+	var total int64
+	for _, item := range items {
+		if item.Price == nil {
+			continue
+		}
+		quantity := item.Quantity + deltas[item.Price.ID]
+		if quantity <= 0 {
+			continue
+		}
+		amount, _, ok := priceIn(item.Price, currency)
+		if !ok {
+			amount = item.Price.UnitAmount
+		}
+		total += amount * quantity
+	}
+	return total
+}
+
+// newItemTotal returns unitAmount when priceID is not on the subscription yet and would be
+// added as a new item.
+func newItemTotal(items []*stripe.SubscriptionItem, priceID string, unitAmount int64) int64 {
+	if priceID == "" {
+		return 0
+	}
+	for _, item := range items {
+		if item.Price != nil && item.Price.ID == priceID {
+			return 0
+		}
+	}
+	return unitAmount
+}
+
+// prorationAmount sums the proration lines of a preview invoice for the changed prices: the
+// charge (or credit, when negative) for the rest of the current billing period.
+func prorationAmount(preview *stripe.Invoice, priceIDs ...string) int64 {
+	if preview.Lines == nil {
+		return 0
+	}
+	var amount int64
+	for _, line := range preview.Lines.Data {
+		if !isProration(line) || line.Pricing == nil || line.Pricing.PriceDetails == nil {
+			continue
+		}
+		for _, priceID := range priceIDs {
+			if priceID != "" && line.Pricing.PriceDetails.Price == priceID {
+				amount += line.Amount
+				break
+			}
+		}
+	}
+	return amount
+}
+
+// isProration reports whether an invoice line is a proration, either of a subscription item
+// or pending as an invoice item.
+func isProration(line *stripe.InvoiceLineItem) bool {
+	if line.Parent == nil {
+		return false
+	}
+	if details := line.Parent.SubscriptionItemDetails; details != nil && details.Proration {
+		return true
+	}
+	details := line.Parent.InvoiceItemDetails
+	return details != nil && details.Proration
+}
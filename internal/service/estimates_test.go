@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"ktrlplane/internal/config"
+	"ktrlplane/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v84"
+)
+
+// estimateSubscription has two standard resources and one premium resource.
+func estimateSubscription() map[string]any {
+	return map[string]any{
+		"id": "sub_1", "object": "subscription", "status": "active", "currency": "eur",
+		"items": stripeList("/v1/subscription_items",
+			map[string]any{"id": "si_std", "object": "subscription_item", "quantity": 2,
+				"price": map[string]any{"id": "price_std", "object": "price", "unit_amount": 1000}},
+			map[string]any{"id": "si_pro", "object": "subscription_item", "quantity": 1,
+				"price": map[string]any{"id": "price_pro", "object": "price", "unit_amount": 5000}},
+		),
+	}
+}
+
+func TestPreviewItems(t *testing.T) {
+	sub := &stripe.Subscription{Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{
+		{ID: "si_std", Quantity: 2, Price: &stripe.Price{ID: "price_std"}},
+		{ID: "si_pro", Quantity: 1, Price: &stripe.Price{ID: "price_pro"}},
+	}}}
+
+	items, changed, remaining := previewItems(sub, "price_std", "price_pro")
+	assert.True(t, changed)
+	assert.Equal(t, 1, remaining)
+	require.Len(t, items, 2)
+	assert.Equal(t, int64(3), *items[0].Quantity)
+	assert.True(t, *items[1].Deleted)
+
+	items, _, remaining = previewItems(sub, "price_max", "price_std")
+	assert.Equal(t, 3, remaining)
+	require.Len(t, items, 2)
+	assert.Equal(t, int64(1), *items[0].Quantity)
+	assert.Equal(t, "price_max", *items[1].Price)
+
+	_, changed, _ = previewItems(sub, "price_std", "price_std")
+	assert.False(t, changed)
+}
+
+func TestEstimateChange_PreviewsProration(t *testing.T) {
+	ClearBillingCaches()
+	defer ClearBillingCaches()
+
+	fs := newFakeStripe(t)
+	fs.handle("GET /v1/prices/price_pro", func(r *http.Request) (int, any) {
+		return http.StatusOK, map[string]any{"id": "price_pro", "object": "price", "unit_amount": 5000, "currency": "eur",
+			"recurring": map[string]any{"interval": "month"}}
+	})
+	fs.handle("GET /v1/subscriptions/sub_1", func(r *http.Request) (int, any) {
+		return http.StatusOK, estimateSubscription()
+	})
+	var form url.Values
+	fs.handle("POST /v1/invoices/create_preview", func(r *http.Request) (int, any) {
+		_ = r.ParseForm()
+		form = r.PostForm
+		line := func(price string, amount int64, proration bool) map[string]any {
+			return map[string]any{
+				"object": "line_item", "amount": amount,
+				"pricing": map[string]any{"price_details": map[string]any{"price": price}},
+				"parent":  map[string]any{"subscription_item_details": map[string]any{"proration": proration}},
+			}
+		}
+		return http.StatusOK, map[string]any{"object": "invoice", "lines": stripeList("/v1/invoices/upcoming/lines",
+			line("price_std", -500, true),
+			line("price_pro", 2500, true),
+			line("price_other", 300, true),
+			line("price_pro", 10000, false),
+		)}
+	})
+
+	account := &models.BillingAccount{StripeCustomerID: stripe.String("cus_1"), StripeSubscriptionID: stripe.String("sub_1")}
+	estimate := &models.ResourceEstimate{}
+	err := NewBillingService(&config.Config{}).estimateChange(context.Background(), account, "price_pro", "price_std", estimate)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(2000), estimate.ProratedAmount, "only prorations of the changed prices")
+	assert.Equal(t, int64(7000), estimate.CurrentRecurringTotal)
+	assert.Equal(t, int64(11000), estimate.RecurringTotal)
+	assert.Equal(t, "eur", estimate.Currency)
+	assert.Equal(t, "month", estimate.Interval)
+	assert.False(t, estimate.NewSubscription)
+
+	assert.Equal(t, "sub_1", form.Get("subscription"))
+	assert.Equal(t, "create_prorations", form.Get("subscription_details[proration_behavior]"))
+	assert.Equal(t, "si_std", form.Get("subscription_details[items][0][id]"))
+	assert.Equal(t, "1", form.Get("subscription_details[items][0][quantity]"))
+	assert.Equal(t, "si_pro", form.Get("subscription_details[items][1][id]"))
+	assert.Equal(t, "2", form.Get("subscription_details[items][1][quantity]"))
+	assert.Zero(t, fs.count("POST /v1/subscription_items"), "estimates do not change the subscription")
+}
+
+func TestEstimateChange_NewSubscription(t *testing.T) {
+	ClearBillingCaches()
+	defer ClearBillingCaches()
+
+	fs := newFakeStripe(t)
+	fs.handle("GET /v1/prices/price_std", func(r *http.Request) (int, any) {
+		return http.StatusOK, map[string]any{"id": "price_std", "object": "price", "unit_amount": 1000, "currency": "eur"}
+	})
+	fs.handle("GET /v1/subscriptions/sub_old", func(r *http.Request) (int, any) {
+		return http.StatusOK, map[string]any{"id": "sub_old", "object": "subscription", "status": "canceled"}
+	})
+
+	account := &models.BillingAccount{StripeCustomerID: stripe.String("cus_1"), StripeSubscriptionID: stripe.String("sub_old")}
+	estimate := &models.ResourceEstimate{}
+	require.NoError(t, NewBillingService(&config.Config{}).estimateChange(context.Background(), account, "price_std", "", estimate))
+	assert.True(t, estimate.NewSubscription)
+	assert.Equal(t, int64(1000), estimate.ProratedAmount, "a new subscription is charged in full")
+	assert.Equal(t, int64(1000), estimate.RecurringTotal)
+	assert.Zero(t, fs.count("POST /v1/invoices/create_preview"))
+}
+
+func TestEstimateChange_SubscriptionCurrency(t *testing.T) {
+	ClearBillingCaches()
+	defer ClearBillingCaches()
+
+	fs := newFakeStripe(t)
+	var query url.Values
+	fs.handle("GET /v1/subscriptions/sub_1", func(r *http.Request) (int, any) {
+		query = r.URL.Query()
+		// Prices default to USD; the subscription bills in CAD
+		return http.StatusOK, map[string]any{
+			"id": "sub_1", "object": "subscription", "status": "active", "currency": "cad",
+			"items": stripeList("/v1/subscription_items",
+				map[string]any{"id": "si_std", "object": "subscription_item", "quantity": 2,
+					"price": map[string]any{"id": "price_std", "object": "price", "unit_amount": 1000, "currency": "usd",
+						"currency_options": map[string]any{"cad": map[string]any{"unit_amount": 1400}}}},
+			),
+		}
+	})
+
+	account := &models.BillingAccount{StripeCustomerID: stripe.String("cus_1"), StripeSubscriptionID: stripe.String("sub_1")}
+	estimate := &models.ResourceEstimate{}
+	require.NoError(t, NewBillingService(&config.Config{}).estimateChange(context.Background(), account, "", "", estimate))
+	assert.Equal(t, "items.data.price.currency_options", query.Get("expand[0]"))
+	assert.Equal(t, "cad", estimate.Currency)
+	assert.Equal(t, int64(2800), estimate.CurrentRecurringTotal)
+	assert.Equal(t, int64(2800), estimate.RecurringTotal)
+}
+
+func TestEstimateChange_LastItemRemoved(t *testing.T) {
+	fs := newFakeStripe(t)
+	fs.handle("GET /v1/subscriptions/sub_1", func(r *http.Request) (int, any) {
+		return http.StatusOK, map[string]any{
+			"id": "sub_1", "object": "subscription", "status": "active", "currency": "eur",
+			"items": stripeList("/v1/subscription_items",
+				map[string]any{"id": "si_std", "object": "subscription_item", "quantity": 1,
+					"price": map[string]any{"id": "price_std", "object": "price", "unit_amount": 1000}},
+			),
+		}
+	})
+
+	account := &models.BillingAccount{StripeCustomerID: stripe.String("cus_1"), StripeSubscriptionID: stripe.String("sub_1")}
+	estimate := &models.ResourceEstimate{}
+	require.NoError(t, NewBillingService(&config.Config{}).estimateChange(context.Background(), account, "", "price_std", estimate))
+	assert.Equal(t, int64(1000), estimate.CurrentRecurringTotal)
+	assert.Zero(t, estimate.RecurringTotal, "the subscription is cancelled")
+	assert.Zero(t, estimate.ProratedAmount)
+	assert.Equal(t, "eur", estimate.Currency)
+	assert.Zero(t, fs.count("POST /v1/invoices/create_preview"))
+}
@@ -0,0 +1,332 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"ktrlplane/internal/config"
+	"ktrlplane/internal/db"
+	"ktrlplane/internal/mail"
+	"ktrlplane/internal/models"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Audit event types for invitations.
+const (
+	AuditInvitationCreated  = "invitation.created"
+	AuditInvitationResent   = "invitation.resent"
+	AuditInvitationRevoked  = "invitation.revoked"
+	AuditInvitationAccepted = "invitation.accepted"
+)
+
+// defaultInvitationTTL applies when invitations.ttl_hours is not set.
+const defaultInvitationTTL = 7 * 24 * time.Hour
+
+// InvitationService handles email invitations to organizations, projects and resources.
+type InvitationService struct {
+	rbacService *RBACService
+	mailer      mail.Mailer
+	signer      invitationSigner
+	ttl         time.Duration
+	acceptURL   string
+	now         func() time.Time
+}
+
+// NewInvitationService creates a new InvitationService. Invitations can only be sent and
+// accepted when invitations.signing_key is configured; it must be the same on every replica
+// for invitation links to work on all of them.
+func NewInvitationService(cfg *config.Config, mailer mail.Mailer) *InvitationService {
+	key := []byte(cfg.Invitations.SigningKey)
+	ttl := time.Duration(cfg.Invitations.TTLHours) * time.Hour
+	if ttl <= 0 {
+		ttl = defaultInvitationTTL
+	}
+	return &InvitationService{
+		rbacService: NewRBACService(),
+		mailer:      mailer,
+		signer:      invitationSigner{key: key},
+		ttl:         ttl,
+		acceptURL:   cfg.Invitations.AcceptURL,
+		now:         time.Now,
+	}
+}
+
+// Enabled reports whether a signing key is configured for invitation tokens.
+func (s *InvitationService) Enabled() bool {
+	return len(s.signer.key) > 0
+}
+
+// requireEnabled rejects issuing and accepting invitation tokens without a signing key.
+func (s *InvitationService) requireEnabled() error {
+	if !s.Enabled() {
+		return NotFound("invitations are not enabled on this server")
+	}
+	return nil
+}
+
+// scanInvitation scans a row selected with the invitation column list, plus extra destinations.
+func scanInvitation(row pgx.Row, extra ...any) (*models.Invitation, error) {
+	var inv models.Invitation
+	dest := []any{
+		&inv.InvitationID, &inv.Email, &inv.RoleID, &inv.ScopeType, &inv.ScopeID, &inv.InvitedBy,
+		&inv.Status, &inv.ExpiresAt, &inv.SentCount, &inv.LastSentAt,
+		&inv.AcceptedBy, &inv.AcceptedAt, &inv.RevokedBy, &inv.RevokedAt, &inv.CreatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// Invite creates a pending invitation and emails it. Requires manage_access on the scope.
+func (s *InvitationService) Invite(ctx context.Context, inviterID, scopeType, scopeID string, req models.CreateInvitationRequest) (*models.Invitation, error) {
+	if err := s.requireEnabled(); err != nil {
+		return nil, err
+	}
+	if err := s.rbacService.requireManageAccess(ctx, inviterID, scopeType, scopeID); err != nil {
+		return nil, err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	invitationID := uuid.New().String()
+	expires := s.now().UTC().Add(s.ttl)
+	token, err := s.signer.sign(invitationID, expires)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	inv, err := scanInvitation(tx.QueryRow(ctx, db.CreateInvitationQuery,
+		invitationID, email, req.RoleID, scopeType, scopeID, inviterID, hashToken(token), expires))
+	if isUniqueViolation(err) {
+		return nil, Conflict("%s already has a pending invitation for this role", email)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	err = recordAuditEvent(ctx, tx, AuditInvitationCreated, inviterID, email, scopeType, scopeID, map[string]any{
+		"invitation_id": inv.InvitationID,
+		"role_id":       inv.RoleID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit invitation: %w", err)
+	}
+
+	if err := s.send(ctx, inv, token); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// ListInvitations lists invitations on a scope, optionally filtered by status.
+// Requires manage_access on the scope.
+func (s *InvitationService) ListInvitations(ctx context.Context, userID, scopeType, scopeID, status string) ([]models.Invitation, error) {
+	if err := s.rbacService.requireManageAccess(ctx, userID, scopeType, scopeID); err != nil {
+		return nil, err
+	}
+
+	pool := db.GetDB()
+	rows, err := pool.Query(ctx, db.ListInvitationsForScopeQuery, scopeType, scopeID, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := make([]models.Invitation, 0)
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invitation: %w", err)
+		}
+		invitations = append(invitations, *inv)
+	}
+	return invitations, rows.Err()
+}
+
+// ResendInvitation issues a new token for a pending invitation, extends its expiry and
+// emails it again. The previous link stops working. Requires manage_access on the scope.
+func (s *InvitationService) ResendInvitation(ctx context.Context, userID, scopeType, scopeID, invitationID string) (*models.Invitation, error) {
+	if err := s.requireEnabled(); err != nil {
+		return nil, err
+	}
+	if err := s.rbacService.requireManageAccess(ctx, userID, scopeType, scopeID); err != nil {
+		return nil, err
+	}
+
+	expires := s.now().UTC().Add(s.ttl)
+	token, err := s.signer.sign(invitationID, expires)
+	if err != nil {
+		return nil, err
+	}
+
+	inv, err := s.updatePending(ctx, scopeType, scopeID, invitationID, AuditInvitationResent, userID,
+		db.ResendInvitationQuery, hashToken(token), expires)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.send(ctx, inv, token); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// RevokeInvitation revokes a pending invitation. Requires manage_access on the scope.
+func (s *InvitationService) RevokeInvitation(ctx context.Context, userID, scopeType, scopeID, invitationID string) (*models.Invitation, error) {
+	if err := s.rbacService.requireManageAccess(ctx, userID, scopeType, scopeID); err != nil {
+		return nil, err
+	}
+	return s.updatePending(ctx, scopeType, scopeID, invitationID, AuditInvitationRevoked, userID,
+		db.RevokeInvitationQuery, userID)
+}
+
+// updatePending applies query to a pending invitation on the given scope and records an audit event.
+func (s *InvitationService) updatePending(ctx context.Context, scopeType, scopeID, invitationID, eventType, actorID, query string, args ...any) (*models.Invitation, error) {
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	current, err := scanInvitation(tx.QueryRow(ctx, db.LockInvitationQuery, invitationID), new(string))
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && (current.ScopeType != scopeType || current.ScopeID != scopeID)) {
+		return nil, NotFound("invitation %s not found", invitationID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+	if current.Status != models.InvitationPending {
+		return nil, Conflict("invitation %s is already %s", invitationID, current.Status)
+	}
+
+	inv, err := scanInvitation(tx.QueryRow(ctx, query, append([]any{invitationID}, args...)...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update invitation: %w", err)
+	}
+
+	err = recordAuditEvent(ctx, tx, eventType, actorID, inv.Email, inv.ScopeType, inv.ScopeID, map[string]any{
+		"invitation_id": inv.InvitationID,
+		"role_id":       inv.RoleID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit invitation update: %w", err)
+	}
+	return inv, nil
+}
+
+// AcceptInvitation grants the invited role to userID. The token must be the latest one
+// issued for a pending, unexpired invitation; it cannot be used again.
+func (s *InvitationService) AcceptInvitation(ctx context.Context, userID, token string) (*models.Invitation, error) {
+	if err := s.requireEnabled(); err != nil {
+		return nil, err
+	}
+	invitationID, err := s.signer.verify(token, s.now())
+	if err != nil {
+		return nil, Wrap(ErrValidation, err, "Invalid or expired invitation")
+	}
+
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var tokenHash string
+	current, err := scanInvitation(tx.QueryRow(ctx, db.LockInvitationQuery, invitationID), &tokenHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, Validation("Invalid or expired invitation")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(tokenHash), []byte(hashToken(token))) != 1 ||
+		!s.now().Before(current.ExpiresAt) {
+		return nil, Validation("Invalid or expired invitation")
+	}
+	if current.Status != models.InvitationPending {
+		return nil, Conflict("invitation has already been %s", current.Status)
+	}
+
+	err = s.rbacService.assignRoleInTx(ctx, tx, userID, current.RoleID, current.ScopeType, current.ScopeID, current.InvitedBy, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	inv, err := scanInvitation(tx.QueryRow(ctx, db.AcceptInvitationQuery, invitationID, userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept invitation: %w", err)
+	}
+
+	err = recordAuditEvent(ctx, tx, AuditInvitationAccepted, userID, userID, inv.ScopeType, inv.ScopeID, map[string]any{
+		"invitation_id": inv.InvitationID,
+		"role_id":       inv.RoleID,
+		"email":         inv.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit invitation acceptance: %w", err)
+	}
+	InvalidateUserPermissions(ctx, userID)
+	return inv, nil
+}
+
+// send emails the invitation link. The invitation is already stored, so on failure
+// it stays pending and can be resent.
+func (s *InvitationService) send(ctx context.Context, inv *models.Invitation, token string) error {
+	err := s.mailer.Send(ctx, invitationMessage(inv, s.acceptLink(token)))
+	if err != nil {
+		return Upstream(err, "Invitation created, but the email could not be sent. Try resending it.")
+	}
+	return nil
+}
+
+// acceptLink returns the frontend URL that accepts token, or the bare token
+// when no accept URL is configured.
+func (s *InvitationService) acceptLink(token string) string {
+	if s.acceptURL == "" {
+		return token
+	}
+	u, err := url.Parse(s.acceptURL)
+	if err != nil {
+		return token
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// invitationMessage renders the invitation email.
+func invitationMessage(inv *models.Invitation, link string) mail.Message {
+	return mail.Message{
+		To:      inv.Email,
+		Subject: fmt.Sprintf("You have been invited to a Konnektr %s", inv.ScopeType),
+		Body: fmt.Sprintf("You have been invited to join the %s %q on Konnektr.\n\n"+
+			"Accept the invitation:\n%s\n\n"+
+			"This invitation expires on %s. If you did not expect it, you can ignore this email.\n",
+			inv.ScopeType, inv.ScopeID, link, inv.ExpiresAt.UTC().Format("2 January 2006 15:04 MST")),
+	}
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ktrlplane/internal/config"
+	"ktrlplane/internal/mail"
+	"ktrlplane/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewInvitationService_Defaults(t *testing.T) {
+	svc := NewInvitationService(&config.Config{Invitations: config.InvitationsConfig{SigningKey: "k"}}, mail.LogMailer{})
+	assert.True(t, svc.Enabled())
+	assert.Equal(t, defaultInvitationTTL, svc.ttl)
+
+	svc = NewInvitationService(&config.Config{Invitations: config.InvitationsConfig{SigningKey: "k", TTLHours: 24}}, mail.LogMailer{})
+	assert.Equal(t, 24*time.Hour, svc.ttl)
+	assert.Equal(t, []byte("k"), svc.signer.key)
+}
+
+func TestInvitationService_AcceptLink(t *testing.T) {
+	svc := &InvitationService{acceptURL: "https://app.example.com/invitations/accept?source=email"}
+	assert.Equal(t, "https://app.example.com/invitations/accept?source=email&token=a.b%2Fc", svc.acceptLink("a.b/c"))
+
+	svc = &InvitationService{}
+	assert.Equal(t, "tok", svc.acceptLink("tok"), "the bare token is sent when no accept URL is configured")
+}
+
+func TestInvitationMessage(t *testing.T) {
+	msg := invitationMessage(&models.Invitation{
+		Email:     "alice@example.com",
+		ScopeType: "project",
+		ScopeID:   "graph-prod",
+		ExpiresAt: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+	}, "https://app.example.com/accept?token=t")
+
+	assert.Equal(t, "alice@example.com", msg.To)
+	assert.Equal(t, "You have been invited to a Konnektr project", msg.Subject)
+	assert.Contains(t, msg.Body, `the project "graph-prod"`)
+	assert.Contains(t, msg.Body, "https://app.example.com/accept?token=t")
+	assert.Contains(t, msg.Body, "1 March 2025 12:00 UTC")
+}
+
+func TestInvitationService_DisabledWithoutSigningKey(t *testing.T) {
+	svc := NewInvitationService(&config.Config{}, mail.LogMailer{})
+	assert.False(t, svc.Enabled())
+
+	_, err := svc.Invite(context.Background(), "u1", "organization", "org-1", models.CreateInvitationRequest{Email: "a@example.com", RoleID: "role-viewer"})
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = svc.ResendInvitation(context.Background(), "u1", "organization", "org-1", "inv-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = svc.AcceptInvitation(context.Background(), "u2", "token")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
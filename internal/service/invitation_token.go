@@ -0,0 +1,70 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errInvalidInvitationToken is returned for malformed, forged or expired tokens.
+// Callers report every case the same way so that tokens cannot be probed.
+var errInvalidInvitationToken = errors.New("invalid or expired invitation token")
+
+// invitationSigner issues and verifies invitation tokens of the form
+// "<invitation id>.<expiry unix>.<nonce>.<signature>", signed with HMAC-SHA256.
+// The signature lets forged tokens be rejected without a database lookup; the
+// stored token hash makes each token single-use and lets a resend revoke the old one.
+type invitationSigner struct {
+	key []byte
+}
+
+// sign returns a new token for an invitation expiring at expires.
+func (s invitationSigner) sign(invitationID string, expires time.Time) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate invitation nonce: %w", err)
+	}
+	payload := invitationID + "." + strconv.FormatInt(expires.Unix(), 10) + "." + base64.RawURLEncoding.EncodeToString(nonce)
+	return payload + "." + s.signature(payload), nil
+}
+
+// verify checks the signature and expiry of token and returns its invitation ID.
+func (s invitationSigner) verify(token string, now time.Time) (string, error) {
+	i := strings.LastIndex(token, ".")
+	if i < 0 {
+		return "", errInvalidInvitationToken
+	}
+	payload, signature := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(s.signature(payload))) {
+		return "", errInvalidInvitationToken
+	}
+
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 {
+		return "", errInvalidInvitationToken
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || !now.Before(time.Unix(expires, 0)) {
+		return "", errInvalidInvitationToken
+	}
+	return parts[0], nil
+}
+
+func (s invitationSigner) signature(payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// hashToken returns the hex SHA-256 of a token, as stored in the database.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
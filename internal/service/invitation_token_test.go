@@ -0,0 +1,49 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvitationSigner_RoundTrip(t *testing.T) {
+	signer := invitationSigner{key: []byte("secret")}
+	now := time.Now()
+
+	token, err := signer.sign("inv-1", now.Add(time.Hour))
+	require.NoError(t, err)
+
+	id, err := signer.verify(token, now)
+	require.NoError(t, err)
+	assert.Equal(t, "inv-1", id)
+
+	other, err := signer.sign("inv-1", now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other, "each token has its own nonce")
+	assert.NotEqual(t, hashToken(token), hashToken(other))
+}
+
+func TestInvitationSigner_Rejects(t *testing.T) {
+	signer := invitationSigner{key: []byte("secret")}
+	now := time.Now()
+	token, err := signer.sign("inv-1", now.Add(time.Hour))
+	require.NoError(t, err)
+
+	_, err = signer.verify(token, now.Add(2*time.Hour))
+	assert.ErrorIs(t, err, errInvalidInvitationToken, "expired")
+
+	_, err = invitationSigner{key: []byte("other")}.verify(token, now)
+	assert.ErrorIs(t, err, errInvalidInvitationToken, "wrong key")
+
+	tampered := strings.Replace(token, "inv-1", "inv-2", 1)
+	_, err = signer.verify(tampered, now)
+	assert.ErrorIs(t, err, errInvalidInvitationToken, "tampered payload")
+
+	for _, malformed := range []string{"", "abc", "a.b", "a.b.c.d.e"} {
+		_, err = signer.verify(malformed, now)
+		assert.ErrorIs(t, err, errInvalidInvitationToken, malformed)
+	}
+}
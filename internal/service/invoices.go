@@ -0,0 +1,417 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"ktrlplane/internal/db"
+	"ktrlplane/internal/models"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stripe/stripe-go/v84"
+	"github.com/stripe/stripe-go/v84/creditnote"
+	"github.com/stripe/stripe-go/v84/invoice"
+	"github.com/stripe/stripe-go/v84/subscriptionitem"
+)
+
+const (
+	// DefaultInvoicePageSize is the number of invoices listed per page unless requested otherwise.
+	DefaultInvoicePageSize = 20
+	// maxInvoicePageSize is Stripe's largest page size.
+	maxInvoicePageSize = 100
+	// maxInvoiceExportRange is the longest period an invoice line export covers.
+	maxInvoiceExportRange = 366 * 24 * time.Hour
+)
+
+// invoiceLinesCSVHeader is the header row of an invoice line export. project_estimated is
+// true for rows split by the current shares of their subscription item.
+var invoiceLinesCSVHeader = []string{
+	"invoice_id", "invoice_number", "invoice_date", "invoice_status", "currency",
+	"line_id", "description", "resource_type", "sku", "period_start", "period_end",
+	"project_id", "quantity", "amount", "project_estimated",
+}
+
+// invoiceAccount returns the billing account whose invoices belong to a scope: the account
+// paying for it. Invoices exist only once the account has a Stripe customer.
+func (s *BillingService) invoiceAccount(ctx context.Context, scopeType, scopeID string) (*models.BillingAccount, bool, error) {
+	scopeType, scopeID, err := s.ResolveBillingScope(ctx, scopeType, scopeID)
+	if err != nil {
+		return nil, false, err
+	}
+	account, err := s.GetBillingAccount(ctx, scopeType, scopeID)
+	if err != nil {
+		return nil, false, err
+	}
+	return account, account.StripeCustomerID != nil && *account.StripeCustomerID != "", nil
+}
+
+// ListInvoices returns a page of the invoices of the billing account paying for a scope,
+// newest first, starting after the invoice startingAfter when it is set.
+func (s *BillingService) ListInvoices(ctx context.Context, scopeType, scopeID string, limit int64, startingAfter string) (*models.InvoiceList, error) {
+	if limit <= 0 {
+		limit = DefaultInvoicePageSize
+	}
+	if limit > maxInvoicePageSize {
+		return nil, Validation("limit must be at most %d", maxInvoicePageSize)
+	}
+	result := &models.InvoiceList{Invoices: []models.Invoice{}}
+	account, hasCustomer, err := s.invoiceAccount(ctx, scopeType, scopeID)
+	if err != nil || !hasCustomer {
+		return result, err
+	}
+
+	params := &stripe.InvoiceListParams{Customer: account.StripeCustomerID}
+	params.Context = ctx
+	params.Limit = stripe.Int64(limit)
+	params.Single = true
+	if startingAfter != "" {
+		params.StartingAfter = stripe.String(startingAfter)
+	}
+	iter := invoice.List(params)
+	for iter.Next() {
+		result.Invoices = append(result.Invoices, convertInvoice(iter.Invoice()))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, Upstream(err, "failed to list Stripe invoices")
+	}
+	if page := iter.InvoiceList(); page != nil && page.HasMore && len(result.Invoices) > 0 {
+		result.HasMore = true
+		result.NextCursor = result.Invoices[len(result.Invoices)-1].ID
+	}
+	return result, nil
+}
+
+// GetInvoice returns an invoice of the billing account paying for a scope with all its lines,
+// split across projects, and its credit notes.
+func (s *BillingService) GetInvoice(ctx context.Context, scopeType, scopeID, invoiceID string) (*models.Invoice, error) {
+	account, hasCustomer, err := s.invoiceAccount(ctx, scopeType, scopeID)
+	if err != nil {
+		return nil, err
+	}
+	if !hasCustomer {
+		return nil, NotFound("invoice not found: %s", invoiceID)
+	}
+
+	inv, err := invoice.Get(invoiceID, &stripe.InvoiceParams{Params: stripe.Params{Context: ctx}})
+	if isStripeNotFound(err) {
+		return nil, NotFound("invoice not found: %s", invoiceID)
+	}
+	if err != nil {
+		return nil, Upstream(err, "failed to fetch Stripe invoice")
+	}
+	if inv.Customer == nil || inv.Customer.ID != *account.StripeCustomerID {
+		return nil, NotFound("invoice not found: %s", invoiceID)
+	}
+
+	attribution, err := s.newLineAttribution(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	result := convertInvoice(inv)
+	result.Lines, err = attribution.invoiceLines(ctx, inv.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	params := &stripe.CreditNoteListParams{Invoice: stripe.String(inv.ID)}
+	params.Context = ctx
+	notes := creditnote.List(params)
+	for notes.Next() {
+		note := notes.CreditNote()
+		result.CreditNotes = append(result.CreditNotes, models.CreditNote{
+			ID:      note.ID,
+			Number:  note.Number,
+			Status:  string(note.Status),
+			Reason:  string(note.Reason),
+			Total:   note.Total,
+			Created: note.Created,
+			PDF:     note.PDF,
+		})
+	}
+	if err := notes.Err(); err != nil {
+		return nil, Upstream(err, "failed to list Stripe credit notes")
+	}
+	return &result, nil
+}
+
+// ExportInvoiceLines writes the lines of the invoices created in [from, to) as CSV, one row
+// per project share of a line. Amounts are in the smallest unit of the currency.
+func (s *BillingService) ExportInvoiceLines(ctx context.Context, scopeType, scopeID string, from, to time.Time, w io.Writer) error {
+	if !from.Before(to) {
+		return Validation("from must be before to")
+	}
+	if to.Sub(from) > maxInvoiceExportRange {
+		return Validation("invoice lines can be exported for at most one year at a time")
+	}
+	account, hasCustomer, err := s.invoiceAccount(ctx, scopeType, scopeID)
+	if err != nil {
+		return err
+	}
+
+	out := csv.NewWriter(w)
+	if err := out.Write(invoiceLinesCSVHeader); err != nil {
+		return err
+	}
+	if !hasCustomer {
+		out.Flush()
+		return out.Error()
+	}
+	attribution, err := s.newLineAttribution(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	params := &stripe.InvoiceListParams{
+		Customer:     account.StripeCustomerID,
+		CreatedRange: &stripe.RangeQueryParams{GreaterThanOrEqual: from.Unix(), LesserThan: to.Unix()},
+	}
+	params.Context = ctx
+	params.Limit = stripe.Int64(maxInvoicePageSize)
+	invoices := invoice.List(params)
+	for invoices.Next() {
+		inv := invoices.Invoice()
+		lines, err := attribution.invoiceLines(ctx, inv.ID)
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			for _, row := range invoiceLineRows(inv, line) {
+				if err := out.Write(row); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := invoices.Err(); err != nil {
+		return Upstream(err, "failed to list Stripe invoices")
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// invoiceLineRows renders the CSV rows of an invoice line: one per project share, or a single
+// row without a project for lines that are not attributed to projects.
+func invoiceLineRows(inv *stripe.Invoice, line models.InvoiceLine) [][]string {
+	row := func(projectID string, quantity, amount int64) []string {
+		return []string{
+			inv.ID, inv.Number, time.Unix(inv.Created, 0).UTC().Format(time.DateOnly), string(inv.Status), string(inv.Currency),
+			line.ID, line.Description, line.ResourceType, line.SKU,
+			time.Unix(line.PeriodStart, 0).UTC().Format(time.DateOnly), time.Unix(line.PeriodEnd, 0).UTC().Format(time.DateOnly),
+			projectID, strconv.FormatInt(quantity, 10), strconv.FormatInt(amount, 10),
+			strconv.FormatBool(line.ProjectsEstimated),
+		}
+	}
+	if len(line.Projects) == 0 {
+		return [][]string{row("", line.Quantity, line.Amount)}
+	}
+	rows := make([][]string, 0, len(line.Projects))
+	for _, share := range line.Projects {
+		rows = append(rows, row(share.ProjectID, share.Quantity, share.Amount))
+	}
+	return rows
+}
+
+// convertInvoice converts a Stripe invoice without its lines.
+func convertInvoice(inv *stripe.Invoice) models.Invoice {
+	var tax int64
+	for _, t := range inv.TotalTaxes {
+		tax += t.Amount
+	}
+	return models.Invoice{
+		ID:                inv.ID,
+		Number:            inv.Number,
+		Status:            string(inv.Status),
+		Currency:          string(inv.Currency),
+		Created:           inv.Created,
+		PeriodStart:       inv.PeriodStart,
+		PeriodEnd:         inv.PeriodEnd,
+		Subtotal:          inv.Subtotal,
+		Tax:               tax,
+		Total:             inv.Total,
+		AmountDue:         inv.AmountDue,
+		AmountPaid:        inv.AmountPaid,
+		AmountRemaining:   inv.AmountRemaining,
+		CreditNotesAmount: inv.PrePaymentCreditNotesAmount + inv.PostPaymentCreditNotesAmount,
+		HostedInvoiceURL:  inv.HostedInvoiceURL,
+		InvoicePDF:        inv.InvoicePDF,
+	}
+}
+
+// isStripeNotFound reports whether err is a Stripe "resource missing" error.
+func isStripeNotFound(err error) bool {
+	var stripeErr *stripe.Error
+	return errors.As(err, &stripeErr) && stripeErr.HTTPStatusCode == http.StatusNotFound
+}
+
+// lineAttribution maps invoice lines to resource types and projects.
+type lineAttribution struct {
+	products      map[string][2]string           // Stripe product ID -> resource type, SKU
+	projects      map[string]string              // Project metadata key -> project ID
+	itemSnapshots map[string][]itemShareSnapshot // Subscription item ID -> recorded shares
+	itemShares    map[string]map[string]int64    // Subscription item ID -> current shares
+}
+
+// newLineAttribution prepares the attribution of invoice lines of a billing account.
+func (s *BillingService) newLineAttribution(ctx context.Context, account *models.BillingAccount) (*lineAttribution, error) {
+	a := &lineAttribution{
+		products:      make(map[string][2]string),
+		projects:      make(map[string]string),
+		itemSnapshots: make(map[string][]itemShareSnapshot),
+		itemShares:    make(map[string]map[string]int64),
+	}
+	if s.config != nil {
+		for _, product := range s.config.Stripe.Products {
+			a.products[product.ProductID] = [2]string{product.ResourceType, product.SKU}
+		}
+	}
+	projectIDs, err := collectIDs(ctx, db.GetDB(), db.ListBilledProjectIDsQuery, account.ScopeType, account.ScopeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list billed projects: %w", err)
+	}
+	for _, projectID := range projectIDs {
+		a.projects[projectMetadataKey(projectID)] = projectID
+	}
+	return a, nil
+}
+
+// invoiceLines fetches and converts all lines of an invoice.
+func (a *lineAttribution) invoiceLines(ctx context.Context, invoiceID string) ([]models.InvoiceLine, error) {
+	params := &stripe.InvoiceListLinesParams{Invoice: stripe.String(invoiceID)}
+	params.Context = ctx
+	params.Limit = stripe.Int64(maxInvoicePageSize)
+	iter := invoice.ListLines(params)
+	lines := []models.InvoiceLine{}
+	for iter.Next() {
+		line, err := a.convertLine(ctx, iter.InvoiceLineItem())
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, Upstream(err, "failed to list Stripe invoice lines")
+	}
+	return lines, nil
+}
+
+// convertLine converts an invoice line, splitting lines for subscription items across the
+// projects that shared the item when the line's period started.
+func (a *lineAttribution) convertLine(ctx context.Context, item *stripe.InvoiceLineItem) (models.InvoiceLine, error) {
+	line := models.InvoiceLine{
+		ID:          item.ID,
+		Description: item.Description,
+		Quantity:    item.Quantity,
+		Amount:      item.Amount,
+	}
+	if item.Period != nil {
+		line.PeriodStart, line.PeriodEnd = item.Period.Start, item.Period.End
+	}
+	if item.Pricing != nil && item.Pricing.PriceDetails != nil {
+		line.PriceID = item.Pricing.PriceDetails.Price
+		if product, ok := a.products[item.Pricing.PriceDetails.Product]; ok {
+			line.ResourceType, line.SKU = product[0], product[1]
+		}
+	}
+	if item.Parent == nil || item.Parent.SubscriptionItemDetails == nil {
+		return line, nil
+	}
+	details := item.Parent.SubscriptionItemDetails
+	line.Proration = details.Proration
+	// A change of quantity credits the unused time of the shares it replaced
+	before := line.Proration && line.Amount < 0
+	shares, estimated, err := a.subscriptionItemShares(ctx, details.SubscriptionItem, line.PeriodStart, before)
+	if err != nil {
+		return line, err
+	}
+	line.Projects = splitLine(line.Quantity, line.Amount, shares)
+	line.ProjectsEstimated = estimated && len(line.Projects) > 0
+	return line, nil
+}
+
+// subscriptionItemShares returns how many of a subscription item's quantity belong to each
+// project at periodStart, or with before, just before it, from the snapshots recorded when
+// the item's shares changed. Without a snapshot, such as for items last changed before
+// snapshots were recorded, the shares come from the item's current metadata and are only an
+// estimate. Removed items without snapshots have no shares.
+func (a *lineAttribution) subscriptionItemShares(ctx context.Context, itemID string, periodStart int64, before bool) (map[string]int64, bool, error) {
+	if itemID == "" {
+		return nil, false, nil
+	}
+	snapshots, ok := a.itemSnapshots[itemID]
+	if !ok {
+		var err error
+		snapshots, err = loadItemShares(ctx, itemID)
+		if err != nil {
+			return nil, false, err
+		}
+		a.itemSnapshots[itemID] = snapshots
+	}
+	if shares, ok := sharesAt(snapshots, periodStart, before); ok {
+		return a.projectShares(shares), false, nil
+	}
+
+	if shares, ok := a.itemShares[itemID]; ok {
+		return shares, true, nil
+	}
+	item, err := subscriptionitem.Get(itemID, &stripe.SubscriptionItemParams{Params: stripe.Params{Context: ctx}})
+	if err != nil && !isStripeNotFound(err) {
+		return nil, false, Upstream(err, "failed to fetch Stripe subscription item")
+	}
+	shares := make(map[string]int64)
+	if item != nil {
+		shares = a.projectShares(metadataShares(item.Metadata))
+	}
+	a.itemShares[itemID] = shares
+	return shares, true, nil
+}
+
+// projectShares maps shares keyed by project metadata key to project IDs.
+func (a *lineAttribution) projectShares(keyShares map[string]int64) map[string]int64 {
+	shares := make(map[string]int64, len(keyShares))
+	for key, count := range keyShares {
+		projectID, ok := a.projects[key]
+		if !ok {
+			// A deleted project, or a project of another account
+			projectID = strings.TrimPrefix(key, projectMetadataPrefix)
+		}
+		shares[projectID] += count
+	}
+	return shares
+}
+
+// splitLine divides the quantity and amount of a line across projects in proportion to their
+// shares. The last project in ID order takes the rounding remainder, so the parts add up exactly.
+func splitLine(quantity, amount int64, shares map[string]int64) []models.InvoiceLineProject {
+	var total int64
+	projectIDs := make([]string, 0, len(shares))
+	for projectID, count := range shares {
+		total += count
+		projectIDs = append(projectIDs, projectID)
+	}
+	if total == 0 {
+		return nil
+	}
+	sort.Strings(projectIDs)
+
+	parts := make([]models.InvoiceLineProject, len(projectIDs))
+	var quantityLeft, amountLeft = quantity, amount
+	for i, projectID := range projectIDs {
+		part := models.InvoiceLineProject{ProjectID: projectID}
+		if i == len(projectIDs)-1 {
+			part.Quantity, part.Amount = quantityLeft, amountLeft
+		} else {
+			part.Quantity = quantity * shares[projectID] / total
+			part.Amount = amount * shares[projectID] / total
+		}
+		quantityLeft -= part.Quantity
+		amountLeft -= part.Amount
+		parts[i] = part
+	}
+	return parts
+}
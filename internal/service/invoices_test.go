@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"ktrlplane/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v84"
+)
+
+func TestSplitLine(t *testing.T) {
+	parts := splitLine(3, 1000, map[string]int64{"p2": 1, "p1": 2})
+	assert.Equal(t, []models.InvoiceLineProject{
+		{ProjectID: "p1", Quantity: 2, Amount: 666},
+		{ProjectID: "p2", Quantity: 1, Amount: 334},
+	}, parts, "the last project takes the remainder")
+
+	// Prorations may have a quantity that does not match the shares
+	parts = splitLine(1, -500, map[string]int64{"p1": 1, "p2": 1})
+	assert.Equal(t, int64(1), parts[0].Quantity+parts[1].Quantity)
+	assert.Equal(t, int64(-500), parts[0].Amount+parts[1].Amount)
+
+	assert.Nil(t, splitLine(3, 1000, nil))
+}
+
+func TestLineAttribution_ConvertLine(t *testing.T) {
+	fakeItemShares(t)
+	fs := newFakeStripe(t)
+	fs.handle("GET /v1/subscription_items/si_1", func(r *http.Request) (int, any) {
+		return http.StatusOK, map[string]any{
+			"id": "si_1", "object": "subscription_item", "quantity": 3,
+			"metadata": map[string]string{
+				projectMetadataKey("p1"): "2",
+				projectMetadataKey("p2"): "1",
+				"managed_by":             "ktrlplane",
+			},
+		}
+	})
+	fs.handle("GET /v1/subscription_items/si_gone", func(r *http.Request) (int, any) {
+		return http.StatusNotFound, map[string]any{"error": map[string]any{"type": "invalid_request_error", "code": "resource_missing"}}
+	})
+
+	a := &lineAttribution{
+		products:      map[string][2]string{"prod_graph": {"Konnektr.Graph", "standard"}},
+		projects:      map[string]string{projectMetadataKey("p1"): "p1"},
+		itemSnapshots: make(map[string][]itemShareSnapshot),
+		itemShares:    make(map[string]map[string]int64),
+	}
+	item := &stripe.InvoiceLineItem{
+		ID: "il_1", Description: "3 × Graph (standard)", Quantity: 3, Amount: 3000,
+		Period: &stripe.Period{Start: 1772323200, End: 1775001600},
+		Pricing: &stripe.InvoiceLineItemPricing{PriceDetails: &stripe.InvoiceLineItemPricingPriceDetails{
+			Price: "price_std", Product: "prod_graph",
+		}},
+		Parent: &stripe.InvoiceLineItemParent{SubscriptionItemDetails: &stripe.InvoiceLineItemParentSubscriptionItemDetails{
+			SubscriptionItem: "si_1",
+		}},
+	}
+
+	line, err := a.convertLine(context.Background(), item)
+	require.NoError(t, err)
+	assert.Equal(t, "Konnektr.Graph", line.ResourceType)
+	assert.Equal(t, "standard", line.SKU)
+	assert.Equal(t, "price_std", line.PriceID)
+	assert.Equal(t, []models.InvoiceLineProject{
+		{ProjectID: "p1", Quantity: 2, Amount: 2000},
+		{ProjectID: "p2", Quantity: 1, Amount: 1000},
+	}, line.Projects, "unknown keys fall back to the project ID in the key")
+	assert.True(t, line.ProjectsEstimated, "without snapshots the current shares are used")
+
+	// Subscription items are fetched once per export
+	_, err = a.convertLine(context.Background(), item)
+	require.NoError(t, err)
+	assert.Equal(t, 1, fs.count("GET /v1/subscription_items/si_1"))
+
+	// Lines of removed subscription items are not attributed
+	item.Parent.SubscriptionItemDetails.SubscriptionItem = "si_gone"
+	line, err = a.convertLine(context.Background(), item)
+	require.NoError(t, err)
+	assert.Empty(t, line.Projects)
+	assert.False(t, line.ProjectsEstimated)
+	assert.Equal(t, "Konnektr.Graph", line.ResourceType)
+}
+
+func TestLineAttribution_ConvertLine_UsesSharesOfThePeriod(t *testing.T) {
+	snapshots := fakeItemShares(t)
+	fs := newFakeStripe(t)
+	snapshots["si_1"] = []itemShareSnapshot{
+		{effectiveAt: 1772323200, shares: map[string]int64{projectMetadataKey("p1"): 2}},
+		{effectiveAt: 1773532800, shares: map[string]int64{projectMetadataKey("p1"): 2, projectMetadataKey("p2"): 1}},
+	}
+	a := &lineAttribution{
+		projects:      map[string]string{projectMetadataKey("p1"): "p1", projectMetadataKey("p2"): "p2"},
+		itemSnapshots: make(map[string][]itemShareSnapshot),
+		itemShares:    make(map[string]map[string]int64),
+	}
+	line := func(quantity, amount, start int64, proration bool) *stripe.InvoiceLineItem {
+		return &stripe.InvoiceLineItem{
+			ID: "il_1", Quantity: quantity, Amount: amount,
+			Period: &stripe.Period{Start: start, End: 1775001600},
+			Parent: &stripe.InvoiceLineItemParent{SubscriptionItemDetails: &stripe.InvoiceLineItemParentSubscriptionItemDetails{
+				SubscriptionItem: "si_1", Proration: proration,
+			}},
+		}
+	}
+
+	got, err := a.convertLine(context.Background(), line(2, 2000, 1772323200, false))
+	require.NoError(t, err)
+	assert.Equal(t, []models.InvoiceLineProject{{ProjectID: "p1", Quantity: 2, Amount: 2000}}, got.Projects,
+		"a project added later is not billed for the period")
+	assert.False(t, got.ProjectsEstimated)
+
+	got, err = a.convertLine(context.Background(), line(3, 1500, 1773532800, true))
+	require.NoError(t, err)
+	assert.Equal(t, []models.InvoiceLineProject{
+		{ProjectID: "p1", Quantity: 2, Amount: 1000},
+		{ProjectID: "p2", Quantity: 1, Amount: 500},
+	}, got.Projects)
+
+	got, err = a.convertLine(context.Background(), line(2, -1000, 1773532800, true))
+	require.NoError(t, err)
+	assert.Equal(t, []models.InvoiceLineProject{{ProjectID: "p1", Quantity: 2, Amount: -1000}}, got.Projects,
+		"unused time is credited to the shares the change replaced")
+	assert.Zero(t, fs.count("GET /v1/subscription_items/si_1"), "recorded shares need no Stripe lookup")
+}
+
+func TestInvoiceLineRows(t *testing.T) {
+	inv := &stripe.Invoice{ID: "in_1", Number: "KP-0001", Status: "paid", Currency: "eur", Created: 1775001600}
+	line := models.InvoiceLine{
+		ID: "il_1", Description: "Graph", ResourceType: "Konnektr.Graph", SKU: "standard",
+		Quantity: 3, Amount: 3000, PeriodStart: 1772323200, PeriodEnd: 1775001600,
+		Projects: []models.InvoiceLineProject{{ProjectID: "p1", Quantity: 2, Amount: 2000}, {ProjectID: "p2", Quantity: 1, Amount: 1000}},
+	}
+	rows := invoiceLineRows(inv, line)
+	require.Len(t, rows, 2)
+	assert.Len(t, rows[0], len(invoiceLinesCSVHeader))
+	assert.Equal(t, "in_1,KP-0001,2026-04-01,paid,eur,il_1,Graph,Konnektr.Graph,standard,2026-03-01,2026-04-01,p1,2,2000,false",
+		strings.Join(rows[0], ","))
+	assert.Equal(t, "p2", rows[1][11])
+
+	line.Projects = nil
+	rows = invoiceLineRows(inv, line)
+	require.Len(t, rows, 1)
+	assert.Equal(t, "", rows[0][11])
+	assert.Equal(t, "3000", rows[0][13])
+}
+
+func TestConvertInvoice(t *testing.T) {
+	inv := &stripe.Invoice{
+		ID: "in_1", Status: "open", Subtotal: 1000, Total: 1210, AmountDue: 1210,
+		TotalTaxes:                   []*stripe.InvoiceTotalTax{{Amount: 150}, {Amount: 60}},
+		PrePaymentCreditNotesAmount:  100,
+		PostPaymentCreditNotesAmount: 50,
+		InvoicePDF:                   "https://pay.stripe.com/invoice/in_1/pdf",
+	}
+	got := convertInvoice(inv)
+	assert.Equal(t, int64(210), got.Tax)
+	assert.Equal(t, int64(150), got.CreditNotesAmount)
+	assert.Equal(t, inv.InvoicePDF, got.InvoicePDF)
+	assert.Nil(t, got.Lines)
+}
+
+func TestInvoices_ValidateParameters(t *testing.T) {
+	s := NewBillingService(nil)
+	_, err := s.ListInvoices(context.Background(), "organization", "acme", maxInvoicePageSize+1, "")
+	assert.True(t, errors.Is(err, ErrValidation))
+
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	err = s.ExportInvoiceLines(context.Background(), "organization", "acme", from, from, &strings.Builder{})
+	assert.True(t, errors.Is(err, ErrValidation))
+	err = s.ExportInvoiceLines(context.Background(), "organization", "acme", from, from.AddDate(2, 0, 0), &strings.Builder{})
+	assert.True(t, errors.Is(err, ErrValidation))
+}
@@ -0,0 +1,429 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"ktrlplane/internal/config"
+	"ktrlplane/internal/db"
+	"ktrlplane/internal/models"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stripe/stripe-go/v84"
+	"github.com/stripe/stripe-go/v84/billing/meterevent"
+)
+
+const (
+	// meterResourcePlaceholder is replaced with the resource ID in meter queries.
+	meterResourcePlaceholder = "{{resource_id}}"
+	// meteringLookback is how far back hours without a usage record are still evaluated,
+	// which covers replicas being down for a while.
+	meteringLookback = 24 * time.Hour
+	// meteringSettleDelay is how long after the end of an hour its samples are assumed to
+	// be ingested by Mimir.
+	meteringSettleDelay = 5 * time.Minute
+	// meteringReportBatch is the number of usage records reported to Stripe per transaction.
+	meteringReportBatch = 100
+	// meteringMaxReportAttempts is how often reporting a usage record is tried.
+	meteringMaxReportAttempts = 10
+	// maxUsageWindow is the longest period a usage summary covers.
+	maxUsageWindow = 31 * 24 * time.Hour
+)
+
+// MeteringService evaluates usage of paid resources from Mimir metrics, stores it as hourly
+// usage records and reports it to Stripe billing meters.
+type MeteringService struct {
+	meters  []config.MeterConfig
+	mimir   *MimirClient // nil when Mimir is not configured
+	billing *BillingService
+	now     func() time.Time
+}
+
+// NewMeteringService creates a new MeteringService. Usage summaries are always available;
+// collecting usage requires metering to be enabled with a Mimir backend and valid meters.
+func NewMeteringService(cfg *config.Config, billing *BillingService) (*MeteringService, error) {
+	s := &MeteringService{billing: billing, now: time.Now}
+	if !cfg.Metering.Enabled {
+		return s, nil
+	}
+
+	mimirCfg := cfg.Observability.Mimir
+	if !mimirCfg.Enabled || mimirCfg.URL == "" {
+		return nil, fmt.Errorf("metering requires the Mimir backend to be enabled")
+	}
+	mimirURL, err := url.Parse(mimirCfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Mimir URL: %w", err)
+	}
+	names := make(map[string]bool, len(cfg.Metering.Meters))
+	for i, meter := range cfg.Metering.Meters {
+		if meter.Name == "" || meter.ResourceType == "" || meter.Query == "" || meter.EventName == "" {
+			return nil, fmt.Errorf("meter %d: name, resource_type, query and event_name are required", i)
+		}
+		if names[meter.Name] {
+			return nil, fmt.Errorf("meter %q is configured twice", meter.Name)
+		}
+		names[meter.Name] = true
+	}
+	s.meters = cfg.Metering.Meters
+	s.mimir = NewMimirClient(mimirURL)
+	return s, nil
+}
+
+// MeteringInterval returns how often usage is collected and reported.
+func MeteringInterval(cfg config.MeteringConfig) time.Duration {
+	if cfg.IntervalMinutes <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(cfg.IntervalMinutes) * time.Minute
+}
+
+// lastCompletedHour returns the start of the latest hour whose usage can be evaluated.
+func lastCompletedHour(now time.Time) time.Time {
+	return now.UTC().Add(-meteringSettleDelay).Truncate(time.Hour).Add(-time.Hour)
+}
+
+// pendingHours returns the hours from since through last, starting no earlier than the hour
+// the resource was created in, that have no usage record yet.
+func pendingHours(createdAt, since, last time.Time, recorded map[int64]bool) []time.Time {
+	start := createdAt.UTC().Truncate(time.Hour)
+	if start.Before(since) {
+		start = since
+	}
+	var hours []time.Time
+	for hour := start; !hour.After(last); hour = hour.Add(time.Hour) {
+		if !recorded[hour.Unix()] {
+			hours = append(hours, hour)
+		}
+	}
+	return hours
+}
+
+// evaluateUsage returns a resource's usage for the hour starting at hourStart. The query runs
+// in the project's tenant at the end of the hour.
+func (s *MeteringService) evaluateUsage(ctx context.Context, meter config.MeterConfig, resourceID, projectID string, hourStart time.Time) (float64, error) {
+	query := strings.ReplaceAll(meter.Query, meterResourcePlaceholder, resourceID)
+	return s.mimir.QueryScalar(ctx, projectID, query, hourStart.Add(time.Hour))
+}
+
+// meteredResource is a paid resource whose usage is metered.
+type meteredResource struct {
+	resourceID string
+	projectID  string
+	createdAt  time.Time
+}
+
+// CollectUsage evaluates every meter for the completed hours of the last day that have no
+// usage record yet, and stores the results. Each record captures the Stripe customer paying
+// for the project at that time. It returns the number of records stored.
+func (s *MeteringService) CollectUsage(ctx context.Context) (int, error) {
+	if s.mimir == nil {
+		return 0, fmt.Errorf("metering is not enabled")
+	}
+	last := lastCompletedHour(s.now())
+	since := last.Add(-meteringLookback)
+	customers := make(map[string]*string)
+
+	stored := 0
+	for _, meter := range s.meters {
+		resources, recorded, err := s.meterState(ctx, meter, since)
+		if err != nil {
+			return stored, err
+		}
+		for _, resource := range resources {
+			for _, hour := range pendingHours(resource.createdAt, since, last, recorded[resource.resourceID]) {
+				quantity, err := s.evaluateUsage(ctx, meter, resource.resourceID, resource.projectID, hour)
+				if err != nil {
+					// Later hours are retried on the next run
+					fmt.Printf("[MeteringService] Failed to evaluate %s for resource %s at %s: %v\n", meter.Name, resource.resourceID, hour.Format(time.RFC3339), err)
+					break
+				}
+				customerID, err := s.projectCustomer(ctx, customers, resource.projectID)
+				if err != nil {
+					return stored, err
+				}
+				tag, err := db.GetDB().Exec(ctx, db.InsertUsageRecordQuery,
+					resource.resourceID, meter.Name, hour, resource.projectID, quantity, meter.EventName, customerID)
+				if err != nil {
+					return stored, fmt.Errorf("failed to store usage record: %w", err)
+				}
+				stored += int(tag.RowsAffected())
+			}
+		}
+	}
+	return stored, nil
+}
+
+// meterState returns the resources a meter applies to and, per resource, the hours from
+// since on that already have a usage record.
+func (s *MeteringService) meterState(ctx context.Context, meter config.MeterConfig, since time.Time) ([]meteredResource, map[string]map[int64]bool, error) {
+	pool := db.GetDB()
+	rows, err := pool.Query(ctx, db.ListMeteredResourcesQuery, meter.ResourceType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list metered resources: %w", err)
+	}
+	var resources []meteredResource
+	for rows.Next() {
+		var resource meteredResource
+		if err := rows.Scan(&resource.resourceID, &resource.projectID, &resource.createdAt); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("failed to scan metered resource: %w", err)
+		}
+		resources = append(resources, resource)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to list metered resources: %w", err)
+	}
+
+	rows, err = pool.Query(ctx, db.ListRecordedUsageHoursQuery, meter.Name, since)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list usage records: %w", err)
+	}
+	defer rows.Close()
+	recorded := make(map[string]map[int64]bool)
+	for rows.Next() {
+		var resourceID string
+		var hour time.Time
+		if err := rows.Scan(&resourceID, &hour); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan usage record: %w", err)
+		}
+		if recorded[resourceID] == nil {
+			recorded[resourceID] = make(map[int64]bool)
+		}
+		recorded[resourceID][hour.Unix()] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to list usage records: %w", err)
+	}
+	return resources, recorded, nil
+}
+
+// projectCustomer returns the Stripe customer paying for a project, remembering it in cache.
+// A deleted project has no customer.
+func (s *MeteringService) projectCustomer(ctx context.Context, cache map[string]*string, projectID string) (*string, error) {
+	if customerID, ok := cache[projectID]; ok {
+		return customerID, nil
+	}
+	account, err := s.billing.ResolveProjectBillingAccount(ctx, projectID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	var customerID *string
+	if account != nil && account.StripeCustomerID != nil && *account.StripeCustomerID != "" {
+		customerID = account.StripeCustomerID
+	}
+	cache[projectID] = customerID
+	return customerID, nil
+}
+
+// pendingUsage is a usage record awaiting a report to Stripe.
+type pendingUsage struct {
+	resourceID string
+	meter      string
+	hourStart  time.Time
+	quantity   float64
+	eventName  string
+	customerID string
+}
+
+// meterEventIdentifier returns the Stripe meter event identifier of a usage record. It is
+// derived from the record's key, so retries and other replicas never report it twice.
+func meterEventIdentifier(meter, resourceID string, hourStart time.Time) string {
+	sum := sha256.Sum256([]byte(meter + "\x00" + resourceID + "\x00" + strconv.FormatInt(hourStart.Unix(), 10)))
+	return "usage_" + hex.EncodeToString(sum[:16])
+}
+
+// meterValue splits the quantity of a usage record plus the remainder carried from earlier
+// records into the whole units to report, since Stripe meter values are whole numbers, and
+// the fraction to carry to the next record.
+func meterValue(quantity, remainder float64) (int64, float64) {
+	total := quantity + remainder
+	// Tolerate the error of summing fractions such as 0.1
+	value := int64(math.Floor(total + 1e-9))
+	if value < 0 {
+		value = 0
+	}
+	return value, total - float64(value)
+}
+
+// reportUsage sends value units of a usage record to its Stripe billing meter. A zero value
+// is not sent.
+func (s *MeteringService) reportUsage(ctx context.Context, usage pendingUsage, value int64) error {
+	if value <= 0 {
+		return nil
+	}
+	identifier := meterEventIdentifier(usage.meter, usage.resourceID, usage.hourStart)
+	_, err := meterevent.New(&stripe.BillingMeterEventParams{
+		Params:     stripe.Params{Context: ctx, IdempotencyKey: stripe.String(identifier)},
+		EventName:  stripe.String(usage.eventName),
+		Identifier: stripe.String(identifier),
+		Timestamp:  stripe.Int64(usage.hourStart.Unix()),
+		Payload: map[string]string{
+			"stripe_customer_id": usage.customerID,
+			"value":              strconv.FormatInt(value, 10),
+		},
+	})
+	if err != nil {
+		return Upstream(err, "failed to report usage to Stripe")
+	}
+	return nil
+}
+
+// ReportUsage reports a batch of usage records to Stripe. Records are locked while they are
+// reported, so replicas report disjoint batches. The fraction of a unit left over by each
+// report is carried to the next record of the same resource and meter. It returns the number
+// of records reported.
+func (s *MeteringService) ReportUsage(ctx context.Context) (int, error) {
+	tx, err := db.GetDB().Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	rows, err := tx.Query(ctx, db.LockPendingUsageRecordsQuery, meteringReportBatch, meteringMaxReportAttempts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list pending usage records: %w", err)
+	}
+	var pending []pendingUsage
+	for rows.Next() {
+		var usage pendingUsage
+		if err := rows.Scan(&usage.resourceID, &usage.meter, &usage.hourStart, &usage.quantity, &usage.eventName, &usage.customerID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan pending usage record: %w", err)
+		}
+		pending = append(pending, usage)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to list pending usage records: %w", err)
+	}
+
+	reported := 0
+	for _, usage := range pending {
+		var remainder float64
+		if err := tx.QueryRow(ctx, db.LockUsageRemainderQuery, usage.resourceID, usage.meter).Scan(&remainder); err != nil {
+			return reported, fmt.Errorf("failed to get usage remainder: %w", err)
+		}
+		value, carried := meterValue(usage.quantity, remainder)
+		if err := s.reportUsage(ctx, usage, value); err != nil {
+			fmt.Printf("[MeteringService] Failed to report %s for resource %s at %s: %v\n", usage.meter, usage.resourceID, usage.hourStart.Format(time.RFC3339), err)
+			if _, err := tx.Exec(ctx, db.MarkUsageRecordFailedQuery, usage.resourceID, usage.meter, usage.hourStart, err.Error()); err != nil {
+				return reported, fmt.Errorf("failed to update usage record: %w", err)
+			}
+			continue
+		}
+		if _, err := tx.Exec(ctx, db.UpdateUsageRemainderQuery, usage.resourceID, usage.meter, carried); err != nil {
+			return reported, fmt.Errorf("failed to update usage remainder: %w", err)
+		}
+		if _, err := tx.Exec(ctx, db.MarkUsageRecordReportedQuery, usage.resourceID, usage.meter, usage.hourStart); err != nil {
+			return reported, fmt.Errorf("failed to update usage record: %w", err)
+		}
+		reported++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return reported, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return reported, nil
+}
+
+// StartMetering collects and reports usage every interval until ctx is done.
+// Running it on every replica is safe: usage records are unique per resource, meter and
+// hour, and each is reported by one replica under a stable identifier.
+func (s *MeteringService) StartMetering(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				stored, err := s.CollectUsage(ctx)
+				if err != nil {
+					fmt.Printf("[MeteringService] Failed to collect usage: %v\n", err)
+				} else if stored > 0 {
+					fmt.Printf("[MeteringService] Stored %d usage records\n", stored)
+				}
+				reported, err := s.ReportUsage(ctx)
+				if err != nil {
+					fmt.Printf("[MeteringService] Failed to report usage: %v\n", err)
+				} else if reported > 0 {
+					fmt.Printf("[MeteringService] Reported %d usage records to Stripe\n", reported)
+				}
+			}
+		}
+	}()
+}
+
+// usageWindow applies the defaults of a usage summary period: from the start of the current
+// month (UTC) until now.
+func usageWindow(from, to, now time.Time) (time.Time, time.Time, error) {
+	now = now.UTC()
+	if to.IsZero() {
+		to = now
+	}
+	if from.IsZero() {
+		from = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	from, to = from.UTC(), to.UTC()
+	if !from.Before(to) {
+		return from, to, Validation("from must be before to")
+	}
+	if to.Sub(from) > maxUsageWindow {
+		return from, to, Validation("usage can be listed for at most 31 days at a time")
+	}
+	return from, to, nil
+}
+
+// GetProjectUsage lists the hourly usage of a project's resources in [from, to), with a total
+// per resource and meter. Zero values select the current month.
+func (s *MeteringService) GetProjectUsage(ctx context.Context, projectID string, from, to time.Time) (*models.UsageSummary, error) {
+	from, to, err := usageWindow(from, to, s.now())
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.GetDB().Query(ctx, db.ListProjectUsageQuery, projectID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list usage records: %w", err)
+	}
+	defer rows.Close()
+
+	summary := &models.UsageSummary{From: from, To: to, Totals: []models.UsageTotal{}, Records: []models.UsageRecord{}}
+	for rows.Next() {
+		var record models.UsageRecord
+		var reportedAt *time.Time
+		if err := rows.Scan(&record.ResourceID, &record.Meter, &record.HourStart, &record.Quantity, &reportedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan usage record: %w", err)
+		}
+		record.Reported = reportedAt != nil
+		summary.Records = append(summary.Records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list usage records: %w", err)
+	}
+	summary.Totals = usageTotals(summary.Records)
+	return summary, nil
+}
+
+// usageTotals sums records ordered by resource and meter.
+func usageTotals(records []models.UsageRecord) []models.UsageTotal {
+	totals := []models.UsageTotal{}
+	for _, record := range records {
+		n := len(totals)
+		if n > 0 && totals[n-1].ResourceID == record.ResourceID && totals[n-1].Meter == record.Meter {
+			totals[n-1].Quantity += record.Quantity
+			continue
+		}
+		totals = append(totals, models.UsageTotal{ResourceID: record.ResourceID, Meter: record.Meter, Quantity: record.Quantity})
+	}
+	return totals
+}
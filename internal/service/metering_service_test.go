@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"ktrlplane/internal/config"
+	"ktrlplane/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMimir is an HTTP server standing in for Mimir's instant query API. It answers with
+// body and records the tenant, query and evaluation time of each request.
+type fakeMimir struct {
+	mu       sync.Mutex
+	status   int
+	body     string
+	requests []url.Values
+	tenants  []string
+}
+
+func newFakeMimir(t *testing.T, body string) (*fakeMimir, *MimirClient) {
+	t.Helper()
+	fm := &fakeMimir{status: http.StatusOK, body: body}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fm.mu.Lock()
+		defer fm.mu.Unlock()
+		if r.URL.Path != "/prometheus/api/v1/query" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fm.requests = append(fm.requests, r.URL.Query())
+		fm.tenants = append(fm.tenants, r.Header.Get("X-Scope-OrgID"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(fm.status)
+		_, _ = w.Write([]byte(fm.body))
+	}))
+	t.Cleanup(srv.Close)
+	baseURL, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	return fm, NewMimirClient(baseURL)
+}
+
+func TestMimirClient_QueryScalar(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want float64
+	}{
+		{"vector", `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"pod":"a"},"value":[1700000000,"12.5"]},
+			{"metric":{"pod":"b"},"value":[1700000000,"2.5"]}]}}`, 15},
+		{"empty vector", `{"status":"success","data":{"resultType":"vector","result":[]}}`, 0},
+		{"scalar", `{"status":"success","data":{"resultType":"scalar","result":[1700000000,"7"]}}`, 7},
+		{"NaN skipped", `{"status":"success","data":{"resultType":"vector","result":[{"value":[1700000000,"NaN"]}]}}`, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fm, client := newFakeMimir(t, tt.body)
+			ts := time.Date(2026, 3, 1, 11, 0, 0, 0, time.UTC)
+			got, err := client.QueryScalar(context.Background(), "proj-1", "up", ts)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			require.Len(t, fm.requests, 1)
+			assert.Equal(t, "proj-1", fm.tenants[0])
+			assert.Equal(t, "up", fm.requests[0].Get("query"))
+			assert.Equal(t, "1772362800", fm.requests[0].Get("time"))
+		})
+	}
+}
+
+func TestMimirClient_QueryErrors(t *testing.T) {
+	fm, client := newFakeMimir(t, `{"status":"error","errorType":"bad_data","error":"parse error"}`)
+	fm.status = http.StatusBadRequest
+	_, err := client.QueryScalar(context.Background(), "proj-1", "sum(", time.Now())
+	assert.True(t, errors.Is(err, ErrUpstream))
+
+	fm.body = `{"status":"success","data":{"resultType":"matrix","result":[]}}`
+	fm.status = http.StatusOK
+	_, err = client.QueryScalar(context.Background(), "proj-1", "up[1h]", time.Now())
+	assert.True(t, errors.Is(err, ErrUpstream), "range results are not usage")
+}
+
+func TestMeteringService_EvaluateUsage(t *testing.T) {
+	fm, client := newFakeMimir(t, `{"status":"success","data":{"resultType":"vector","result":[{"value":[0,"42"]}]}}`)
+	s := &MeteringService{mimir: client}
+	meter := config.MeterConfig{
+		Name:  "flow_events",
+		Query: `sum(increase(flow_events_total{resource_id="{{resource_id}}"}[1h]))`,
+	}
+	hour := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	got, err := s.evaluateUsage(context.Background(), meter, "flow-1", "proj-1", hour)
+	require.NoError(t, err)
+	assert.Equal(t, 42.0, got)
+	assert.Equal(t, `sum(increase(flow_events_total{resource_id="flow-1"}[1h]))`, fm.requests[0].Get("query"))
+	assert.Equal(t, "1772362800", fm.requests[0].Get("time"), "evaluated at the end of the hour")
+	assert.Equal(t, "proj-1", fm.tenants[0], "queries run in the project tenant")
+}
+
+func TestMeteringService_ReportUsage(t *testing.T) {
+	fs := newFakeStripe(t)
+	var forms []url.Values
+	var keys []string
+	fs.handle("POST /v1/billing/meter_events", func(r *http.Request) (int, any) {
+		_ = r.ParseForm()
+		forms = append(forms, r.PostForm)
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		return http.StatusOK, map[string]any{"object": "billing.meter_event", "event_name": r.PostForm.Get("event_name")}
+	})
+
+	s := &MeteringService{}
+	hour := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	usage := pendingUsage{resourceID: "flow-1", meter: "flow_events", hourStart: hour, quantity: 41.6, eventName: "flow_events", customerID: "cus_1"}
+	require.NoError(t, s.reportUsage(context.Background(), usage, 42))
+	require.NoError(t, s.reportUsage(context.Background(), usage, 42))
+
+	require.Len(t, forms, 2)
+	form := forms[0]
+	assert.Equal(t, "flow_events", form.Get("event_name"))
+	assert.Equal(t, "cus_1", form.Get("payload[stripe_customer_id]"))
+	assert.Equal(t, "42", form.Get("payload[value]"))
+	assert.Equal(t, "1772359200", form.Get("timestamp"))
+	identifier := meterEventIdentifier("flow_events", "flow-1", hour)
+	assert.Equal(t, identifier, form.Get("identifier"))
+	assert.Equal(t, []string{identifier, identifier}, keys, "retries reuse the idempotency key")
+	assert.Equal(t, identifier, forms[1].Get("identifier"))
+
+	require.NoError(t, s.reportUsage(context.Background(), usage, 0))
+	assert.Equal(t, 2, fs.count("POST /v1/billing/meter_events"), "zero usage is not sent")
+}
+
+func TestMeterValue(t *testing.T) {
+	value, carried := meterValue(41.6, 0)
+	assert.Equal(t, int64(41), value)
+	assert.InDelta(t, 0.6, carried, 1e-9)
+
+	value, carried = meterValue(41.6, carried)
+	assert.Equal(t, int64(42), value, "the carried fraction adds up to a unit")
+	assert.InDelta(t, 0.2, carried, 1e-9)
+
+	// Sub-unit usage is reported once it adds up to a unit
+	var total int64
+	carried = 0
+	for range 10 {
+		value, carried = meterValue(0.1, carried)
+		total += value
+	}
+	assert.Equal(t, int64(1), total)
+	assert.InDelta(t, 0, carried, 1e-9)
+}
+
+func TestMeteringService_ReportUsageFailure(t *testing.T) {
+	fs := newFakeStripe(t)
+	fs.handle("POST /v1/billing/meter_events", func(r *http.Request) (int, any) {
+		return http.StatusBadRequest, map[string]any{"error": map[string]any{"type": "invalid_request_error", "message": "no meter"}}
+	})
+	s := &MeteringService{}
+	err := s.reportUsage(context.Background(), pendingUsage{meter: "m", eventName: "missing", quantity: 3, customerID: "cus_1"}, 3)
+	assert.True(t, errors.Is(err, ErrUpstream))
+}
+
+func TestMeterEventIdentifier(t *testing.T) {
+	hour := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	id := meterEventIdentifier("flow_events", "flow-1", hour)
+	assert.LessOrEqual(t, len(id), 100)
+	assert.Equal(t, id, meterEventIdentifier("flow_events", "flow-1", hour.In(time.FixedZone("CET", 3600))))
+	assert.NotEqual(t, id, meterEventIdentifier("flow_events", "flow-1", hour.Add(time.Hour)))
+	assert.NotEqual(t, id, meterEventIdentifier("flow_events", "flow-2", hour))
+	assert.NotEqual(t, id, meterEventIdentifier("graph_storage", "flow-1", hour))
+}
+
+func TestPendingHours(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 3, 0, 0, time.UTC)
+	last := lastCompletedHour(now)
+	assert.Equal(t, time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC), last, "the last hour is still settling")
+	since := last.Add(-meteringLookback)
+
+	createdAt := time.Date(2026, 3, 2, 7, 30, 0, 0, time.UTC)
+	recorded := map[int64]bool{time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC).Unix(): true}
+	assert.Equal(t, []time.Time{
+		time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC),
+		time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC),
+		time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC),
+	}, pendingHours(createdAt, since, last, recorded))
+
+	old := pendingHours(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), since, last, nil)
+	assert.Len(t, old, 25)
+	assert.Equal(t, since, old[0], "older hours are not backfilled")
+}
+
+func TestUsageWindow(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	from, to, err := usageWindow(time.Time{}, time.Time{}, now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, now, to)
+
+	_, _, err = usageWindow(now, now.Add(-time.Hour), now)
+	assert.True(t, errors.Is(err, ErrValidation))
+	_, _, err = usageWindow(now.Add(-32*24*time.Hour), now, now)
+	assert.True(t, errors.Is(err, ErrValidation))
+}
+
+func TestUsageTotals(t *testing.T) {
+	records := []models.UsageRecord{
+		{ResourceID: "a", Meter: "events", Quantity: 1},
+		{ResourceID: "a", Meter: "events", Quantity: 2},
+		{ResourceID: "a", Meter: "storage", Quantity: 5},
+		{ResourceID: "b", Meter: "events", Quantity: 4},
+	}
+	assert.Equal(t, []models.UsageTotal{
+		{ResourceID: "a", Meter: "events", Quantity: 3},
+		{ResourceID: "a", Meter: "storage", Quantity: 5},
+		{ResourceID: "b", Meter: "events", Quantity: 4},
+	}, usageTotals(records))
+	assert.Empty(t, usageTotals(nil))
+}
+
+func TestNewMeteringService_Validates(t *testing.T) {
+	cfg := &config.Config{}
+	s, err := NewMeteringService(cfg, nil)
+	require.NoError(t, err, "disabled metering needs no configuration")
+	_, err = s.CollectUsage(context.Background())
+	assert.Error(t, err)
+
+	cfg.Metering.Enabled = true
+	_, err = NewMeteringService(cfg, nil)
+	assert.Error(t, err, "Mimir is required")
+
+	cfg.Observability.Mimir = config.MimirConfig{Enabled: true, URL: "http://mimir:9009"}
+	meter := config.MeterConfig{Name: "events", ResourceType: "Konnektr.Flow", Query: "up", EventName: "events"}
+	cfg.Metering.Meters = []config.MeterConfig{meter, meter}
+	_, err = NewMeteringService(cfg, nil)
+	assert.Error(t, err, "meter names are unique")
+
+	cfg.Metering.Meters = []config.MeterConfig{meter, {Name: "storage"}}
+	_, err = NewMeteringService(cfg, nil)
+	assert.Error(t, err, "meters are complete")
+
+	cfg.Metering.Meters = []config.MeterConfig{meter}
+	s, err = NewMeteringService(cfg, nil)
+	require.NoError(t, err)
+	assert.NotNil(t, s.mimir)
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"ktrlplane/internal/telemetry"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// MimirClient evaluates PromQL queries through Mimir's Prometheus-compatible API.
+type MimirClient struct {
+	baseURL *url.URL
+	client  *http.Client
+}
+
+// NewMimirClient creates a MimirClient for the Mimir server at baseURL.
+func NewMimirClient(baseURL *url.URL) *MimirClient {
+	return &MimirClient{
+		baseURL: baseURL,
+		client: &http.Client{
+			Transport: telemetry.Transport("mimir", nil, telemetry.PrometheusRoute),
+			Timeout:   30 * time.Second,
+		},
+	}
+}
+
+// mimirResponse is the envelope of a Prometheus instant query response.
+type mimirResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// QueryScalar evaluates an instant query at ts in the tenant's metrics and returns the sum of
+// the resulting samples. A query without samples, for example for a resource that reported no
+// metrics, evaluates to 0.
+func (c *MimirClient) QueryScalar(ctx context.Context, tenant, query string, ts time.Time) (float64, error) {
+	endpoint := c.baseURL.JoinPath("/prometheus/api/v1/query")
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("time", strconv.FormatInt(ts.Unix(), 10))
+	endpoint.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create Mimir request: %w", err)
+	}
+	req.Header.Set("X-Scope-OrgID", tenant)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, Upstream(err, "failed to query Mimir")
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, Upstream(err, "failed to read Mimir response")
+	}
+	var result mimirResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, Upstream(fmt.Errorf("status %d: %w", resp.StatusCode, err), "invalid Mimir response")
+	}
+	if result.Status != "success" {
+		return 0, Upstream(fmt.Errorf("%s: %s", result.ErrorType, result.Error), "Mimir query failed")
+	}
+	return sumSamples(result.Data.ResultType, result.Data.Result)
+}
+
+// sumSamples adds up the values of a scalar or vector query result. NaN samples are skipped.
+func sumSamples(resultType string, result json.RawMessage) (float64, error) {
+	var values [][2]any
+	switch resultType {
+	case "scalar":
+		var value [2]any
+		if err := json.Unmarshal(result, &value); err != nil {
+			return 0, Upstream(err, "invalid Mimir scalar result")
+		}
+		values = append(values, value)
+	case "vector":
+		var samples []struct {
+			Value [2]any `json:"value"`
+		}
+		if err := json.Unmarshal(result, &samples); err != nil {
+			return 0, Upstream(err, "invalid Mimir vector result")
+		}
+		for _, sample := range samples {
+			values = append(values, sample.Value)
+		}
+	default:
+		return 0, Upstream(errors.New(resultType), "unsupported Mimir result type")
+	}
+
+	var sum float64
+	for _, value := range values {
+		raw, ok := value[1].(string)
+		if !ok {
+			return 0, Upstream(fmt.Errorf("sample value %v", value[1]), "invalid Mimir sample")
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return 0, Upstream(err, "invalid Mimir sample")
+		}
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			sum += v
+		}
+	}
+	return sum, nil
+}
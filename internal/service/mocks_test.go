@@ -62,3 +62,27 @@ func (m *MockOrganizationService) DeleteOrganization(ctx context.Context, orgID,
 	args := m.Called(ctx, orgID, userID)
 	return args.Error(0)
 }
+
+// fakeRows answers QueryRow with fixed values per query; other queries find no rows.
+type fakeRows map[string][]any
+
+func (f fakeRows) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return nil, pgx.ErrNoRows
+}
+
+func (f fakeRows) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return fakeRow(f[sql])
+}
+
+// fakeRow scans fixed values into string destinations.
+type fakeRow []any
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r == nil {
+		return pgx.ErrNoRows
+	}
+	for i, d := range dest {
+		*d.(*string) = r[i].(string)
+	}
+	return nil
+}
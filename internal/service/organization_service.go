@@ -24,7 +24,7 @@ func NewOrganizationService() *OrganizationService {
 func (s *OrganizationService) CreateOrganization(ctx context.Context, req models.CreateOrganizationRequest, ownerUserID string) (*models.Organization, error) {
 	// Validate the provided ID
 	if err := utils.ValidateDNSID(req.ID); err != nil {
-		return nil, fmt.Errorf("invalid organization ID: %w", err)
+		return nil, Validation("invalid organization ID: %v", err)
 	}
 
 	pool := db.GetDB()
@@ -49,6 +49,9 @@ func (s *OrganizationService) CreateOrganization(ctx context.Context, req models
 	err = tx.QueryRow(ctx, db.CreateOrganization,
 		org.OrgID, org.Name).Scan(&org.CreatedAt, &org.UpdatedAt)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, Conflict("organization %s already exists", req.ID)
+		}
 		return nil, fmt.Errorf("failed to create organization: %w", err)
 	}
 
@@ -62,6 +65,7 @@ func (s *OrganizationService) CreateOrganization(ctx context.Context, req models
 	if err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	InvalidateUserPermissions(ctx, ownerUserID)
 
 	return org, nil
 }
@@ -85,7 +89,7 @@ func (s *OrganizationService) ListOrganizations(ctx context.Context, userID stri
 		organizations = append(organizations, org)
 	}
 
-	return organizations, nil
+	return filterByTokenScope(ctx, userID, "organization", organizations, func(org models.Organization) string { return org.OrgID })
 }
 
 // GetOrganization returns a specific organization if user has read access
@@ -96,7 +100,7 @@ func (s *OrganizationService) GetOrganization(ctx context.Context, orgID, userID
 		return nil, fmt.Errorf("failed to check permissions: %w", err)
 	}
 	if !hasPermission {
-		return nil, fmt.Errorf("insufficient permissions to view organization")
+		return nil, Forbidden("insufficient permissions to view organization")
 	}
 
 	// Get organization details
@@ -115,7 +119,7 @@ func (s *OrganizationService) GetOrganization(ctx context.Context, orgID, userID
 		return &org, nil
 	}
 
-	return nil, fmt.Errorf("organization not found")
+	return nil, NotFound("organization not found")
 }
 
 // UpdateOrganization updates an organization if user has write access
@@ -126,7 +130,7 @@ func (s *OrganizationService) UpdateOrganization(ctx context.Context, orgID, nam
 		return nil, fmt.Errorf("failed to check permissions: %w", err)
 	}
 	if !hasPermission {
-		return nil, fmt.Errorf("insufficient permissions to update organization")
+		return nil, Forbidden("insufficient permissions to update organization")
 	}
 
 	// Update organization
@@ -146,7 +150,17 @@ func (s *OrganizationService) DeleteOrganization(ctx context.Context, orgID, use
 		return fmt.Errorf("failed to check permissions: %w", err)
 	}
 	if !hasPermission {
-		return fmt.Errorf("insufficient permissions to delete organization")
+		return Forbidden("insufficient permissions to delete organization")
+	}
+
+	// Service accounts and teams are backed by users rows, which do not cascade
+	// with the organization.
+	if err := db.ExecQuery(ctx, db.DeleteServiceAccountsForOrganizationQuery, orgID); err != nil {
+		fmt.Printf("[OrganizationService] Failed to delete service accounts for organization %s: %v\n", orgID, err)
+	}
+	serviceAccounts.Clear()
+	if err := db.ExecQuery(ctx, db.DeleteTeamsForOrganizationQuery, orgID); err != nil {
+		fmt.Printf("[OrganizationService] Failed to delete teams for organization %s: %v\n", orgID, err)
 	}
 
 	// Delete organization (cascades to projects, resources, role assignments)
@@ -154,6 +168,7 @@ func (s *OrganizationService) DeleteOrganization(ctx context.Context, orgID, use
 	if err != nil {
 		return fmt.Errorf("failed to delete organization: %w", err)
 	}
+	ClearPermissionCache(ctx)
 
 	return nil
 }
@@ -0,0 +1,420 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ktrlplane/internal/config"
+	"ktrlplane/internal/db"
+	"ktrlplane/internal/mail"
+	"ktrlplane/internal/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stripe/stripe-go/v84"
+	"github.com/stripe/stripe-go/v84/customer"
+	"github.com/stripe/stripe-go/v84/subscription"
+)
+
+// Audit event types for payment enforcement.
+const (
+	AuditBillingPaymentIssue         = "billing.payment_issue"
+	AuditBillingResourcesSuspended   = "billing.resources_suspended"
+	AuditBillingResourcesReactivated = "billing.resources_reactivated"
+)
+
+// subscriptionHealth classifies a Stripe subscription status for payment enforcement.
+type subscriptionHealth int
+
+const (
+	// subscriptionPending is a subscription awaiting its first payment; nothing changes.
+	subscriptionPending subscriptionHealth = iota
+	subscriptionHealthy
+	subscriptionUnhealthy
+)
+
+// healthOf classifies a subscription status. Past due, unpaid, canceled, expired and paused
+// subscriptions no longer pay for the resources billed to them.
+func healthOf(status stripe.SubscriptionStatus) subscriptionHealth {
+	switch status {
+	case stripe.SubscriptionStatusActive, stripe.SubscriptionStatusTrialing:
+		return subscriptionHealthy
+	case stripe.SubscriptionStatusPastDue, stripe.SubscriptionStatusUnpaid, stripe.SubscriptionStatusCanceled,
+		stripe.SubscriptionStatusIncompleteExpired, stripe.SubscriptionStatusPaused:
+		return subscriptionUnhealthy
+	default:
+		return subscriptionPending
+	}
+}
+
+// PaymentGracePeriod returns how long a payment problem lasts before paid resources are suspended.
+func PaymentGracePeriod(cfg config.PaymentEnforcementConfig) time.Duration {
+	if cfg.GracePeriodHours <= 0 {
+		return 7 * 24 * time.Hour
+	}
+	return time.Duration(cfg.GracePeriodHours) * time.Hour
+}
+
+// PaymentEnforcementInterval returns how often subscriptions are checked.
+func PaymentEnforcementInterval(cfg config.PaymentEnforcementConfig) time.Duration {
+	if cfg.IntervalMinutes <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(cfg.IntervalMinutes) * time.Minute
+}
+
+// paymentEnforced reports whether payment enforcement is enabled.
+func (s *BillingService) paymentEnforced() bool {
+	return s.config != nil && s.config.PaymentEnforcement.Enabled
+}
+
+// paymentGracePeriod returns the configured grace period.
+func (s *BillingService) paymentGracePeriod() time.Duration {
+	if s.config == nil {
+		return PaymentGracePeriod(config.PaymentEnforcementConfig{})
+	}
+	return PaymentGracePeriod(s.config.PaymentEnforcement)
+}
+
+// requireHealthySubscription refuses to bill more paid resources to a subscription that is
+// not being paid, when payment enforcement is enabled.
+func (s *BillingService) requireHealthySubscription(sub *stripe.Subscription) error {
+	if s.paymentEnforced() && healthOf(sub.Status) == subscriptionUnhealthy {
+		return PaymentRequired("the subscription is %s; update the payment method before adding paid resources", sub.Status)
+	}
+	return nil
+}
+
+// enforcementState is the payment enforcement state of a billing account.
+type enforcementState struct {
+	subscriptionStatus *string
+	paymentIssueSince  *time.Time
+	suspendedAt        *time.Time
+}
+
+// enforcementAction is a transition applied to a billing account.
+type enforcementAction int
+
+const (
+	enforceNone enforcementAction = iota
+	enforceWarn
+	enforceSuspend
+	enforceReactivate
+)
+
+// nextEnforcement returns the state of a billing account after a check at now found its
+// subscription in the given health, and the action that takes it there. Healthy accounts always reactivate,
+// which also covers suspended projects that moved to a paying account.
+func nextEnforcement(state enforcementState, health subscriptionHealth, now time.Time, grace time.Duration) (enforcementState, enforcementAction) {
+	switch health {
+	case subscriptionHealthy:
+		state.paymentIssueSince, state.suspendedAt = nil, nil
+		return state, enforceReactivate
+	case subscriptionUnhealthy:
+		if state.paymentIssueSince == nil {
+			state.paymentIssueSince = &now
+			return state, enforceWarn
+		}
+		if state.suspendedAt == nil && !now.Before(state.paymentIssueSince.Add(grace)) {
+			state.suspendedAt = &now
+			return state, enforceSuspend
+		}
+	}
+	return state, enforceNone
+}
+
+// GetPaymentEnforcement returns the payment enforcement state of the billing account paying
+// for a scope.
+func (s *BillingService) GetPaymentEnforcement(ctx context.Context, scopeType, scopeID string) (*models.PaymentEnforcementStatus, error) {
+	scopeType, scopeID, err := s.ResolveBillingScope(ctx, scopeType, scopeID)
+	if err != nil {
+		return nil, err
+	}
+	var subscriptionID *string
+	var state enforcementState
+	err = db.GetDB().QueryRow(ctx, db.GetPaymentEnforcementQuery, scopeType, scopeID).
+		Scan(&subscriptionID, &state.subscriptionStatus, &state.paymentIssueSince, &state.suspendedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &models.PaymentEnforcementStatus{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment enforcement state: %w", err)
+	}
+	status := &models.PaymentEnforcementStatus{
+		SubscriptionStatus: state.subscriptionStatus,
+		PaymentIssueSince:  state.paymentIssueSince,
+		SuspendedAt:        state.suspendedAt,
+	}
+	if state.paymentIssueSince != nil && state.suspendedAt == nil {
+		suspendAt := state.paymentIssueSince.Add(s.paymentGracePeriod())
+		status.SuspendAt = &suspendAt
+	}
+	return status, nil
+}
+
+// PaymentEnforcementService suspends the paid resources of billing accounts whose subscription
+// is not being paid, and reactivates them once payment recovers.
+type PaymentEnforcementService struct {
+	mailer mail.Mailer
+	grace  time.Duration
+	now    func() time.Time
+}
+
+// NewPaymentEnforcementService creates a new PaymentEnforcementService.
+func NewPaymentEnforcementService(cfg *config.Config, mailer mail.Mailer) *PaymentEnforcementService {
+	return &PaymentEnforcementService{
+		mailer: mailer,
+		grace:  PaymentGracePeriod(cfg.PaymentEnforcement),
+		now:    time.Now,
+	}
+}
+
+// EnforcePayments checks the subscription of every billing account and applies the resulting
+// transitions. Accounts that fail are logged and retried on the next run. It returns the
+// number of accounts that changed.
+func (s *PaymentEnforcementService) EnforcePayments(ctx context.Context) (int, error) {
+	rows, err := db.GetDB().Query(ctx, db.ListEnforcedBillingAccountsQuery)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list billing accounts: %w", err)
+	}
+	var accounts []models.BillingAccount
+	for rows.Next() {
+		var account models.BillingAccount
+		if err := rows.Scan(&account.BillingAccountID, &account.ScopeType, &account.ScopeID, &account.StripeCustomerID,
+			&account.StripeSubscriptionID, &account.CreatedAt, &account.UpdatedAt, &account.Currency, &account.BillingInterval); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan billing account: %w", err)
+		}
+		accounts = append(accounts, account)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to list billing accounts: %w", err)
+	}
+
+	changed := 0
+	for i := range accounts {
+		account := &accounts[i]
+		ok, err := s.enforceAccount(ctx, account)
+		if err != nil {
+			fmt.Printf("[PaymentEnforcementService] Failed to enforce payment for %s %s: %v\n", account.ScopeType, account.ScopeID, err)
+			continue
+		}
+		if ok {
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+// enforceAccount checks the subscription of one billing account and applies the transition.
+// Billing contacts are notified after the transition commits. It reports whether the
+// account changed.
+func (s *PaymentEnforcementService) enforceAccount(ctx context.Context, account *models.BillingAccount) (bool, error) {
+	health := subscriptionHealthy
+	var status *string
+	if account.StripeSubscriptionID != nil {
+		sub, err := subscription.Get(*account.StripeSubscriptionID, &stripe.SubscriptionParams{Params: stripe.Params{Context: ctx}})
+		if err != nil {
+			return false, Upstream(err, "failed to fetch Stripe subscription")
+		}
+		health = healthOf(sub.Status)
+		status = stripe.String(string(sub.Status))
+	}
+
+	tx, err := db.GetDB().Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var subscriptionID *string
+	var state enforcementState
+	err = tx.QueryRow(ctx, db.LockPaymentEnforcementQuery, account.ScopeType, account.ScopeID).
+		Scan(&subscriptionID, &state.subscriptionStatus, &state.paymentIssueSince, &state.suspendedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to lock billing account: %w", err)
+	}
+	if !sameString(subscriptionID, account.StripeSubscriptionID) {
+		// The subscription was replaced since it was fetched; check again on the next run
+		return false, nil
+	}
+
+	now := s.now().UTC()
+	next, action := nextEnforcement(state, health, now, s.grace)
+	next.subscriptionStatus = status
+
+	var resourceIDs []string
+	var message *mail.Message
+	switch action {
+	case enforceWarn:
+		message = paymentIssueMessage(account, *status, now.Add(s.grace))
+		err = recordAuditEvent(ctx, tx, AuditBillingPaymentIssue, auditActorSystem, account.ScopeID, account.ScopeType, account.ScopeID,
+			map[string]any{"subscription_status": *status})
+	case enforceSuspend:
+		resourceIDs, err = collectIDs(ctx, tx, db.SuspendBilledResourcesQuery, account.ScopeType, account.ScopeID)
+		if err == nil {
+			message = resourcesSuspendedMessage(account, *status, len(resourceIDs))
+			err = recordAuditEvent(ctx, tx, AuditBillingResourcesSuspended, auditActorSystem, account.ScopeID, account.ScopeType, account.ScopeID,
+				map[string]any{"subscription_status": *status, "resource_ids": resourceIDs})
+		}
+	case enforceReactivate:
+		resourceIDs, err = collectIDs(ctx, tx, db.ReactivateBilledResourcesQuery, account.ScopeType, account.ScopeID)
+		if err == nil && (len(resourceIDs) > 0 || state.suspendedAt != nil) {
+			message = resourcesReactivatedMessage(account, len(resourceIDs))
+			err = recordAuditEvent(ctx, tx, AuditBillingResourcesReactivated, auditActorSystem, account.ScopeID, account.ScopeType, account.ScopeID,
+				map[string]any{"resource_ids": resourceIDs})
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if next.equal(state) && message == nil {
+		return false, nil
+	}
+	if !next.equal(state) {
+		_, err = tx.Exec(ctx, db.UpdatePaymentEnforcementQuery, account.ScopeType, account.ScopeID,
+			next.subscriptionStatus, next.paymentIssueSince, next.suspendedAt)
+		if err != nil {
+			return false, fmt.Errorf("failed to update payment enforcement state: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if message != nil {
+		s.notify(ctx, account, *message)
+	}
+	return true, nil
+}
+
+// equal reports whether two states hold the same values.
+func (e enforcementState) equal(other enforcementState) bool {
+	return sameString(e.subscriptionStatus, other.subscriptionStatus) &&
+		sameTime(e.paymentIssueSince, other.paymentIssueSince) &&
+		sameTime(e.suspendedAt, other.suspendedAt)
+}
+
+// sameString reports whether two optional strings are equal.
+func sameString(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// sameTime reports whether two optional times are equal.
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// collectIDs runs a statement returning one ID per row and collects them.
+func collectIDs(ctx context.Context, q querier, query string, args ...any) ([]string, error) {
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update resources: %w", err)
+	}
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan resource: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// billingContacts returns the email addresses notified about the billing of an account: the
+// billing contacts of its Stripe customer with the alerts role.
+func billingContacts(ctx context.Context, account *models.BillingAccount) ([]string, error) {
+	if account.StripeCustomerID == nil {
+		return nil, nil
+	}
+	cust, err := customer.Get(*account.StripeCustomerID, &stripe.CustomerParams{Params: stripe.Params{Context: ctx}})
+	if err != nil {
+		return nil, Upstream(err, "failed to fetch Stripe customer")
+	}
+	return contactsWithRole(customerContacts(cust), ContactRoleAlerts), nil
+}
+
+// notify emails msg to the billing contacts of an account. The transition it reports has
+// already been applied, so failures are only logged.
+func (s *PaymentEnforcementService) notify(ctx context.Context, account *models.BillingAccount, msg mail.Message) {
+	if s.mailer == nil {
+		return
+	}
+	contacts, err := billingContacts(ctx, account)
+	if err != nil {
+		fmt.Printf("[PaymentEnforcementService] Failed to get billing contacts for %s %s: %v\n", account.ScopeType, account.ScopeID, err)
+		return
+	}
+	for _, to := range contacts {
+		msg.To = to
+		if err := s.mailer.Send(ctx, msg); err != nil {
+			fmt.Printf("[PaymentEnforcementService] Failed to notify %s about %s %s: %v\n", to, account.ScopeType, account.ScopeID, err)
+		}
+	}
+}
+
+// StartPaymentEnforcement runs EnforcePayments every interval until ctx is done.
+// Running it on every replica is safe: transitions are applied under a row lock, once.
+func (s *PaymentEnforcementService) StartPaymentEnforcement(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				changed, err := s.EnforcePayments(ctx)
+				if err != nil {
+					fmt.Printf("[PaymentEnforcementService] Failed to enforce payments: %v\n", err)
+				} else if changed > 0 {
+					fmt.Printf("[PaymentEnforcementService] Updated payment enforcement for %d billing accounts\n", changed)
+				}
+			}
+		}
+	}()
+}
+
+// paymentIssueMessage renders the email sent when a subscription stops being paid.
+func paymentIssueMessage(account *models.BillingAccount, status string, suspendAt time.Time) *mail.Message {
+	return &mail.Message{
+		Subject: "Action required: payment problem with your Konnektr subscription",
+		Body: fmt.Sprintf("The Konnektr subscription of the %s %q is %s.\n\n"+
+			"New paid resources cannot be created until the payment method is updated. "+
+			"Unless payment is received, paid resources will be suspended on %s.\n",
+			account.ScopeType, account.ScopeID, status, suspendAt.UTC().Format("2 January 2006 15:04 MST")),
+	}
+}
+
+// resourcesSuspendedMessage renders the email sent when paid resources are suspended.
+func resourcesSuspendedMessage(account *models.BillingAccount, status string, count int) *mail.Message {
+	return &mail.Message{
+		Subject: "Your paid Konnektr resources have been suspended",
+		Body: fmt.Sprintf("The Konnektr subscription of the %s %q is still %s, so %d paid resources have been suspended.\n\n"+
+			"They are reactivated automatically once payment is received.\n",
+			account.ScopeType, account.ScopeID, status, count),
+	}
+}
+
+// resourcesReactivatedMessage renders the email sent when payment recovers.
+func resourcesReactivatedMessage(account *models.BillingAccount, count int) *mail.Message {
+	return &mail.Message{
+		Subject: "Your Konnektr resources have been reactivated",
+		Body: fmt.Sprintf("Payment for the Konnektr subscription of the %s %q has been received. "+
+			"%d suspended resources are being reactivated.\n",
+			account.ScopeType, account.ScopeID, count),
+	}
+}
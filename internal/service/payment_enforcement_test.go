@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ktrlplane/internal/config"
+	"ktrlplane/internal/mail"
+	"ktrlplane/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v84"
+)
+
+// recordingMailer collects sent messages.
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (m *recordingMailer) Send(_ context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestHealthOf(t *testing.T) {
+	assert.Equal(t, subscriptionHealthy, healthOf(stripe.SubscriptionStatusActive))
+	assert.Equal(t, subscriptionHealthy, healthOf(stripe.SubscriptionStatusTrialing))
+	assert.Equal(t, subscriptionPending, healthOf(stripe.SubscriptionStatusIncomplete))
+	for _, status := range []stripe.SubscriptionStatus{
+		stripe.SubscriptionStatusPastDue, stripe.SubscriptionStatusUnpaid, stripe.SubscriptionStatusCanceled,
+		stripe.SubscriptionStatusIncompleteExpired, stripe.SubscriptionStatusPaused,
+	} {
+		assert.Equal(t, subscriptionUnhealthy, healthOf(status), status)
+	}
+}
+
+func TestNextEnforcement(t *testing.T) {
+	grace := 72 * time.Hour
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// A payment problem starts the grace period
+	state, action := nextEnforcement(enforcementState{}, subscriptionUnhealthy, start, grace)
+	assert.Equal(t, enforceWarn, action)
+	require.NotNil(t, state.paymentIssueSince)
+	assert.Equal(t, start, *state.paymentIssueSince)
+
+	// Nothing happens during the grace period
+	same, action := nextEnforcement(state, subscriptionUnhealthy, start.Add(grace-time.Minute), grace)
+	assert.Equal(t, enforceNone, action)
+	assert.True(t, same.equal(state))
+
+	// Pending subscriptions neither suspend nor recover
+	_, action = nextEnforcement(state, subscriptionPending, start.Add(2*grace), grace)
+	assert.Equal(t, enforceNone, action)
+
+	// Paid resources are suspended once the grace period is over, once
+	suspended, action := nextEnforcement(state, subscriptionUnhealthy, start.Add(grace), grace)
+	assert.Equal(t, enforceSuspend, action)
+	require.NotNil(t, suspended.suspendedAt)
+	_, action = nextEnforcement(suspended, subscriptionUnhealthy, start.Add(2*grace), grace)
+	assert.Equal(t, enforceNone, action)
+
+	// Recovery clears the state and reactivates
+	recovered, action := nextEnforcement(suspended, subscriptionHealthy, start.Add(2*grace), grace)
+	assert.Equal(t, enforceReactivate, action)
+	assert.Nil(t, recovered.paymentIssueSince)
+	assert.Nil(t, recovered.suspendedAt)
+}
+
+func TestEnforcementStateEqual(t *testing.T) {
+	now := time.Now()
+	a := enforcementState{subscriptionStatus: stripe.String("past_due"), paymentIssueSince: &now}
+	later := now.In(time.FixedZone("CET", 3600))
+	b := enforcementState{subscriptionStatus: stripe.String("past_due"), paymentIssueSince: &later}
+	assert.True(t, a.equal(b))
+	b.subscriptionStatus = stripe.String("unpaid")
+	assert.False(t, a.equal(b))
+	assert.False(t, a.equal(enforcementState{subscriptionStatus: a.subscriptionStatus}))
+}
+
+func TestPaymentGracePeriod(t *testing.T) {
+	assert.Equal(t, 7*24*time.Hour, PaymentGracePeriod(config.PaymentEnforcementConfig{}))
+	assert.Equal(t, 48*time.Hour, PaymentGracePeriod(config.PaymentEnforcementConfig{GracePeriodHours: 48}))
+	assert.Equal(t, 15*time.Minute, PaymentEnforcementInterval(config.PaymentEnforcementConfig{}))
+}
+
+func TestAddSubscriptionItems_RefusesUnpaidSubscription(t *testing.T) {
+	ClearBillingCaches()
+	defer ClearBillingCaches()
+
+	fs := newFakeStripe(t)
+	fs.handle("GET /v1/subscriptions/sub_1", func(r *http.Request) (int, any) {
+		return http.StatusOK, map[string]any{
+			"id": "sub_1", "object": "subscription", "status": "past_due",
+			"items": stripeList("/v1/subscription_items"),
+		}
+	})
+
+	account := &models.BillingAccount{
+		ScopeType: "project", ScopeID: "p1",
+		StripeCustomerID: stripe.String("cus_1"), StripeSubscriptionID: stripe.String("sub_1"),
+	}
+	cfg := &config.Config{PaymentEnforcement: config.PaymentEnforcementConfig{Enabled: true}}
+	err := NewBillingService(cfg).addSubscriptionItems(context.Background(), account, "p1", "price_std", 1)
+	assert.True(t, errors.Is(err, ErrPaymentRequired))
+	assert.Zero(t, fs.count("POST /v1/subscription_items"))
+	assert.Zero(t, fs.count("POST /v1/subscriptions"))
+}
+
+func TestRequireHealthySubscription_OnlyWhenEnforced(t *testing.T) {
+	sub := &stripe.Subscription{Status: stripe.SubscriptionStatusUnpaid}
+	assert.NoError(t, NewBillingService(&config.Config{}).requireHealthySubscription(sub))
+
+	enforced := NewBillingService(&config.Config{PaymentEnforcement: config.PaymentEnforcementConfig{Enabled: true}})
+	assert.True(t, errors.Is(enforced.requireHealthySubscription(sub), ErrPaymentRequired))
+	assert.NoError(t, enforced.requireHealthySubscription(&stripe.Subscription{Status: stripe.SubscriptionStatusIncomplete}))
+}
+
+func TestPaymentEnforcement_NotifiesBillingContacts(t *testing.T) {
+	fs := newFakeStripe(t)
+	fs.handle("GET /v1/customers/cus_1", func(r *http.Request) (int, any) {
+		return http.StatusOK, map[string]any{"id": "cus_1", "object": "customer", "email": "billing@example.com"}
+	})
+	mailer := &recordingMailer{}
+	s := NewPaymentEnforcementService(&config.Config{}, mailer)
+
+	account := &models.BillingAccount{ScopeType: "organization", ScopeID: "acme", StripeCustomerID: stripe.String("cus_1")}
+	suspendAt := time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)
+	s.notify(context.Background(), account, *paymentIssueMessage(account, "past_due", suspendAt))
+
+	require.Len(t, mailer.sent, 1)
+	msg := mailer.sent[0]
+	assert.Equal(t, "billing@example.com", msg.To)
+	assert.Contains(t, msg.Body, `organization "acme" is past_due`)
+	assert.Contains(t, msg.Body, "8 March 2026")
+
+	// Accounts without a Stripe customer have nobody to notify
+	s.notify(context.Background(), &models.BillingAccount{ScopeType: "project", ScopeID: "p1"}, *resourcesReactivatedMessage(account, 1))
+	assert.Len(t, mailer.sent, 1)
+}
+
+func TestPaymentEnforcement_NotifiesAlertContacts(t *testing.T) {
+	fs := newFakeStripe(t)
+	fs.handle("GET /v1/customers/cus_1", func(r *http.Request) (int, any) {
+		return http.StatusOK, map[string]any{"id": "cus_1", "object": "customer", "email": "finance@example.com",
+			"metadata": map[string]any{
+				"billing_contacts_invoices": "finance@example.com",
+				"billing_contacts_alerts":   "ops@example.com,cto@example.com",
+			}}
+	})
+	mailer := &recordingMailer{}
+	s := NewPaymentEnforcementService(&config.Config{}, mailer)
+
+	account := &models.BillingAccount{ScopeType: "organization", ScopeID: "acme", StripeCustomerID: stripe.String("cus_1")}
+	s.notify(context.Background(), account, *resourcesReactivatedMessage(account, 1))
+
+	require.Len(t, mailer.sent, 2)
+	assert.Equal(t, "ops@example.com", mailer.sent[0].To)
+	assert.Equal(t, "cto@example.com", mailer.sent[1].To)
+}
+
+func TestPaymentEnforcementMessages(t *testing.T) {
+	account := &models.BillingAccount{ScopeType: "project", ScopeID: "p1"}
+	suspended := resourcesSuspendedMessage(account, "unpaid", 3)
+	assert.Contains(t, suspended.Body, "3 paid resources have been suspended")
+	reactivated := resourcesReactivatedMessage(account, 3)
+	assert.True(t, strings.HasPrefix(reactivated.Subject, "Your Konnektr resources"))
+	assert.Contains(t, reactivated.Body, "3 suspended resources")
+}
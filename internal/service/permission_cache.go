@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"ktrlplane/internal/cache"
+	"ktrlplane/internal/db"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// permissionCacheTTL bounds how long a permission decision may be served from the
+// shared cache. Role changes made through this service invalidate entries right
+// away; the TTL only matters for changes made elsewhere (migrations, other replicas).
+const permissionCacheTTL = 30 * time.Second
+
+// permissionCache maps (user, scope) to the actions the user holds on the scope.
+// It is shared by all RBACService instances, since other services create their own.
+var permissionCache = cache.New[permissionSet]("permissions", permissionCacheTTL)
+
+// permissionSet is the resolved action set for a user on a scope.
+type permissionSet struct {
+	actions []string
+	// expires is the earliest expiry of an assignment contributing to the set,
+	// or zero when every contributing assignment is permanent.
+	expires time.Time
+}
+
+// has reports whether the set contains action.
+func (p permissionSet) has(action string) bool {
+	return slices.Contains(p.actions, action)
+}
+
+// expiredAt reports whether an assignment in the set has expired at now.
+func (p permissionSet) expiredAt(now time.Time) bool {
+	return !p.expires.IsZero() && !now.Before(p.expires)
+}
+
+// permissionKey returns the cache key for a user and scope. User IDs may contain
+// "|" (Auth0 subjects), so fields are joined with a NUL byte.
+func permissionKey(userID, scopeType, scopeID string) string {
+	return userID + "\x00" + scopeType + "\x00" + scopeID
+}
+
+// loadPermissions resolves a permission set from the database. Tests and
+// benchmarks replace it to count round-trips.
+var loadPermissions = queryPermissions
+
+// queryPermissions resolves the action set for a user on a scope, including
+// inherited permissions, in a single query.
+func queryPermissions(ctx context.Context, userID, scopeType, scopeID string) (permissionSet, error) {
+	pool := db.GetDB()
+	rows, err := pool.Query(ctx, db.ListPermissionsWithExpiryQuery, userID, scopeType, scopeID)
+	if err != nil {
+		return permissionSet{}, fmt.Errorf("failed to list permissions: %w", err)
+	}
+	defer rows.Close()
+
+	var set permissionSet
+	for rows.Next() {
+		var action string
+		var expires *time.Time
+		if err := rows.Scan(&action, &expires); err != nil {
+			return permissionSet{}, fmt.Errorf("failed to scan permission: %w", err)
+		}
+		set.actions = append(set.actions, action)
+		if expires != nil && (set.expires.IsZero() || expires.Before(set.expires)) {
+			set.expires = *expires
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return permissionSet{}, fmt.Errorf("failed to list permissions: %w", err)
+	}
+	return set, nil
+}
+
+// resolvePermissions returns the permission set for a user on a scope, consulting
+// the per-request memo first, then the shared cache, then the database. Requests
+// authenticated with a scoped personal access token get the intersection with the
+// token's scope and actions; the memo and cache always hold the unrestricted set.
+func resolvePermissions(ctx context.Context, userID, scopeType, scopeID string) (permissionSet, error) {
+	set, err := resolveRolePermissions(ctx, userID, scopeType, scopeID)
+	if err != nil {
+		return permissionSet{}, err
+	}
+	return tokenRestrictionFor(ctx, userID).apply(ctx, scopeType, scopeID, set)
+}
+
+// resolveRolePermissions returns the permission set granted by the user's role assignments.
+func resolveRolePermissions(ctx context.Context, userID, scopeType, scopeID string) (permissionSet, error) {
+	key := permissionKey(userID, scopeType, scopeID)
+	memo := permissionMemoFrom(ctx)
+	if set, ok := memo.get(key); ok {
+		return set, nil
+	}
+
+	if set, ok := permissionCache.Get(key); ok && set.expiredAt(time.Now()) {
+		permissionCache.Invalidate(key)
+	}
+	set, err := permissionCache.GetOrLoad(ctx, key, func() (permissionSet, error) {
+		return loadPermissions(ctx, userID, scopeType, scopeID)
+	}, nil)
+	if err != nil {
+		return permissionSet{}, err
+	}
+	memo.set(key, set)
+	return set, nil
+}
+
+// InvalidateUserPermissions drops cached permission decisions for a user on every
+// scope. Call it after granting or revoking one of the user's roles. A team's roles
+// apply to every member, so invalidating a team drops all cached decisions.
+func InvalidateUserPermissions(ctx context.Context, userID string) {
+	if isTeamID(userID) {
+		ClearPermissionCache(ctx)
+		return
+	}
+	prefix := userID + "\x00"
+	match := func(key string) bool { return strings.HasPrefix(key, prefix) }
+	permissionCache.InvalidateFunc(match)
+	permissionMemoFrom(ctx).invalidate(match)
+}
+
+// ClearPermissionCache drops all cached permission decisions. Call it when a scope
+// is deleted, since that affects every user with access to its descendants.
+func ClearPermissionCache(ctx context.Context) {
+	permissionCache.Clear()
+	permissionMemoFrom(ctx).invalidate(func(string) bool { return true })
+}
+
+// permissionMemo memoizes permission sets for the lifetime of one request, so that
+// service methods calling each other check a scope at most once.
+type permissionMemo struct {
+	mu   sync.Mutex
+	sets map[string]permissionSet
+}
+
+type permissionMemoKey struct{}
+
+// WithPermissionMemo returns a context carrying a fresh per-request permission memo.
+func WithPermissionMemo(ctx context.Context) context.Context {
+	return context.WithValue(ctx, permissionMemoKey{}, &permissionMemo{sets: make(map[string]permissionSet)})
+}
+
+// permissionMemoFrom returns the memo stored in ctx, or nil. A nil memo is a no-op.
+func permissionMemoFrom(ctx context.Context) *permissionMemo {
+	memo, _ := ctx.Value(permissionMemoKey{}).(*permissionMemo)
+	return memo
+}
+
+func (m *permissionMemo) get(key string) (permissionSet, bool) {
+	if m == nil {
+		return permissionSet{}, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	set, ok := m.sets[key]
+	return set, ok
+}
+
+func (m *permissionMemo) set(key string, set permissionSet) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.sets[key] = set
+	m.mu.Unlock()
+}
+
+func (m *permissionMemo) invalidate(match func(key string) bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	for key := range m.sets {
+		if match(key) {
+			delete(m.sets, key)
+		}
+	}
+	m.mu.Unlock()
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingLoader replaces loadPermissions with a fake that grants actions and
+// counts database round-trips. The original loader is restored on cleanup.
+func countingLoader(tb testing.TB, actions ...string) *atomic.Int64 {
+	tb.Helper()
+	var calls atomic.Int64
+	original := loadPermissions
+	loadPermissions = func(ctx context.Context, userID, scopeType, scopeID string) (permissionSet, error) {
+		calls.Add(1)
+		return permissionSet{actions: actions}, nil
+	}
+	permissionCache.Clear()
+	tb.Cleanup(func() {
+		loadPermissions = original
+		permissionCache.Clear()
+	})
+	return &calls
+}
+
+func TestCheckPermission_MemoizedPerRequest(t *testing.T) {
+	calls := countingLoader(t, "read", "write")
+	rbac := NewRBACService()
+	ctx := WithPermissionMemo(context.Background())
+
+	canWrite, err := rbac.CheckPermission(ctx, "user-1", "write", "project", "p1")
+	require.NoError(t, err)
+	assert.True(t, canWrite)
+	canRead, err := rbac.CheckPermission(ctx, "user-1", "read", "project", "p1")
+	require.NoError(t, err)
+	assert.True(t, canRead)
+	canDelete, err := rbac.CheckPermission(ctx, "user-1", "delete", "project", "p1")
+	require.NoError(t, err)
+	assert.False(t, canDelete)
+
+	assert.Equal(t, int64(1), calls.Load(), "one round-trip per (user, scope)")
+}
+
+func TestCheckPermission_SharedCacheAcrossRequests(t *testing.T) {
+	calls := countingLoader(t, "read")
+	rbac := NewRBACService()
+
+	for i := 0; i < 3; i++ {
+		_, err := rbac.CheckPermission(WithPermissionMemo(context.Background()), "user-1", "read", "project", "p1")
+		require.NoError(t, err)
+	}
+	_, err := rbac.CheckPermission(context.Background(), "user-2", "read", "project", "p1")
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(2), calls.Load(), "each user is loaded once")
+}
+
+func TestInvalidateUserPermissions(t *testing.T) {
+	calls := countingLoader(t, "read")
+	rbac := NewRBACService()
+	ctx := WithPermissionMemo(context.Background())
+
+	_, _ = rbac.CheckPermission(ctx, "user-1", "read", "project", "p1")
+	_, _ = rbac.CheckPermission(ctx, "user-1", "read", "organization", "o1")
+	_, _ = rbac.CheckPermission(ctx, "user-2", "read", "project", "p1")
+	require.Equal(t, int64(3), calls.Load())
+
+	InvalidateUserPermissions(ctx, "user-1")
+
+	_, _ = rbac.CheckPermission(ctx, "user-1", "read", "project", "p1")
+	_, _ = rbac.CheckPermission(ctx, "user-1", "read", "organization", "o1")
+	_, _ = rbac.CheckPermission(ctx, "user-2", "read", "project", "p1")
+	assert.Equal(t, int64(5), calls.Load(), "only user-1 is reloaded, from the memo and the shared cache")
+}
+
+func TestClearPermissionCache(t *testing.T) {
+	calls := countingLoader(t, "read")
+	rbac := NewRBACService()
+	ctx := WithPermissionMemo(context.Background())
+
+	_, _ = rbac.CheckPermission(ctx, "user-1", "read", "project", "p1")
+	ClearPermissionCache(ctx)
+	_, _ = rbac.CheckPermission(ctx, "user-1", "read", "project", "p1")
+
+	assert.Equal(t, int64(2), calls.Load())
+}
+
+func TestCheckPermission_ReloadsAfterAssignmentExpiry(t *testing.T) {
+	var calls atomic.Int64
+	original := loadPermissions
+	loadPermissions = func(ctx context.Context, userID, scopeType, scopeID string) (permissionSet, error) {
+		if calls.Add(1) == 1 {
+			return permissionSet{actions: []string{"read"}, expires: time.Now().Add(-time.Second)}, nil
+		}
+		return permissionSet{}, nil
+	}
+	permissionCache.Clear()
+	t.Cleanup(func() {
+		loadPermissions = original
+		permissionCache.Clear()
+	})
+
+	rbac := NewRBACService()
+	_, err := rbac.CheckPermission(context.Background(), "user-1", "read", "project", "p1")
+	require.NoError(t, err)
+
+	canRead, err := rbac.CheckPermission(context.Background(), "user-1", "read", "project", "p1")
+	require.NoError(t, err)
+	assert.False(t, canRead, "an expired assignment is not served from the cache")
+	assert.Equal(t, int64(2), calls.Load())
+}
+
+func TestListPermissions_ReturnsCopy(t *testing.T) {
+	countingLoader(t, "read", "write")
+	rbac := NewRBACService()
+
+	permissions, err := rbac.ListPermissions(context.Background(), "user-1", "project", "p1")
+	require.NoError(t, err)
+	permissions[0] = "delete"
+
+	canDelete, err := rbac.CheckPermission(context.Background(), "user-1", "delete", "project", "p1")
+	require.NoError(t, err)
+	assert.False(t, canDelete, "callers cannot mutate the cached set")
+}
+
+// BenchmarkUpdateResourceChecks mirrors the permission checks made by one
+// UpdateResource request: a write check, then a read check in GetResourceByID.
+// It reports database round-trips per request without and with caching.
+func BenchmarkUpdateResourceChecks(b *testing.B) {
+	b.Run("uncached", func(b *testing.B) {
+		calls := countingLoader(b, "read", "write")
+		ctx := context.Background()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			// Before caching, every CheckPermission ran the inheritance query.
+			_, _ = loadPermissions(ctx, "user-1", "project", "p1")
+			_, _ = loadPermissions(ctx, "user-1", "project", "p1")
+		}
+		b.ReportMetric(float64(calls.Load())/float64(b.N), "queries/op")
+	})
+
+	b.Run("memo", func(b *testing.B) {
+		calls := countingLoader(b, "read", "write")
+		rbac := NewRBACService()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			// Expire the shared cache every request to isolate the per-request memo.
+			permissionCache.Clear()
+			ctx := WithPermissionMemo(context.Background())
+			_, _ = rbac.CheckPermission(ctx, "user-1", "write", "project", "p1")
+			_, _ = rbac.CheckPermission(ctx, "user-1", "read", "project", "p1")
+		}
+		b.ReportMetric(float64(calls.Load())/float64(b.N), "queries/op")
+	})
+
+	b.Run("memo+shared", func(b *testing.B) {
+		calls := countingLoader(b, "read", "write")
+		rbac := NewRBACService()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			ctx := WithPermissionMemo(context.Background())
+			_, _ = rbac.CheckPermission(ctx, "user-1", "write", "project", "p1")
+			_, _ = rbac.CheckPermission(ctx, "user-1", "read", "project", "p1")
+		}
+		b.ReportMetric(float64(calls.Load())/float64(b.N), "queries/op")
+	})
+}
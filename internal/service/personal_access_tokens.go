@@ -0,0 +1,350 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"ktrlplane/internal/cache"
+	"ktrlplane/internal/db"
+	"ktrlplane/internal/models"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// PersonalAccessTokenPrefix marks personal access tokens, so that the auth middleware
+// can tell them apart from JWTs without parsing.
+const PersonalAccessTokenPrefix = "kpat_"
+
+// Audit event types for personal access tokens.
+const (
+	AuditPersonalAccessTokenCreated = "personal_access_token.created"
+	AuditPersonalAccessTokenRevoked = "personal_access_token.revoked"
+)
+
+const (
+	// defaultPersonalAccessTokenTTL applies when a token is created without expires_in_days.
+	defaultPersonalAccessTokenTTL = 30 * 24 * time.Hour
+
+	// personalAccessTokenCacheTTL bounds how long another replica may keep accepting a
+	// revoked token.
+	personalAccessTokenCacheTTL = 30 * time.Second
+
+	// scopeWithinCacheTTL bounds how long scope ancestry is cached. Scopes never move
+	// between parents, so this only matters for deleted scopes.
+	scopeWithinCacheTTL = 5 * time.Minute
+)
+
+var (
+	// personalAccessTokens caches token lookups by hash; a nil value means the token
+	// is unknown or expired.
+	personalAccessTokens = cache.New[*ResolvedAccessToken]("personal-access-tokens", personalAccessTokenCacheTTL)
+
+	// scopeAncestry caches whether one scope lies within another.
+	scopeAncestry = cache.New[bool]("scope-ancestry", scopeWithinCacheTTL)
+
+	// accessTokenTouches records when last_used_at was last written per token.
+	accessTokenTouches sync.Map // map[string]time.Time
+)
+
+// ResolvedAccessToken is a valid personal access token with its owner's profile.
+type ResolvedAccessToken struct {
+	models.PersonalAccessToken
+	Email string
+	Name  string
+}
+
+// PersonalAccessTokenService manages the personal access tokens of users.
+type PersonalAccessTokenService struct {
+	rbacService *RBACService
+	now         func() time.Time
+}
+
+// NewPersonalAccessTokenService creates a new PersonalAccessTokenService.
+func NewPersonalAccessTokenService() *PersonalAccessTokenService {
+	return &PersonalAccessTokenService{
+		rbacService: NewRBACService(),
+		now:         time.Now,
+	}
+}
+
+// scanPersonalAccessToken scans a row selected with the token column list, plus any extra destinations.
+func scanPersonalAccessToken(row pgx.Row, extra ...any) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	dest := append([]any{
+		&token.TokenID, &token.UserID, &token.Name, &token.ScopeType, &token.ScopeID,
+		&token.Actions, &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// CreateToken creates a personal access token for a user. A scoped token requires
+// read access on the scope. The token is only returned here; KtrlPlane stores its hash.
+func (s *PersonalAccessTokenService) CreateToken(ctx context.Context, userID string, req models.CreatePersonalAccessTokenRequest) (*models.CreatedPersonalAccessToken, error) {
+	var scopeType, scopeID *string
+	if req.ScopeID != "" && req.ScopeType == "" {
+		return nil, Validation("scope_type is required with scope_id")
+	}
+	if req.ScopeType != "" {
+		canRead, err := s.rbacService.CheckPermission(ctx, userID, "read", req.ScopeType, req.ScopeID)
+		if err != nil {
+			return nil, err
+		}
+		if !canRead {
+			return nil, Forbidden("no access to %s %s", req.ScopeType, req.ScopeID)
+		}
+		scopeType, scopeID = &req.ScopeType, &req.ScopeID
+	}
+	var actions []string
+	if len(req.Actions) > 0 {
+		actions = slices.Compact(slices.Sorted(slices.Values(req.Actions)))
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+	secret := PersonalAccessTokenPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	ttl := defaultPersonalAccessTokenTTL
+	if req.ExpiresInDays > 0 {
+		ttl = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	token, err := scanPersonalAccessToken(tx.QueryRow(ctx, db.CreatePersonalAccessTokenQuery,
+		uuid.New().String(), userID, req.Name, hashToken(secret), scopeType, scopeID, actions, s.now().UTC().Add(ttl)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create access token: %w", err)
+	}
+	var auditScopeType, auditScopeID string
+	if scopeType != nil {
+		auditScopeType, auditScopeID = *scopeType, *scopeID
+	}
+	err = recordAuditEvent(ctx, tx, AuditPersonalAccessTokenCreated, userID, userID, auditScopeType, auditScopeID, map[string]any{
+		"token_id":   token.TokenID,
+		"name":       token.Name,
+		"actions":    token.Actions,
+		"expires_at": token.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit access token: %w", err)
+	}
+	return &models.CreatedPersonalAccessToken{PersonalAccessToken: *token, Token: secret}, nil
+}
+
+// ListTokens lists the personal access tokens of a user, without their values.
+func (s *PersonalAccessTokenService) ListTokens(ctx context.Context, userID string) ([]models.PersonalAccessToken, error) {
+	pool := db.GetDB()
+	rows, err := pool.Query(ctx, db.ListPersonalAccessTokensQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list access tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := make([]models.PersonalAccessToken, 0)
+	for rows.Next() {
+		token, err := scanPersonalAccessToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan access token: %w", err)
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeToken deletes a personal access token of a user.
+func (s *PersonalAccessTokenService) RevokeToken(ctx context.Context, userID, tokenID string) error {
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	tag, err := tx.Exec(ctx, db.DeletePersonalAccessTokenQuery, tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return NotFound("access token %s not found", tokenID)
+	}
+	err = recordAuditEvent(ctx, tx, AuditPersonalAccessTokenRevoked, userID, userID, "", "", map[string]any{
+		"token_id": tokenID,
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit access token revocation: %w", err)
+	}
+	personalAccessTokens.Clear()
+	return nil
+}
+
+// ResolvePersonalAccessToken returns the valid token matching secret, or nil when the
+// token is unknown or expired.
+func ResolvePersonalAccessToken(ctx context.Context, secret string) (*ResolvedAccessToken, error) {
+	hash := hashToken(secret)
+	token, err := personalAccessTokens.GetOrLoad(ctx, hash, func() (*ResolvedAccessToken, error) {
+		var resolved ResolvedAccessToken
+		token, err := scanPersonalAccessToken(db.GetDB().QueryRow(ctx, db.GetPersonalAccessTokenByHashQuery, hash),
+			&resolved.Email, &resolved.Name)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve access token: %w", err)
+		}
+		resolved.PersonalAccessToken = *token
+		return &resolved, nil
+	}, nil)
+	if err != nil || token == nil {
+		return nil, err
+	}
+	if !time.Now().Before(token.ExpiresAt) {
+		personalAccessTokens.Invalidate(hash)
+		return nil, nil
+	}
+	touchAccessToken(ctx, token.TokenID)
+	return token, nil
+}
+
+// touchAccessToken records that a token was used, at most once per
+// serviceAccountTouchInterval per replica. Failures are logged, not returned.
+func touchAccessToken(ctx context.Context, tokenID string) {
+	now := time.Now()
+	if last, ok := accessTokenTouches.Load(tokenID); ok && now.Sub(last.(time.Time)) < serviceAccountTouchInterval {
+		return
+	}
+	accessTokenTouches.Store(tokenID, now)
+	if err := db.ExecQuery(ctx, db.TouchPersonalAccessTokenQuery, tokenID); err != nil {
+		fmt.Printf("[PersonalAccessTokenService] Failed to record last use of %s: %v\n", tokenID, err)
+	}
+}
+
+// tokenRestriction limits the permissions of a request authenticated with a scoped
+// personal access token to the token's scope and actions.
+type tokenRestriction struct {
+	userID    string
+	scopeType string // Empty for tokens valid on every scope
+	scopeID   string
+	actions   []string // Empty for tokens carrying every action
+}
+
+type tokenRestrictionKey struct{}
+
+// WithAccessTokenRestriction returns a context in which the permissions of the token's
+// owner are intersected with the token's scope and actions.
+func WithAccessTokenRestriction(ctx context.Context, token *models.PersonalAccessToken) context.Context {
+	restriction := &tokenRestriction{userID: token.UserID, actions: token.Actions}
+	if token.ScopeType != nil && token.ScopeID != nil {
+		restriction.scopeType, restriction.scopeID = *token.ScopeType, *token.ScopeID
+	}
+	return context.WithValue(ctx, tokenRestrictionKey{}, restriction)
+}
+
+// tokenRestrictionFor returns the restriction applying to userID in ctx, or nil.
+func tokenRestrictionFor(ctx context.Context, userID string) *tokenRestriction {
+	restriction, _ := ctx.Value(tokenRestrictionKey{}).(*tokenRestriction)
+	if restriction == nil || restriction.userID != userID {
+		return nil
+	}
+	return restriction
+}
+
+// apply intersects a permission set on a scope with the restriction.
+func (r *tokenRestriction) apply(ctx context.Context, scopeType, scopeID string, set permissionSet) (permissionSet, error) {
+	if r == nil {
+		return set, nil
+	}
+	within, err := r.covers(ctx, scopeType, scopeID)
+	if err != nil {
+		return permissionSet{}, err
+	}
+	if !within {
+		return permissionSet{}, nil
+	}
+	if len(r.actions) == 0 {
+		return set, nil
+	}
+	restricted := permissionSet{expires: set.expires}
+	for _, action := range set.actions {
+		if slices.Contains(r.actions, action) {
+			restricted.actions = append(restricted.actions, action)
+		}
+	}
+	return restricted, nil
+}
+
+// allows reports whether the restriction lets action through on a scope.
+func (r *tokenRestriction) allows(ctx context.Context, action, scopeType, scopeID string) (bool, error) {
+	if r == nil {
+		return true, nil
+	}
+	if len(r.actions) > 0 && !slices.Contains(r.actions, action) {
+		return false, nil
+	}
+	return r.covers(ctx, scopeType, scopeID)
+}
+
+// covers reports whether a scope is the token scope or one of its descendants.
+func (r *tokenRestriction) covers(ctx context.Context, scopeType, scopeID string) (bool, error) {
+	if r.scopeType == "" {
+		return true, nil
+	}
+	return scopeWithin(ctx, r.scopeType, r.scopeID, scopeType, scopeID)
+}
+
+// scopeWithin reports whether (scopeType, scopeID) is (parentType, parentID) or lies below it.
+func scopeWithin(ctx context.Context, parentType, parentID, scopeType, scopeID string) (bool, error) {
+	if parentType == scopeType {
+		return parentID == scopeID, nil
+	}
+	key := strings.Join([]string{parentType, parentID, scopeType, scopeID}, "\x00")
+	return scopeAncestry.GetOrLoad(ctx, key, func() (bool, error) {
+		var within bool
+		err := db.GetDB().QueryRow(ctx, db.ScopeWithinQuery, parentType, parentID, scopeType, scopeID).Scan(&within)
+		if err != nil {
+			return false, fmt.Errorf("failed to resolve scope ancestry: %w", err)
+		}
+		return within, nil
+	}, nil)
+}
+
+// filterByTokenScope drops the items of a listing that a scoped personal access token
+// cannot read. Lists for other users, and unrestricted requests, pass through.
+func filterByTokenScope[T any](ctx context.Context, userID, scopeType string, items []T, id func(T) string) ([]T, error) {
+	restriction := tokenRestrictionFor(ctx, userID)
+	if restriction == nil {
+		return items, nil
+	}
+	filtered := make([]T, 0, len(items))
+	for _, item := range items {
+		ok, err := restriction.allows(ctx, "read", scopeType, id(item))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered, nil
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"ktrlplane/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scopedToken(userID, scopeType, scopeID string, actions ...string) *models.PersonalAccessToken {
+	token := &models.PersonalAccessToken{UserID: userID, Actions: actions}
+	if scopeType != "" {
+		token.ScopeType, token.ScopeID = &scopeType, &scopeID
+	}
+	return token
+}
+
+func TestCheckPermission_AccessTokenActions(t *testing.T) {
+	countingLoader(t, "read", "write", "delete")
+	rbac := NewRBACService()
+	ctx := WithAccessTokenRestriction(WithPermissionMemo(context.Background()), scopedToken("user-1", "", "", "read"))
+
+	canRead, err := rbac.CheckPermission(ctx, "user-1", "read", "project", "p1")
+	require.NoError(t, err)
+	assert.True(t, canRead)
+	canWrite, err := rbac.CheckPermission(ctx, "user-1", "write", "project", "p1")
+	require.NoError(t, err)
+	assert.False(t, canWrite, "write is not among the token actions")
+
+	actions, err := rbac.ListPermissions(ctx, "user-1", "project", "p1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"read"}, actions)
+
+	canWrite, err = rbac.CheckPermission(ctx, "user-2", "write", "project", "p1")
+	require.NoError(t, err)
+	assert.True(t, canWrite, "the restriction only applies to the token owner")
+
+	canWrite, err = rbac.CheckPermission(context.Background(), "user-1", "write", "project", "p1")
+	require.NoError(t, err)
+	assert.True(t, canWrite, "the shared cache holds the unrestricted set")
+}
+
+func TestCheckPermission_AccessTokenScope(t *testing.T) {
+	countingLoader(t, "read", "write")
+	rbac := NewRBACService()
+	ctx := WithAccessTokenRestriction(context.Background(), scopedToken("user-1", "project", "p1"))
+
+	canWrite, err := rbac.CheckPermission(ctx, "user-1", "write", "project", "p1")
+	require.NoError(t, err)
+	assert.True(t, canWrite)
+	canRead, err := rbac.CheckPermission(ctx, "user-1", "read", "project", "p2")
+	require.NoError(t, err)
+	assert.False(t, canRead, "p2 is outside the token scope")
+}
+
+func TestFilterByTokenScope(t *testing.T) {
+	ids := []string{"p1", "p2"}
+	identity := func(id string) string { return id }
+
+	ctx := WithAccessTokenRestriction(context.Background(), scopedToken("user-1", "project", "p2"))
+	filtered, err := filterByTokenScope(ctx, "user-1", "project", ids, identity)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"p2"}, filtered)
+
+	filtered, err = filterByTokenScope(ctx, "user-2", "project", ids, identity)
+	require.NoError(t, err)
+	assert.Equal(t, ids, filtered)
+
+	ctx = WithAccessTokenRestriction(context.Background(), scopedToken("user-1", "", "", "write"))
+	filtered, err = filterByTokenScope(ctx, "user-1", "project", ids, identity)
+	require.NoError(t, err)
+	assert.Empty(t, filtered, "listing requires the read action")
+}
+
+func TestPersonalAccessTokenService_CreateRequiresScopeAccess(t *testing.T) {
+	countingLoader(t)
+	_, err := NewPersonalAccessTokenService().CreateToken(context.Background(), "user-1", models.CreatePersonalAccessTokenRequest{
+		Name: "ci", ScopeType: "project", ScopeID: "p1",
+	})
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, err = NewPersonalAccessTokenService().CreateToken(context.Background(), "user-1", models.CreatePersonalAccessTokenRequest{
+		Name: "ci", ScopeID: "p1",
+	})
+	assert.ErrorIs(t, err, ErrValidation)
+}
+
+func TestExplainPermission_AccessTokenRestriction(t *testing.T) {
+	original := loadPermissionGrants
+	loadPermissionGrants = func(ctx context.Context, userID, action, scopeType, scopeID string) ([]models.PermissionGrant, error) {
+		return []models.PermissionGrant{{RoleName: "Editor", ScopeType: scopeType, ScopeID: scopeID}}, nil
+	}
+	t.Cleanup(func() { loadPermissionGrants = original })
+	rbac := NewRBACService()
+	ctx := WithAccessTokenRestriction(context.Background(), scopedToken("user-1", "project", "p1", "read"))
+
+	explanation, err := rbac.ExplainPermission(ctx, "user-1", "read", "project", "p1")
+	require.NoError(t, err)
+	assert.True(t, explanation.Allowed)
+	assert.False(t, explanation.RestrictedByToken)
+
+	explanation, err = rbac.ExplainPermission(ctx, "user-1", "write", "project", "p1")
+	require.NoError(t, err)
+	assert.False(t, explanation.Allowed, "write is not among the token actions")
+	assert.True(t, explanation.RestrictedByToken)
+	assert.Len(t, explanation.Grants, 1)
+
+	explanation, err = rbac.ExplainPermission(ctx, "user-1", "read", "project", "p2")
+	require.NoError(t, err)
+	assert.False(t, explanation.Allowed, "p2 is outside the token scope")
+
+	explanation, err = rbac.ExplainPermission(ctx, "user-2", "write", "project", "p1")
+	require.NoError(t, err)
+	assert.True(t, explanation.Allowed, "the restriction only applies to the token owner")
+}
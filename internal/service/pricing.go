@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"ktrlplane/internal/models"
+	"strings"
+
+	"github.com/stripe/stripe-go/v84"
+)
+
+// Billing intervals an account can choose between. Accounts without a preference are billed
+// at monthly prices.
+const (
+	IntervalMonth = "month"
+	IntervalYear  = "year"
+)
+
+// billingIntervals lists the billing intervals in the order prices are listed.
+var billingIntervals = []string{IntervalMonth, IntervalYear}
+
+// normalizeCurrency returns a currency code the way Stripe reports it: lowercase.
+func normalizeCurrency(currency string) string {
+	return strings.ToLower(strings.TrimSpace(currency))
+}
+
+// validateCurrency checks that currency is empty or looks like an ISO 4217 code.
+func validateCurrency(currency string) error {
+	if currency == "" {
+		return nil
+	}
+	if len(currency) != 3 || strings.Trim(currency, "abcdefghijklmnopqrstuvwxyz") != "" {
+		return Validation("currency must be a three-letter ISO 4217 code")
+	}
+	return nil
+}
+
+// defaultCurrency returns the currency of accounts that did not choose one. It is empty when
+// none is configured, in which case each product's first price is used.
+func (s *BillingService) defaultCurrency() string {
+	if s.config == nil {
+		return ""
+	}
+	return normalizeCurrency(s.config.Stripe.DefaultCurrency)
+}
+
+// accountCurrency returns the currency a billing account is billed in.
+func (s *BillingService) accountCurrency(account *models.BillingAccount) string {
+	if account != nil && account.Currency != nil && *account.Currency != "" {
+		return normalizeCurrency(*account.Currency)
+	}
+	return s.defaultCurrency()
+}
+
+// automaticTax reports whether Stripe Tax calculates the tax on subscriptions.
+func (s *BillingService) automaticTax() bool {
+	return s.config != nil && s.config.Stripe.AutomaticTax
+}
+
+// accountInterval returns the billing interval a billing account chose, or "" without a
+// preference.
+func (s *BillingService) accountInterval(account *models.BillingAccount) string {
+	if account != nil && account.BillingInterval != nil {
+		return *account.BillingInterval
+	}
+	return ""
+}
+
+// selectPrice picks the price to bill in currency and interval from the active prices of a
+// product: a price in that currency, or else a price with currency options for it. Without a
+// currency or interval, any currency or interval matches.
+func selectPrice(prices []*stripe.Price, currency, interval string) *stripe.Price {
+	var candidates []*stripe.Price
+	for _, p := range prices {
+		if interval == "" || (p.Recurring != nil && string(p.Recurring.Interval) == interval) {
+			candidates = append(candidates, p)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	if currency == "" {
+		return candidates[0]
+	}
+	for _, p := range candidates {
+		if string(p.Currency) == currency {
+			return p
+		}
+	}
+	for _, p := range candidates {
+		if _, ok := p.CurrencyOptions[currency]; ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// priceIn returns the unit amount and tax behavior of a price in currency, which is either
+// the price's own currency or one of its currency options. An empty currency means the
+// price's own.
+func priceIn(p *stripe.Price, currency string) (amount int64, taxBehavior string, ok bool) {
+	if currency == "" || string(p.Currency) == currency {
+		return p.UnitAmount, string(p.TaxBehavior), true
+	}
+	if option, found := p.CurrencyOptions[currency]; found && option != nil {
+		return option.UnitAmount, string(option.TaxBehavior), true
+	}
+	return 0, "", false
+}
+
+// prepareSubscription completes the parameters of a new subscription for billing account
+// scopeType/scopeID: its currency, Stripe Tax when enabled, and the trial the account is due.
+func (s *BillingService) prepareSubscription(ctx context.Context, scopeType, scopeID, currency string, params *stripe.SubscriptionParams) error {
+	if currency != "" {
+		params.Currency = stripe.String(currency)
+	}
+	if s.automaticTax() {
+		params.AutomaticTax = &stripe.SubscriptionAutomaticTaxParams{Enabled: stripe.Bool(true)}
+	}
+	return s.applyTrial(ctx, scopeType, scopeID, params)
+}
+
+// stripeRequestError reports Stripe rejecting a request as invalid, such as a malformed tax
+// ID or an expired coupon, as a validation error; other failures are upstream errors.
+func stripeRequestError(err error, message string) error {
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) && stripeErr.Type == stripe.ErrorTypeInvalidRequest {
+		return Wrap(ErrValidation, err, "%s: %s", message, stripeErr.Msg)
+	}
+	return Upstream(err, "%s", message)
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"ktrlplane/internal/config"
+	"ktrlplane/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v84"
+)
+
+func TestValidateCurrency(t *testing.T) {
+	assert.NoError(t, validateCurrency(""))
+	assert.NoError(t, validateCurrency(normalizeCurrency(" USD ")))
+	assert.True(t, errors.Is(validateCurrency("euro"), ErrValidation))
+	assert.True(t, errors.Is(validateCurrency("EUR"), ErrValidation), "codes are normalized first")
+}
+
+func TestSelectPrice(t *testing.T) {
+	eur := &stripe.Price{ID: "price_eur", Currency: "eur", CurrencyOptions: map[string]*stripe.PriceCurrencyOptions{
+		"gbp": {UnitAmount: 4200},
+	}}
+	usd := &stripe.Price{ID: "price_usd", Currency: "usd"}
+	prices := []*stripe.Price{eur, usd}
+
+	assert.Equal(t, eur, selectPrice(prices, "", ""))
+	assert.Equal(t, usd, selectPrice(prices, "usd", ""))
+	assert.Equal(t, eur, selectPrice(prices, "gbp", ""), "currency options")
+	assert.Nil(t, selectPrice(prices, "jpy", ""))
+	assert.Nil(t, selectPrice(nil, "", ""))
+}
+
+func TestPriceIn(t *testing.T) {
+	p := &stripe.Price{UnitAmount: 4900, Currency: "eur", TaxBehavior: "exclusive", CurrencyOptions: map[string]*stripe.PriceCurrencyOptions{
+		"usd": {UnitAmount: 5300, TaxBehavior: "inclusive"},
+	}}
+
+	amount, taxBehavior, ok := priceIn(p, "eur")
+	assert.True(t, ok)
+	assert.Equal(t, int64(4900), amount)
+	assert.Equal(t, "exclusive", taxBehavior)
+
+	amount, taxBehavior, ok = priceIn(p, "usd")
+	assert.True(t, ok)
+	assert.Equal(t, int64(5300), amount)
+	assert.Equal(t, "inclusive", taxBehavior)
+
+	_, _, ok = priceIn(p, "gbp")
+	assert.False(t, ok)
+}
+
+func TestGetResourceTierPrice_Currency(t *testing.T) {
+	ClearBillingCaches()
+	defer ClearBillingCaches()
+
+	fs := newFakeStripe(t)
+	fs.handle("GET /v1/prices", func(r *http.Request) (int, any) {
+		return http.StatusOK, stripeList("/v1/prices",
+			map[string]any{"id": "price_eur", "object": "price", "currency": "eur"},
+			map[string]any{"id": "price_usd", "object": "price", "currency": "usd",
+				"currency_options": map[string]any{"cad": map[string]any{"unit_amount": 7000}}},
+		)
+	})
+	fs.handle("GET /v1/prices/price_usd", func(r *http.Request) (int, any) {
+		return http.StatusOK, map[string]any{
+			"id": "price_usd", "object": "price", "unit_amount": 5300, "currency": "usd", "tax_behavior": "exclusive",
+			"recurring":        map[string]any{"interval": "month"},
+			"currency_options": map[string]any{"cad": map[string]any{"unit_amount": 7000, "tax_behavior": "exclusive"}},
+		}
+	})
+
+	svc := newPricingBillingService()
+	svc.config.Stripe.DefaultCurrency = "usd"
+
+	tierPrice, err := svc.GetResourceTierPrice(context.Background(), "Konnektr.Graph", "standard", "")
+	require.NoError(t, err)
+	assert.Equal(t, "price_usd", tierPrice.PriceID, "the default currency")
+	assert.Equal(t, int64(5300), tierPrice.Amount)
+	assert.Equal(t, "exclusive", tierPrice.TaxBehavior)
+
+	tierPrice, err = svc.GetResourceTierPrice(context.Background(), "Konnektr.Graph", "standard", "CAD")
+	require.NoError(t, err)
+	assert.Equal(t, "price_usd", tierPrice.PriceID)
+	assert.Equal(t, int64(7000), tierPrice.Amount)
+	assert.Equal(t, "cad", tierPrice.Currency)
+
+	_, err = svc.GetResourceTierPrice(context.Background(), "Konnektr.Graph", "standard", "jpy")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	_, err = svc.GetResourceTierPrice(context.Background(), "Konnektr.Graph", "standard", "us$")
+	assert.True(t, errors.Is(err, ErrValidation))
+}
+
+func TestAccountCurrency(t *testing.T) {
+	svc := NewBillingService(&config.Config{Stripe: config.StripeConfig{DefaultCurrency: "EUR"}})
+	assert.Equal(t, "eur", svc.accountCurrency(nil))
+	assert.Equal(t, "usd", svc.accountCurrency(&models.BillingAccount{Currency: stripe.String("usd")}))
+}
+
+func TestCreateStripeCustomer_RejectsInvalidCurrency(t *testing.T) {
+	fs := newFakeStripe(t)
+	_, err := NewBillingService(&config.Config{}).CreateStripeCustomer(context.Background(), "organization", "acme", "a@example.com", "Acme",
+		models.CreateStripeCustomerRequest{Currency: "euro"})
+	assert.True(t, errors.Is(err, ErrValidation))
+	assert.Zero(t, fs.count("POST /v1/customers"))
+}
+
+func TestConvertBillingAddress(t *testing.T) {
+	info := convertBillingAddress(&stripe.Customer{
+		Address: &stripe.Address{Line1: "Main 1", City: "Ghent", PostalCode: "9000", Country: "BE"},
+		TaxIDs: &stripe.TaxIDList{Data: []*stripe.TaxID{
+			{ID: "txi_1", Type: "eu_vat", Value: "BE0123456789", Verification: &stripe.TaxIDVerification{Status: "verified"}},
+		}},
+		Tax: &stripe.CustomerTax{AutomaticTax: "supported"},
+	})
+	require.NotNil(t, info.Address)
+	assert.Equal(t, "Ghent", info.Address.City)
+	assert.Equal(t, []models.TaxID{{ID: "txi_1", Type: "eu_vat", Value: "BE0123456789", Verification: "verified"}}, info.TaxIDs)
+	assert.Equal(t, "supported", info.AutomaticTax)
+
+	info = convertBillingAddress(&stripe.Customer{Address: &stripe.Address{}})
+	assert.Nil(t, info.Address)
+	assert.NotNil(t, info.TaxIDs, "an empty list, not null")
+
+	params := addressParams(&models.BillingAddress{Line1: "Main 1", City: "Ghent", PostalCode: "9000", Country: "be"})
+	assert.Equal(t, "BE", *params.Country)
+	assert.Equal(t, "", *params.Line2)
+}
+
+func TestGetResourceTierPrice_ListsIntervals(t *testing.T) {
+	ClearBillingCaches()
+	defer ClearBillingCaches()
+
+	fs := newFakeStripe(t)
+	intervalPrices(fs)
+	fs.handle("GET /v1/prices/price_std_month", func(r *http.Request) (int, any) {
+		return http.StatusOK, map[string]any{"id": "price_std_month", "object": "price", "currency": "eur", "unit_amount": 4900,
+			"recurring": map[string]any{"interval": "month"}}
+	})
+
+	tierPrice, err := newPricingBillingService().GetResourceTierPrice(context.Background(), "Konnektr.Graph", "standard", "eur")
+	require.NoError(t, err)
+	assert.Equal(t, "price_std_month", tierPrice.PriceID)
+	assert.Equal(t, "month", tierPrice.Interval)
+	assert.Equal(t, []models.ResourceIntervalPrice{
+		{PriceID: "price_std_month", Amount: 4900, Interval: "month"},
+		{PriceID: "price_std_year", Amount: 49000, Interval: "year"},
+	}, tierPrice.Prices)
+}
@@ -8,6 +8,7 @@ import (
 	"ktrlplane/internal/models"
 	"ktrlplane/internal/utils"
 
+	"github.com/stripe/stripe-go/v84"
 	"github.com/stripe/stripe-go/v84/subscription"
 )
 
@@ -31,7 +32,7 @@ func NewProjectService(cfg *config.Config) *ProjectService {
 func (s *ProjectService) CreateProject(ctx context.Context, req models.CreateProjectRequest, userID string) (*models.Project, error) {
 	// Validate the provided ID
 	if err := utils.ValidateDNSID(req.ID); err != nil {
-		return nil, fmt.Errorf("invalid project ID: %w", err)
+		return nil, Validation("invalid project ID: %v", err)
 	}
 
 	// Allow org_id to be optional. If provided, use it; if not, allow project without org.
@@ -65,8 +66,11 @@ func (s *ProjectService) CreateProject(ctx context.Context, req models.CreatePro
 	}
 
 	err = tx.QueryRow(ctx, db.CreateProjectWithTimestampsQuery,
-		project.ProjectID, project.OrgID, project.Name, project.Status).Scan(&project.CreatedAt, &project.UpdatedAt)
+		project.ProjectID, project.OrgID, project.Name, project.Status).Scan(&project.InheritsBillingFromOrg, &project.CreatedAt, &project.UpdatedAt)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, Conflict("project %s already exists", req.ID)
+		}
 		return nil, fmt.Errorf("failed to create project: %w", err)
 	}
 
@@ -86,6 +90,7 @@ func (s *ProjectService) CreateProject(ctx context.Context, req models.CreatePro
 	if err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	InvalidateUserPermissions(ctx, userID)
 
 	return project, nil
 }
@@ -98,7 +103,7 @@ func (s *ProjectService) GetProjectByID(ctx context.Context, projectID, userID s
 		return nil, fmt.Errorf("failed to check permissions: %w", err)
 	}
 	if !hasPermission {
-		return nil, fmt.Errorf("insufficient permissions to view project")
+		return nil, Forbidden("insufficient permissions to view project")
 	}
 
 	pool := db.GetDB()
@@ -110,13 +115,13 @@ func (s *ProjectService) GetProjectByID(ctx context.Context, projectID, userID s
 
 	if rows.Next() {
 		var project models.Project
-		if err := rows.Scan(&project.ProjectID, &project.OrgID, &project.Name, &project.Status, &project.CreatedAt, &project.UpdatedAt); err != nil {
+		if err := rows.Scan(&project.ProjectID, &project.OrgID, &project.Name, &project.Status, &project.InheritsBillingFromOrg, &project.CreatedAt, &project.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan project: %w", err)
 		}
 		return &project, nil
 	}
 
-	return nil, fmt.Errorf("project not found: %s", projectID)
+	return nil, NotFound("project not found: %s", projectID)
 }
 
 // ListProjects returns projects the user has access to (either directly or through organization access)
@@ -132,13 +137,13 @@ func (s *ProjectService) ListProjects(ctx context.Context, userID string) ([]mod
 	projects := make([]models.Project, 0)
 	for rows.Next() {
 		var project models.Project
-		if err := rows.Scan(&project.ProjectID, &project.OrgID, &project.Name, &project.Status, &project.CreatedAt, &project.UpdatedAt); err != nil {
+		if err := rows.Scan(&project.ProjectID, &project.OrgID, &project.Name, &project.Status, &project.InheritsBillingFromOrg, &project.CreatedAt, &project.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan project: %w", err)
 		}
 		projects = append(projects, project)
 	}
 
-	return projects, nil
+	return filterByTokenScope(ctx, userID, "project", projects, func(project models.Project) string { return project.ProjectID })
 }
 
 // UpdateProject updates a project if user has write access
@@ -149,7 +154,7 @@ func (s *ProjectService) UpdateProject(ctx context.Context, projectID string, re
 		return nil, fmt.Errorf("failed to check permissions: %w", err)
 	}
 	if !hasPermission {
-		return nil, fmt.Errorf("insufficient permissions to update project")
+		return nil, Forbidden("insufficient permissions to update project")
 	}
 
 	err = db.ExecQuery(ctx, db.UpdateProjectQuery, projectID, req.Name)
@@ -169,31 +174,45 @@ func (s *ProjectService) DeleteProject(ctx context.Context, projectID, userID st
 		return fmt.Errorf("failed to check permissions: %w", err)
 	}
 	if !hasPermission {
-		return fmt.Errorf("insufficient permissions to delete project")
+		return Forbidden("insufficient permissions to delete project")
 	}
 
-	// Cancel Stripe subscription and clean up billing account before deleting project
+	// Stop billing the project before deleting it. A project billed to its organization only
+	// gives up its own items; the organization keeps its subscription.
 	billingSvc := NewBillingService(s.config)
-	billingAccount, err := billingSvc.GetBillingAccount("project", projectID)
-	if err == nil && billingAccount != nil {
+	billingAccount, err := billingSvc.ResolveProjectBillingAccount(ctx, projectID)
+	if err == nil && billingAccount.ScopeType == "organization" {
+		billingSvc.RemoveProjectItems(ctx, billingAccount, projectID)
+	} else if err == nil {
+		defer InvalidateBillingInfo("project", projectID)
 		// Cancel Stripe subscription immediately (not at period end)
 		if billingAccount.StripeSubscriptionID != nil && *billingAccount.StripeSubscriptionID != "" {
-			_, err := subscription.Cancel(*billingAccount.StripeSubscriptionID, nil)
+			_, err := subscription.Cancel(*billingAccount.StripeSubscriptionID, &stripe.SubscriptionCancelParams{Params: stripe.Params{Context: ctx}})
 			if err != nil {
 				// Log error but continue with deletion to avoid orphaned database records
 				fmt.Printf("[ProjectService] Failed to cancel Stripe subscription %s: %v\n", *billingAccount.StripeSubscriptionID, err)
 			}
 		}
+	}
 
-		// Delete billing account record
-		deleteQuery := `DELETE FROM ktrlplane.billing_accounts WHERE scope_type = 'project' AND scope_id = $1`
-		err = db.ExecQuery(ctx, deleteQuery, projectID)
-		if err != nil {
-			// Log error but continue with project deletion
-			fmt.Printf("[ProjectService] Failed to delete billing account for project %s: %v\n", projectID, err)
-		}
+	// Delete billing account record
+	deleteQuery := `DELETE FROM ktrlplane.billing_accounts WHERE scope_type = 'project' AND scope_id = $1`
+	err = db.ExecQuery(ctx, deleteQuery, projectID)
+	if err != nil {
+		// Log error but continue with project deletion
+		fmt.Printf("[ProjectService] Failed to delete billing account for project %s: %v\n", projectID, err)
 	}
 
+	// Service accounts owned by the project do not cascade with it
+	if err := db.ExecQuery(ctx, db.DeleteServiceAccountsForProjectQuery, projectID); err != nil {
+		fmt.Printf("[ProjectService] Failed to delete service accounts for project %s: %v\n", projectID, err)
+	}
+	serviceAccounts.Clear()
+
 	// Delete the project (this will cascade delete resources, role assignments, etc.)
-	return db.ExecQuery(ctx, db.DeleteProjectQuery, projectID)
+	if err := db.ExecQuery(ctx, db.DeleteProjectQuery, projectID); err != nil {
+		return err
+	}
+	ClearPermissionCache(ctx)
+	return nil
 }
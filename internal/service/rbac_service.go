@@ -2,18 +2,22 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"ktrlplane/internal/db"
 	"ktrlplane/internal/models"
 	"ktrlplane/internal/utils"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 )
 
 // RBACService handles role-based access control operations.
-// Intentionally empty: all methods are stateless and operate on the database.
+// Intentionally empty: methods operate on the database, and permission decisions are
+// cached at package level so that every instance shares them.
 type RBACService struct{}
 
 // NewRBACService creates a new RBACService.
@@ -80,6 +84,15 @@ func (s *RBACService) ListPermissionsForRole(ctx context.Context, roleID string)
 
 // AssignRole assigns a role to a user for a specific scope
 func (s *RBACService) AssignRole(ctx context.Context, userID, roleID, scopeType, scopeID, assignedBy string) error {
+	return s.AssignRoleUntil(ctx, userID, roleID, scopeType, scopeID, assignedBy, nil)
+}
+
+// AssignRoleUntil assigns a role that expires at expiresAt, or never when expiresAt is nil.
+func (s *RBACService) AssignRoleUntil(ctx context.Context, userID, roleID, scopeType, scopeID, assignedBy string, expiresAt *time.Time) error {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return Validation("expires_at must be in the future")
+	}
+
 	pool := db.GetDB()
 
 	tx, err := pool.Begin(ctx)
@@ -92,16 +105,25 @@ func (s *RBACService) AssignRole(ctx context.Context, userID, roleID, scopeType,
 		}
 	}()
 
-	err = s.AssignRoleInTx(ctx, tx, userID, roleID, scopeType, scopeID, assignedBy)
+	err = s.assignRoleInTx(ctx, tx, userID, roleID, scopeType, scopeID, assignedBy, expiresAt)
 	if err != nil {
 		return err
 	}
 
-	return tx.Commit(ctx)
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	InvalidateUserPermissions(ctx, userID)
+	return nil
 }
 
-// AssignRoleInTx assigns a role within a transaction (exported for use by other services)
+// AssignRoleInTx assigns a role within a transaction (exported for use by other services).
+// Callers invalidate the user's cached permissions after committing tx.
 func (s *RBACService) AssignRoleInTx(ctx context.Context, tx pgx.Tx, userID, roleID, scopeType, scopeID, assignedBy string) error {
+	return s.assignRoleInTx(ctx, tx, userID, roleID, scopeType, scopeID, assignedBy, nil)
+}
+
+func (s *RBACService) assignRoleInTx(ctx context.Context, tx pgx.Tx, userID, roleID, scopeType, scopeID, assignedBy string, expiresAt *time.Time) error {
 	// Check if user exists, if not and userID looks like an email, create a placeholder user
 	var existingUserID string
 	err := tx.QueryRow(ctx, db.GetUserByIDQuery, userID).Scan(&existingUserID, new(string), new(string))
@@ -115,13 +137,29 @@ func (s *RBACService) AssignRoleInTx(ctx context.Context, tx pgx.Tx, userID, rol
 			}
 			fmt.Printf("[RBACService] Created placeholder user for invitation: %s\n", userID)
 		} else {
-			return fmt.Errorf("user %s does not exist and is not a valid email for invitation", userID)
+			return Validation("user %s does not exist and is not a valid email for invitation", userID)
+		}
+	}
+	if isTeamID(userID) {
+		if err := checkTeamAssignmentScope(ctx, tx, userID, scopeType, scopeID); err != nil {
+			return err
+		}
+	}
+	if isServiceAccountID(userID) {
+		if err := checkServiceAccountAssignmentScope(ctx, tx, userID, scopeType, scopeID); err != nil {
+			return err
 		}
 	}
 
-	// Insert role assignment (ON CONFLICT DO NOTHING to avoid duplicates)
+	// Insert role assignment. An existing assignment is kept, and only ever extended.
+	// expires_at is a TIMESTAMP column compared against NOW(), so store it in UTC.
+	var expiresUTC *time.Time
+	if expiresAt != nil {
+		utc := expiresAt.UTC()
+		expiresUTC = &utc
+	}
 	_, err = tx.Exec(ctx, db.AssignRoleWithTransactionQuery,
-		uuid.New().String(), userID, roleID, scopeType, scopeID, assignedBy)
+		uuid.New().String(), userID, roleID, scopeType, scopeID, assignedBy, expiresUTC)
 	if err != nil {
 		return fmt.Errorf("failed to assign role: %w", err)
 	}
@@ -131,39 +169,172 @@ func (s *RBACService) AssignRoleInTx(ctx context.Context, tx pgx.Tx, userID, rol
 
 // ListPermissions returns all actions (permissions) the user has for a given scope, considering inheritance
 func (s *RBACService) ListPermissions(ctx context.Context, userID, scopeType, scopeID string) ([]string, error) {
+	set, err := resolvePermissions(ctx, userID, scopeType, scopeID)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(set.actions), nil
+}
+
+// CheckPermission checks if a user has a specific permission on a resource.
+// Decisions are memoized per request and cached briefly across requests (see permission_cache.go).
+func (s *RBACService) CheckPermission(ctx context.Context, userID, action, scopeType, scopeID string) (bool, error) {
+	// Permissions are resolved with inheritance:
+	// 1. Direct assignment on the specific scope
+	// 2. Inherited from parent scopes (organization -> project -> resource)
+	set, err := resolvePermissions(ctx, userID, scopeType, scopeID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check permission: %w", err)
+	}
+	return set.has(action), nil
+}
+
+// CheckPermissions evaluates a batch of permission checks in a single query and
+// returns one decision per check, in order. Every check must have a UserID.
+func (s *RBACService) CheckPermissions(ctx context.Context, checks []models.PermissionCheck) ([]bool, error) {
+	if len(checks) == 0 {
+		return []bool{}, nil
+	}
+
+	userIDs := make([]string, len(checks))
+	scopeTypes := make([]string, len(checks))
+	scopeIDs := make([]string, len(checks))
+	actions := make([]string, len(checks))
+	for i, check := range checks {
+		userIDs[i], scopeTypes[i], scopeIDs[i], actions[i] = check.UserID, check.ScopeType, check.ScopeID, check.Action
+	}
+
 	pool := db.GetDB()
-	rows, err := pool.Query(ctx, db.ListPermissionsWithInheritanceQuery, userID, scopeType, scopeID)
+	rows, err := pool.Query(ctx, db.BatchCheckPermissionsQuery, userIDs, scopeTypes, scopeIDs, actions)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list permissions: %w", err)
+		return nil, fmt.Errorf("failed to check permissions: %w", err)
 	}
 	defer rows.Close()
 
-	var permissions []string
+	allowed := make([]bool, len(checks))
 	for rows.Next() {
-		var action string
-		if err := rows.Scan(&action); err != nil {
-			return nil, fmt.Errorf("failed to scan permission: %w", err)
+		var idx int
+		var ok bool
+		if err := rows.Scan(&idx, &ok); err != nil {
+			return nil, fmt.Errorf("failed to scan permission check: %w", err)
 		}
-		permissions = append(permissions, action)
+		allowed[idx] = ok
 	}
-	return permissions, nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to check permissions: %w", err)
+	}
+	for i, check := range checks {
+		if !allowed[i] {
+			continue
+		}
+		ok, err := tokenRestrictionFor(ctx, check.UserID).allows(ctx, check.Action, check.ScopeType, check.ScopeID)
+		if err != nil {
+			return nil, err
+		}
+		allowed[i] = ok
+	}
+	return allowed, nil
 }
 
-// CheckPermission checks if a user has a specific permission on a resource
-func (s *RBACService) CheckPermission(ctx context.Context, userID, action, scopeType, scopeID string) (bool, error) {
+// maxSuggestedRoles caps the roles suggested by ExplainPermission when access is denied.
+const maxSuggestedRoles = 3
+
+// ExplainPermission reports whether a user may perform an action on a scope and lists the
+// role assignments that grant it, nearest scope first. When no assignment grants the action
+// it suggests the least-privileged roles that would. Like CheckPermission, the decision is
+// limited by the scoped personal access token authenticating the user in ctx, if any.
+func (s *RBACService) ExplainPermission(ctx context.Context, userID, action, scopeType, scopeID string) (*models.PermissionExplanation, error) {
+	grants, err := loadPermissionGrants(ctx, userID, action, scopeType, scopeID)
+	if err != nil {
+		return nil, err
+	}
+
+	explanation := &models.PermissionExplanation{
+		UserID:    userID,
+		ScopeType: scopeType,
+		ScopeID:   scopeID,
+		Action:    action,
+		Allowed:   len(grants) > 0,
+		Grants:    grants,
+	}
+	// A scoped personal access token can withhold what the grants allow
+	if explanation.Allowed {
+		explanation.Allowed, err = tokenRestrictionFor(ctx, userID).allows(ctx, action, scopeType, scopeID)
+		if err != nil {
+			return nil, err
+		}
+		explanation.RestrictedByToken = !explanation.Allowed
+	}
+	if len(grants) == 0 {
+		explanation.Suggested, err = s.rolesGrantingAction(ctx, action, maxSuggestedRoles)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return explanation, nil
+}
+
+// loadPermissionGrants finds the assignments granting an action on a scope. Tests replace it.
+var loadPermissionGrants = queryPermissionGrants
+
+// queryPermissionGrants returns the assignments granting action to a user on a scope,
+// directly, through a team, or inherited from a parent scope, nearest scope first.
+func queryPermissionGrants(ctx context.Context, userID, action, scopeType, scopeID string) ([]models.PermissionGrant, error) {
 	pool := db.GetDB()
 
-	// This query checks permission inheritance:
-	// 1. Direct assignment on the specific scope
-	// 2. Inherited from parent scopes (organization -> project -> resource)
+	rows, err := pool.Query(ctx, db.ExplainPermissionGrantsQuery, userID, scopeType, scopeID, action)
+	if err != nil {
+		return nil, fmt.Errorf("failed to explain permission: %w", err)
+	}
+	defer rows.Close()
+
+	grants := make([]models.PermissionGrant, 0)
+	for rows.Next() {
+		var grant models.PermissionGrant
+		err := rows.Scan(
+			&grant.AssignmentID, &grant.RoleID, &grant.RoleName, &grant.RoleDisplayName,
+			&grant.ScopeType, &grant.ScopeID, &grant.InheritanceType,
+			&grant.AssignedBy, &grant.CreatedAt, &grant.ExpiresAt, &grant.TeamID, &grant.TeamName,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan permission grant: %w", err)
+		}
+		grants = append(grants, grant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to explain permission: %w", err)
+	}
+	return grants, nil
+}
 
-	var hasPermission bool
-	err := pool.QueryRow(ctx, db.CheckPermissionWithInheritanceQuery, userID, scopeType, scopeID, action).Scan(&hasPermission)
+// rolesGrantingAction returns up to limit visible roles that include action, least privileged first.
+func (s *RBACService) rolesGrantingAction(ctx context.Context, action string, limit int) ([]models.Role, error) {
+	pool := db.GetDB()
+	rows, err := pool.Query(ctx, db.GetRolesGrantingActionQuery, action, limit)
 	if err != nil {
-		return false, fmt.Errorf("failed to check permission: %w", err)
+		return nil, fmt.Errorf("failed to list roles granting %s: %w", action, err)
 	}
+	defer rows.Close()
 
-	return hasPermission, nil
+	roles := make([]models.Role, 0)
+	for rows.Next() {
+		var role models.Role
+		err := rows.Scan(
+			&role.RoleID,
+			&role.Name,
+			&role.DisplayName,
+			&role.Description,
+			&role.IsSystem,
+			&role.IsHidden,
+			&role.CreatedAt,
+			&role.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
 }
 
 // CanServiceAccountCheckPermissions checks if a service account (M2M client) has permission
@@ -173,12 +344,8 @@ func (s *RBACService) CheckPermission(ctx context.Context, userID, action, scope
 // Service accounts need a role assignment with the "check_permissions_on_behalf_of" permission
 // at the global scope (scope_type = "global", scope_id = "global").
 func (s *RBACService) CanServiceAccountCheckPermissions(ctx context.Context, serviceAccountID string) (bool, error) {
-	pool := db.GetDB()
-
 	// Check if the service account has the special permission at global scope
-	var hasPermission bool
-	err := pool.QueryRow(ctx, db.CheckPermissionWithInheritanceQuery,
-		serviceAccountID, "global", "global", "check_permissions_on_behalf_of").Scan(&hasPermission)
+	hasPermission, err := s.CheckPermission(ctx, serviceAccountID, "check_permissions_on_behalf_of", "global", "global")
 	if err != nil {
 		return false, fmt.Errorf("failed to check service account permission: %w", err)
 	}
@@ -225,11 +392,12 @@ func (s *RBACService) GetRoleAssignmentsForScope(ctx context.Context, scopeType,
 	for rows.Next() {
 		var assignment models.RoleAssignmentWithDetails
 		var userEmail, userName string
+		var isTeam bool
 		err := rows.Scan(
 			&assignment.AssignmentID, &assignment.UserID, &assignment.RoleID, &assignment.ScopeType, &assignment.ScopeID,
 			&assignment.AssignedBy, &assignment.CreatedAt, &assignment.ExpiresAt,
 			&assignment.Role.Name, &assignment.Role.DisplayName, &assignment.Role.Description, &assignment.Role.IsSystem,
-			&userEmail, &userName,
+			&userEmail, &userName, &isTeam,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan role assignment: %w", err)
@@ -244,10 +412,21 @@ func (s *RBACService) GetRoleAssignmentsForScope(ctx context.Context, scopeType,
 		assignment.User.ID = assignment.UserID
 		assignment.User.Email = userEmail
 		assignment.User.Name = userName
+		assignment.PrincipalType = models.PrincipalUser
+		if isTeam {
+			assignment.PrincipalType = models.PrincipalTeam
+		}
 
 		assignments = append(assignments, assignment)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list role assignments: %w", err)
+	}
+	rows.Close()
 
+	if err := attachTeamMembers(ctx, assignments); err != nil {
+		return nil, err
+	}
 	return assignments, nil
 }
 
@@ -265,12 +444,14 @@ func (s *RBACService) GetRoleAssignmentsWithInheritance(ctx context.Context, sco
 	for rows.Next() {
 		var assignment models.RoleAssignmentWithDetails
 		var userEmail, userName string
+		var isTeam bool
 		err := rows.Scan(
 			&assignment.AssignmentID, &assignment.UserID, &assignment.RoleID, &assignment.ScopeType, &assignment.ScopeID,
 			&assignment.AssignedBy, &assignment.CreatedAt, &assignment.ExpiresAt,
 			&assignment.Role.Name, &assignment.Role.DisplayName, &assignment.Role.Description, &assignment.Role.IsSystem,
 			&userEmail, &userName,
 			&assignment.InheritanceType, &assignment.InheritedFromScopeType, &assignment.InheritedFromScopeID, &assignment.InheritedFromName,
+			&isTeam,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan role assignment with inheritance: %w", err)
@@ -285,10 +466,21 @@ func (s *RBACService) GetRoleAssignmentsWithInheritance(ctx context.Context, sco
 		assignment.User.ID = assignment.UserID
 		assignment.User.Email = userEmail
 		assignment.User.Name = userName
+		assignment.PrincipalType = models.PrincipalUser
+		if isTeam {
+			assignment.PrincipalType = models.PrincipalTeam
+		}
 
 		assignments = append(assignments, assignment)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list role assignments: %w", err)
+	}
+	rows.Close()
 
+	if err := attachTeamMembers(ctx, assignments); err != nil {
+		return nil, err
+	}
 	return assignments, nil
 }
 
@@ -315,13 +507,14 @@ func (s *RBACService) SearchUsers(ctx context.Context, query string) ([]models.U
 // DeleteRoleAssignment deletes a role assignment by assignment ID (unique)
 func (s *RBACService) DeleteRoleAssignment(ctx context.Context, assignmentID string) error {
 	pool := db.GetDB()
-	query := db.DeleteRoleAssignmentQuery
-	cmdTag, err := pool.Exec(ctx, query, assignmentID)
+	var userID string
+	err := pool.QueryRow(ctx, db.DeleteRoleAssignmentQuery, assignmentID).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return NotFound("role assignment %s not found", assignmentID)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to delete role assignment %s: %w", assignmentID, err)
 	}
-	if cmdTag.RowsAffected() == 0 {
-		return fmt.Errorf("role assignment %s not found", assignmentID)
-	}
+	InvalidateUserPermissions(ctx, userID)
 	return nil
 }
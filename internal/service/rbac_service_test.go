@@ -1,7 +1,9 @@
 package service
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -274,3 +276,34 @@ func TestRBACService_RoleNames(t *testing.T) {
 // Note: Full integration tests for RBAC methods require database setup
 // These should be in separate integration test files with proper DB fixtures
 // The tests above focus on parameter validation and business logic structure
+
+func TestRBACService_AssignRoleUntilRejectsPastExpiry(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	err := NewRBACService().AssignRoleUntil(context.Background(), "user123", "role123", "project", "project123", "admin", &past)
+	assert.ErrorIs(t, err, ErrValidation)
+}
+
+func TestRBACService_MergeUsersRequiresManageUsers(t *testing.T) {
+	countingLoader(t, "read", "manage_access")
+	_, err := NewRBACService().MergeUsers(context.Background(), "admin", "old", "new")
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestRBACService_MergeUsersRejectsSelfMerge(t *testing.T) {
+	countingLoader(t, "manage_users")
+	_, err := NewRBACService().MergeUsers(context.Background(), "admin", "user-1", "user-1")
+	assert.ErrorIs(t, err, ErrValidation)
+}
+
+func TestMergeUsersInTx_RejectsNonHumanPrincipals(t *testing.T) {
+	for _, pair := range [][2]string{
+		{"team-1", "user-1"},
+		{"user-1", "team-1"},
+		{"sa-1", "user-1"},
+		{"user-1", "sa-1"},
+	} {
+		// Rejected before the transaction is used
+		_, err := mergeUsersInTx(context.Background(), nil, pair[0], pair[1], "admin")
+		assert.ErrorIs(t, err, ErrValidation, "%s into %s", pair[0], pair[1])
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"ktrlplane/internal/telemetry"
+	"net/http"
 	"os"
 	"path/filepath"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -26,6 +29,9 @@ func NewSecretService() (*SecretService, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get kubernetes config: %w", err)
 	}
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return telemetry.Transport("kubernetes", rt, telemetry.KubernetesRoute)
+	})
 
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
@@ -65,6 +71,21 @@ func getKubernetesConfig() (*rest.Config, error) {
 	return config, nil
 }
 
+// kubernetesError maps a Kubernetes API error for the named object to a domain error.
+func kubernetesError(err error, format string, args ...any) error {
+	object := fmt.Sprintf(format, args...)
+	switch {
+	case apierrors.IsNotFound(err):
+		return Wrap(ErrNotFound, err, "%s not found", object)
+	case apierrors.IsAlreadyExists(err):
+		return Wrap(ErrConflict, err, "%s already exists", object)
+	case apierrors.IsInvalid(err):
+		return Wrap(ErrValidation, err, "%s is invalid", object)
+	default:
+		return Upstream(err, "kubernetes request for %s failed", object)
+	}
+}
+
 // SecretData represents the base64-encoded secret data.
 // Data values are returned as base64 strings and should be decoded in the frontend.
 type SecretData struct {
@@ -85,7 +106,7 @@ func (s *SecretService) GetProjectSecret(ctx context.Context, projectID, secretN
 		return nil, fmt.Errorf("failed to check permissions: %w", err)
 	}
 	if !hasPermission {
-		return nil, fmt.Errorf("insufficient permissions to access project secrets")
+		return nil, Forbidden("insufficient permissions to access project secrets")
 	}
 
 	// Project ID is the namespace name
@@ -94,7 +115,7 @@ func (s *SecretService) GetProjectSecret(ctx context.Context, projectID, secretN
 	// Retrieve the secret from Kubernetes
 	secret, err := s.clientset.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve secret '%s' from namespace '%s': %w", secretName, namespace, err)
+		return nil, kubernetesError(err, "secret '%s' in namespace '%s'", secretName, namespace)
 	}
 
 	// Keep secret data base64-encoded (convert byte arrays to base64 strings)
@@ -124,7 +145,7 @@ func (s *SecretService) CreateProjectSecret(ctx context.Context, projectID strin
 		return nil, fmt.Errorf("failed to check permissions: %w", err)
 	}
 	if !hasPermission {
-		return nil, fmt.Errorf("insufficient permissions to create project secrets")
+		return nil, Forbidden("insufficient permissions to create project secrets")
 	}
 
 	namespace := projectID
@@ -161,7 +182,7 @@ func (s *SecretService) CreateProjectSecret(ctx context.Context, projectID strin
 
 	createdSecret, err := s.clientset.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create secret: %w", err)
+		return nil, kubernetesError(err, "secret '%s'", data.Name)
 	}
 
 	// Helper to reconstruct response (similar to Get)
@@ -188,7 +209,7 @@ func (s *SecretService) UpdateProjectSecret(ctx context.Context, projectID strin
 		return nil, fmt.Errorf("failed to check permissions: %w", err)
 	}
 	if !hasPermission {
-		return nil, fmt.Errorf("insufficient permissions to update project secrets")
+		return nil, Forbidden("insufficient permissions to update project secrets")
 	}
 
 	namespace := projectID
@@ -196,7 +217,7 @@ func (s *SecretService) UpdateProjectSecret(ctx context.Context, projectID strin
 	// Get existing secret to ensure it exists and preserve any metadata if needed
 	existingSecret, err := s.clientset.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve secret for update: %w", err)
+		return nil, kubernetesError(err, "secret '%s'", secretName)
 	}
 
 	// Update encoded data
@@ -216,7 +237,7 @@ func (s *SecretService) UpdateProjectSecret(ctx context.Context, projectID strin
 
 	updatedSecret, err := s.clientset.CoreV1().Secrets(namespace).Update(ctx, existingSecret, metav1.UpdateOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to update secret: %w", err)
+		return nil, kubernetesError(err, "secret '%s'", secretName)
 	}
 
 	// Helper to reconstruct response
@@ -0,0 +1,582 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ktrlplane/internal/cache"
+	"ktrlplane/internal/config"
+	"ktrlplane/internal/db"
+	"ktrlplane/internal/models"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ServiceAccountTokenIssuer is the iss and aud claim of KtrlPlane-signed service account tokens.
+const ServiceAccountTokenIssuer = "ktrlplane"
+
+// Audit event types for service accounts.
+const (
+	AuditServiceAccountCreated       = "service_account.created"
+	AuditServiceAccountUpdated       = "service_account.updated"
+	AuditServiceAccountDeleted       = "service_account.deleted"
+	AuditServiceAccountSecretCreated = "service_account.secret_created"
+	AuditServiceAccountSecretDeleted = "service_account.secret_deleted"
+)
+
+const (
+	serviceAccountIDPrefix     = "sa-"
+	serviceAccountSecretPrefix = "kpsa_"
+
+	// defaultServiceAccountTokenTTL applies when auth.service_account_tokens.ttl_minutes is not set.
+	defaultServiceAccountTokenTTL = time.Hour
+
+	// serviceAccountCacheTTL bounds how long another replica may keep accepting tokens
+	// of a service account after it was disabled or deleted.
+	serviceAccountCacheTTL = 30 * time.Second
+
+	// serviceAccountTouchInterval throttles last_used_at updates per service account.
+	serviceAccountTouchInterval = time.Minute
+)
+
+var (
+	// serviceAccounts caches token lookups; a nil value means the token does not
+	// belong to a managed service account.
+	serviceAccounts = cache.New[*models.ServiceAccount]("service-accounts", serviceAccountCacheTTL)
+
+	// serviceAccountTouches records when last_used_at was last written per service account.
+	serviceAccountTouches sync.Map // map[string]time.Time
+)
+
+// ServiceAccountService manages service accounts, their client secrets and tokens.
+type ServiceAccountService struct {
+	rbacService    *RBACService
+	signingKey     []byte
+	tokenTTL       time.Duration
+	trustedIssuers []string // Issuers whose clients can be mapped to service accounts
+	now            func() time.Time
+}
+
+// NewServiceAccountService creates a new ServiceAccountService. Access tokens are only
+// issued when auth.service_account_tokens.signing_key is configured.
+func NewServiceAccountService(cfg *config.Config) *ServiceAccountService {
+	ttl := time.Duration(cfg.Auth.ServiceAccountTokens.TTLMinutes) * time.Minute
+	if ttl <= 0 {
+		ttl = defaultServiceAccountTokenTTL
+	}
+	return &ServiceAccountService{
+		rbacService:    NewRBACService(),
+		signingKey:     []byte(cfg.Auth.ServiceAccountTokens.SigningKey),
+		tokenTTL:       ttl,
+		trustedIssuers: trustedIssuerURLs(cfg),
+		now:            time.Now,
+	}
+}
+
+// trustedIssuerURLs lists the iss values of the configured token issuers.
+func trustedIssuerURLs(cfg *config.Config) []string {
+	var issuers []string
+	if cfg.Auth.Issuer != "" {
+		issuers = append(issuers, cfg.Auth.Issuer)
+	}
+	for _, issuer := range cfg.Auth.Issuers {
+		issuers = append(issuers, issuer.Issuer)
+	}
+	return issuers
+}
+
+// scanServiceAccount scans a row selected with the service account column list.
+func scanServiceAccount(row pgx.Row) (*models.ServiceAccount, error) {
+	var sa models.ServiceAccount
+	err := row.Scan(
+		&sa.ServiceAccountID, &sa.Name, &sa.Description, &sa.ScopeType, &sa.ScopeID, &sa.ExternalIssuer, &sa.ExternalClientID,
+		&sa.Disabled, &sa.CreatedBy, &sa.LastUsedAt, &sa.CreatedAt, &sa.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &sa, nil
+}
+
+// scanServiceAccountSecret scans a row selected with the client secret column list.
+func scanServiceAccountSecret(row pgx.Row) (*models.ServiceAccountSecret, error) {
+	var secret models.ServiceAccountSecret
+	err := row.Scan(
+		&secret.SecretID, &secret.ServiceAccountID, &secret.Description,
+		&secret.ExpiresAt, &secret.LastUsedAt, &secret.CreatedBy, &secret.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+// normalizeClientID trims an external issuer or client ID and maps "" to nil.
+func normalizeClientID(clientID *string) *string {
+	if clientID == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*clientID)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
+
+// checkExternalClient authorizes and validates a change of the external client mapped to a
+// service account. Every token of a mapped client acts as the service account, so only
+// platform administrators, with manage_users at global scope, may map one, and only from a
+// trusted issuer. issuer and clientID are normalized; both nil clears the mapping.
+func (s *ServiceAccountService) checkExternalClient(ctx context.Context, userID string, issuer, clientID *string) error {
+	canManage, err := s.rbacService.CheckPermission(ctx, userID, "manage_users", "global", "global")
+	if err != nil {
+		return err
+	}
+	if !canManage {
+		return Forbidden("mapping an external client requires the 'manage_users' permission at global scope")
+	}
+	if (issuer == nil) != (clientID == nil) {
+		return Validation("external_issuer and external_client_id must be set together")
+	}
+	if issuer != nil && !slices.Contains(s.trustedIssuers, *issuer) {
+		return Validation("issuer %s is not a trusted token issuer", *issuer)
+	}
+	return nil
+}
+
+// CreateServiceAccount creates a service account owned by an organization or project.
+// Requires manage_access on the scope, and manage_users at global scope to map an external client.
+func (s *ServiceAccountService) CreateServiceAccount(ctx context.Context, userID, scopeType, scopeID string, req models.CreateServiceAccountRequest) (*models.ServiceAccount, error) {
+	if err := s.rbacService.requireManageAccess(ctx, userID, scopeType, scopeID); err != nil {
+		return nil, err
+	}
+	issuer, clientID := normalizeClientID(req.ExternalIssuer), normalizeClientID(req.ExternalClientID)
+	if req.ExternalIssuer != nil || req.ExternalClientID != nil {
+		if err := s.checkExternalClient(ctx, userID, issuer, clientID); err != nil {
+			return nil, err
+		}
+	}
+
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	id := serviceAccountIDPrefix + uuid.New().String()
+	if _, err := tx.Exec(ctx, db.CreateServiceAccountUserQuery, id, req.Name); err != nil {
+		return nil, fmt.Errorf("failed to create service account user: %w", err)
+	}
+	sa, err := scanServiceAccount(tx.QueryRow(ctx, db.CreateServiceAccountQuery,
+		id, req.Name, req.Description, scopeType, scopeID, issuer, clientID, userID))
+	if isUniqueViolation(err) {
+		return nil, Conflict("client %s of %s is already mapped to another service account", *clientID, *issuer)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service account: %w", err)
+	}
+
+	err = recordAuditEvent(ctx, tx, AuditServiceAccountCreated, userID, id, scopeType, scopeID, map[string]any{
+		"name":               sa.Name,
+		"external_issuer":    sa.ExternalIssuer,
+		"external_client_id": sa.ExternalClientID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit service account: %w", err)
+	}
+	serviceAccounts.Clear()
+	return sa, nil
+}
+
+// ListServiceAccounts lists the service accounts owned by a scope. Requires read on the scope.
+func (s *ServiceAccountService) ListServiceAccounts(ctx context.Context, userID, scopeType, scopeID string) ([]models.ServiceAccount, error) {
+	if err := s.requireRead(ctx, userID, scopeType, scopeID); err != nil {
+		return nil, err
+	}
+
+	pool := db.GetDB()
+	rows, err := pool.Query(ctx, db.ListServiceAccountsForScopeQuery, scopeType, scopeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list service accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := make([]models.ServiceAccount, 0)
+	for rows.Next() {
+		sa, err := scanServiceAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan service account: %w", err)
+		}
+		accounts = append(accounts, *sa)
+	}
+	return accounts, rows.Err()
+}
+
+// GetServiceAccount returns a service account owned by a scope. Requires read on the scope.
+func (s *ServiceAccountService) GetServiceAccount(ctx context.Context, userID, scopeType, scopeID, serviceAccountID string) (*models.ServiceAccount, error) {
+	if err := s.requireRead(ctx, userID, scopeType, scopeID); err != nil {
+		return nil, err
+	}
+	return s.getServiceAccount(ctx, scopeType, scopeID, serviceAccountID)
+}
+
+func (s *ServiceAccountService) getServiceAccount(ctx context.Context, scopeType, scopeID, serviceAccountID string) (*models.ServiceAccount, error) {
+	sa, err := scanServiceAccount(db.GetDB().QueryRow(ctx, db.GetServiceAccountQuery, serviceAccountID, scopeType, scopeID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, NotFound("service account %s not found", serviceAccountID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service account: %w", err)
+	}
+	return sa, nil
+}
+
+// UpdateServiceAccount renames, remaps, disables or re-enables a service account.
+// Requires manage_access on the scope, and manage_users at global scope to change the
+// external client.
+func (s *ServiceAccountService) UpdateServiceAccount(ctx context.Context, userID, scopeType, scopeID, serviceAccountID string, req models.UpdateServiceAccountRequest) (*models.ServiceAccount, error) {
+	if err := s.rbacService.requireManageAccess(ctx, userID, scopeType, scopeID); err != nil {
+		return nil, err
+	}
+	clearClientID := req.ExternalClientID != nil && strings.TrimSpace(*req.ExternalClientID) == ""
+	issuer, clientID := normalizeClientID(req.ExternalIssuer), normalizeClientID(req.ExternalClientID)
+	if req.ExternalIssuer != nil || req.ExternalClientID != nil {
+		if clearClientID {
+			issuer = nil
+		}
+		if err := s.checkExternalClient(ctx, userID, issuer, clientID); err != nil {
+			return nil, err
+		}
+	}
+
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	sa, err := scanServiceAccount(tx.QueryRow(ctx, db.UpdateServiceAccountQuery,
+		serviceAccountID, scopeType, scopeID, req.Name, req.Description, clearClientID, clientID, req.Disabled, issuer))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, NotFound("service account %s not found", serviceAccountID)
+	}
+	if isUniqueViolation(err) {
+		return nil, Conflict("client %s of %s is already mapped to another service account", *clientID, *issuer)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update service account: %w", err)
+	}
+	if req.Name != nil {
+		if _, err := tx.Exec(ctx, db.UpdateServiceAccountUserNameQuery, serviceAccountID, *req.Name); err != nil {
+			return nil, fmt.Errorf("failed to rename service account user: %w", err)
+		}
+	}
+
+	details := map[string]any{"name": sa.Name, "external_issuer": sa.ExternalIssuer, "external_client_id": sa.ExternalClientID, "disabled": sa.Disabled}
+	if err := recordAuditEvent(ctx, tx, AuditServiceAccountUpdated, userID, serviceAccountID, scopeType, scopeID, details); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit service account update: %w", err)
+	}
+	serviceAccounts.Clear()
+	return sa, nil
+}
+
+// DeleteServiceAccount deletes a service account with its secrets and role assignments.
+// Roles it granted to others stay in place and are attributed to the deleting user.
+// Requires manage_access on the scope.
+func (s *ServiceAccountService) DeleteServiceAccount(ctx context.Context, userID, scopeType, scopeID, serviceAccountID string) error {
+	if err := s.rbacService.requireManageAccess(ctx, userID, scopeType, scopeID); err != nil {
+		return err
+	}
+
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, db.ReassignRoleAssignmentGrantorQuery, serviceAccountID, userID); err != nil {
+		return fmt.Errorf("failed to reassign role assignments granted by service account: %w", err)
+	}
+	tag, err := tx.Exec(ctx, db.DeleteServiceAccountQuery, serviceAccountID, scopeType, scopeID)
+	if err != nil {
+		return fmt.Errorf("failed to delete service account: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return NotFound("service account %s not found", serviceAccountID)
+	}
+
+	if err := recordAuditEvent(ctx, tx, AuditServiceAccountDeleted, userID, serviceAccountID, scopeType, scopeID, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit service account deletion: %w", err)
+	}
+	serviceAccounts.Clear()
+	InvalidateUserPermissions(ctx, serviceAccountID)
+	return nil
+}
+
+// CreateSecret issues a client secret for a service account. The secret is only
+// returned here; KtrlPlane stores its hash. Requires manage_access on the scope.
+func (s *ServiceAccountService) CreateSecret(ctx context.Context, userID, scopeType, scopeID, serviceAccountID string, req models.CreateServiceAccountSecretRequest) (*models.CreatedServiceAccountSecret, error) {
+	if err := s.rbacService.requireManageAccess(ctx, userID, scopeType, scopeID); err != nil {
+		return nil, err
+	}
+	if _, err := s.getServiceAccount(ctx, scopeType, scopeID, serviceAccountID); err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate client secret: %w", err)
+	}
+	secret := serviceAccountSecretPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		expires := s.now().UTC().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &expires
+	}
+
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	created, err := scanServiceAccountSecret(tx.QueryRow(ctx, db.CreateServiceAccountSecretQuery,
+		uuid.New().String(), serviceAccountID, hashToken(secret), req.Description, expiresAt, userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client secret: %w", err)
+	}
+	err = recordAuditEvent(ctx, tx, AuditServiceAccountSecretCreated, userID, serviceAccountID, scopeType, scopeID, map[string]any{
+		"secret_id":  created.SecretID,
+		"expires_at": created.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit client secret: %w", err)
+	}
+	return &models.CreatedServiceAccountSecret{ServiceAccountSecret: *created, Secret: secret}, nil
+}
+
+// ListSecrets lists the client secrets of a service account, without their values.
+// Requires manage_access on the scope.
+func (s *ServiceAccountService) ListSecrets(ctx context.Context, userID, scopeType, scopeID, serviceAccountID string) ([]models.ServiceAccountSecret, error) {
+	if err := s.rbacService.requireManageAccess(ctx, userID, scopeType, scopeID); err != nil {
+		return nil, err
+	}
+	if _, err := s.getServiceAccount(ctx, scopeType, scopeID, serviceAccountID); err != nil {
+		return nil, err
+	}
+
+	pool := db.GetDB()
+	rows, err := pool.Query(ctx, db.ListServiceAccountSecretsQuery, serviceAccountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list client secrets: %w", err)
+	}
+	defer rows.Close()
+
+	secrets := make([]models.ServiceAccountSecret, 0)
+	for rows.Next() {
+		secret, err := scanServiceAccountSecret(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan client secret: %w", err)
+		}
+		secrets = append(secrets, *secret)
+	}
+	return secrets, rows.Err()
+}
+
+// DeleteSecret revokes a client secret. Tokens already issued with it stay valid until
+// they expire; disable the service account to cut access immediately.
+// Requires manage_access on the scope.
+func (s *ServiceAccountService) DeleteSecret(ctx context.Context, userID, scopeType, scopeID, serviceAccountID, secretID string) error {
+	if err := s.rbacService.requireManageAccess(ctx, userID, scopeType, scopeID); err != nil {
+		return err
+	}
+	if _, err := s.getServiceAccount(ctx, scopeType, scopeID, serviceAccountID); err != nil {
+		return err
+	}
+
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	tag, err := tx.Exec(ctx, db.DeleteServiceAccountSecretQuery, secretID, serviceAccountID)
+	if err != nil {
+		return fmt.Errorf("failed to delete client secret: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return NotFound("client secret %s not found", secretID)
+	}
+	err = recordAuditEvent(ctx, tx, AuditServiceAccountSecretDeleted, userID, serviceAccountID, scopeType, scopeID, map[string]any{
+		"secret_id": secretID,
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit client secret deletion: %w", err)
+	}
+	return nil
+}
+
+// IssueToken exchanges a client secret for a KtrlPlane-signed access token
+// (OAuth 2.0 client credentials grant). The client ID is the service account ID.
+func (s *ServiceAccountService) IssueToken(ctx context.Context, clientID, clientSecret string) (*models.ServiceAccountToken, error) {
+	if len(s.signingKey) == 0 {
+		return nil, NotFound("service account tokens are not enabled on this server")
+	}
+	if clientID == "" || clientSecret == "" {
+		return nil, Unauthorized("Invalid client credentials")
+	}
+
+	var secretID string
+	err := db.GetDB().QueryRow(ctx, db.UseServiceAccountSecretQuery, clientID, hashToken(clientSecret)).Scan(&secretID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, Unauthorized("Invalid client credentials")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify client secret: %w", err)
+	}
+
+	token, err := s.signToken(clientID)
+	if err != nil {
+		return nil, err
+	}
+	TouchServiceAccount(ctx, clientID)
+	return &models.ServiceAccountToken{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.tokenTTL.Seconds()),
+	}, nil
+}
+
+// signToken returns an HS256 JWT for a service account, accepted by the auth middleware
+// when the same signing key is configured.
+func (s *ServiceAccountService) signToken(serviceAccountID string) (string, error) {
+	now := s.now()
+	header := []byte(`{"alg":"HS256","typ":"JWT"}`)
+	payload, err := json.Marshal(map[string]any{
+		"iss":       ServiceAccountTokenIssuer,
+		"aud":       ServiceAccountTokenIssuer,
+		"sub":       serviceAccountID,
+		"client_id": serviceAccountID,
+		"iat":       now.Unix(),
+		"exp":       now.Add(s.tokenTTL).Unix(),
+		"jti":       uuid.New().String(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode access token: %w", err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (s *ServiceAccountService) requireRead(ctx context.Context, userID, scopeType, scopeID string) error {
+	canRead, err := s.rbacService.CheckPermission(ctx, userID, "read", scopeType, scopeID)
+	if err != nil {
+		return err
+	}
+	if !canRead {
+		return Forbidden("insufficient permissions to view service accounts on this %s", scopeType)
+	}
+	return nil
+}
+
+// isServiceAccountID reports whether a principal ID belongs to a service account.
+func isServiceAccountID(id string) bool {
+	return strings.HasPrefix(id, serviceAccountIDPrefix)
+}
+
+// checkServiceAccountAssignmentScope rejects role assignments to a service account outside the
+// scope owning it and its descendants. Whoever manages that scope can mint secrets for the
+// service account, so it must not carry roles they could not grant themselves.
+func checkServiceAccountAssignmentScope(ctx context.Context, q querier, serviceAccountID, scopeType, scopeID string) error {
+	var ownerType, ownerID string
+	err := q.QueryRow(ctx, db.GetServiceAccountScopeQuery, serviceAccountID).Scan(&ownerType, &ownerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return NotFound("service account %s not found", serviceAccountID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get service account scope: %w", err)
+	}
+	within, err := scopeWithin(ctx, ownerType, ownerID, scopeType, scopeID)
+	if err != nil {
+		return err
+	}
+	if !within {
+		return Validation("service account %s can only be assigned roles within its %s", serviceAccountID, ownerType)
+	}
+	return nil
+}
+
+// ResolveServiceAccount returns the managed service account behind a service account
+// token, or nil for unmanaged clients. KtrlPlane-issued tokens are matched by service
+// account ID; tokens of external issuers by the mapped issuer and client ID.
+func ResolveServiceAccount(ctx context.Context, issuer, subject, clientID string) (*models.ServiceAccount, error) {
+	issuedByKtrlPlane := issuer == ServiceAccountTokenIssuer
+	key := clientID
+	if issuedByKtrlPlane {
+		key = subject
+	}
+	if key == "" {
+		return nil, nil
+	}
+
+	return serviceAccounts.GetOrLoad(ctx, issuer+"\x00"+key, func() (*models.ServiceAccount, error) {
+		row := db.GetDB().QueryRow(ctx, db.GetServiceAccountByClientIDQuery, issuer, clientID)
+		if issuedByKtrlPlane {
+			row = db.GetDB().QueryRow(ctx, db.GetServiceAccountByIDQuery, subject)
+		}
+		sa, err := scanServiceAccount(row)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve service account: %w", err)
+		}
+		return sa, nil
+	}, nil)
+}
+
+// TouchServiceAccount records that a service account authenticated, at most once per
+// serviceAccountTouchInterval per replica. Failures are logged, not returned.
+func TouchServiceAccount(ctx context.Context, serviceAccountID string) {
+	now := time.Now()
+	if last, ok := serviceAccountTouches.Load(serviceAccountID); ok && now.Sub(last.(time.Time)) < serviceAccountTouchInterval {
+		return
+	}
+	serviceAccountTouches.Store(serviceAccountID, now)
+	if err := db.ExecQuery(ctx, db.TouchServiceAccountQuery, serviceAccountID); err != nil {
+		fmt.Printf("[ServiceAccountService] Failed to record last use of %s: %v\n", serviceAccountID, err)
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"ktrlplane/internal/config"
+	"ktrlplane/internal/db"
+	"ktrlplane/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewServiceAccountService_Defaults(t *testing.T) {
+	svc := NewServiceAccountService(&config.Config{})
+	assert.Equal(t, defaultServiceAccountTokenTTL, svc.tokenTTL)
+	assert.Empty(t, svc.signingKey)
+
+	svc = NewServiceAccountService(&config.Config{Auth: config.AuthConfig{
+		ServiceAccountTokens: config.ServiceAccountTokensConfig{SigningKey: "k", TTLMinutes: 5},
+	}})
+	assert.Equal(t, 5*time.Minute, svc.tokenTTL)
+	assert.Equal(t, []byte("k"), svc.signingKey)
+}
+
+func TestServiceAccountService_SignToken(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	svc := NewServiceAccountService(&config.Config{Auth: config.AuthConfig{
+		ServiceAccountTokens: config.ServiceAccountTokensConfig{SigningKey: "secret", TTLMinutes: 10},
+	}})
+	svc.now = func() time.Time { return now }
+
+	token, err := svc.signToken("sa-1")
+	require.NoError(t, err)
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), parts[2])
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+	var claims map[string]any
+	require.NoError(t, json.Unmarshal(payload, &claims))
+	assert.Equal(t, ServiceAccountTokenIssuer, claims["iss"])
+	assert.Equal(t, ServiceAccountTokenIssuer, claims["aud"])
+	assert.Equal(t, "sa-1", claims["sub"])
+	assert.Equal(t, "sa-1", claims["client_id"])
+	assert.EqualValues(t, now.Add(10*time.Minute).Unix(), claims["exp"])
+}
+
+func TestServiceAccountService_IssueTokenRequiresSigningKey(t *testing.T) {
+	_, err := NewServiceAccountService(&config.Config{}).IssueToken(context.Background(), "sa-1", "kpsa_x")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestServiceAccountService_RequiresPermissions(t *testing.T) {
+	countingLoader(t, "read")
+	svc := NewServiceAccountService(&config.Config{})
+	ctx := context.Background()
+
+	_, err := svc.CreateServiceAccount(ctx, "user-1", "organization", "org-1", models.CreateServiceAccountRequest{Name: "ci"})
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = svc.UpdateServiceAccount(ctx, "user-1", "organization", "org-1", "sa-1", models.UpdateServiceAccountRequest{})
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.ErrorIs(t, svc.DeleteServiceAccount(ctx, "user-1", "organization", "org-1", "sa-1"), ErrForbidden)
+	_, err = svc.CreateSecret(ctx, "user-1", "project", "p1", "sa-1", models.CreateServiceAccountSecretRequest{})
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = svc.ListSecrets(ctx, "user-1", "project", "p1", "sa-1")
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	countingLoader(t)
+	_, err = svc.ListServiceAccounts(ctx, "user-1", "project", "p1")
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestServiceAccountService_ExternalClientRequiresPlatformAdmin(t *testing.T) {
+	countingLoader(t, "read", "manage_access")
+	svc := NewServiceAccountService(&config.Config{Auth: config.AuthConfig{Issuer: "https://tenant.auth0.com/"}})
+	ctx := context.Background()
+	issuer, clientID := "https://tenant.auth0.com/", "platform-deployer"
+
+	// A scope administrator cannot claim another tenant's or the platform's client
+	_, err := svc.CreateServiceAccount(ctx, "user-1", "organization", "org-1", models.CreateServiceAccountRequest{
+		Name: "ci", ExternalIssuer: &issuer, ExternalClientID: &clientID,
+	})
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = svc.UpdateServiceAccount(ctx, "user-1", "organization", "org-1", "sa-1", models.UpdateServiceAccountRequest{
+		ExternalIssuer: &issuer, ExternalClientID: &clientID,
+	})
+	assert.ErrorIs(t, err, ErrForbidden)
+	cleared := ""
+	_, err = svc.UpdateServiceAccount(ctx, "user-1", "organization", "org-1", "sa-1", models.UpdateServiceAccountRequest{ExternalClientID: &cleared})
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestServiceAccountService_ExternalClientValidation(t *testing.T) {
+	countingLoader(t, "manage_access", "manage_users")
+	svc := NewServiceAccountService(&config.Config{Auth: config.AuthConfig{
+		Issuers: []config.OIDCIssuerConfig{{Issuer: "https://keycloak.example.com/realms/acme"}},
+	}})
+	ctx := context.Background()
+	trusted, untrusted, clientID := "https://keycloak.example.com/realms/acme", "https://evil.example.com", "deployer"
+
+	tests := []struct {
+		name string
+		req  models.CreateServiceAccountRequest
+	}{
+		{"client without issuer", models.CreateServiceAccountRequest{Name: "ci", ExternalClientID: &clientID}},
+		{"issuer without client", models.CreateServiceAccountRequest{Name: "ci", ExternalIssuer: &trusted}},
+		{"untrusted issuer", models.CreateServiceAccountRequest{Name: "ci", ExternalIssuer: &untrusted, ExternalClientID: &clientID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.CreateServiceAccount(ctx, "admin", "organization", "org-1", tt.req)
+			assert.ErrorIs(t, err, ErrValidation)
+		})
+	}
+
+	ktrlplane := ServiceAccountTokenIssuer
+	_, err := svc.UpdateServiceAccount(ctx, "admin", "organization", "org-1", "sa-1", models.UpdateServiceAccountRequest{
+		ExternalIssuer: &ktrlplane, ExternalClientID: &clientID,
+	})
+	assert.ErrorIs(t, err, ErrValidation, "KtrlPlane-issued tokens are matched by service account ID")
+}
+
+func TestNormalizeClientID(t *testing.T) {
+	blank, padded := "  ", " client-1 "
+	assert.Nil(t, normalizeClientID(nil))
+	assert.Nil(t, normalizeClientID(&blank))
+	assert.Equal(t, "client-1", *normalizeClientID(&padded))
+}
+
+func TestCheckServiceAccountAssignmentScope(t *testing.T) {
+	scopeAncestry.Clear()
+	defer scopeAncestry.Clear()
+	// Project p1 holds resource r1 and belongs to organization acme
+	scopeAncestry.Set(strings.Join([]string{"project", "p1", "resource", "r1"}, "\x00"), true)
+	scopeAncestry.Set(strings.Join([]string{"project", "p1", "organization", "acme"}, "\x00"), false)
+	scopeAncestry.Set(strings.Join([]string{"project", "p1", "organization", "other"}, "\x00"), false)
+	q := fakeRows{db.GetServiceAccountScopeQuery: {"project", "p1"}}
+	ctx := context.Background()
+
+	assert.NoError(t, checkServiceAccountAssignmentScope(ctx, q, "sa-1", "project", "p1"))
+	assert.NoError(t, checkServiceAccountAssignmentScope(ctx, q, "sa-1", "resource", "r1"))
+	assert.ErrorIs(t, checkServiceAccountAssignmentScope(ctx, q, "sa-1", "project", "p2"), ErrValidation)
+	assert.ErrorIs(t, checkServiceAccountAssignmentScope(ctx, q, "sa-1", "organization", "acme"), ErrValidation,
+		"a project's service account gets no roles on its organization")
+	assert.ErrorIs(t, checkServiceAccountAssignmentScope(ctx, q, "sa-1", "organization", "other"), ErrValidation)
+	assert.ErrorIs(t, checkServiceAccountAssignmentScope(ctx, fakeRows{}, "sa-gone", "project", "p1"), ErrNotFound)
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stripe/stripe-go/v84"
+)
+
+// fakeStripe is an HTTP server standing in for the Stripe API. Routes are keyed by
+// "METHOD /v1/path" and return the JSON encoding of the handler's result.
+type fakeStripe struct {
+	mu     sync.Mutex
+	routes map[string]func(r *http.Request) (int, any)
+	calls  map[string]int
+}
+
+// newFakeStripe points the global Stripe API backend at a fake server for the
+// duration of the test.
+func newFakeStripe(t *testing.T) *fakeStripe {
+	t.Helper()
+	fs := &fakeStripe{
+		routes: make(map[string]func(r *http.Request) (int, any)),
+		calls:  make(map[string]int),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(fs.serve))
+
+	previousBackend := stripe.GetBackend(stripe.APIBackend)
+	previousKey := stripe.Key
+	stripe.Key = "sk_test_fake"
+	stripe.SetBackend(stripe.APIBackend, stripe.GetBackendWithConfig(stripe.APIBackend, &stripe.BackendConfig{
+		URL:               stripe.String(srv.URL),
+		MaxNetworkRetries: stripe.Int64(0),
+	}))
+	t.Cleanup(func() {
+		stripe.SetBackend(stripe.APIBackend, previousBackend)
+		stripe.Key = previousKey
+		srv.Close()
+	})
+	return fs
+}
+
+// handle registers a route such as "GET /v1/prices".
+func (fs *fakeStripe) handle(route string, fn func(r *http.Request) (int, any)) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.routes[route] = fn
+}
+
+// count returns how often route was called.
+func (fs *fakeStripe) count(route string) int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.calls[route]
+}
+
+func (fs *fakeStripe) serve(w http.ResponseWriter, r *http.Request) {
+	route := r.Method + " " + r.URL.Path
+	fs.mu.Lock()
+	fs.calls[route]++
+	fn, ok := fs.routes[route]
+	fs.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":{"type":"invalid_request_error","message":"no fake for ` + route + `"}}`))
+		return
+	}
+	status, body := fn(r)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// stripeList wraps data in a Stripe list envelope.
+func stripeList(url string, data ...any) map[string]any {
+	if data == nil {
+		data = []any{}
+	}
+	return map[string]any{"object": "list", "url": url, "has_more": false, "data": data}
+}
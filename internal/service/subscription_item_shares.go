@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"ktrlplane/internal/db"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stripe/stripe-go/v84"
+)
+
+// itemShareSnapshot records how the quantity of a subscription item was shared between
+// projects from a point in time until the next snapshot.
+type itemShareSnapshot struct {
+	effectiveAt int64            // Unix time
+	shares      map[string]int64 // Project metadata key -> quantity
+}
+
+// metadataShares returns the project shares in the metadata of a subscription item, keyed by
+// project metadata key.
+func metadataShares(metadata map[string]string) map[string]int64 {
+	shares := make(map[string]int64)
+	for key, value := range metadata {
+		if !strings.HasPrefix(key, projectMetadataPrefix) {
+			continue
+		}
+		count, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || count <= 0 {
+			continue
+		}
+		shares[key] = count
+	}
+	return shares
+}
+
+// sharesAt returns the snapshot in effect at time at, or with before, the one in effect just
+// before it. Snapshots are ordered oldest first.
+func sharesAt(snapshots []itemShareSnapshot, at int64, before bool) (map[string]int64, bool) {
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if snapshots[i].effectiveAt < at || (!before && snapshots[i].effectiveAt == at) {
+			return snapshots[i].shares, true
+		}
+	}
+	return nil, false
+}
+
+// recordItemShares snapshots the project shares of a subscription item from effectiveAt on.
+// Stripe already made the change, so a failure is logged rather than returned; invoice lines
+// of the item then fall back to an earlier snapshot or its current metadata.
+func recordItemShares(ctx context.Context, item *stripe.SubscriptionItem, effectiveAt int64) {
+	if item == nil || item.ID == "" {
+		return
+	}
+	if err := saveItemShares(ctx, item.ID, itemShareSnapshot{effectiveAt: effectiveAt, shares: metadataShares(item.Metadata)}); err != nil {
+		fmt.Printf("[BillingService] %v\n", err)
+	}
+}
+
+// recordSubscriptionShares snapshots the project shares of the items of a new subscription
+// from its start on.
+func recordSubscriptionShares(ctx context.Context, sub *stripe.Subscription) {
+	if sub == nil || sub.Items == nil {
+		return
+	}
+	for _, item := range sub.Items.Data {
+		recordItemShares(ctx, item, sub.StartDate)
+	}
+}
+
+// saveItemShares stores a share snapshot of a subscription item. Tests replace it.
+var saveItemShares = insertItemShares
+
+func insertItemShares(ctx context.Context, itemID string, snapshot itemShareSnapshot) error {
+	payload, err := json.Marshal(snapshot.shares)
+	if err != nil {
+		return fmt.Errorf("failed to encode shares of subscription item %s: %w", itemID, err)
+	}
+	if _, err := db.GetDB().Exec(ctx, db.InsertSubscriptionItemSharesQuery, itemID, time.Unix(snapshot.effectiveAt, 0).UTC(), string(payload)); err != nil {
+		return fmt.Errorf("failed to record shares of subscription item %s: %w", itemID, err)
+	}
+	return nil
+}
+
+// loadItemShares lists the share snapshots of a subscription item, oldest first. Tests replace it.
+var loadItemShares = queryItemShares
+
+func queryItemShares(ctx context.Context, itemID string) ([]itemShareSnapshot, error) {
+	rows, err := db.GetDB().Query(ctx, db.ListSubscriptionItemSharesQuery, itemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shares of subscription item %s: %w", itemID, err)
+	}
+	defer rows.Close()
+	var snapshots []itemShareSnapshot
+	for rows.Next() {
+		var effectiveAt time.Time
+		var payload []byte
+		if err := rows.Scan(&effectiveAt, &payload); err != nil {
+			return nil, fmt.Errorf("failed to scan shares of subscription item %s: %w", itemID, err)
+		}
+		snapshot := itemShareSnapshot{effectiveAt: effectiveAt.Unix()}
+		if err := json.Unmarshal(payload, &snapshot.shares); err != nil {
+			return nil, fmt.Errorf("failed to decode shares of subscription item %s: %w", itemID, err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
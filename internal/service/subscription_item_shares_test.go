@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeItemShares replaces the share snapshot store with an in-memory one for the test.
+func fakeItemShares(t *testing.T) map[string][]itemShareSnapshot {
+	t.Helper()
+	store := make(map[string][]itemShareSnapshot)
+	originalSave, originalLoad := saveItemShares, loadItemShares
+	saveItemShares = func(ctx context.Context, itemID string, snapshot itemShareSnapshot) error {
+		store[itemID] = append(store[itemID], snapshot)
+		return nil
+	}
+	loadItemShares = func(ctx context.Context, itemID string) ([]itemShareSnapshot, error) {
+		return store[itemID], nil
+	}
+	t.Cleanup(func() {
+		saveItemShares, loadItemShares = originalSave, originalLoad
+	})
+	return store
+}
+
+func TestMetadataShares(t *testing.T) {
+	shares := metadataShares(map[string]string{
+		"project:p1": "2",
+		"project:p2": "0",
+		"project:p3": "x",
+		"managed_by": "ktrlplane",
+	})
+	assert.Equal(t, map[string]int64{"project:p1": 2}, shares)
+}
+
+func TestSharesAt(t *testing.T) {
+	snapshots := []itemShareSnapshot{
+		{effectiveAt: 100, shares: map[string]int64{"project:p1": 1}},
+		{effectiveAt: 200, shares: map[string]int64{"project:p1": 1, "project:p2": 1}},
+	}
+
+	_, ok := sharesAt(snapshots, 50, false)
+	assert.False(t, ok, "nothing was recorded yet")
+
+	shares, ok := sharesAt(snapshots, 150, false)
+	assert.True(t, ok)
+	assert.Equal(t, snapshots[0].shares, shares)
+
+	shares, _ = sharesAt(snapshots, 200, false)
+	assert.Equal(t, snapshots[1].shares, shares, "a change applies from its own time")
+
+	shares, _ = sharesAt(snapshots, 200, true)
+	assert.Equal(t, snapshots[0].shares, shares, "credit for unused time uses the shares it replaced")
+}
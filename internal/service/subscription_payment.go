@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"ktrlplane/internal/models"
+
+	"github.com/stripe/stripe-go/v84"
+	"github.com/stripe/stripe-go/v84/customer"
+)
+
+// Payment statuses of a billing account during onboarding, as reported by GetBillingStatus.
+const (
+	PaymentStatusRequiresCustomer      = "requires_customer"       // No Stripe customer yet
+	PaymentStatusRequiresPaymentMethod = "requires_payment_method" // The customer has no payment method
+	PaymentStatusRequiresAction        = "requires_action"         // The first payment awaits confirmation
+	PaymentStatusReady                 = "ready"
+)
+
+// firstPaymentMethod returns the ID of a payment method of a customer, or "" when it has none.
+func firstPaymentMethod(ctx context.Context, customerID string) (string, error) {
+	params := &stripe.CustomerListPaymentMethodsParams{Customer: stripe.String(customerID)}
+	params.Context = ctx
+	params.Limit = stripe.Int64(1)
+	iter := customer.ListPaymentMethods(params)
+	if iter.Next() {
+		return iter.PaymentMethod().ID, nil
+	}
+	if err := iter.Err(); err != nil {
+		return "", Upstream(err, "failed to list payment methods of customer %s", customerID)
+	}
+	return "", nil
+}
+
+// setPaymentBehavior makes a new subscription charge paymentMethodID. Without a payment method
+// the subscription starts incomplete: the customer confirms its first payment (or, on a trial,
+// sets up a payment method) with the client secret, which saves the payment method as the
+// subscription's default.
+func setPaymentBehavior(params *stripe.SubscriptionParams, paymentMethodID string) {
+	if paymentMethodID != "" {
+		params.DefaultPaymentMethod = stripe.String(paymentMethodID)
+		return
+	}
+	params.PaymentBehavior = stripe.String("default_incomplete")
+	params.PaymentSettings = &stripe.SubscriptionPaymentSettingsParams{
+		SaveDefaultPaymentMethod: stripe.String("on_subscription"),
+	}
+	params.AddExpand("latest_invoice.confirmation_secret")
+	params.AddExpand("pending_setup_intent")
+}
+
+// subscriptionClientSecret returns the client secret Stripe.js needs to collect the payment
+// method of a subscription: that of the first invoice's payment while the subscription is
+// incomplete, or that of the setup intent of a subscription starting on a trial. It is empty
+// when nothing needs to be collected.
+func subscriptionClientSecret(sub *stripe.Subscription) string {
+	if sub.Status == stripe.SubscriptionStatusIncomplete && sub.LatestInvoice != nil && sub.LatestInvoice.ConfirmationSecret != nil {
+		return sub.LatestInvoice.ConfirmationSecret.ClientSecret
+	}
+	if sub.PendingSetupIntent != nil {
+		return sub.PendingSetupIntent.ClientSecret
+	}
+	return ""
+}
+
+// paymentStatus reports what a billing account still needs before its subscription is paid.
+func paymentStatus(info *models.BillingInfo) string {
+	switch {
+	case info.BillingAccount.StripeCustomerID == nil:
+		return PaymentStatusRequiresCustomer
+	case len(info.PaymentMethods) == 0:
+		return PaymentStatusRequiresPaymentMethod
+	case info.SubscriptionDetails != nil && info.SubscriptionDetails.Status == string(stripe.SubscriptionStatusIncomplete):
+		return PaymentStatusRequiresAction
+	default:
+		return PaymentStatusReady
+	}
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"ktrlplane/internal/config"
+	"ktrlplane/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v84"
+)
+
+// fakeBillingAccount replaces the billing account, resource count and trial storage with an
+// account for cus_1 without a subscription that has had its trial and bills projectID for one
+// standard graph. It returns the account, whose subscription is updated when one is recorded.
+func fakeBillingAccount(t *testing.T, projectID string) *models.BillingAccount {
+	t.Helper()
+	fakeItemShares(t)
+	account := &models.BillingAccount{ScopeType: "project", ScopeID: projectID, StripeCustomerID: stripe.String("cus_1")}
+	trialUsed := time.Now()
+	originalAccount, originalCounts := loadBillingAccount, loadResourceCounts
+	originalTrial, originalSave := loadBillingTrial, saveAccountSubscription
+	loadBillingAccount = func(ctx context.Context, scopeType, scopeID string) (*models.BillingAccount, error) {
+		return account, nil
+	}
+	loadResourceCounts = func(ctx context.Context, scopeType, scopeID string) (projectResourceCounts, error) {
+		return projectResourceCounts{"Konnektr.Graph:standard": {projectID: 1}}, nil
+	}
+	loadBillingTrial = func(ctx context.Context, scopeType, scopeID string) (*models.BillingTrial, error) {
+		return &models.BillingTrial{TrialUsedAt: &trialUsed}, nil
+	}
+	saveAccountSubscription = func(ctx context.Context, a *models.BillingAccount, subscriptionID *string) error {
+		a.StripeSubscriptionID = subscriptionID
+		return nil
+	}
+	t.Cleanup(func() {
+		loadBillingAccount, loadResourceCounts = originalAccount, originalCounts
+		loadBillingTrial, saveAccountSubscription = originalTrial, originalSave
+	})
+	return account
+}
+
+// handleNewSubscription serves subscription creation: active with a default payment method,
+// otherwise incomplete with the client secret of its first invoice. It returns the form
+// Stripe received.
+func handleNewSubscription(fs *fakeStripe) *url.Values {
+	form := &url.Values{}
+	fs.handle("POST /v1/subscriptions", func(r *http.Request) (int, any) {
+		_ = r.ParseForm()
+		*form = r.PostForm
+		if form.Get("default_payment_method") != "" {
+			return http.StatusOK, map[string]any{"id": "sub_1", "object": "subscription", "status": "active"}
+		}
+		return http.StatusOK, map[string]any{
+			"id": "sub_1", "object": "subscription", "status": "incomplete",
+			"latest_invoice": map[string]any{"id": "in_1", "object": "invoice",
+				"confirmation_secret": map[string]any{"client_secret": "pi_1_secret_x", "type": "payment_intent"}},
+		}
+	})
+	return form
+}
+
+func TestSubscriptionPayment_NoPaymentMethod(t *testing.T) {
+	ClearBillingCaches()
+	defer ClearBillingCaches()
+
+	fs := newFakeStripe(t)
+	intervalPrices(fs)
+	fs.handle("GET /v1/customers/cus_1/payment_methods", func(r *http.Request) (int, any) {
+		return http.StatusOK, stripeList("/v1/customers/cus_1/payment_methods")
+	})
+	form := handleNewSubscription(fs)
+	fakeBillingAccount(t, "p1")
+
+	result, err := newPricingBillingService().CreateStripeSubscription(context.Background(), "project", "p1", models.CreateStripeSubscriptionRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "incomplete", result.SubscriptionStatus)
+	assert.Equal(t, "pi_1_secret_x", result.ClientSecret)
+	assert.Equal(t, "sub_1", *result.StripeSubscriptionID)
+
+	assert.Equal(t, "price_std_month", form.Get("items[0][price]"))
+	assert.Equal(t, "1", form.Get("items[0][quantity]"))
+	assert.Equal(t, "default_incomplete", form.Get("payment_behavior"))
+	assert.Equal(t, "on_subscription", form.Get("payment_settings[save_default_payment_method]"))
+	assert.Empty(t, form.Get("default_payment_method"))
+	assert.Equal(t, "latest_invoice.confirmation_secret", form.Get("expand[0]"))
+	assert.Empty(t, form.Get("trial_period_days"), "the account had its trial")
+}
+
+func TestSubscriptionPayment_OnePaymentMethod(t *testing.T) {
+	ClearBillingCaches()
+	defer ClearBillingCaches()
+
+	fs := newFakeStripe(t)
+	fs.handle("GET /v1/customers/cus_1/payment_methods", func(r *http.Request) (int, any) {
+		return http.StatusOK, stripeList("/v1/customers/cus_1/payment_methods",
+			map[string]any{"id": "pm_card", "object": "payment_method", "type": "card"})
+	})
+	form := handleNewSubscription(fs)
+	account := fakeBillingAccount(t, "p1")
+
+	require.NoError(t, NewBillingService(&config.Config{}).addSubscriptionItems(context.Background(), account, "p1", "price_std", 1))
+	assert.Equal(t, "pm_card", form.Get("default_payment_method"))
+	assert.Empty(t, form.Get("payment_behavior"))
+	assert.Equal(t, "price_std", form.Get("items[0][price]"))
+	assert.Equal(t, "1", form.Get("items[0][metadata]["+projectMetadataKey("p1")+"]"))
+	assert.Equal(t, "sub_1", *account.StripeSubscriptionID, "the subscription is recorded on the account")
+}
+
+func TestSubscriptionPayment_ManyPaymentMethods(t *testing.T) {
+	ClearBillingCaches()
+	defer ClearBillingCaches()
+
+	fs := newFakeStripe(t)
+	fs.handle("GET /v1/customers/cus_1/payment_methods", func(r *http.Request) (int, any) {
+		assert.Equal(t, "1", r.URL.Query().Get("limit"))
+		list := stripeList("/v1/customers/cus_1/payment_methods",
+			map[string]any{"id": "pm_first", "object": "payment_method", "type": "card"})
+		list["has_more"] = true
+		return http.StatusOK, list
+	})
+	form := handleNewSubscription(fs)
+	account := fakeBillingAccount(t, "p1")
+
+	require.NoError(t, NewBillingService(&config.Config{}).addSubscriptionItems(context.Background(), account, "p1", "price_std", 1))
+	assert.Equal(t, "pm_first", form.Get("default_payment_method"))
+	assert.Equal(t, 1, fs.count("GET /v1/customers/cus_1/payment_methods"), "further pages are not fetched")
+}
+
+func TestSubscriptionPayment_RequestedPaymentMethod(t *testing.T) {
+	ClearBillingCaches()
+	defer ClearBillingCaches()
+
+	fs := newFakeStripe(t)
+	intervalPrices(fs)
+	form := handleNewSubscription(fs)
+	fakeBillingAccount(t, "p1")
+
+	result, err := newPricingBillingService().CreateStripeSubscription(context.Background(), "project", "p1",
+		models.CreateStripeSubscriptionRequest{PaymentMethodID: "pm_chosen"})
+	require.NoError(t, err)
+	assert.Equal(t, "active", result.SubscriptionStatus)
+	assert.Empty(t, result.ClientSecret, "an active subscription needs nothing collected")
+	assert.Equal(t, "pm_chosen", form.Get("default_payment_method"))
+	assert.Zero(t, fs.count("GET /v1/customers/cus_1/payment_methods"), "the requested payment method is used as is")
+}
+
+func TestSubscriptionClientSecret_Trial(t *testing.T) {
+	sub := &stripe.Subscription{
+		Status:             stripe.SubscriptionStatusTrialing,
+		LatestInvoice:      &stripe.Invoice{ConfirmationSecret: &stripe.InvoiceConfirmationSecret{ClientSecret: "pi_zero_secret"}},
+		PendingSetupIntent: &stripe.SetupIntent{ClientSecret: "seti_1_secret_x"},
+	}
+	assert.Equal(t, "seti_1_secret_x", subscriptionClientSecret(sub), "trials collect the payment method with a setup intent")
+}
+
+func TestPaymentStatus(t *testing.T) {
+	info := &models.BillingInfo{}
+	assert.Equal(t, PaymentStatusRequiresCustomer, paymentStatus(info))
+
+	info.BillingAccount.StripeCustomerID = stripe.String("cus_1")
+	info.SubscriptionDetails = &models.StripeSubscriptionDetails{Status: "incomplete"}
+	assert.Equal(t, PaymentStatusRequiresPaymentMethod, paymentStatus(info))
+
+	info.PaymentMethods = []models.StripePaymentMethod{{ID: "pm_card"}}
+	assert.Equal(t, PaymentStatusRequiresAction, paymentStatus(info))
+
+	info.SubscriptionDetails.Status = "active"
+	assert.Equal(t, PaymentStatusReady, paymentStatus(info))
+}
@@ -0,0 +1,461 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ktrlplane/internal/cache"
+	"ktrlplane/internal/config"
+	"ktrlplane/internal/db"
+	"ktrlplane/internal/models"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Audit event types for teams.
+const (
+	AuditTeamCreated       = "team.created"
+	AuditTeamUpdated       = "team.updated"
+	AuditTeamDeleted       = "team.deleted"
+	AuditTeamMemberAdded   = "team.member_added"
+	AuditTeamMemberRemoved = "team.member_removed"
+)
+
+// teamIDPrefix marks the users rows backing teams.
+const teamIDPrefix = "team-"
+
+// teamSyncInterval throttles IdP group syncs per user and group set.
+const teamSyncInterval = 5 * time.Minute
+
+// teamSyncs remembers recent IdP group syncs, keyed by user, issuer and sorted groups.
+var teamSyncs = cache.New[bool]("team-syncs", teamSyncInterval)
+
+// TeamService manages teams and their members.
+type TeamService struct {
+	rbacService    *RBACService
+	trustedIssuers []string // Issuers whose groups can be mapped to teams
+}
+
+// NewTeamService creates a new TeamService.
+func NewTeamService(cfg *config.Config) *TeamService {
+	return &TeamService{rbacService: NewRBACService(), trustedIssuers: trustedIssuerURLs(cfg)}
+}
+
+// isTeamID reports whether a principal ID belongs to a team.
+func isTeamID(id string) bool {
+	return strings.HasPrefix(id, teamIDPrefix)
+}
+
+// scanTeam scans a row selected with the team column list.
+func scanTeam(row pgx.Row) (*models.Team, error) {
+	var team models.Team
+	err := row.Scan(
+		&team.TeamID, &team.OrgID, &team.Name, &team.Description, &team.IDPIssuer, &team.IDPGroup, &team.MemberCount,
+		&team.CreatedBy, &team.CreatedAt, &team.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &team, nil
+}
+
+// normalizeIDPGroup trims an IdP issuer or group and maps "" to nil.
+func normalizeIDPGroup(group *string) *string {
+	if group == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*group)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
+
+// checkIDPGroup authorizes and validates a change of the IdP group mapped to a team.
+// Every user of the issuer in the group joins the team, so only platform administrators,
+// with manage_users at global scope, may map one, and only from a trusted issuer. issuer and
+// group are normalized; both nil clears the mapping.
+func (s *TeamService) checkIDPGroup(ctx context.Context, userID string, issuer, group *string) error {
+	canManage, err := s.rbacService.CheckPermission(ctx, userID, "manage_users", "global", "global")
+	if err != nil {
+		return err
+	}
+	if !canManage {
+		return Forbidden("mapping an IdP group requires the 'manage_users' permission at global scope")
+	}
+	if (issuer == nil) != (group == nil) {
+		return Validation("idp_issuer and idp_group must be set together")
+	}
+	if issuer != nil && !slices.Contains(s.trustedIssuers, *issuer) {
+		return Validation("issuer %s is not a trusted token issuer", *issuer)
+	}
+	return nil
+}
+
+// CreateTeam creates a team in an organization. Requires manage_access on the organization,
+// and manage_users at global scope to map an IdP group.
+func (s *TeamService) CreateTeam(ctx context.Context, userID, orgID string, req models.CreateTeamRequest) (*models.Team, error) {
+	if err := s.rbacService.requireManageAccess(ctx, userID, "organization", orgID); err != nil {
+		return nil, err
+	}
+	issuer, group := normalizeIDPGroup(req.IDPIssuer), normalizeIDPGroup(req.IDPGroup)
+	if req.IDPIssuer != nil || req.IDPGroup != nil {
+		if err := s.checkIDPGroup(ctx, userID, issuer, group); err != nil {
+			return nil, err
+		}
+	}
+
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	id := teamIDPrefix + uuid.New().String()
+	if _, err := tx.Exec(ctx, db.CreateUserQuery, id, "", req.Name); err != nil {
+		return nil, fmt.Errorf("failed to create team principal: %w", err)
+	}
+	team, err := scanTeam(tx.QueryRow(ctx, db.CreateTeamQuery,
+		id, orgID, req.Name, req.Description, issuer, group, userID))
+	if isUniqueViolation(err) {
+		return nil, Conflict("a team named %s already exists in this organization", req.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create team: %w", err)
+	}
+
+	err = recordAuditEvent(ctx, tx, AuditTeamCreated, userID, id, "organization", orgID, map[string]any{
+		"name":       team.Name,
+		"idp_issuer": team.IDPIssuer,
+		"idp_group":  team.IDPGroup,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit team: %w", err)
+	}
+	return team, nil
+}
+
+// ListTeams lists the teams of an organization. Requires read on the organization.
+func (s *TeamService) ListTeams(ctx context.Context, userID, orgID string) ([]models.Team, error) {
+	if err := s.requireRead(ctx, userID, orgID); err != nil {
+		return nil, err
+	}
+
+	pool := db.GetDB()
+	rows, err := pool.Query(ctx, db.ListTeamsForOrganizationQuery, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list teams: %w", err)
+	}
+	defer rows.Close()
+
+	teams := make([]models.Team, 0)
+	for rows.Next() {
+		team, err := scanTeam(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan team: %w", err)
+		}
+		teams = append(teams, *team)
+	}
+	return teams, rows.Err()
+}
+
+// GetTeam returns a team of an organization. Requires read on the organization.
+func (s *TeamService) GetTeam(ctx context.Context, userID, orgID, teamID string) (*models.Team, error) {
+	if err := s.requireRead(ctx, userID, orgID); err != nil {
+		return nil, err
+	}
+	return s.getTeam(ctx, orgID, teamID)
+}
+
+func (s *TeamService) getTeam(ctx context.Context, orgID, teamID string) (*models.Team, error) {
+	team, err := scanTeam(db.GetDB().QueryRow(ctx, db.GetTeamQuery, teamID, orgID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, NotFound("team %s not found", teamID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get team: %w", err)
+	}
+	return team, nil
+}
+
+// UpdateTeam renames a team or changes its IdP group. Requires manage_access on the organization,
+// and manage_users at global scope to change the IdP group.
+func (s *TeamService) UpdateTeam(ctx context.Context, userID, orgID, teamID string, req models.UpdateTeamRequest) (*models.Team, error) {
+	if err := s.rbacService.requireManageAccess(ctx, userID, "organization", orgID); err != nil {
+		return nil, err
+	}
+	clearGroup := req.IDPGroup != nil && strings.TrimSpace(*req.IDPGroup) == ""
+	issuer, group := normalizeIDPGroup(req.IDPIssuer), normalizeIDPGroup(req.IDPGroup)
+	if req.IDPIssuer != nil || req.IDPGroup != nil {
+		if clearGroup {
+			issuer = nil
+		}
+		if err := s.checkIDPGroup(ctx, userID, issuer, group); err != nil {
+			return nil, err
+		}
+	}
+
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	team, err := scanTeam(tx.QueryRow(ctx, db.UpdateTeamQuery,
+		teamID, orgID, req.Name, req.Description, clearGroup, group, issuer))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, NotFound("team %s not found", teamID)
+	}
+	if isUniqueViolation(err) {
+		return nil, Conflict("a team named %s already exists in this organization", *req.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update team: %w", err)
+	}
+	if req.Name != nil {
+		if _, err := tx.Exec(ctx, db.UpdateUserNameQuery, teamID, *req.Name); err != nil {
+			return nil, fmt.Errorf("failed to rename team principal: %w", err)
+		}
+	}
+
+	err = recordAuditEvent(ctx, tx, AuditTeamUpdated, userID, teamID, "organization", orgID, map[string]any{
+		"name":       team.Name,
+		"idp_issuer": team.IDPIssuer,
+		"idp_group":  team.IDPGroup,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit team update: %w", err)
+	}
+	if req.IDPIssuer != nil || req.IDPGroup != nil {
+		// Members sync against the new group on their next login
+		teamSyncs.Clear()
+	}
+	return team, nil
+}
+
+// DeleteTeam deletes a team with its memberships and role assignments.
+// Requires manage_access on the organization.
+func (s *TeamService) DeleteTeam(ctx context.Context, userID, orgID, teamID string) error {
+	if err := s.rbacService.requireManageAccess(ctx, userID, "organization", orgID); err != nil {
+		return err
+	}
+
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	tag, err := tx.Exec(ctx, db.DeleteTeamQuery, teamID, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete team: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return NotFound("team %s not found", teamID)
+	}
+	if err := recordAuditEvent(ctx, tx, AuditTeamDeleted, userID, teamID, "organization", orgID, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit team deletion: %w", err)
+	}
+	InvalidateUserPermissions(ctx, teamID)
+	return nil
+}
+
+// ListMembers lists the members of a team. Requires read on the organization.
+func (s *TeamService) ListMembers(ctx context.Context, userID, orgID, teamID string) ([]models.TeamMember, error) {
+	if err := s.requireRead(ctx, userID, orgID); err != nil {
+		return nil, err
+	}
+	if _, err := s.getTeam(ctx, orgID, teamID); err != nil {
+		return nil, err
+	}
+
+	pool := db.GetDB()
+	rows, err := pool.Query(ctx, db.ListTeamMembersQuery, teamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list team members: %w", err)
+	}
+	defer rows.Close()
+
+	members := make([]models.TeamMember, 0)
+	for rows.Next() {
+		var member models.TeamMember
+		err := rows.Scan(&member.UserID, &member.Email, &member.Name, &member.Source, &member.AddedBy, &member.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan team member: %w", err)
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// AddMember adds an existing user to a team. Requires manage_access on the organization.
+func (s *TeamService) AddMember(ctx context.Context, userID, orgID, teamID, memberID string) error {
+	if err := s.rbacService.requireManageAccess(ctx, userID, "organization", orgID); err != nil {
+		return err
+	}
+	if isTeamID(memberID) {
+		return Validation("teams cannot be members of other teams")
+	}
+	if _, err := s.getTeam(ctx, orgID, teamID); err != nil {
+		return err
+	}
+	return s.changeMembership(ctx, userID, orgID, teamID, memberID, db.AddTeamMemberQuery, AuditTeamMemberAdded, userID)
+}
+
+// RemoveMember removes a user from a team. Members synced from the IdP rejoin on their
+// next login while they remain in the group. Requires manage_access on the organization.
+func (s *TeamService) RemoveMember(ctx context.Context, userID, orgID, teamID, memberID string) error {
+	if err := s.rbacService.requireManageAccess(ctx, userID, "organization", orgID); err != nil {
+		return err
+	}
+	if _, err := s.getTeam(ctx, orgID, teamID); err != nil {
+		return err
+	}
+	return s.changeMembership(ctx, userID, orgID, teamID, memberID, db.RemoveTeamMemberQuery, AuditTeamMemberRemoved)
+}
+
+// changeMembership runs a membership query for (teamID, memberID, args...) and audits it.
+func (s *TeamService) changeMembership(ctx context.Context, userID, orgID, teamID, memberID, query, auditType string, args ...any) error {
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	_, err = tx.Exec(ctx, query, append([]any{teamID, memberID}, args...)...)
+	if isForeignKeyViolation(err) {
+		return NotFound("user %s not found", memberID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update team membership: %w", err)
+	}
+	err = recordAuditEvent(ctx, tx, auditType, userID, memberID, "organization", orgID, map[string]any{
+		"team_id": teamID,
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit team membership: %w", err)
+	}
+	InvalidateUserPermissions(ctx, memberID)
+	return nil
+}
+
+func (s *TeamService) requireRead(ctx context.Context, userID, orgID string) error {
+	canRead, err := s.rbacService.CheckPermission(ctx, userID, "read", "organization", orgID)
+	if err != nil {
+		return err
+	}
+	if !canRead {
+		return Forbidden("insufficient permissions to view teams of this organization")
+	}
+	return nil
+}
+
+// SyncTeamMemberships makes a user's IdP-synced team memberships match the groups claim
+// of their token from issuer. Only teams mapped to a group of that issuer are joined. It runs
+// at most once per teamSyncInterval for the same user, issuer and groups.
+func SyncTeamMemberships(ctx context.Context, userID, issuer string, groups []string) error {
+	sorted := slices.Compact(slices.Sorted(slices.Values(groups)))
+	key := userID + "\x00" + issuer + "\x00" + strings.Join(sorted, "\x00")
+	_, err := teamSyncs.GetOrLoad(ctx, key, func() (bool, error) {
+		changes, err := syncIdPTeams(ctx, userID, issuer, sorted)
+		if err != nil {
+			return false, err
+		}
+		if changes > 0 {
+			InvalidateUserPermissions(ctx, userID)
+		}
+		return true, nil
+	}, nil)
+	return err
+}
+
+// syncIdPTeams applies a groups claim to a user's IdP-synced memberships and returns the
+// number of changes. Tests replace it.
+var syncIdPTeams = queryIdPTeamSync
+
+func queryIdPTeamSync(ctx context.Context, userID, issuer string, groups []string) (int64, error) {
+	var changes int64
+	if err := db.GetDB().QueryRow(ctx, db.SyncIdPTeamMembershipsQuery, userID, groups, issuer).Scan(&changes); err != nil {
+		return 0, fmt.Errorf("failed to sync team memberships: %w", err)
+	}
+	return changes, nil
+}
+
+// checkTeamAssignmentScope rejects role assignments to a team outside the team's organization.
+func checkTeamAssignmentScope(ctx context.Context, q querier, teamID, scopeType, scopeID string) error {
+	var orgID string
+	err := q.QueryRow(ctx, db.GetTeamOrganizationQuery, teamID).Scan(&orgID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return NotFound("team %s not found", teamID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get team organization: %w", err)
+	}
+	within, err := scopeWithin(ctx, "organization", orgID, scopeType, scopeID)
+	if err != nil {
+		return err
+	}
+	if !within {
+		return Validation("team %s can only be assigned roles within its organization", teamID)
+	}
+	return nil
+}
+
+// attachTeamMembers fills in the members of team principals in a list of role assignments.
+func attachTeamMembers(ctx context.Context, assignments []models.RoleAssignmentWithDetails) error {
+	var teamIDs []string
+	for _, assignment := range assignments {
+		if assignment.PrincipalType == models.PrincipalTeam && !slices.Contains(teamIDs, assignment.UserID) {
+			teamIDs = append(teamIDs, assignment.UserID)
+		}
+	}
+	if len(teamIDs) == 0 {
+		return nil
+	}
+
+	pool := db.GetDB()
+	rows, err := pool.Query(ctx, db.ListMembersOfTeamsQuery, teamIDs)
+	if err != nil {
+		return fmt.Errorf("failed to list team members: %w", err)
+	}
+	defer rows.Close()
+
+	members := make(map[string][]models.User, len(teamIDs))
+	for rows.Next() {
+		var teamID string
+		var member models.User
+		if err := rows.Scan(&teamID, &member.ID, &member.Email, &member.Name); err != nil {
+			return fmt.Errorf("failed to scan team member: %w", err)
+		}
+		members[teamID] = append(members[teamID], member)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list team members: %w", err)
+	}
+	for i := range assignments {
+		if assignments[i].PrincipalType == models.PrincipalTeam {
+			assignments[i].TeamMembers = members[assignments[i].UserID]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"ktrlplane/internal/config"
+	"ktrlplane/internal/db"
+	"ktrlplane/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTeamService_RequiresPermissions(t *testing.T) {
+	countingLoader(t, "read")
+	svc := NewTeamService(&config.Config{})
+	ctx := context.Background()
+
+	_, err := svc.CreateTeam(ctx, "user-1", "org-1", models.CreateTeamRequest{Name: "platform"})
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = svc.UpdateTeam(ctx, "user-1", "org-1", "team-1", models.UpdateTeamRequest{})
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.ErrorIs(t, svc.DeleteTeam(ctx, "user-1", "org-1", "team-1"), ErrForbidden)
+	assert.ErrorIs(t, svc.AddMember(ctx, "user-1", "org-1", "team-1", "user-2"), ErrForbidden)
+	assert.ErrorIs(t, svc.RemoveMember(ctx, "user-1", "org-1", "team-1", "user-2"), ErrForbidden)
+
+	countingLoader(t)
+	_, err = svc.ListTeams(ctx, "user-1", "org-1")
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = svc.ListMembers(ctx, "user-1", "org-1", "team-1")
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestTeamService_RejectsNestedTeams(t *testing.T) {
+	countingLoader(t, "manage_access")
+	err := NewTeamService(&config.Config{}).AddMember(context.Background(), "user-1", "org-1", teamIDPrefix+"a", teamIDPrefix+"b")
+	assert.ErrorIs(t, err, ErrValidation)
+}
+
+func TestTeamService_IDPGroupRequiresPlatformAdmin(t *testing.T) {
+	countingLoader(t, "read", "manage_access")
+	svc := NewTeamService(&config.Config{Auth: config.AuthConfig{Issuer: "https://tenant.auth0.com/"}})
+	ctx := context.Background()
+	issuer, group := "https://tenant.auth0.com/", "engineering"
+
+	// An organization administrator cannot capture the users of a group another tenant maps
+	_, err := svc.CreateTeam(ctx, "user-1", "org-2", models.CreateTeamRequest{
+		Name: "engineering", IDPIssuer: &issuer, IDPGroup: &group,
+	})
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = svc.UpdateTeam(ctx, "user-1", "org-2", "team-1", models.UpdateTeamRequest{IDPIssuer: &issuer, IDPGroup: &group})
+	assert.ErrorIs(t, err, ErrForbidden)
+	cleared := ""
+	_, err = svc.UpdateTeam(ctx, "user-1", "org-2", "team-1", models.UpdateTeamRequest{IDPGroup: &cleared})
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestTeamService_IDPGroupValidation(t *testing.T) {
+	countingLoader(t, "manage_access", "manage_users")
+	svc := NewTeamService(&config.Config{Auth: config.AuthConfig{
+		Issuers: []config.OIDCIssuerConfig{{Issuer: "https://keycloak.example.com/realms/acme"}},
+	}})
+	ctx := context.Background()
+	trusted, untrusted, group := "https://keycloak.example.com/realms/acme", "https://evil.example.com", "engineering"
+
+	tests := []struct {
+		name string
+		req  models.CreateTeamRequest
+	}{
+		{"group without issuer", models.CreateTeamRequest{Name: "eng", IDPGroup: &group}},
+		{"issuer without group", models.CreateTeamRequest{Name: "eng", IDPIssuer: &trusted}},
+		{"untrusted issuer", models.CreateTeamRequest{Name: "eng", IDPIssuer: &untrusted, IDPGroup: &group}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.CreateTeam(ctx, "admin", "org-1", tt.req)
+			assert.ErrorIs(t, err, ErrValidation)
+		})
+	}
+}
+
+func TestSyncTeamMemberships_ScopedByIssuer(t *testing.T) {
+	type sync struct {
+		issuer string
+		groups []string
+	}
+	var syncs []sync
+	original := syncIdPTeams
+	syncIdPTeams = func(ctx context.Context, userID, issuer string, groups []string) (int64, error) {
+		syncs = append(syncs, sync{issuer, groups})
+		return 0, nil
+	}
+	teamSyncs.Clear()
+	t.Cleanup(func() {
+		syncIdPTeams = original
+		teamSyncs.Clear()
+	})
+	ctx := context.Background()
+
+	// Two organizations' IdPs both have an "engineering" group; a user of one must not be
+	// synced as a member of the other's group
+	require.NoError(t, SyncTeamMemberships(ctx, "user-1", "https://acme.example.com", []string{"engineering"}))
+	require.NoError(t, SyncTeamMemberships(ctx, "user-1", "https://globex.example.com", []string{"engineering"}))
+	require.NoError(t, SyncTeamMemberships(ctx, "user-1", "https://acme.example.com", []string{"engineering"}))
+	assert.Equal(t, []sync{
+		{"https://acme.example.com", []string{"engineering"}},
+		{"https://globex.example.com", []string{"engineering"}},
+	}, syncs)
+}
+
+func TestInvalidateUserPermissions_Team(t *testing.T) {
+	calls := countingLoader(t, "read")
+	rbac := NewRBACService()
+	ctx := context.Background()
+
+	_, err := rbac.CheckPermission(ctx, "user-1", "read", "project", "p1")
+	require.NoError(t, err)
+	InvalidateUserPermissions(ctx, "user-2")
+	_, err = rbac.CheckPermission(ctx, "user-1", "read", "project", "p1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, calls.Load(), "another user's invalidation keeps the entry")
+
+	InvalidateUserPermissions(ctx, teamIDPrefix+"1")
+	_, err = rbac.CheckPermission(ctx, "user-1", "read", "project", "p1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, calls.Load(), "a team's roles may apply to any user")
+}
+
+func TestNormalizeIDPGroup(t *testing.T) {
+	blank, padded := " ", " admins "
+	assert.Nil(t, normalizeIDPGroup(nil))
+	assert.Nil(t, normalizeIDPGroup(&blank))
+	assert.Equal(t, "admins", *normalizeIDPGroup(&padded))
+}
+
+func TestCheckTeamAssignmentScope(t *testing.T) {
+	scopeAncestry.Clear()
+	defer scopeAncestry.Clear()
+	scopeAncestry.Set(strings.Join([]string{"organization", "acme", "project", "p1"}, "\x00"), true)
+	scopeAncestry.Set(strings.Join([]string{"organization", "acme", "project", "p9"}, "\x00"), false)
+	q := fakeRows{db.GetTeamOrganizationQuery: {"acme"}}
+	ctx := context.Background()
+
+	assert.NoError(t, checkTeamAssignmentScope(ctx, q, "team-1", "organization", "acme"))
+	assert.NoError(t, checkTeamAssignmentScope(ctx, q, "team-1", "project", "p1"))
+	assert.ErrorIs(t, checkTeamAssignmentScope(ctx, q, "team-1", "project", "p9"), ErrValidation)
+	assert.ErrorIs(t, checkTeamAssignmentScope(ctx, q, "team-1", "organization", "other"), ErrValidation)
+}
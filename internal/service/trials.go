@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ktrlplane/internal/db"
+	"ktrlplane/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stripe/stripe-go/v84"
+	"github.com/stripe/stripe-go/v84/promotioncode"
+	"github.com/stripe/stripe-go/v84/subscription"
+)
+
+// Audit event types for trials and discounts.
+const (
+	AuditBillingTrialGranted    = "billing.trial_granted"
+	AuditBillingDiscountApplied = "billing.discount_applied"
+)
+
+// GetBillingTrial returns the trial of the billing account paying for a scope.
+func (s *BillingService) GetBillingTrial(ctx context.Context, scopeType, scopeID string) (*models.BillingTrial, error) {
+	scopeType, scopeID, err := s.ResolveBillingScope(ctx, scopeType, scopeID)
+	if err != nil {
+		return nil, err
+	}
+	return loadBillingTrial(ctx, scopeType, scopeID)
+}
+
+// loadBillingTrial reads the trial of billing account scopeType/scopeID; an account without
+// one has an empty trial. Tests replace it.
+var loadBillingTrial = queryBillingTrial
+
+func queryBillingTrial(ctx context.Context, scopeType, scopeID string) (*models.BillingTrial, error) {
+	var trial models.BillingTrial
+	err := db.GetDB().QueryRow(ctx, db.GetBillingTrialQuery, scopeType, scopeID).Scan(&trial.TrialDays, &trial.TrialUsedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &trial, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get billing trial: %w", err)
+	}
+	return &trial, nil
+}
+
+// SetBillingTrial grants a trial length to the billing account paying for a scope; nil
+// restores the product defaults. It applies to the next subscription the account starts,
+// unless the account has had its trial already.
+func (s *BillingService) SetBillingTrial(ctx context.Context, scopeType, scopeID string, trialDays *int, actorID string) (*models.BillingTrial, error) {
+	scopeType, scopeID, err := s.ResolveBillingScope(ctx, scopeType, scopeID)
+	if err != nil {
+		return nil, err
+	}
+	// Make sure the account exists
+	if _, err := s.GetBillingAccount(ctx, scopeType, scopeID); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.GetDB().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var trial models.BillingTrial
+	err = tx.QueryRow(ctx, db.UpdateBillingTrialDaysQuery, scopeType, scopeID, trialDays).Scan(&trial.TrialDays, &trial.TrialUsedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update billing trial: %w", err)
+	}
+	if err := recordAuditEvent(ctx, tx, AuditBillingTrialGranted, actorID, scopeID, scopeType, scopeID, map[string]any{
+		"trial_days": trialDays,
+	}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit billing trial: %w", err)
+	}
+	return &trial, nil
+}
+
+// productTrialDays returns the trial length configured for a Stripe product.
+func (s *BillingService) productTrialDays(productID string) int64 {
+	if s.config == nil {
+		return 0
+	}
+	for _, product := range s.config.Stripe.Products {
+		if product.ProductID == productID {
+			return int64(product.TrialDays)
+		}
+	}
+	return 0
+}
+
+// subscriptionTrialDays returns the trial a new subscription of billing account
+// scopeType/scopeID with prices priceIDs starts with: none once the account has had a trial,
+// the length granted to the account, or else the longest trial of the products.
+func (s *BillingService) subscriptionTrialDays(ctx context.Context, scopeType, scopeID string, priceIDs []string) (int64, error) {
+	trial, err := loadBillingTrial(ctx, scopeType, scopeID)
+	if err != nil {
+		return 0, err
+	}
+	if trial.TrialUsedAt != nil {
+		return 0, nil
+	}
+	if trial.TrialDays != nil {
+		return int64(*trial.TrialDays), nil
+	}
+
+	var days int64
+	for _, priceID := range priceIDs {
+		p, err := getPrice(ctx, priceID)
+		if err != nil {
+			return 0, Upstream(err, "failed to get price details for price ID %s", priceID)
+		}
+		if p.Product != nil {
+			days = max(days, s.productTrialDays(p.Product.ID))
+		}
+	}
+	return days, nil
+}
+
+// applyTrial starts the new subscription described by params with the trial billing account
+// scopeType/scopeID is due, if any.
+func (s *BillingService) applyTrial(ctx context.Context, scopeType, scopeID string, params *stripe.SubscriptionParams) error {
+	priceIDs := make([]string, 0, len(params.Items))
+	for _, item := range params.Items {
+		if item.Price != nil {
+			priceIDs = append(priceIDs, *item.Price)
+		}
+	}
+	days, err := s.subscriptionTrialDays(ctx, scopeType, scopeID, priceIDs)
+	if err != nil {
+		return err
+	}
+	if days > 0 {
+		params.TrialPeriodDays = stripe.Int64(days)
+	}
+	return nil
+}
+
+// markTrialUsed records that billing account scopeType/scopeID had its trial when sub started
+// with one. The subscription exists at this point, so a failure is only logged.
+func markTrialUsed(ctx context.Context, scopeType, scopeID string, sub *stripe.Subscription) {
+	if sub == nil || sub.TrialEnd == 0 {
+		return
+	}
+	if err := db.ExecQuery(ctx, db.MarkBillingTrialUsedQuery, scopeType, scopeID); err != nil {
+		fmt.Printf("[BillingService] Failed to record trial of %s %s: %v\n", scopeType, scopeID, err)
+	}
+}
+
+// resolvePromotionCode returns the ID of the active promotion code a customer entered.
+func resolvePromotionCode(ctx context.Context, code string) (string, error) {
+	params := &stripe.PromotionCodeListParams{Code: stripe.String(code), Active: stripe.Bool(true)}
+	params.Context = ctx
+	params.Limit = stripe.Int64(1)
+	iter := promotioncode.List(params)
+	if iter.Next() {
+		return iter.PromotionCode().ID, nil
+	}
+	if err := iter.Err(); err != nil {
+		return "", Upstream(err, "failed to look up promotion code")
+	}
+	return "", Validation("promotion code %q is not valid", code)
+}
+
+// subscriptionDiscount returns the discount params for a promotion code or coupon, of which
+// exactly one must be set.
+func subscriptionDiscount(ctx context.Context, promotionCode, coupon string) (*stripe.SubscriptionDiscountParams, error) {
+	switch {
+	case promotionCode != "" && coupon != "":
+		return nil, Validation("set either a promotion code or a coupon")
+	case promotionCode != "":
+		id, err := resolvePromotionCode(ctx, promotionCode)
+		if err != nil {
+			return nil, err
+		}
+		return &stripe.SubscriptionDiscountParams{PromotionCode: stripe.String(id)}, nil
+	case coupon != "":
+		return &stripe.SubscriptionDiscountParams{Coupon: stripe.String(coupon)}, nil
+	}
+	return nil, Validation("a promotion code or coupon is required")
+}
+
+// ApplyDiscount applies a promotion code or coupon to the subscription of the billing account
+// paying for a scope, replacing any discount it had.
+func (s *BillingService) ApplyDiscount(ctx context.Context, scopeType, scopeID string, req models.ApplyDiscountRequest, actorID string) (*models.BillingAccount, error) {
+	discount, err := subscriptionDiscount(ctx, req.PromotionCode, req.Coupon)
+	if err != nil {
+		return nil, err
+	}
+	scopeType, scopeID, err = s.ResolveBillingScope(ctx, scopeType, scopeID)
+	if err != nil {
+		return nil, err
+	}
+	account, err := s.GetBillingAccount(ctx, scopeType, scopeID)
+	if err != nil {
+		return nil, err
+	}
+	if account.StripeSubscriptionID == nil || *account.StripeSubscriptionID == "" {
+		return nil, NotFound("no active subscription found")
+	}
+
+	_, err = subscription.Update(*account.StripeSubscriptionID, &stripe.SubscriptionParams{
+		Params:    stripe.Params{Context: ctx},
+		Discounts: []*stripe.SubscriptionDiscountParams{discount},
+	})
+	if err != nil {
+		return nil, stripeRequestError(err, "failed to apply discount to Stripe subscription")
+	}
+	InvalidateBillingInfo(scopeType, scopeID)
+
+	if err := recordAuditEvent(ctx, db.GetDB(), AuditBillingDiscountApplied, actorID, scopeID, scopeType, scopeID, map[string]any{
+		"promotion_code": req.PromotionCode,
+		"coupon":         req.Coupon,
+	}); err != nil {
+		fmt.Printf("[BillingService] %v\n", err)
+	}
+	return account, nil
+}
+
+// convertDiscounts converts the expanded discounts of a subscription.
+func convertDiscounts(discounts []*stripe.Discount) []models.StripeSubscriptionDiscount {
+	var converted []models.StripeSubscriptionDiscount
+	for _, d := range discounts {
+		if d == nil || d.Source == nil || d.Source.Coupon == nil {
+			continue
+		}
+		coupon := d.Source.Coupon
+		discount := models.StripeSubscriptionDiscount{
+			ID:         d.ID,
+			Coupon:     coupon.ID,
+			Name:       coupon.Name,
+			PercentOff: coupon.PercentOff,
+			AmountOff:  coupon.AmountOff,
+			Currency:   string(coupon.Currency),
+			End:        d.End,
+		}
+		if d.PromotionCode != nil {
+			discount.PromotionCode = d.PromotionCode.Code
+		}
+		converted = append(converted, discount)
+	}
+	return converted
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"ktrlplane/internal/config"
+	"ktrlplane/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v84"
+)
+
+func TestProductTrialDays(t *testing.T) {
+	s := NewBillingService(&config.Config{Stripe: config.StripeConfig{Products: []config.StripeProduct{
+		{ResourceType: "Konnektr.Graph", SKU: "standard", ProductID: "prod_graph", TrialDays: 14},
+		{ResourceType: "Konnektr.Flow", SKU: "standard", ProductID: "prod_flow"},
+	}}})
+	assert.Equal(t, int64(14), s.productTrialDays("prod_graph"))
+	assert.Zero(t, s.productTrialDays("prod_flow"))
+	assert.Zero(t, s.productTrialDays("prod_unknown"))
+}
+
+func TestSubscriptionDiscount(t *testing.T) {
+	fs := newFakeStripe(t)
+	fs.handle("GET /v1/promotion_codes", func(r *http.Request) (int, any) {
+		if r.URL.Query().Get("code") != "LAUNCH20" || r.URL.Query().Get("active") != "true" {
+			return http.StatusOK, stripeList("/v1/promotion_codes")
+		}
+		return http.StatusOK, stripeList("/v1/promotion_codes", map[string]any{"id": "promo_1", "object": "promotion_code", "code": "LAUNCH20"})
+	})
+
+	discount, err := subscriptionDiscount(context.Background(), "LAUNCH20", "")
+	require.NoError(t, err)
+	assert.Equal(t, "promo_1", *discount.PromotionCode)
+	assert.Nil(t, discount.Coupon)
+
+	_, err = subscriptionDiscount(context.Background(), "EXPIRED", "")
+	assert.True(t, errors.Is(err, ErrValidation), "unknown or inactive codes are rejected")
+
+	discount, err = subscriptionDiscount(context.Background(), "", "partner-50")
+	require.NoError(t, err)
+	assert.Equal(t, "partner-50", *discount.Coupon)
+
+	_, err = subscriptionDiscount(context.Background(), "LAUNCH20", "partner-50")
+	assert.True(t, errors.Is(err, ErrValidation))
+	_, err = subscriptionDiscount(context.Background(), "", "")
+	assert.True(t, errors.Is(err, ErrValidation))
+}
+
+func TestConvertDiscounts(t *testing.T) {
+	discounts := []*stripe.Discount{
+		{
+			ID: "di_1", End: 1780000000,
+			Source:        &stripe.DiscountSource{Coupon: &stripe.Coupon{ID: "launch", Name: "Launch", PercentOff: 20}},
+			PromotionCode: &stripe.PromotionCode{ID: "promo_1", Code: "LAUNCH20"},
+		},
+		{ID: "di_2", Source: &stripe.DiscountSource{Coupon: &stripe.Coupon{ID: "credit", AmountOff: 500, Currency: "eur"}}},
+		{ID: "di_unexpanded"},
+	}
+	assert.Equal(t, []models.StripeSubscriptionDiscount{
+		{ID: "di_1", Coupon: "launch", Name: "Launch", PromotionCode: "LAUNCH20", PercentOff: 20, End: 1780000000},
+		{ID: "di_2", Coupon: "credit", AmountOff: 500, Currency: "eur"},
+	}, convertDiscounts(discounts))
+}
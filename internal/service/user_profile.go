@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ktrlplane/internal/db"
+	"ktrlplane/internal/models"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Audit event types for self-service profile changes.
+const (
+	AuditUserUpdated = "user.updated"
+	AuditUserDeleted = "user.deleted"
+)
+
+// GetProfile returns the profile of the caller, with the roles it holds anywhere.
+func (s *RBACService) GetProfile(ctx context.Context, caller *models.User) (*models.UserProfile, error) {
+	pool := db.GetDB()
+	profile, err := scanUserProfile(pool.QueryRow(ctx, db.GetUserProfileQuery, caller.ID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, NotFound("user %s not found", caller.ID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user profile: %w", err)
+	}
+	return s.completeProfile(ctx, profile, caller)
+}
+
+// UpdateProfile sets the display name of the caller. Later sign-ins keep it.
+func (s *RBACService) UpdateProfile(ctx context.Context, caller *models.User, req models.UpdateProfileRequest) (*models.UserProfile, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, Validation("name must not be blank")
+	}
+
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	profile, err := scanUserProfile(tx.QueryRow(ctx, db.SetUserDisplayNameQuery, caller.ID, name))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, NotFound("user %s not found", caller.ID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user profile: %w", err)
+	}
+	err = recordAuditEvent(ctx, tx, AuditUserUpdated, caller.ID, caller.ID, "", "", map[string]any{
+		"name": name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit user profile: %w", err)
+	}
+	return s.completeProfile(ctx, profile, caller)
+}
+
+// completeProfile adds the details that are not stored on the users row.
+func (s *RBACService) completeProfile(ctx context.Context, profile *models.UserProfile, caller *models.User) (*models.UserProfile, error) {
+	profile.IsServiceAccount = caller.IsServiceAccount || isServiceAccountID(caller.ID)
+	profile.Groups = caller.Groups
+	profile.AccountType = models.AccountTypeUser
+	if profile.IsServiceAccount {
+		profile.AccountType = models.AccountTypeServiceAccount
+	}
+
+	rows, err := db.GetDB().Query(ctx, db.ListUserRoleNamesQuery, caller.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user roles: %w", err)
+	}
+	defer rows.Close()
+	profile.Roles = make([]string, 0)
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, fmt.Errorf("failed to scan user role: %w", err)
+		}
+		profile.Roles = append(profile.Roles, role)
+	}
+	return profile, rows.Err()
+}
+
+func scanUserProfile(row pgx.Row) (*models.UserProfile, error) {
+	var profile models.UserProfile
+	if err := row.Scan(&profile.ID, &profile.Email, &profile.Name, &profile.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// GetAccessSummary lists the organizations, projects and resources userID can reach,
+// with the highest role that applies at each. A personal access token only sees the
+// scopes it may read.
+func (s *RBACService) GetAccessSummary(ctx context.Context, userID string) (*models.AccessSummary, error) {
+	rows, err := db.GetDB().Query(ctx, db.ListUserAccessQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user access: %w", err)
+	}
+	defer rows.Close()
+
+	summary := &models.AccessSummary{
+		Organizations: make([]models.AccessEntry, 0),
+		Projects:      make([]models.AccessEntry, 0),
+		Resources:     make([]models.AccessEntry, 0),
+	}
+	for rows.Next() {
+		var scopeType string
+		var entry models.AccessEntry
+		if err := rows.Scan(&scopeType, &entry.ScopeID, &entry.Name, &entry.ParentID, &entry.Role, &entry.GrantedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user access: %w", err)
+		}
+		entry.Inherited = entry.GrantedAt != scopeType
+		switch scopeType {
+		case "organization":
+			summary.Organizations = append(summary.Organizations, entry)
+		case "project":
+			summary.Projects = append(summary.Projects, entry)
+		case "resource":
+			summary.Resources = append(summary.Resources, entry)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list user access: %w", err)
+	}
+	rows.Close()
+
+	scopeID := func(entry models.AccessEntry) string { return entry.ScopeID }
+	if summary.Organizations, err = filterByTokenScope(ctx, userID, "organization", summary.Organizations, scopeID); err != nil {
+		return nil, err
+	}
+	if summary.Projects, err = filterByTokenScope(ctx, userID, "project", summary.Projects, scopeID); err != nil {
+		return nil, err
+	}
+	if summary.Resources, err = filterByTokenScope(ctx, userID, "resource", summary.Resources, scopeID); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// DeleteAccount deletes userID and everything that only belongs to it: role assignments,
+// team memberships, personal access tokens and identity links. It is refused while the
+// user is the only Owner of an organization, project or resource, which would otherwise
+// be left without anyone able to manage it, also when the user is the only member of an
+// owning team. Assignments the user granted to others stay, without a grantor.
+func (s *RBACService) DeleteAccount(ctx context.Context, userID string) error {
+	if isServiceAccountID(userID) || isTeamID(userID) {
+		return Forbidden("only user accounts can be deleted this way")
+	}
+
+	pool := db.GetDB()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	owned, err := soleOwnedScopes(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	if len(owned) > 0 {
+		return Conflict("you are the only owner of %s; transfer ownership or delete them first", strings.Join(owned, ", "))
+	}
+
+	tag, err := tx.Exec(ctx, db.DeletePlaceholderUserQuery, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return NotFound("user %s not found", userID)
+	}
+	if err := recordAuditEvent(ctx, tx, AuditUserDeleted, userID, userID, "", "", nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit user deletion: %w", err)
+	}
+
+	InvalidateUserPermissions(ctx, userID)
+	identityLinks.Clear()
+	personalAccessTokens.Clear()
+	return nil
+}
+
+// soleOwnedScopes lists the scopes only userID owns, as "type id".
+func soleOwnedScopes(ctx context.Context, tx pgx.Tx, userID string) ([]string, error) {
+	rows, err := tx.Query(ctx, db.ListOwnersOfOwnedScopesQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check ownership: %w", err)
+	}
+	defer rows.Close()
+	var grants []ownerGrant
+	for rows.Next() {
+		var grant ownerGrant
+		if err := rows.Scan(&grant.scopeType, &grant.scopeID, &grant.holder, &grant.isTeam, &grant.otherMembers); err != nil {
+			return nil, fmt.Errorf("failed to scan owned scope: %w", err)
+		}
+		grants = append(grants, grant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to check ownership: %w", err)
+	}
+	return soleOwned(userID, grants), nil
+}
+
+// ownerGrant is an Owner assignment that applies to a scope a user owns.
+type ownerGrant struct {
+	scopeType, scopeID string // Scope the user owns
+	holder             string // User or team holding the Owner role on it or on a parent scope
+	isTeam             bool
+	otherMembers       int64 // Members of the holding team besides the user
+}
+
+// soleOwned lists the scopes of grants that userID owns, directly or through a team, and that
+// no one else does. A team only counts as another owner when someone else is a member.
+func soleOwned(userID string, grants []ownerGrant) []string {
+	owned := make([]string, 0)
+	shared := make(map[string]bool)
+	for _, grant := range grants {
+		scope := grant.scopeType + " " + grant.scopeID
+		if !slices.Contains(owned, scope) {
+			owned = append(owned, scope)
+		}
+		if grant.holder != userID && (!grant.isTeam || grant.otherMembers > 0) {
+			shared[scope] = true
+		}
+	}
+	return slices.DeleteFunc(owned, func(scope string) bool { return shared[scope] })
+}
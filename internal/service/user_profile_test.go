@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"ktrlplane/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateProfile_RejectsBlankName(t *testing.T) {
+	_, err := NewRBACService().UpdateProfile(context.Background(), &models.User{ID: "user-1"}, models.UpdateProfileRequest{Name: "  "})
+	assert.ErrorIs(t, err, ErrValidation)
+}
+
+func TestDeleteAccount_OnlyUserAccounts(t *testing.T) {
+	rbac := NewRBACService()
+	assert.ErrorIs(t, rbac.DeleteAccount(context.Background(), serviceAccountIDPrefix+"1"), ErrForbidden)
+	assert.ErrorIs(t, rbac.DeleteAccount(context.Background(), teamIDPrefix+"1"), ErrForbidden)
+}
+
+func TestSoleOwned(t *testing.T) {
+	grants := []ownerGrant{
+		// Owned directly and through a team of one: listed once
+		{scopeType: "organization", scopeID: "acme", holder: "user-1"},
+		{scopeType: "organization", scopeID: "acme", holder: "team-solo", isTeam: true},
+		// Owned only through a team no one else is a member of
+		{scopeType: "project", scopeID: "p1", holder: "team-solo", isTeam: true},
+		// Owned through a team with other members
+		{scopeType: "project", scopeID: "p2", holder: "team-platform", isTeam: true, otherMembers: 2},
+		// Owned directly, with another Owner of the parent organization
+		{scopeType: "resource", scopeID: "r1", holder: "user-1"},
+		{scopeType: "resource", scopeID: "r1", holder: "user-2"},
+	}
+	assert.Equal(t, []string{"organization acme", "project p1"}, soleOwned("user-1", grants))
+	assert.Empty(t, soleOwned("user-1", nil))
+}
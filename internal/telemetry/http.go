@@ -0,0 +1,71 @@
+package telemetry
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Transport wraps base with an OpenTelemetry round-tripper whose spans are named
+// "<peer> <METHOD> <route>", where route templates the request path to keep span names
+// low-cardinality, e.g. "kubernetes GET /api/v1/namespaces/{namespace}/secrets/{name}".
+// The full path is recorded in the url.path attribute. A nil route uses the path as is;
+// a nil base uses http.DefaultTransport.
+func Transport(peer string, base http.RoundTripper, route func(path string) string) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if route == nil {
+		route = func(path string) string { return path }
+	}
+	return otelhttp.NewTransport(pathAttribute{next: base},
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return peer + " " + r.Method + " " + route(r.URL.Path)
+		}),
+	)
+}
+
+// pathAttribute records the request path on the span otelhttp started for the request.
+type pathAttribute struct {
+	next http.RoundTripper
+}
+
+func (p pathAttribute) RoundTrip(r *http.Request) (*http.Response, error) {
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("url.path", r.URL.Path))
+	return p.next.RoundTrip(r)
+}
+
+// KubernetesRoute templates the namespace and object names of a Kubernetes API path:
+// /api/v1/namespaces/p1/secrets/s becomes /api/v1/namespaces/{namespace}/secrets/{name}.
+func KubernetesRoute(path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	// Skip the group and version: /api/v1 or /apis/<group>/<version>
+	start := 2
+	if len(segments) > 0 && segments[0] == "apis" {
+		start = 3
+	}
+	// The rest alternates between resource types and names
+	for i := start + 1; i < len(segments); i += 2 {
+		if segments[i-1] == "namespaces" {
+			segments[i] = "{namespace}"
+		} else {
+			segments[i] = "{name}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// PrometheusRoute templates the label names in the paths of the Prometheus-style HTTP APIs
+// of Mimir and Loki: /api/v1/label/job/values becomes /api/v1/label/{name}/values.
+func PrometheusRoute(path string) string {
+	segments := strings.Split(path, "/")
+	for i := 1; i < len(segments); i++ {
+		if segments[i-1] == "label" {
+			segments[i] = "{name}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,42 @@
+package telemetry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestTransport_SpanNameUsesRoute(t *testing.T) {
+	exporter, restore := NewInMemoryProvider()
+	defer restore()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: Transport("kubernetes", nil, KubernetesRoute)}
+	resp, err := client.Get(srv.URL + "/api/v1/namespaces/p1/secrets/s")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "kubernetes GET /api/v1/namespaces/{namespace}/secrets/{name}", spans[0].Name)
+	assert.Contains(t, spans[0].Attributes, attribute.String("url.path", "/api/v1/namespaces/p1/secrets/s"))
+}
+
+func TestKubernetesRoute(t *testing.T) {
+	assert.Equal(t, "/api/v1/namespaces/{namespace}/secrets", KubernetesRoute("/api/v1/namespaces/p1/secrets"))
+	assert.Equal(t, "/apis/apps/v1/namespaces/{namespace}/deployments/{name}/scale",
+		KubernetesRoute("/apis/apps/v1/namespaces/p1/deployments/graph/scale"))
+	assert.Equal(t, "/api/v1/nodes/{name}", KubernetesRoute("/api/v1/nodes/node-1"))
+	assert.Equal(t, "/version", KubernetesRoute("/version"))
+}
+
+func TestPrometheusRoute(t *testing.T) {
+	assert.Equal(t, "/prometheus/api/v1/label/{name}/values", PrometheusRoute("/prometheus/api/v1/label/job/values"))
+	assert.Equal(t, "/loki/api/v1/query_range", PrometheusRoute("/loki/api/v1/query_range"))
+}
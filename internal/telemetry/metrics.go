@@ -0,0 +1,83 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"ktrlplane/internal/config"
+	"log"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+)
+
+// Meter returns the meter used for KtrlPlane's own instruments.
+func Meter() metric.Meter {
+	return otel.Meter(instrumentationName)
+}
+
+// SetupMetrics installs a global meter provider exporting over OTLP/HTTP.
+// When metrics are disabled the global no-op provider is left in place.
+// The returned function flushes and stops the exporter; it is always non-nil.
+func SetupMetrics(ctx context.Context, cfg config.MetricsConfig, serviceName string) (func(context.Context) error, error) {
+	noop := func(context.Context) error { return nil }
+	if !cfg.Enabled {
+		return noop, nil
+	}
+
+	opts := []otlpmetrichttp.Option{}
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlpmetrichttp.WithEndpoint(cfg.Endpoint))
+	}
+	if cfg.Insecure {
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	}
+	exporter, err := otlpmetrichttp.New(ctx, opts...)
+	if err != nil {
+		return noop, fmt.Errorf("failed to create OTLP metric exporter: %w", err)
+	}
+
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+	)
+	if err != nil {
+		return noop, fmt.Errorf("failed to build metric resource: %w", err)
+	}
+
+	interval := time.Duration(cfg.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(interval))),
+		sdkmetric.WithResource(res),
+	)
+	otel.SetMeterProvider(provider)
+
+	log.Printf("OpenTelemetry metrics enabled (endpoint: %s, interval: %s)", cfg.Endpoint, interval)
+	return provider.Shutdown, nil
+}
+
+// NewManualMetricReader installs a meter provider backed by a manual reader
+// so tests can collect metrics on demand.
+// The returned function restores the previously installed global provider.
+func NewManualMetricReader() (*sdkmetric.ManualReader, func()) {
+	previous := otel.GetMeterProvider()
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	otel.SetMeterProvider(provider)
+	return reader, func() {
+		_ = provider.Shutdown(context.Background())
+		otel.SetMeterProvider(previous)
+	}
+}
@@ -0,0 +1,138 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/stripe/stripe-go/v84"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// stripeBackend wraps a Stripe backend and records a client span per API call.
+type stripeBackend struct {
+	next stripe.Backend
+}
+
+// InstrumentStripe replaces the global Stripe API backend with a traced wrapper.
+// Spans are parented to the Context set on the call's params, if any.
+func InstrumentStripe() {
+	backend := stripe.GetBackend(stripe.APIBackend)
+	if _, ok := backend.(*stripeBackend); ok {
+		return
+	}
+	stripe.SetBackend(stripe.APIBackend, WrapStripeBackend(backend))
+}
+
+// WrapStripeBackend returns a Stripe backend that traces every call made through next.
+func WrapStripeBackend(next stripe.Backend) stripe.Backend {
+	return &stripeBackend{next: next}
+}
+
+func (b *stripeBackend) Call(method, path, key string, params stripe.ParamsContainer, v stripe.LastResponseSetter) error {
+	ctx, span := b.start(paramsContext(params), method, path)
+	defer span.End()
+	err := b.next.Call(method, path, key, withContext(params, ctx), v)
+	recordStripeResult(span, err)
+	return err
+}
+
+func (b *stripeBackend) CallStreaming(method, path, key string, params stripe.ParamsContainer, v stripe.StreamingLastResponseSetter) error {
+	ctx, span := b.start(paramsContext(params), method, path)
+	defer span.End()
+	err := b.next.CallStreaming(method, path, key, withContext(params, ctx), v)
+	recordStripeResult(span, err)
+	return err
+}
+
+func (b *stripeBackend) CallRaw(method, path, key string, body []byte, params *stripe.Params, v stripe.LastResponseSetter) error {
+	var parent context.Context
+	if params != nil {
+		parent = params.Context
+	}
+	ctx, span := b.start(parent, method, path)
+	defer span.End()
+	if params != nil {
+		params.Context = ctx
+	}
+	err := b.next.CallRaw(method, path, key, body, params, v)
+	recordStripeResult(span, err)
+	return err
+}
+
+func (b *stripeBackend) CallMultipart(method, path, key, boundary string, body *bytes.Buffer, params *stripe.Params, v stripe.LastResponseSetter) error {
+	var parent context.Context
+	if params != nil {
+		parent = params.Context
+	}
+	ctx, span := b.start(parent, method, path)
+	defer span.End()
+	if params != nil {
+		params.Context = ctx
+	}
+	err := b.next.CallMultipart(method, path, key, boundary, body, params, v)
+	recordStripeResult(span, err)
+	return err
+}
+
+func (b *stripeBackend) SetMaxNetworkRetries(maxNetworkRetries int64) {
+	b.next.SetMaxNetworkRetries(maxNetworkRetries)
+}
+
+func (b *stripeBackend) start(parent context.Context, method, path string) (context.Context, trace.Span) {
+	if parent == nil {
+		parent = context.Background()
+	}
+	return Tracer().Start(parent, "stripe "+method+" "+stripeRoute(path),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "stripe"),
+			attribute.String("http.request.method", method),
+			attribute.String("url.path", path),
+		),
+	)
+}
+
+// stripeRoute templates the object IDs of a Stripe API path, keeping span names
+// low-cardinality: /v1/customers/cus_123/payment_methods becomes
+// /v1/customers/{id}/payment_methods. Resource names are lowercase letters and underscores,
+// while IDs carry digits or uppercase letters.
+func stripeRoute(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		// Skip the leading "" and the API version
+		if i > 1 && strings.ContainsFunc(segment, func(r rune) bool { return r != '_' && (r < 'a' || r > 'z') }) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func recordStripeResult(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// paramsContext returns the request context carried by Stripe params, tolerating
+// typed nil pointers which the Stripe client passes when no params are given.
+func paramsContext(params stripe.ParamsContainer) context.Context {
+	if params == nil || reflect.ValueOf(params).IsNil() {
+		return nil
+	}
+	return params.GetParams().Context
+}
+
+// withContext stores ctx on params so the underlying HTTP request carries the span.
+func withContext(params stripe.ParamsContainer, ctx context.Context) stripe.ParamsContainer {
+	if params == nil || reflect.ValueOf(params).IsNil() {
+		return params
+	}
+	params.GetParams().Context = ctx
+	return params
+}
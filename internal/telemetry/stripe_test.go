@@ -0,0 +1,111 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stripe/stripe-go/v84"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeBackend records the params context it receives.
+type fakeBackend struct {
+	err     error
+	lastCtx context.Context
+}
+
+func (f *fakeBackend) Call(method, path, key string, params stripe.ParamsContainer, v stripe.LastResponseSetter) error {
+	f.lastCtx = paramsContext(params)
+	return f.err
+}
+
+func (f *fakeBackend) CallStreaming(method, path, key string, params stripe.ParamsContainer, v stripe.StreamingLastResponseSetter) error {
+	return f.err
+}
+
+func (f *fakeBackend) CallRaw(method, path, key string, body []byte, params *stripe.Params, v stripe.LastResponseSetter) error {
+	return f.err
+}
+
+func (f *fakeBackend) CallMultipart(method, path, key, boundary string, body *bytes.Buffer, params *stripe.Params, v stripe.LastResponseSetter) error {
+	return f.err
+}
+
+func (f *fakeBackend) SetMaxNetworkRetries(maxNetworkRetries int64) {}
+
+func TestStripeBackend_RecordsSpanWithParent(t *testing.T) {
+	exporter, restore := NewInMemoryProvider()
+	defer restore()
+
+	fake := &fakeBackend{}
+	backend := WrapStripeBackend(fake)
+
+	parentCtx, parent := Tracer().Start(context.Background(), "parent")
+	params := &stripe.CustomerParams{}
+	params.Context = parentCtx
+	err := backend.Call("POST", "/v1/customers", "sk_test", params, &stripe.Customer{})
+	parent.End()
+	assert.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, "stripe POST /v1/customers", spans[0].Name)
+		assert.Equal(t, trace.SpanKindClient, spans[0].SpanKind)
+		assert.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+	}
+	// The downstream call must carry the Stripe span, not the parent.
+	assert.Equal(t, spans[0].SpanContext.SpanID(), trace.SpanContextFromContext(fake.lastCtx).SpanID())
+}
+
+func TestStripeBackend_RecordsErrorAndToleratesNilParams(t *testing.T) {
+	exporter, restore := NewInMemoryProvider()
+	defer restore()
+
+	backend := WrapStripeBackend(&fakeBackend{err: errors.New("card_declined")})
+
+	var params *stripe.CustomerParams
+	err := backend.Call("GET", "/v1/customers/cus_1", "sk_test", params, &stripe.Customer{})
+	assert.Error(t, err)
+
+	spans := exporter.GetSpans()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+		assert.False(t, spans[0].Parent.IsValid())
+	}
+}
+
+func TestInstrumentStripe_Idempotent(t *testing.T) {
+	original := stripe.GetBackend(stripe.APIBackend)
+	defer stripe.SetBackend(stripe.APIBackend, original)
+
+	InstrumentStripe()
+	first := stripe.GetBackend(stripe.APIBackend)
+	InstrumentStripe()
+	assert.Same(t, first, stripe.GetBackend(stripe.APIBackend))
+}
+
+func TestStripeBackend_SpanNameTemplatesIDs(t *testing.T) {
+	exporter, restore := NewInMemoryProvider()
+	defer restore()
+
+	backend := WrapStripeBackend(&fakeBackend{})
+	err := backend.Call("GET", "/v1/customers/cus_NffrFeUfNV2Hib/payment_methods", "sk_test", &stripe.CustomerParams{}, &stripe.Customer{})
+	assert.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, "stripe GET /v1/customers/{id}/payment_methods", spans[0].Name)
+		assert.Contains(t, spans[0].Attributes, attribute.String("url.path", "/v1/customers/cus_NffrFeUfNV2Hib/payment_methods"))
+	}
+}
+
+func TestStripeRoute(t *testing.T) {
+	assert.Equal(t, "/v1/subscriptions/{id}", stripeRoute("/v1/subscriptions/sub_123"))
+	assert.Equal(t, "/v1/billing/meter_events", stripeRoute("/v1/billing/meter_events"))
+	assert.Equal(t, "/v1/invoices/{id}/lines", stripeRoute("/v1/invoices/in_1Abc/lines"))
+}
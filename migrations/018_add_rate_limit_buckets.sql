@@ -0,0 +1,14 @@
+-- 018_add_rate_limit_buckets.sql
+-- Migration: Add token bucket storage for the Postgres-backed API rate limiter
+-- Only used when rate_limit.store is "postgres"; buckets are refilled lazily on each request
+
+SET search_path TO ktrlplane, public;
+
+CREATE TABLE IF NOT EXISTS ktrlplane.rate_limit_buckets (
+    bucket_key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    allowed BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_updated_at ON ktrlplane.rate_limit_buckets(updated_at);
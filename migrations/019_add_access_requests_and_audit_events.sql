@@ -0,0 +1,48 @@
+-- 019_add_access_requests_and_audit_events.sql
+-- Migration: Add just-in-time access requests and an audit event log
+-- Approved access requests create role assignments with expires_at; a background sweeper
+-- removes expired assignments and records an audit event for each one
+
+SET search_path TO ktrlplane, public;
+
+-- Speeds up the expired-assignment sweep
+CREATE INDEX IF NOT EXISTS idx_role_assignments_expires_at
+    ON ktrlplane.role_assignments(expires_at)
+    WHERE expires_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS ktrlplane.access_requests (
+    request_id VARCHAR(255) PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL REFERENCES ktrlplane.users(user_id) ON DELETE CASCADE,
+    role_id VARCHAR(255) NOT NULL REFERENCES ktrlplane.roles(role_id) ON DELETE CASCADE,
+    scope_type VARCHAR(50) NOT NULL, -- 'organization', 'project', 'resource'
+    scope_id VARCHAR(255) NOT NULL,
+    justification TEXT NOT NULL,
+    duration_hours INTEGER NOT NULL CHECK (duration_hours > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- 'pending', 'approved', 'denied'
+    decided_by VARCHAR(255) REFERENCES ktrlplane.users(user_id) ON DELETE SET NULL,
+    decided_at TIMESTAMP NULL,
+    expires_at TIMESTAMP NULL, -- Expiry of the granted assignment, once approved
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- At most one pending request per user, role and scope
+CREATE UNIQUE INDEX IF NOT EXISTS idx_access_requests_pending
+    ON ktrlplane.access_requests(user_id, role_id, scope_type, scope_id)
+    WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_access_requests_scope
+    ON ktrlplane.access_requests(scope_type, scope_id, status);
+
+CREATE TABLE IF NOT EXISTS ktrlplane.audit_events (
+    event_id BIGSERIAL PRIMARY KEY,
+    event_type VARCHAR(100) NOT NULL, -- e.g. 'role_assignment.expired', 'access_request.approved'
+    actor_id VARCHAR(255) NOT NULL,   -- User who caused the event, or 'system'
+    subject_id VARCHAR(255),          -- User the event is about
+    scope_type VARCHAR(50),
+    scope_id VARCHAR(255),
+    details JSONB NOT NULL DEFAULT '{}'::jsonb,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_scope ON ktrlplane.audit_events(scope_type, scope_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_subject ON ktrlplane.audit_events(subject_id, created_at);
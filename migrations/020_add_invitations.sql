@@ -0,0 +1,32 @@
+-- 020_add_invitations.sql
+-- Migration: Add email invitations with signed single-use tokens
+-- Only a SHA-256 hash of the current token is stored; resending rotates the token
+
+SET search_path TO ktrlplane, public;
+
+CREATE TABLE IF NOT EXISTS ktrlplane.invitations (
+    invitation_id VARCHAR(255) PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    role_id VARCHAR(255) NOT NULL REFERENCES ktrlplane.roles(role_id) ON DELETE CASCADE,
+    scope_type VARCHAR(50) NOT NULL, -- 'organization', 'project', 'resource'
+    scope_id VARCHAR(255) NOT NULL,
+    invited_by VARCHAR(255) NOT NULL REFERENCES ktrlplane.users(user_id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- 'pending', 'accepted', 'revoked'
+    expires_at TIMESTAMP NOT NULL,
+    sent_count INTEGER NOT NULL DEFAULT 1,
+    last_sent_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    accepted_by VARCHAR(255) REFERENCES ktrlplane.users(user_id) ON DELETE SET NULL,
+    accepted_at TIMESTAMP NULL,
+    revoked_by VARCHAR(255) REFERENCES ktrlplane.users(user_id) ON DELETE SET NULL,
+    revoked_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- At most one pending invitation per email, role and scope
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invitations_pending
+    ON ktrlplane.invitations(LOWER(email), role_id, scope_type, scope_id)
+    WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_invitations_scope
+    ON ktrlplane.invitations(scope_type, scope_id, status);
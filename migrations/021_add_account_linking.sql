@@ -0,0 +1,55 @@
+-- 021_add_account_linking.sql
+-- Migration: Add explicit account linking and user merges
+-- A linked identity (a token subject from another IdP connection) resolves to an existing user.
+-- Merging two users moves every role assignment to the surviving user and links the old subject.
+
+SET search_path TO ktrlplane, public;
+
+CREATE TABLE IF NOT EXISTS ktrlplane.user_identity_links (
+    subject VARCHAR(255) PRIMARY KEY, -- Token subject of the linked identity
+    user_id VARCHAR(255) NOT NULL REFERENCES ktrlplane.users(user_id) ON DELETE CASCADE,
+    linked_by VARCHAR(255) NOT NULL, -- User who created the link (the user themselves or an admin)
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identity_links_user_id ON ktrlplane.user_identity_links(user_id);
+
+-- Short-lived, single-use tokens proving control of the account being linked.
+-- Only a SHA-256 hash of the token is stored.
+CREATE TABLE IF NOT EXISTS ktrlplane.account_link_tokens (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL REFERENCES ktrlplane.users(user_id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_link_tokens_user_id ON ktrlplane.account_link_tokens(user_id);
+
+-- Platform administrators can merge user records
+INSERT INTO ktrlplane.permissions (permission_id, resource_type, action, description, created_at)
+VALUES (
+  '00000000-0001-0000-0000-000000000007',
+  'Konnektr.KtrlPlane',
+  'manage_users',
+  'Merge and link user accounts (global scope only)',
+  NOW()
+)
+ON CONFLICT (resource_type, action) DO NOTHING;
+
+INSERT INTO ktrlplane.roles (role_id, name, display_name, description, is_system, is_hidden, display_order, created_at, updated_at)
+VALUES (
+  'platform-user-admin',
+  'Platform: User Administrator',
+  'Platform: User Administrator',
+  'Allows merging and linking user accounts. Assign at global scope.',
+  true,
+  true,  -- Hidden from user-facing role listings
+  1001,
+  NOW(),
+  NOW()
+)
+ON CONFLICT (role_id) DO NOTHING;
+
+INSERT INTO ktrlplane.role_permissions (role_id, permission_id)
+VALUES ('platform-user-admin', '00000000-0001-0000-0000-000000000007')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,37 @@
+-- 022_add_service_accounts.sql
+-- Migration: Add service accounts owned by an organization or project
+-- Each service account has a row in users (its service_account_id is the user_id) so that
+-- roles can be assigned to it like to any user. It authenticates either with service account tokens
+-- of an external OIDC client mapped through external_client_id, or with KtrlPlane-issued client secrets.
+
+SET search_path TO ktrlplane, public;
+
+CREATE TABLE IF NOT EXISTS ktrlplane.service_accounts (
+    service_account_id VARCHAR(255) PRIMARY KEY REFERENCES ktrlplane.users(user_id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    scope_type VARCHAR(50) NOT NULL CHECK (scope_type IN ('organization', 'project')),
+    scope_id VARCHAR(255) NOT NULL,
+    external_client_id VARCHAR(255) UNIQUE, -- Client ID (azp/client_id/appid) of an external OIDC client acting as this account
+    disabled BOOLEAN NOT NULL DEFAULT false,
+    created_by VARCHAR(255) NOT NULL,
+    last_used_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_service_accounts_scope ON ktrlplane.service_accounts(scope_type, scope_id);
+
+-- Client secrets exchanged for KtrlPlane-signed access tokens. Only a SHA-256 hash is stored.
+CREATE TABLE IF NOT EXISTS ktrlplane.service_account_secrets (
+    secret_id VARCHAR(255) PRIMARY KEY,
+    service_account_id VARCHAR(255) NOT NULL REFERENCES ktrlplane.service_accounts(service_account_id) ON DELETE CASCADE,
+    secret_hash VARCHAR(64) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP NULL, -- NULL means the secret does not expire
+    last_used_at TIMESTAMP NULL,
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_service_account_secrets_account ON ktrlplane.service_account_secrets(service_account_id);
@@ -0,0 +1,22 @@
+-- 023_add_personal_access_tokens.sql
+-- Migration: Add personal access tokens for CLI and CI usage
+-- A token acts as its owner, optionally restricted to one scope (and its descendants) and to a
+-- subset of actions. Only a SHA-256 hash of the token is stored.
+
+SET search_path TO ktrlplane, public;
+
+CREATE TABLE IF NOT EXISTS ktrlplane.personal_access_tokens (
+    token_id VARCHAR(255) PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL REFERENCES ktrlplane.users(user_id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    scope_type VARCHAR(50) NULL CHECK (scope_type IN ('organization', 'project', 'resource')), -- NULL means every scope of the owner
+    scope_id VARCHAR(255) NULL,
+    actions TEXT[] NULL, -- NULL means every action of the owner
+    expires_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK ((scope_type IS NULL) = (scope_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user ON ktrlplane.personal_access_tokens(user_id);
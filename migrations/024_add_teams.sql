@@ -0,0 +1,33 @@
+-- 024_add_teams.sql
+-- Migration: Add teams within organizations
+-- Each team has a row in users (its team_id is the user_id) so that roles can be assigned to it
+-- through the existing role assignment endpoints. Permission checks resolve a user's roles together
+-- with the roles of the teams they belong to.
+
+SET search_path TO ktrlplane, public;
+
+CREATE TABLE IF NOT EXISTS ktrlplane.teams (
+    team_id VARCHAR(255) PRIMARY KEY REFERENCES ktrlplane.users(user_id) ON DELETE CASCADE,
+    org_id VARCHAR(255) NOT NULL REFERENCES ktrlplane.organizations(org_id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    idp_group VARCHAR(255) NULL, -- Members are synced from this IdP groups claim value at login
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (org_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_teams_idp_group ON ktrlplane.teams(idp_group) WHERE idp_group IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS ktrlplane.team_members (
+    team_id VARCHAR(255) NOT NULL REFERENCES ktrlplane.teams(team_id) ON DELETE CASCADE,
+    user_id VARCHAR(255) NOT NULL REFERENCES ktrlplane.users(user_id) ON DELETE CASCADE,
+    source VARCHAR(20) NOT NULL DEFAULT 'manual' CHECK (source IN ('manual', 'idp')),
+    added_by VARCHAR(255) NULL, -- NULL for members synced from the IdP
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (team_id, user_id)
+);
+
+-- Permission checks look up the teams of a user
+CREATE INDEX IF NOT EXISTS idx_team_members_user ON ktrlplane.team_members(user_id);
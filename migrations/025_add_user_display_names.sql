@@ -0,0 +1,8 @@
+-- 025_add_user_display_names.sql
+-- Migration: Keep display names chosen by the user across sign-ins
+
+SET search_path TO ktrlplane, public;
+
+-- Names set through PUT /me are no longer overwritten by the name claim of the token
+ALTER TABLE ktrlplane.users
+ADD COLUMN IF NOT EXISTS name_is_custom BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,19 @@
+-- 026_project_billing_inheritance.sql
+-- Migration: Resolve project billing through the organization when inheritance is on
+-- Projects that already pay through a Stripe customer of their own keep doing so; all
+-- other projects in an organization are billed to the organization's subscription.
+
+SET search_path TO ktrlplane, public;
+
+UPDATE ktrlplane.projects p
+SET inherits_billing_from_org = false
+WHERE EXISTS (
+    SELECT 1 FROM ktrlplane.billing_accounts ba
+    WHERE ba.scope_type = 'project'
+      AND ba.scope_id = p.project_id
+      AND ba.stripe_customer_id IS NOT NULL
+);
+
+UPDATE ktrlplane.projects SET inherits_billing_from_org = true WHERE inherits_billing_from_org IS NULL;
+
+ALTER TABLE ktrlplane.projects ALTER COLUMN inherits_billing_from_org SET NOT NULL;
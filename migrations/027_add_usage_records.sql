@@ -0,0 +1,26 @@
+-- 027_add_usage_records.sql
+-- Migration: Add hourly usage records for usage-based billing
+-- One row per resource, meter and hour, evaluated from Mimir and reported to a Stripe
+-- billing meter. Rows outlive their resource so usage is still reported after deletion.
+
+SET search_path TO ktrlplane, public;
+
+CREATE TABLE IF NOT EXISTS ktrlplane.usage_records (
+    resource_id VARCHAR(255) NOT NULL,
+    meter VARCHAR(255) NOT NULL,
+    hour_start TIMESTAMP NOT NULL, -- UTC
+    project_id VARCHAR(255) NOT NULL,
+    quantity DOUBLE PRECISION NOT NULL,
+    event_name VARCHAR(255) NOT NULL,
+    stripe_customer_id VARCHAR(255) NULL, -- NULL when the paying account had no Stripe customer; never reported
+    reported_at TIMESTAMP NULL,
+    report_attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (resource_id, meter, hour_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_usage_records_project_hour ON ktrlplane.usage_records(project_id, hour_start);
+CREATE INDEX IF NOT EXISTS idx_usage_records_meter_hour ON ktrlplane.usage_records(meter, hour_start);
+CREATE INDEX IF NOT EXISTS idx_usage_records_unreported ON ktrlplane.usage_records(hour_start)
+    WHERE reported_at IS NULL AND stripe_customer_id IS NOT NULL;
@@ -0,0 +1,15 @@
+-- 028_add_payment_enforcement.sql
+-- Migration: Track payment enforcement per billing account
+-- While a subscription is past due, unpaid or canceled, payment_issue_since records when the
+-- problem was first seen. Once it outlasts the grace period, the paid resources billed to the
+-- account get status 'Suspended' (the operator scales them down) and resources_suspended_at is
+-- set. Both are cleared and the resources return to 'Updating' when payment recovers.
+
+SET search_path TO ktrlplane, public;
+
+ALTER TABLE ktrlplane.billing_accounts
+    ADD COLUMN IF NOT EXISTS subscription_status VARCHAR(50) NULL, -- As last checked by payment enforcement
+    ADD COLUMN IF NOT EXISTS payment_issue_since TIMESTAMP NULL,
+    ADD COLUMN IF NOT EXISTS resources_suspended_at TIMESTAMP NULL;
+
+CREATE INDEX IF NOT EXISTS idx_resources_suspended ON ktrlplane.resources(project_id) WHERE status = 'Suspended';
@@ -0,0 +1,12 @@
+-- 029_add_billing_trials.sql
+-- Migration: Track free trials per billing account
+-- A new subscription starts with a trial when one of its products has trial days configured,
+-- once per billing account: trial_used_at records when the trial was given. trial_days is a
+-- length granted to the account (for example by sales) that overrides the product defaults;
+-- 0 gives no trial.
+
+SET search_path TO ktrlplane, public;
+
+ALTER TABLE ktrlplane.billing_accounts
+    ADD COLUMN IF NOT EXISTS trial_days INTEGER NULL CHECK (trial_days >= 0),
+    ADD COLUMN IF NOT EXISTS trial_used_at TIMESTAMP NULL;
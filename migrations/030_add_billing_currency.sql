@@ -0,0 +1,9 @@
+-- 030_add_billing_currency.sql
+-- Migration: Record the currency a billing account is billed in
+-- The currency is chosen when the Stripe customer is created and selects the prices used for
+-- its subscription items. Accounts without one use the configured default currency.
+
+SET search_path TO ktrlplane, public;
+
+ALTER TABLE ktrlplane.billing_accounts
+    ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NULL; -- ISO 4217, lowercase as Stripe reports it
@@ -0,0 +1,10 @@
+-- 031_add_billing_interval.sql
+-- Migration: Record whether a billing account is billed monthly or annually
+-- The interval selects the prices of its subscription items. Accounts without a preference use
+-- the product's monthly price, or else its first active price.
+
+SET search_path TO ktrlplane, public;
+
+ALTER TABLE ktrlplane.billing_accounts
+    ADD COLUMN IF NOT EXISTS billing_interval VARCHAR(10) NULL
+        CHECK (billing_interval IN ('month', 'year'));
@@ -0,0 +1,16 @@
+-- 032_scope_service_account_clients_by_issuer.sql
+-- Migration: Map external OIDC clients to service accounts by issuer and client ID
+-- Client IDs are only unique within an issuer, so a mapping on the client ID alone could match
+-- tokens of another issuer's client. Existing mappings have no issuer and match no token until a
+-- platform administrator sets external_issuer.
+
+SET search_path TO ktrlplane, public;
+
+ALTER TABLE ktrlplane.service_accounts
+    ADD COLUMN IF NOT EXISTS external_issuer VARCHAR(255) NULL; -- Issuer (iss) of the tokens of external_client_id
+
+ALTER TABLE ktrlplane.service_accounts
+    DROP CONSTRAINT IF EXISTS service_accounts_external_client_id_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_service_accounts_external_client
+    ON ktrlplane.service_accounts(external_issuer, external_client_id);
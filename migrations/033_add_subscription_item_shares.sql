@@ -0,0 +1,15 @@
+-- 033_add_subscription_item_shares.sql
+-- Migration: Snapshot how subscription items are shared between projects
+-- The project shares of a subscription item live in its Stripe metadata, which only holds the
+-- current shares. A snapshot is recorded whenever the shares change, so invoice lines for
+-- earlier periods are attributed to the projects billed at the time.
+
+SET search_path TO ktrlplane, public;
+
+CREATE TABLE IF NOT EXISTS ktrlplane.subscription_item_shares (
+    subscription_item_id VARCHAR(255) NOT NULL,
+    effective_at TIMESTAMP NOT NULL, -- UTC; the shares apply from here until the next snapshot
+    shares JSONB NOT NULL, -- Project metadata key -> quantity
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (subscription_item_id, effective_at)
+);
@@ -0,0 +1,14 @@
+-- 034_add_usage_remainders.sql
+-- Migration: Carry the fractional usage left over by Stripe meter events
+-- Stripe meter values are whole numbers. The fraction of each resource's usage that was not
+-- reported yet is kept per meter and added to the next hour, so sub-unit usage is not lost.
+
+SET search_path TO ktrlplane, public;
+
+CREATE TABLE IF NOT EXISTS ktrlplane.usage_remainders (
+    resource_id VARCHAR(255) NOT NULL,
+    meter VARCHAR(255) NOT NULL,
+    remainder DOUBLE PRECISION NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (resource_id, meter)
+);
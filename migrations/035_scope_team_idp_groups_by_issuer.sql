@@ -0,0 +1,15 @@
+-- 035_scope_team_idp_groups_by_issuer.sql
+-- Migration: Map teams to IdP groups by issuer and group
+-- Group names are only meaningful within an issuer, so a mapping on the group alone could match
+-- the groups claim of another issuer or another tenant. Existing mappings have no issuer and
+-- match no token until a platform administrator sets idp_issuer.
+
+SET search_path TO ktrlplane, public;
+
+ALTER TABLE ktrlplane.teams
+    ADD COLUMN IF NOT EXISTS idp_issuer VARCHAR(255) NULL; -- Issuer (iss) of the groups claim carrying idp_group
+
+DROP INDEX IF EXISTS ktrlplane.idx_teams_idp_group;
+
+CREATE INDEX IF NOT EXISTS idx_teams_idp_issuer_group
+    ON ktrlplane.teams(idp_issuer, idp_group) WHERE idp_group IS NOT NULL;
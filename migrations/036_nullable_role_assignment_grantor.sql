@@ -0,0 +1,17 @@
+-- 036_nullable_role_assignment_grantor.sql
+-- Migration: Keep role assignments when the user who granted them is deleted
+-- assigned_by referenced the granting user without ON DELETE, so deleting a user first had to
+-- rewrite the assignments they granted. It now becomes NULL instead, so that the remaining
+-- assignments never name someone who did not grant them.
+
+SET search_path TO ktrlplane, public;
+
+ALTER TABLE ktrlplane.role_assignments
+    ALTER COLUMN assigned_by DROP NOT NULL;
+
+ALTER TABLE ktrlplane.role_assignments
+    DROP CONSTRAINT IF EXISTS role_assignments_assigned_by_fkey;
+
+ALTER TABLE ktrlplane.role_assignments
+    ADD CONSTRAINT role_assignments_assigned_by_fkey
+    FOREIGN KEY (assigned_by) REFERENCES ktrlplane.users(user_id) ON DELETE SET NULL;
@@ -29,7 +29,7 @@ export interface RoleAssignment {
   role_id: string;
   scope_type: 'organization' | 'project' | 'resource';
   scope_id: string;
-  assigned_by: string;
+  assigned_by: string | null; // null once the granting user is deleted
   created_at: string;
   expires_at?: string;
   // Populated fields